@@ -0,0 +1,302 @@
+package gomarc21
+
+import (
+	"strings"
+)
+
+/*
+source: https://www.loc.gov/marc/authority/
+
+    1XX   Headings (the authorized form)
+    4XX   See From Tracings (variant forms)
+    5XX   See Also From Tracings (related headings), $w control subfield
+    7XX   Heading Linking Entries (the heading in another thesaurus),
+          second indicator for the thesaurus
+    008   Fixed-Length Data Elements
+
+Headings are rendered with their subject subdivisions ($v, $x, $y, $z)
+separated by "--", e.g. "Acadians--Expulsion, 1755".
+*/
+
+// headingTypes maps the last two characters of the tag of an authority
+// heading to its type.
+var headingTypes = map[string]string{
+	"00": "personal name",
+	"10": "corporate name",
+	"11": "meeting name",
+	"30": "uniform title",
+	"47": "named event",
+	"48": "chronological term",
+	"50": "topical term",
+	"51": "geographic name",
+	"55": "genre/form term",
+	"62": "medium of performance term",
+	"80": "general subdivision",
+	"81": "geographic subdivision",
+	"82": "chronological subdivision",
+	"85": "form subdivision",
+}
+
+// seeAlsoRelationships decodes $w/0 of see also from tracings.
+var seeAlsoRelationships = map[byte]string{
+	'a': "earlier heading",
+	'b': "later heading",
+	'd': "acronym",
+	'f': "musical composition",
+	'g': "broader term",
+	'h': "narrower term",
+	'i': "reference instruction phrase in subfield $i",
+	'n': "not applicable",
+	'r': "relationship designation in $i or $4",
+	't': "immediate parent body",
+}
+
+// earlierForms decodes $w/2 of tracings.
+var earlierForms = map[byte]string{
+	'a': "pre-AACR 2 form of heading",
+	'e': "earlier established form of heading",
+	'o': "original form of heading",
+	'n': "not applicable",
+}
+
+// referenceDisplays decodes $w/3 of tracings.
+var referenceDisplays = map[byte]string{
+	'a': "reference not displayed",
+	'b': "reference not displayed in public catalog",
+	'n': "not applicable",
+}
+
+// linkingThesauri decodes the second indicator of 7XX linking entries.
+var linkingThesauri = map[string]string{
+	"0": "Library of Congress Subject Headings",
+	"1": "LC subject headings for children's literature",
+	"2": "Medical Subject Headings",
+	"3": "National Agricultural Library subject authority file",
+	"4": "Source not specified",
+	"5": "Canadian Subject Headings",
+	"6": "Répertoire de vedettes-matière",
+}
+
+// AuthorityHeading is a heading of an authority record: the 1XX, a
+// tracing or a linking entry.
+type AuthorityHeading struct {
+	Field DataField
+}
+
+// Type returns the type of heading implied by the tag, e.g. "topical term".
+func (h AuthorityHeading) Type() string {
+	tag := h.Field.Tag.GetTag()
+	if len(tag) != 3 {
+		return ""
+	}
+	return headingTypes[tag[1:]]
+}
+
+// String returns the heading with its subdivisions separated by "--".
+func (h AuthorityHeading) String() string {
+	return subjectString(h.Field)
+}
+
+// Identifiers returns the record control numbers ($0) of the heading.
+func (h AuthorityHeading) Identifiers() []string {
+	var ids []string
+	for _, sf := range h.Field.GetSubFields("0") {
+		ids = append(ids, strings.TrimSpace(sf.Data))
+	}
+	return ids
+}
+
+// Tracing is a see from (4XX) or see also from (5XX) tracing with its
+// control subfield ($w) decoded.
+type Tracing struct {
+	AuthorityHeading
+	Relationship     string // $w/0, or $i when it holds the relationship
+	EarlierForm      string // $w/2
+	ReferenceDisplay string // $w/3
+}
+
+// LinkingEntry is a 7XX heading linking entry.
+type LinkingEntry struct {
+	AuthorityHeading
+	Thesaurus string // from the second indicator, or $2
+}
+
+// Authority008 holds the decoded authority fixed-length data elements.
+type Authority008 struct {
+	DateEntered           string // 00-05, yymmdd
+	GeographicSubdivision byte   // 06
+	RomanizationScheme    byte   // 07
+	LanguageOfCatalog     byte   // 08
+	KindOfRecord          byte   // 09
+	DescriptiveRules      byte   // 10
+	SubjectHeadingSystem  byte   // 11
+	TypeOfSeries          byte   // 12
+	NumberedSeries        byte   // 13
+	MainAddedEntryUse     byte   // 14
+	SubjectAddedEntryUse  byte   // 15
+	SeriesAddedEntryUse   byte   // 16
+	TypeOfSubdivision     byte   // 17
+	GovernmentAgency      byte   // 28
+	ReferenceEvaluation   byte   // 29
+	UpdateInProcess       byte   // 31
+	UndifferentiatedName  byte   // 32
+	LevelOfEstablishment  byte   // 33
+	ModifiedRecord        byte   // 38
+	CatalogingSource      byte   // 39
+}
+
+// kindsOfRecord decodes 008/09.
+var kindsOfRecord = map[byte]string{
+	'a': "established heading",
+	'b': "untraced reference",
+	'c': "traced reference",
+	'd': "subdivision",
+	'e': "node label",
+	'f': "established heading and subdivision",
+	'g': "reference and subdivision",
+}
+
+// subjectHeadingSystems decodes 008/11.
+var subjectHeadingSystems = map[byte]string{
+	'a': "Library of Congress Subject Headings",
+	'b': "LC subject headings for children's literature",
+	'c': "Medical Subject Headings",
+	'd': "National Agricultural Library subject authority file",
+	'k': "Canadian Subject Headings",
+	'n': "Not applicable",
+	'r': "Art and Architecture Thesaurus",
+	's': "Sears List of Subject Headings",
+	'v': "Répertoire de vedettes-matière",
+	'z': "Other",
+}
+
+// levelsOfEstablishment decodes 008/33.
+var levelsOfEstablishment = map[byte]string{
+	'a': "fully established",
+	'b': "memorandum",
+	'c': "provisional",
+	'd': "preliminary",
+	'n': "not applicable",
+}
+
+// KindOfRecordName returns the description of 008/09.
+func (f Authority008) KindOfRecordName() string {
+	return kindsOfRecord[f.KindOfRecord]
+}
+
+// SubjectHeadingSystemName returns the description of 008/11.
+func (f Authority008) SubjectHeadingSystemName() string {
+	return subjectHeadingSystems[f.SubjectHeadingSystem]
+}
+
+// LevelOfEstablishmentName returns the description of 008/33.
+func (f Authority008) LevelOfEstablishmentName() string {
+	return levelsOfEstablishment[f.LevelOfEstablishment]
+}
+
+// IsAuthority reports whether the record is an authority record
+// (leader/06 z).
+func (rec Record) IsAuthority() bool {
+	return rec.Leader.TypeOfRecord == 'z'
+}
+
+// Heading returns the 1XX heading of an authority record. ok is false when
+// the record has no 1XX.
+func (rec Record) Heading() (heading AuthorityHeading, ok bool) {
+	for _, df := range rec.DataFields {
+		if strings.HasPrefix(df.Tag.GetTag(), "1") {
+			return AuthorityHeading{Field: df}, true
+		}
+	}
+	return AuthorityHeading{}, false
+}
+
+// SeeFrom returns the see from tracings (4XX) of an authority record.
+func (rec Record) SeeFrom() []Tracing {
+	return rec.tracings("4")
+}
+
+// SeeAlso returns the see also from tracings (5XX) of an authority record.
+func (rec Record) SeeAlso() []Tracing {
+	return rec.tracings("5")
+}
+
+func (rec Record) tracings(prefix string) []Tracing {
+	var tracings []Tracing
+	for _, df := range rec.DataFields {
+		tag := df.Tag.GetTag()
+		if !strings.HasPrefix(tag, prefix) || headingTypes[tag[1:]] == "" {
+			continue
+		}
+		t := Tracing{AuthorityHeading: AuthorityHeading{Field: df}}
+		w := []byte(joinSubFields(df, "w", ""))
+		if len(w) > 0 && prefix == "5" {
+			t.Relationship = seeAlsoRelationships[w[0]]
+			if w[0] == 'i' || w[0] == 'r' {
+				if i := joinSubFields(df, "i", " "); i != "" {
+					t.Relationship = chopPunctuation(strings.TrimSuffix(i, ":"))
+				}
+			}
+		}
+		if len(w) > 2 {
+			t.EarlierForm = earlierForms[w[2]]
+		}
+		if len(w) > 3 {
+			t.ReferenceDisplay = referenceDisplays[w[3]]
+		}
+		tracings = append(tracings, t)
+	}
+	return tracings
+}
+
+// LinkingEntries returns the heading linking entries (7XX) of an
+// authority record with their thesaurus.
+func (rec Record) LinkingEntries() []LinkingEntry {
+	var entries []LinkingEntry
+	for _, df := range rec.DataFields {
+		tag := df.Tag.GetTag()
+		if !strings.HasPrefix(tag, "7") || headingTypes[tag[1:]] == "" {
+			continue
+		}
+		thesaurus := linkingThesauri[df.GetIndicator2()]
+		if df.GetIndicator2() == "7" {
+			thesaurus = joinSubFields(df, "2", " ")
+		}
+		entries = append(entries, LinkingEntry{AuthorityHeading: AuthorityHeading{Field: df}, Thesaurus: thesaurus})
+	}
+	return entries
+}
+
+// Authority008 decodes the 008 of an authority record. ok is false when
+// the record has no complete 008.
+func (rec Record) Authority008() (f Authority008, ok bool) {
+	var data string
+	for _, cf := range rec.GetControlfields("008") {
+		data = cf.Data
+	}
+	if len(data) < 40 {
+		return f, false
+	}
+	return Authority008{
+		DateEntered:           data[0:6],
+		GeographicSubdivision: data[6],
+		RomanizationScheme:    data[7],
+		LanguageOfCatalog:     data[8],
+		KindOfRecord:          data[9],
+		DescriptiveRules:      data[10],
+		SubjectHeadingSystem:  data[11],
+		TypeOfSeries:          data[12],
+		NumberedSeries:        data[13],
+		MainAddedEntryUse:     data[14],
+		SubjectAddedEntryUse:  data[15],
+		SeriesAddedEntryUse:   data[16],
+		TypeOfSubdivision:     data[17],
+		GovernmentAgency:      data[28],
+		ReferenceEvaluation:   data[29],
+		UpdateInProcess:       data[31],
+		UndifferentiatedName:  data[32],
+		LevelOfEstablishment:  data[33],
+		ModifiedRecord:        data[38],
+		CatalogingSource:      data[39],
+	}, true
+}
@@ -0,0 +1,397 @@
+package gomarc21
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+/*
+Authority control links the headings of bibliographic records to the
+authority records that establish them.
+
+An AuthorityIndex maps the NACO normalized form (see NacoNormalize) of
+every authorized heading (1XX) and every variant (4XX) of a set of
+authority records to the authorized heading. Headings are only compared
+with headings of the same kind, so the personal name of a 600 is looked
+up among the X00 of the authority records, the topical term of a 650
+among the X50, and so on.
+
+The index can be saved to a sidecar file next to the authority file (see
+AuthorityIndexFileName), one entry per line:
+
+    <kind> TAB <normalized heading> TAB <V|A> TAB <record id> TAB <authorized field in mnemonic form>
+
+preceded, as the sidecar index of a MARC file (see Index), by a line with
+an empty kind giving the size and the modification time of the authority
+file indexed, so that the index of a file changed since is rebuilt:
+
+    TAB <size> TAB <modification time>
+
+A heading matching the headings of several authority records is ambiguous
+and is left as it is.
+*/
+
+// Match status of a bibliographic heading.
+const (
+	MatchExact     = "exact"     // the heading is an authorized heading
+	MatchVariant   = "variant"   // the heading is a variant of an authorized heading
+	MatchUnmatched = "unmatched" // the heading is not in the authority file
+	MatchAmbiguous = "ambiguous" // the heading matches several authority records
+)
+
+// controlledTags are the bibliographic fields under authority control.
+var controlledTags = map[string]bool{
+	"100": true, "110": true, "111": true, "130": true, "240": true,
+	"600": true, "610": true, "611": true, "630": true, "648": true, "650": true, "651": true, "655": true,
+	"700": true, "710": true, "711": true, "730": true,
+}
+
+// AuthorityEntry is an authorized heading of the index.
+type AuthorityEntry struct {
+	Id      string    // control number of the authority record, e.g. (CaOONL)cash10001
+	Field   DataField // the authorized heading (1XX)
+	Variant bool      // true when the entry was reached through a 4XX
+}
+
+// AuthorityIndex maps normalized headings to authorized headings.
+type AuthorityIndex struct {
+	Entries map[string][]AuthorityEntry
+
+	// Size and ModTime are the size and the modification time of the
+	// authority file indexed, when known.
+	Size    int64
+	ModTime time.Time
+}
+
+// AuthorityMatch is the result of looking up a heading of a bibliographic
+// record.
+type AuthorityMatch struct {
+	Position int       // index of the field in Record.DataFields
+	Field    DataField // the bibliographic heading
+	Status   string
+	Entry    AuthorityEntry   // the authorized heading when exact or variant
+	Entries  []AuthorityEntry // the authorized headings when ambiguous
+}
+
+// AuthorityIndexFileName returns the name of the sidecar authority index
+// file for an authority file.
+func AuthorityIndexFileName(authorityFile string) string {
+	return authorityFile + ".auth"
+}
+
+// NewAuthorityIndex returns an empty authority index.
+func NewAuthorityIndex() *AuthorityIndex {
+	return &AuthorityIndex{Entries: map[string][]AuthorityEntry{}}
+}
+
+// headingKind returns the part of the tag giving the kind of heading,
+// e.g. "50" for 150, 450 and 650. Uniform titles of 240 are "30".
+func headingKind(tag string) string {
+	if tag == "240" {
+		return "30"
+	}
+	if len(tag) != 3 {
+		return ""
+	}
+	return tag[1:]
+}
+
+// isHeadingSubField reports whether a subfield is part of the heading
+// rather than a relator term, a control subfield or a link.
+func isHeadingSubField(tag string, code string) bool {
+	if code == "" || !unicode.IsLetter(rune(code[0])) {
+		return false
+	}
+	relators := "e"
+	if headingKind(tag) == "11" {
+		relators = "j"
+	}
+	return !strings.Contains(relators+"iw", code)
+}
+
+// headingKey returns the index key of a heading field: its kind and the
+// NACO normalized heading subfields.
+func headingKey(df DataField) string {
+	tag := df.Tag.GetTag()
+	heading := DataField{Tag: df.Tag}
+	for _, sf := range df.SubFields {
+		if isHeadingSubField(tag, sf.Code) {
+			heading.SubFields = append(heading.SubFields, sf)
+		}
+	}
+	normalized := heading.NacoNormalize("")
+	if normalized == "" {
+		return ""
+	}
+	return headingKind(tag) + "\t" + normalized
+}
+
+// authorityId returns the control number of an authority record prefixed
+// with the organization code of the 003, e.g. (CaOONL)cash10001.
+func authorityId(rec Record) string {
+	id := strings.TrimSpace(rec.ControlNum())
+	for _, cf := range rec.GetControlfields("003") {
+		if org := strings.TrimSpace(cf.Data); org != "" && id != "" {
+			return "(" + org + ")" + id
+		}
+	}
+	return id
+}
+
+// Add indexes the heading and the see from tracings of an authority
+// record. Other records are ignored.
+func (idx *AuthorityIndex) Add(rec Record) {
+	heading, ok := rec.Heading()
+	if !ok || !rec.IsAuthority() {
+		return
+	}
+	id := authorityId(rec)
+	idx.add(headingKey(heading.Field), AuthorityEntry{Id: id, Field: heading.Field})
+	for _, t := range rec.SeeFrom() {
+		idx.add(headingKey(t.Field), AuthorityEntry{Id: id, Field: heading.Field, Variant: true})
+	}
+}
+
+func (idx *AuthorityIndex) add(key string, entry AuthorityEntry) {
+	if key == "" {
+		return
+	}
+	for _, e := range idx.Entries[key] {
+		if e.Id == entry.Id && e.Variant == entry.Variant {
+			return
+		}
+	}
+	idx.Entries[key] = append(idx.Entries[key], entry)
+}
+
+// BuildAuthorityIndex indexes the authority records of a reader.
+func BuildAuthorityIndex(reader *Reader) (*AuthorityIndex, error) {
+	idx := NewAuthorityIndex()
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			return idx, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		idx.Add(rec)
+	}
+}
+
+// Lookup returns the authorized headings a heading field matches.
+// Authorized forms are returned before variants.
+func (idx *AuthorityIndex) Lookup(df DataField) []AuthorityEntry {
+	entries := append([]AuthorityEntry{}, idx.Entries[headingKey(df)]...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return !entries[i].Variant && entries[j].Variant
+	})
+	return entries
+}
+
+// Match looks up the controlled headings of a bibliographic record.
+func (idx *AuthorityIndex) Match(rec Record) []AuthorityMatch {
+	var matches []AuthorityMatch
+	for pos, df := range rec.DataFields {
+		if !controlledTags[df.Tag.GetTag()] {
+			continue
+		}
+		m := AuthorityMatch{Position: pos, Field: df, Status: MatchUnmatched}
+		if entries := idx.Lookup(df); len(entries) > 0 {
+			// the authorized forms, or the variants when there are none
+			best := entries[:1]
+			for _, e := range entries[1:] {
+				if e.Variant == entries[0].Variant && e.Id != entries[0].Id {
+					best = append(best, e)
+				}
+			}
+			switch {
+			case len(best) > 1:
+				m.Status = MatchAmbiguous
+				m.Entries = best
+			case entries[0].Variant:
+				m.Status = MatchVariant
+				m.Entry = entries[0]
+			default:
+				m.Status = MatchExact
+				m.Entry = entries[0]
+			}
+		}
+		matches = append(matches, m)
+	}
+	return matches
+}
+
+// authorizedField returns the bibliographic heading with its heading
+// subfields replaced by those of the authorized heading. Relator terms and
+// other subfields are kept after the heading.
+func authorizedField(df DataField, authorized DataField) DataField {
+	tag := df.Tag.GetTag()
+	out := DataField{Tag: df.Tag, Indicator1: df.Indicator1, Indicator2: df.Indicator2}
+	if kind := headingKind(tag); kind == "00" || kind == "10" || kind == "11" {
+		// the type of name indicator follows the authority record
+		out.Indicator1 = authorized.Indicator1
+	}
+	for _, sf := range authorized.SubFields {
+		if isHeadingSubField(authorized.Tag.GetTag(), sf.Code) {
+			out.SubFields = append(out.SubFields, sf)
+		}
+	}
+	for _, sf := range df.SubFields {
+		if !isHeadingSubField(tag, sf.Code) {
+			out.SubFields = append(out.SubFields, sf)
+		}
+	}
+	return out
+}
+
+// Control matches the headings of a bibliographic record and returns a
+// copy of the record where variant headings are replaced by their
+// authorized form. With addIds the matched headings get the control number
+// of the authority record in $0. Ambiguous headings are left unchanged.
+func (idx *AuthorityIndex) Control(rec Record, addIds bool) (Record, []AuthorityMatch) {
+	matches := idx.Match(rec)
+	out := rec
+	out.DataFields = append([]DataField{}, rec.DataFields...)
+	for _, m := range matches {
+		if m.Status == MatchUnmatched || m.Status == MatchAmbiguous {
+			continue
+		}
+		df := m.Field
+		if m.Status == MatchVariant {
+			df = authorizedField(df, m.Entry.Field)
+		}
+		if addIds && m.Entry.Id != "" {
+			df = withIdentifier(df, m.Entry.Id)
+		}
+		out.DataFields[m.Position] = df
+	}
+	return out, matches
+}
+
+// withIdentifier adds a $0 to a field unless it already has it.
+func withIdentifier(df DataField, id string) DataField {
+	for _, sf := range df.GetSubFields("0") {
+		if strings.TrimSpace(sf.Data) == id {
+			return df
+		}
+	}
+	df.SubFields = append(append([]SubField{}, df.SubFields...), SubField{Code: "0", Data: id})
+	return df
+}
+
+// Write saves the index, one entry per line, in key order.
+func (idx *AuthorityIndex) Write(writer io.Writer) error {
+	keys := make([]string, 0, len(idx.Entries))
+	for key := range idx.Entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	w := bufio.NewWriter(writer)
+	if !idx.ModTime.IsZero() {
+		if _, err := fmt.Fprintf(w, "\t%d\t%d\n", idx.Size, idx.ModTime.UnixNano()); err != nil {
+			return err
+		}
+	}
+	for _, key := range keys {
+		for _, e := range idx.Entries[key] {
+			use := "A"
+			if e.Variant {
+				use = "V"
+			}
+			if _, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", key, use, e.Id, headingMrk(e.Field)); err != nil {
+				return err
+			}
+		}
+	}
+	return w.Flush()
+}
+
+// headingMrk returns a heading in mnemonic form, with "{dollar}" for a
+// "$" in the subfield data as parseMrkLine reads it.
+func headingMrk(df DataField) string {
+	escaped := df
+	escaped.SubFields = make([]SubField, len(df.SubFields))
+	for i, sf := range df.SubFields {
+		escaped.SubFields[i] = SubField{Code: sf.Code, Data: strings.ReplaceAll(sf.Data, "$", "{dollar}")}
+	}
+	return escaped.String()
+}
+
+// ReadAuthorityIndex reads an index saved with Write.
+func ReadAuthorityIndex(reader io.Reader) (*AuthorityIndex, error) {
+	idx := NewAuthorityIndex()
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), MAX_RECORD_LEN)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.HasPrefix(scanner.Text(), "\t") {
+			// the size and the modification time of the authority file
+			var size, modTime int64
+			if _, err := fmt.Sscanf(scanner.Text(), "\t%d\t%d", &size, &modTime); err != nil {
+				return nil, fmt.Errorf("invalid authority index header on line %d", line)
+			}
+			idx.Size, idx.ModTime = size, time.Unix(0, modTime)
+			continue
+		}
+		parts := strings.SplitN(scanner.Text(), "\t", 5)
+		if len(parts) != 5 {
+			return nil, fmt.Errorf("invalid authority index entry on line %d", line)
+		}
+		var rec Record
+		if err := parseMrkLine(&rec, parts[4]); err != nil || len(rec.DataFields) != 1 {
+			return nil, fmt.Errorf("invalid authority heading on line %d", line)
+		}
+		key := parts[0] + "\t" + parts[1]
+		idx.Entries[key] = append(idx.Entries[key], AuthorityEntry{Id: parts[3], Field: rec.DataFields[0], Variant: parts[2] == "V"})
+	}
+	return idx, scanner.Err()
+}
+
+// OpenAuthorityIndex returns the index of an authority file in any record
+// format. The index is read from the sidecar file when it exists and is of
+// the authority file as it is; otherwise it is built and, with save,
+// written to the sidecar file.
+func OpenAuthorityIndex(authorityFile string, save bool) (*AuthorityIndex, error) {
+	info, err := os.Stat(authorityFile)
+	if err != nil {
+		return nil, err
+	}
+	sidecar, err := os.Open(AuthorityIndexFileName(authorityFile))
+	if err == nil {
+		idx, err := ReadAuthorityIndex(sidecar)
+		sidecar.Close()
+		if err == nil && idx.Size == info.Size() && idx.ModTime.Equal(info.ModTime()) {
+			return idx, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	data, err := OpenFile(authorityFile)
+	if err != nil {
+		return nil, err
+	}
+	defer data.Close()
+	idx, err := BuildAuthorityIndex(NewReader(data))
+	if err != nil || !save {
+		return idx, err
+	}
+	idx.Size, idx.ModTime = info.Size(), info.ModTime()
+
+	out, err := os.Create(AuthorityIndexFileName(authorityFile))
+	if err != nil {
+		return nil, err
+	}
+	if err := idx.Write(out); err != nil {
+		out.Close()
+		return nil, err
+	}
+	return idx, out.Close()
+}
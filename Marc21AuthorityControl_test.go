@@ -0,0 +1,153 @@
+package gomarc21
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthorityControl(test *testing.T) {
+	data, err := os.Open("data/CanadianSubjectHeadings_202112_UTF8.txt")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer data.Close()
+	idx, err := BuildAuthorityIndex(NewReader(data))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	bib := Record{DataFields: []DataField{
+		{Tag: "245", Indicator1: "1", Indicator2: "0", SubFields: []SubField{{Code: "a", Data: "A history of Acadia."}}},
+		{Tag: "650", Indicator1: " ", Indicator2: "5", SubFields: []SubField{{Code: "a", Data: "ACADIANS"}, {Code: "x", Data: "Expulsion, 1755."}}},
+		{Tag: "650", Indicator1: " ", Indicator2: "5", SubFields: []SubField{{Code: "a", Data: "Acadians"}, {Code: "x", Data: "Deportation, 1755."}, {Code: "2", Data: "csh"}}},
+		{Tag: "651", Indicator1: " ", Indicator2: "5", SubFields: []SubField{{Code: "a", Data: "Baffin Bay."}}},
+		{Tag: "650", Indicator1: " ", Indicator2: "5", SubFields: []SubField{{Code: "a", Data: "Expulsion of the Acadians, Canada, 1755"}}},
+		{Tag: "650", Indicator1: " ", Indicator2: "0", SubFields: []SubField{{Code: "a", Data: "Nowhere in particular"}}},
+	}}
+
+	controlled, matches := idx.Control(bib, true)
+	statuses := []string{MatchExact, MatchVariant, MatchExact, MatchVariant, MatchUnmatched}
+	if len(matches) != len(statuses) {
+		test.Fatal("wrong number of matches", matches)
+	}
+	for i, m := range matches {
+		if m.Status != statuses[i] {
+			test.Errorf("heading %s is %s, expected %s", m.Field, m.Status, statuses[i])
+		}
+	}
+	if matches[0].Entry.Id != "(CaOONL)cash10001" {
+		test.Error("wrong authority record", matches[0].Entry)
+	}
+
+	want := "=650  \\5$aAcadians$xExpulsion, 1755$2csh$0(CaOONL)cash10001"
+	if got := controlled.DataFields[2].String(); got != want {
+		test.Errorf("variant heading was not authorized:\n%s\n%s", got, want)
+	}
+	if got := controlled.DataFields[3].String(); got != "=651  \\5$aBaffin Bay.$0(CaOONL)cash10000" {
+		test.Error("exact heading should only get $0", got)
+	}
+	if bib.DataFields[2].SubFields[0].Data != "Acadians" || len(bib.DataFields[3].SubFields) != 1 {
+		test.Error("the original record was modified")
+	}
+
+	var buf bytes.Buffer
+	if err := idx.Write(&buf); err != nil {
+		test.Fatal(err)
+	}
+	saved, err := ReadAuthorityIndex(&buf)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(saved.Entries) != len(idx.Entries) {
+		test.Error("saved index differs", len(saved.Entries), len(idx.Entries))
+	}
+	if _, again := saved.Control(bib, true); again[3].Status != MatchVariant || again[3].Entry.Id != "(CaOONL)cash10001" {
+		test.Error("saved index does not match", again[3])
+	}
+
+	// a heading with a "$" in its data
+	authority, err := NewFormatReader(strings.NewReader(
+		"=LDR  00000nz  a2200000n  4500\n=001  dollar1\n=150  \\\\$aDollar ({dollar}) sign\n"), FormatMrk).Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	idx = NewAuthorityIndex()
+	idx.Add(authority)
+	buf.Reset()
+	if err := idx.Write(&buf); err != nil {
+		test.Fatal(err)
+	}
+	if saved, err = ReadAuthorityIndex(&buf); err != nil {
+		test.Fatal(err)
+	}
+	heading := DataField{Tag: "650", Indicator1: " ", Indicator2: "0", SubFields: []SubField{{Code: "a", Data: "Dollar ($) sign"}}}
+	if entries := saved.Lookup(heading); len(entries) != 1 || len(entries[0].Field.SubFields) != 1 ||
+		entries[0].Field.SubFields[0].Data != "Dollar ($) sign" {
+		test.Error("wrong saved heading", entries)
+	}
+}
+
+func TestAuthorityControlAmbiguous(test *testing.T) {
+	idx := NewAuthorityIndex()
+	for _, mrk := range []string{
+		"=LDR  00000nz  a2200000n  4500\n=001  a1\n=150  \\\\$aMercury (Planet)\n=450  \\\\$aMercury\n",
+		"=LDR  00000nz  a2200000n  4500\n=001  a2\n=150  \\\\$aMercury (Chemical element)\n=450  \\\\$aMercury\n",
+	} {
+		rec, err := NewFormatReader(strings.NewReader(mrk), FormatMrk).Next()
+		if err != nil {
+			test.Fatal(err)
+		}
+		idx.Add(rec)
+	}
+	bib := Record{DataFields: []DataField{
+		{Tag: "650", Indicator1: " ", Indicator2: "0", SubFields: []SubField{{Code: "a", Data: "Mercury."}}},
+	}}
+	controlled, matches := idx.Control(bib, true)
+	if len(matches) != 1 || matches[0].Status != MatchAmbiguous || len(matches[0].Entries) != 2 {
+		test.Fatal("wrong match", matches)
+	}
+	if got := controlled.DataFields[0].String(); got != bib.DataFields[0].String() {
+		test.Error("an ambiguous heading was changed", got)
+	}
+}
+
+func TestOpenAuthorityIndex(test *testing.T) {
+	authorityFile := filepath.Join(test.TempDir(), "authorities.mrk")
+	mrk := "=LDR  00000nz  a2200000n  4500\n=001  a1\n=150  \\\\$aAcadians\n\n"
+	if err := os.WriteFile(authorityFile, []byte(mrk), 0o644); err != nil {
+		test.Fatal(err)
+	}
+	heading := func(term string) DataField {
+		return DataField{Tag: "650", Indicator1: " ", Indicator2: "0", SubFields: []SubField{{Code: "a", Data: term}}}
+	}
+	idx, err := OpenAuthorityIndex(authorityFile, true)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(idx.Lookup(heading("Acadians"))) != 1 {
+		test.Fatal("heading not indexed")
+	}
+	if _, err := os.Stat(AuthorityIndexFileName(authorityFile)); err != nil {
+		test.Fatal("the index was not saved", err)
+	}
+
+	// the index of the authority file before a change is rebuilt
+	mrk += "=LDR  00000nz  a2200000n  4500\n=001  a2\n=150  \\\\$aCajuns\n\n"
+	if err := os.WriteFile(authorityFile, []byte(mrk), 0o644); err != nil {
+		test.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(authorityFile, later, later); err != nil {
+		test.Fatal(err)
+	}
+	if idx, err = OpenAuthorityIndex(authorityFile, true); err != nil {
+		test.Fatal(err)
+	}
+	if len(idx.Lookup(heading("Cajuns"))) != 1 {
+		test.Error("the stale index was used")
+	}
+}
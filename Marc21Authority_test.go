@@ -0,0 +1,74 @@
+package gomarc21
+
+import (
+	"os"
+	"testing"
+)
+
+func TestAuthorityHeadings(test *testing.T) {
+	data, err := os.Open("data/test02.mrk")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer data.Close()
+	rec := readAll(test, NewReader(data))[0]
+
+	if !rec.IsAuthority() {
+		test.Error("record should be an authority record")
+	}
+	heading, ok := rec.Heading()
+	if !ok || heading.String() != "Acadians--Expulsion, 1755" || heading.Type() != "topical term" {
+		test.Error("heading is wrong", heading)
+	}
+
+	seeFrom := rec.SeeFrom()
+	if len(seeFrom) != 6 || seeFrom[3].String() != "Acadians--Deportation, 1755" {
+		test.Error("see from tracings are wrong", seeFrom)
+	}
+
+	seeAlso := rec.SeeAlso()
+	if len(seeAlso) != 2 || seeAlso[0].Relationship != "broader term" || seeAlso[0].Type() != "geographic name" {
+		test.Error("see also tracings are wrong", seeAlso)
+	}
+	if ids := seeAlso[1].Identifiers(); len(ids) != 1 || ids[0] != "(CaOONL)cash10915" {
+		test.Error("see also identifiers are wrong", ids)
+	}
+
+	links := rec.LinkingEntries()
+	if len(links) != 2 || links[0].Thesaurus != "Library of Congress Subject Headings" || links[1].Thesaurus != "Répertoire de vedettes-matière" {
+		test.Error("linking entries are wrong", links)
+	}
+
+	f, ok := rec.Authority008()
+	if !ok || f.DateEntered != "850805" || f.KindOfRecordName() != "established heading" ||
+		f.SubjectHeadingSystemName() != "Canadian Subject Headings" || f.LevelOfEstablishmentName() != "fully established" {
+		test.Error("008 is wrong", f)
+	}
+}
+
+func TestAuthorityFile(test *testing.T) {
+	data, err := os.Open("data/CanadianSubjectHeadings_202112_UTF8.txt")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer data.Close()
+
+	recs := readAll(test, NewReader(data))
+	if len(recs) != 2282 {
+		test.Fatal("wrong number of records", len(recs))
+	}
+	narrower := 0
+	for _, rec := range recs {
+		if _, ok := rec.Heading(); !ok {
+			test.Error("record without heading", rec.ControlNum())
+		}
+		for _, t := range rec.SeeAlso() {
+			if t.Relationship == "broader term" {
+				narrower++
+			}
+		}
+	}
+	if narrower != 1168 {
+		test.Error("wrong number of broader term references", narrower)
+	}
+}
@@ -0,0 +1,344 @@
+package gomarc21
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+/*
+source: https://www.itu.int/rec/T-REC-X.690
+
+    BER, the Basic Encoding Rules of ASN.1, encode each value as a tag, a
+    length and the contents, which are other values when the value is
+    constructed:
+
+    tag      class (2 bits), constructed (1 bit), number (5 bits, or 11111
+             followed by base 128 bytes)
+    length   one byte below 128, or 0x80 + the number of length bytes;
+             0x80 alone is an indefinite length ended by two zero bytes
+    contents
+
+Values are encoded with definite lengths; both are decoded.
+*/
+
+// BER tag classes.
+const (
+	berUniversal   = 0
+	berApplication = 1
+	berContext     = 2
+	berPrivate     = 3
+)
+
+// BER universal tags.
+const (
+	berBoolean     = 1
+	berInteger     = 2
+	berBitString   = 3
+	berOctetString = 4
+	berNull        = 5
+	berOid         = 6
+	berExternal    = 8
+	berSequence    = 16
+	berVisible     = 26
+	berGeneral     = 27
+)
+
+// berMaxLength limits the length of a value, to not allocate what a
+// broken peer announces.
+const berMaxLength = 1 << 28
+
+// berValue is a decoded or to be encoded BER value. A constructed value
+// has children, a primitive value has data.
+type berValue struct {
+	Class       int
+	Constructed bool
+	Tag         int
+	Data        []byte
+	Children    []*berValue
+}
+
+// berPrimitive returns a primitive value of the context class.
+func berPrimitive(tag int, data []byte) *berValue {
+	return &berValue{Class: berContext, Tag: tag, Data: data}
+}
+
+// berConstructed returns a constructed value of the context class.
+func berConstructed(tag int, children ...*berValue) *berValue {
+	return &berValue{Class: berContext, Constructed: true, Tag: tag, Children: children}
+}
+
+// berSequenceOf returns a universal sequence.
+func berSequenceOf(children ...*berValue) *berValue {
+	return &berValue{Class: berUniversal, Constructed: true, Tag: berSequence, Children: children}
+}
+
+// berIntData returns the contents of an integer.
+func berIntData(n int) []byte {
+	data := []byte{byte(n)}
+	for (n > 127 || n < -128) && len(data) < 8 {
+		n >>= 8
+		data = append([]byte{byte(n)}, data...)
+	}
+	return data
+}
+
+func berInt(tag int, n int) *berValue {
+	return berPrimitive(tag, berIntData(n))
+}
+
+func berBool(tag int, b bool) *berValue {
+	if b {
+		return berPrimitive(tag, []byte{0xff})
+	}
+	return berPrimitive(tag, []byte{0})
+}
+
+func berString(tag int, s string) *berValue {
+	return berPrimitive(tag, []byte(s))
+}
+
+// berBits returns a bit string of the bits set, numbered from the first.
+func berBits(tag int, n int, set ...int) *berValue {
+	data := make([]byte, 1+(n+7)/8)
+	data[0] = byte(len(data)*8 - 8 - n)
+	for _, bit := range set {
+		data[1+bit/8] |= 0x80 >> (bit % 8)
+	}
+	return berPrimitive(tag, data)
+}
+
+// berOidValue returns a universal object identifier of its dotted form.
+func berOidValue(oid string) *berValue {
+	var arcs []int
+	for _, arc := range strings.Split(oid, ".") {
+		n, _ := strconv.Atoi(arc)
+		arcs = append(arcs, n)
+	}
+	data := []byte{byte(40*arcs[0] + arcs[1])}
+	for _, arc := range arcs[2:] {
+		var b []byte
+		for b = []byte{byte(arc & 0x7f)}; arc > 127; {
+			arc >>= 7
+			b = append([]byte{byte(arc&0x7f) | 0x80}, b...)
+		}
+		data = append(data, b...)
+	}
+	return &berValue{Class: berUniversal, Tag: berOid, Data: data}
+}
+
+// Int returns the integer of a primitive value.
+func (v *berValue) Int() int {
+	n := 0
+	for i, b := range v.Data {
+		if i == 0 && b&0x80 != 0 {
+			n = -1
+		}
+		n = n<<8 | int(b)
+	}
+	return n
+}
+
+// Bool returns the boolean of a primitive value.
+func (v *berValue) Bool() bool {
+	return len(v.Data) > 0 && v.Data[0] != 0
+}
+
+// Bit tells whether a bit of a bit string is set.
+func (v *berValue) Bit(bit int) bool {
+	return len(v.Data) > 1+bit/8 && v.Data[1+bit/8]&(0x80>>(bit%8)) != 0
+}
+
+// Oid returns the dotted form of an object identifier.
+func (v *berValue) Oid() string {
+	if len(v.Data) == 0 {
+		return ""
+	}
+	arcs := []string{strconv.Itoa(int(v.Data[0]) / 40), strconv.Itoa(int(v.Data[0]) % 40)}
+	n := 0
+	for _, b := range v.Data[1:] {
+		n = n<<7 | int(b&0x7f)
+		if b&0x80 == 0 {
+			arcs = append(arcs, strconv.Itoa(n))
+			n = 0
+		}
+	}
+	return strings.Join(arcs, ".")
+}
+
+// Child returns the first child of a class and tag, or nil.
+func (v *berValue) Child(class int, tag int) *berValue {
+	for _, child := range v.Children {
+		if child.Class == class && child.Tag == tag {
+			return child
+		}
+	}
+	return nil
+}
+
+// Context returns the first child of the context class with a tag, or
+// nil.
+func (v *berValue) Context(tag int) *berValue {
+	return v.Child(berContext, tag)
+}
+
+// Is tells whether a value has a class and tag.
+func (v *berValue) Is(class int, tag int) bool {
+	return v != nil && v.Class == class && v.Tag == tag
+}
+
+// Encode returns the encoding of a value.
+func (v *berValue) Encode() []byte {
+	var b bytes.Buffer
+	v.encode(&b)
+	return b.Bytes()
+}
+
+func (v *berValue) encode(b *bytes.Buffer) {
+	first := byte(v.Class << 6)
+	if v.Constructed {
+		first |= 0x20
+	}
+	if v.Tag < 31 {
+		b.WriteByte(first | byte(v.Tag))
+	} else {
+		b.WriteByte(first | 0x1f)
+		var tag []byte
+		for n := v.Tag; ; {
+			tag = append([]byte{byte(n & 0x7f)}, tag...)
+			if n >>= 7; n == 0 {
+				break
+			}
+		}
+		for i := 0; i < len(tag)-1; i++ {
+			tag[i] |= 0x80
+		}
+		b.Write(tag)
+	}
+
+	data := v.Data
+	if v.Constructed {
+		var contents bytes.Buffer
+		for _, child := range v.Children {
+			child.encode(&contents)
+		}
+		data = contents.Bytes()
+	}
+	if len(data) < 128 {
+		b.WriteByte(byte(len(data)))
+	} else {
+		length := berIntData(len(data))
+		if length[0] == 0 {
+			length = length[1:]
+		}
+		b.WriteByte(0x80 | byte(len(length)))
+		b.Write(length)
+	}
+	b.Write(data)
+}
+
+// berReader reads values from a stream or from the contents of a value.
+type berReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// errBerEnd is the end of the contents of an indefinite length.
+var errBerEnd = errors.New("end of contents")
+
+// readBer reads a value. It returns io.EOF only when there is no value
+// at all.
+func readBer(r berReader) (*berValue, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	v := &berValue{Class: int(first >> 6), Constructed: first&0x20 != 0, Tag: int(first & 0x1f)}
+	if v.Tag == 0x1f {
+		v.Tag = 0
+		for {
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, unexpectedEof(err)
+			}
+			v.Tag = v.Tag<<7 | int(b&0x7f)
+			if b&0x80 == 0 {
+				break
+			}
+			if v.Tag > 1<<24 {
+				return nil, fmt.Errorf("BER tag too long")
+			}
+		}
+	}
+
+	b, err := r.ReadByte()
+	if err != nil {
+		return nil, unexpectedEof(err)
+	}
+	if first == 0 && b == 0 {
+		return nil, errBerEnd
+	}
+	if b == 0x80 {
+		if !v.Constructed {
+			return nil, fmt.Errorf("BER primitive value of indefinite length")
+		}
+		for {
+			child, err := readBer(r)
+			if err == errBerEnd {
+				return v, nil
+			}
+			if err != nil {
+				return nil, unexpectedEof(err)
+			}
+			v.Children = append(v.Children, child)
+		}
+	}
+	length := int(b)
+	if b&0x80 != 0 {
+		if b&0x7f > 4 {
+			return nil, fmt.Errorf("BER length of %d bytes", b&0x7f)
+		}
+		length = 0
+		for i := 0; i < int(b&0x7f); i++ {
+			lb, err := r.ReadByte()
+			if err != nil {
+				return nil, unexpectedEof(err)
+			}
+			length = length<<8 | int(lb)
+		}
+	}
+	if length > berMaxLength {
+		return nil, fmt.Errorf("BER length %d too large", length)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, unexpectedEof(err)
+	}
+	if !v.Constructed {
+		v.Data = data
+		return v, nil
+	}
+	contents := bytes.NewReader(data)
+	for contents.Len() > 0 {
+		child, err := readBer(contents)
+		if err != nil {
+			if err == errBerEnd {
+				err = fmt.Errorf("BER end of contents in a value of definite length")
+			}
+			return nil, unexpectedEof(err)
+		}
+		v.Children = append(v.Children, child)
+	}
+	return v, nil
+}
+
+func unexpectedEof(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
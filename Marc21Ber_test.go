@@ -0,0 +1,72 @@
+package gomarc21
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestBer(test *testing.T) {
+	long := strings.Repeat("x", 300)
+	value := berConstructed(z3950SearchRequest,
+		berInt(13, 0),
+		berInt(14, -129),
+		berInt(15, 70000),
+		berBool(16, true),
+		berString(105, long),
+		berBits(3, 3, 0, 2),
+		berOidValue(Z3950UsMarcSyntax))
+	data := value.Encode()
+	if data[0] != 0xb6 || data[1] != 0x82 {
+		test.Errorf("wrong tag or length % x", data[:4])
+	}
+
+	decoded, err := readBer(bytes.NewReader(data))
+	if err != nil {
+		test.Fatal(err)
+	}
+	if !decoded.Is(berContext, z3950SearchRequest) || !decoded.Constructed || len(decoded.Children) != 7 {
+		test.Fatal("wrong value", decoded)
+	}
+	if decoded.Context(13).Int() != 0 || decoded.Context(14).Int() != -129 || decoded.Context(15).Int() != 70000 {
+		test.Error("wrong integers", decoded.Context(14).Data, decoded.Context(15).Data)
+	}
+	if !decoded.Context(16).Bool() || string(decoded.Context(105).Data) != long {
+		test.Error("wrong boolean or string")
+	}
+	if bits := decoded.Context(3); !bits.Bit(0) || bits.Bit(1) || !bits.Bit(2) || bits.Data[0] != 5 {
+		test.Error("wrong bit string", bits.Data)
+	}
+	if oid := decoded.Child(berUniversal, berOid); oid.Oid() != Z3950UsMarcSyntax {
+		test.Error("wrong object identifier", oid.Oid())
+	}
+	if !bytes.Equal(decoded.Encode(), data) {
+		test.Error("the decoded value is encoded differently")
+	}
+
+	// an indefinite length
+	indefinite := []byte{0xb6, 0x80, 0x8d, 0x01, 0x05, 0x30, 0x80, 0x02, 0x01, 0x07, 0x00, 0x00, 0x00, 0x00}
+	decoded, err = readBer(bytes.NewReader(indefinite))
+	if err != nil {
+		test.Fatal(err)
+	}
+	if decoded.Context(13).Int() != 5 || decoded.Child(berUniversal, berSequence).Children[0].Int() != 7 {
+		test.Error("wrong value of indefinite length", decoded)
+	}
+
+	if _, err := readBer(bytes.NewReader(nil)); err != io.EOF {
+		test.Error("expected io.EOF, got", err)
+	}
+	for _, broken := range [][]byte{
+		{0xb6, 0x05, 0x8d, 0x01},
+		{0xb6, 0x80, 0x8d, 0x01, 0x05},
+		{0x9f},
+		{0x04, 0x85, 1, 2, 3, 4, 5},
+		{0x30, 0x02, 0x00, 0x00},
+	} {
+		if _, err := readBer(bytes.NewReader(broken)); err == nil || err == io.EOF {
+			test.Errorf("% x: expected an error, got %v", broken, err)
+		}
+	}
+}
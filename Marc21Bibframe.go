@@ -0,0 +1,466 @@
+package gomarc21
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+/*
+MARC 21 to BIBFRAME 2.0, modeled on the LC marc2bibframe2 conversion:
+
+source: https://www.loc.gov/bibframe/mtbf/
+        https://github.com/lcnetdev/marc2bibframe2
+
+Each bibliographic record becomes a Work, an Instance of the Work and,
+when the record carries holdings or electronic location data (852, 856),
+an Item of the Instance. Node IRIs are minted from the base IRI, the
+control number (001) and the position of the source field, e.g.
+
+    <http://example.org/ocm57175940#Work>
+    <http://example.org/ocm57175940#Instance>
+    <http://example.org/ocm57175940#Agent100-11>
+
+so converting the same record again produces the same graph.
+
+    Work        Leader/06 class, 1XX/7XX contribution, 6XX subject,
+                655 genreForm, 008/041 language, 050/082 classification,
+                520 summary, 130/240 title
+    Instance    245 title and responsibilityStatement, 246 variant title,
+                250 edition, 260/264 provisionActivity, 300 extent,
+                337/338 media/carrier, 490 series, 5XX note,
+                010/020/022/024/035 identifiedBy, Leader/07 issuance
+    Item        852 shelfMark/heldBy, 856 electronicLocator
+    AdminMetadata  001, 003, 005, 008/00-05, 040
+*/
+
+const (
+	BfNamespace   = "http://id.loc.gov/ontologies/bibframe/"
+	BflcNamespace = "http://id.loc.gov/ontologies/bflc/"
+
+	DefaultBaseIri = "http://example.org/"
+)
+
+// bfChangeDate matches a 005: the date and time of the latest transaction
+// as yyyymmddhhmmss and a fraction of second.
+var bfChangeDate = regexp.MustCompile(`^(\d{14})\.\d+$`)
+
+// bfWorkClass maps leader/06 to the BIBFRAME Work subclass.
+var bfWorkClass = map[byte]string{
+	'a': "Text",
+	'c': "NotatedMusic",
+	'd': "NotatedMusic",
+	'e': "Cartography",
+	'f': "Cartography",
+	'g': "MovingImage",
+	'i': "Audio",
+	'j': "Audio",
+	'k': "StillImage",
+	'm': "Multimedia",
+	'o': "MixedMaterial",
+	'p': "MixedMaterial",
+	'r': "Object",
+	't': "Text",
+}
+
+// bfAgentClass maps the last two characters of X00/X10/X11 tags to the
+// BIBFRAME Agent subclass.
+var bfAgentClass = map[string]string{
+	"00": "Person",
+	"10": "Organization",
+	"11": "Meeting",
+}
+
+// bfSubjectSource maps the second indicator of 6XX fields to the subject
+// scheme.
+var bfSubjectSource = map[string]string{
+	"0": "http://id.loc.gov/authorities/subjects",
+	"1": "http://id.loc.gov/authorities/childrensSubjects",
+	"2": "http://id.loc.gov/vocabulary/subjectSchemes/mesh",
+	"3": "http://id.loc.gov/vocabulary/subjectSchemes/nal",
+	"5": "http://id.loc.gov/vocabulary/subjectSchemes/cash",
+	"6": "http://id.loc.gov/vocabulary/subjectSchemes/rvm",
+}
+
+// bfIssuance maps leader/07 to the LC issuance vocabulary.
+var bfIssuance = map[byte]string{
+	'a': "mono",
+	'c': "mono",
+	'd': "mono",
+	'm': "mono",
+	'b': "serl",
+	's': "serl",
+	'i': "intg",
+}
+
+// bfProvision maps the second indicator of 264 to the provision activity.
+var bfProvision = map[string]string{
+	"0": "Production",
+	"1": "Publication",
+	"2": "Distribution",
+	"3": "Manufacture",
+}
+
+// bfIdentifier maps identifier tags to the Identifier subclass.
+var bfIdentifier = map[string]string{
+	"010": "Lccn",
+	"020": "Isbn",
+	"022": "Issn",
+	"024": "Identifier",
+	"035": "Local",
+}
+
+// bibframe holds the state of a single record conversion.
+type bibframe struct {
+	g        *RdfGraph
+	base     string
+	work     RdfTerm
+	instance RdfTerm
+}
+
+// newBibframeGraph returns an empty graph knowing the bf and bflc prefixes.
+func newBibframeGraph() *RdfGraph {
+	g := NewRdfGraph()
+	g.Prefixes["bf"] = BfNamespace
+	g.Prefixes["bflc"] = BflcNamespace
+	return g
+}
+
+func bf(local string) string {
+	return BfNamespace + local
+}
+
+// node mints the IRI of a resource derived from the field at position pos.
+func (b *bibframe) node(kind string, tag string, pos int, n int) RdfTerm {
+	if n > 0 {
+		return Iri(fmt.Sprintf("%s#%s%s-%d-%d", b.base, kind, tag, pos, n))
+	}
+	return Iri(fmt.Sprintf("%s#%s%s-%d", b.base, kind, tag, pos))
+}
+
+// labeled adds a resource of class with an rdfs:label.
+func (b *bibframe) labeled(node RdfTerm, class string, label string) RdfTerm {
+	b.g.Add(node, RdfNamespace+"type", Iri(bf(class)))
+	b.g.Add(node, RdfsNamespace+"label", Literal(label))
+	return node
+}
+
+// Bibframe converts the record to a BIBFRAME 2.0 graph. baseIri is
+// prefixed to the control number to mint the node IRIs; DefaultBaseIri is
+// used when it is empty. The record must have a control number.
+func (rec Record) Bibframe(baseIri string) (*RdfGraph, error) {
+	id := strings.TrimSpace(rec.ControlNum())
+	if id == "" {
+		return nil, errors.New("a control number (001) is needed to mint BIBFRAME IRIs")
+	}
+	if baseIri == "" {
+		baseIri = DefaultBaseIri
+	}
+
+	g := newBibframeGraph()
+	b := &bibframe{g: g, base: baseIri + IriComponent(id)}
+	b.work = Iri(b.base + "#Work")
+	b.instance = Iri(b.base + "#Instance")
+
+	g.Add(b.work, RdfNamespace+"type", Iri(bf("Work")))
+	if class, ok := bfWorkClass[rec.Leader.TypeOfRecord]; ok {
+		g.Add(b.work, RdfNamespace+"type", Iri(bf(class)))
+	}
+	g.Add(b.work, bf("hasInstance"), b.instance)
+	g.Add(b.instance, RdfNamespace+"type", Iri(bf("Instance")))
+	g.Add(b.instance, bf("instanceOf"), b.work)
+	if code, ok := bfIssuance[rec.Leader.BibLevel]; ok {
+		g.Add(b.instance, bf("issuance"), Iri("http://id.loc.gov/vocabulary/issuance/"+code))
+	}
+
+	b.adminMetadata(rec)
+	b.languages(rec)
+
+	var item RdfTerm
+	for pos, df := range rec.DataFields {
+		tag := df.Tag.GetTag()
+		switch {
+		case tag == "010" || tag == "020" || tag == "022" || tag == "024" || tag == "035":
+			b.identifiers(df, pos)
+		case tag == "050" || tag == "082":
+			b.classification(df, pos)
+		case tag == "100" || tag == "110" || tag == "111" || tag == "700" || tag == "710" || tag == "711":
+			b.contribution(df, pos)
+		case tag == "130" || tag == "240":
+			b.title(b.work, df, pos, "Title", "adfklmnoprs")
+		case tag == "245":
+			b.title(b.instance, df, pos, "Title", "afgks")
+			b.title(b.work, df, pos, "Title", "afgks")
+			g.Add(b.instance, bf("responsibilityStatement"), Literal(joinSubFields(df, "c", " ")))
+		case tag == "246":
+			b.title(b.instance, df, pos, "VariantTitle", "af")
+		case tag == "250":
+			g.Add(b.instance, bf("editionStatement"), Literal(joinSubFields(df, "ab", " ")))
+		case tag == "260" || tag == "264":
+			b.provisionActivity(df, pos)
+		case tag == "300":
+			for n, sf := range df.GetSubFields("a") {
+				extent := b.labeled(b.node("Extent", tag, pos, n), "Extent", chopPunctuation(sf.Data))
+				g.Add(b.instance, bf("extent"), extent)
+			}
+			g.Add(b.instance, bf("dimensions"), Literal(joinSubFields(df, "c", " ")))
+		case tag == "337":
+			g.Add(b.instance, bf("media"), b.labeled(b.node("Media", tag, pos, 0), "Media", joinSubFields(df, "a", " ")))
+		case tag == "338":
+			g.Add(b.instance, bf("carrier"), b.labeled(b.node("Carrier", tag, pos, 0), "Carrier", joinSubFields(df, "a", " ")))
+		case tag == "440" || tag == "490":
+			g.Add(b.instance, bf("seriesStatement"), Literal(joinSubFields(df, "av", " ")))
+		case tag == "520":
+			g.Add(b.work, bf("summary"), b.labeled(b.node("Summary", tag, pos, 0), "Summary", joinSubFields(df, "ab", " ")))
+		case tag >= "500" && tag <= "599":
+			g.Add(b.instance, bf("note"), b.labeled(b.node("Note", tag, pos, 0), "Note", joinSubFields(df, "a", " ")))
+		case tag == "600" || tag == "610" || tag == "611" || tag == "630" || tag == "648" || tag == "650" || tag == "651":
+			b.subject(df, pos)
+		case tag == "655":
+			g.Add(b.work, bf("genreForm"), b.labeled(b.node("GenreForm", tag, pos, 0), "GenreForm", subjectString(df)))
+		case tag == "852" || tag == "856":
+			if item.Value == "" {
+				item = Iri(b.base + "#Item")
+				g.Add(item, RdfNamespace+"type", Iri(bf("Item")))
+				g.Add(item, bf("itemOf"), b.instance)
+				g.Add(b.instance, bf("hasItem"), item)
+			}
+			b.item(item, df, pos)
+		}
+	}
+	return g, nil
+}
+
+func (b *bibframe) adminMetadata(rec Record) {
+	admin := Iri(b.base + "#AdminMetadata")
+	b.g.Add(b.instance, bf("adminMetadata"), admin)
+	b.g.Add(admin, RdfNamespace+"type", Iri(bf("AdminMetadata")))
+
+	local := Iri(b.base + "#Local001")
+	b.g.Add(admin, bf("identifiedBy"), local)
+	b.g.Add(local, RdfNamespace+"type", Iri(bf("Local")))
+	b.g.Add(local, RdfNamespace+"value", Literal(strings.TrimSpace(rec.ControlNum())))
+	for _, cf := range rec.GetControlfields("003") {
+		source := b.labeled(Iri(b.base+"#Source003"), "Source", strings.TrimSpace(cf.Data))
+		b.g.Add(local, bf("assigner"), source)
+	}
+
+	if date := rec.fixedField("008", 0, 6); date != "" {
+		b.g.Add(admin, bf("creationDate"), Literal(date))
+	}
+	for _, cf := range rec.GetControlfields("005") {
+		if m := bfChangeDate.FindStringSubmatch(strings.TrimSpace(cf.Data)); m != nil {
+			if stamp, err := time.Parse("20060102150405", m[1]); err == nil {
+				b.g.Add(admin, bf("changeDate"), TypedLiteral(stamp.Format("2006-01-02T15:04:05"), XsdNamespace+"dateTime"))
+			}
+		}
+	}
+	for pos, df := range rec.DataFields {
+		if df.Tag.GetTag() != "040" {
+			continue
+		}
+		for n, sf := range df.GetSubFields("a") {
+			b.g.Add(admin, bf("assigner"), b.labeled(b.node("Agent", "040", pos, n), "Organization", strings.TrimSpace(sf.Data)))
+		}
+		for n, sf := range df.GetSubFields("e") {
+			b.g.Add(admin, bf("descriptionConventions"), b.labeled(b.node("DescriptionConventions", "040", pos, n), "DescriptionConventions", strings.TrimSpace(sf.Data)))
+		}
+	}
+}
+
+func (b *bibframe) languages(rec Record) {
+	if lang := rec.languageCode(); lang != "" {
+		b.g.Add(b.work, bf("language"), Iri("http://id.loc.gov/vocabulary/languages/"+IriComponent(lang)))
+	}
+	for _, df := range rec.GetDatafields("041") {
+		for _, sf := range df.GetSubFields("a") {
+			for i := 0; i+3 <= len(sf.Data); i += 3 {
+				b.g.Add(b.work, bf("language"), Iri("http://id.loc.gov/vocabulary/languages/"+IriComponent(sf.Data[i:i+3])))
+			}
+		}
+	}
+}
+
+func (b *bibframe) title(subject RdfTerm, df DataField, pos int, class string, codes string) {
+	title := b.node(class, df.Tag.GetTag(), pos, 0)
+	if subject == b.work {
+		title = b.node("Work"+class, df.Tag.GetTag(), pos, 0)
+	}
+	b.g.Add(subject, bf("title"), title)
+	b.g.Add(title, RdfNamespace+"type", Iri(bf(class)))
+	b.g.Add(title, bf("mainTitle"), Literal(joinSubFields(df, codes, " ")))
+	b.g.Add(title, bf("subtitle"), Literal(joinSubFields(df, "b", " ")))
+	for _, sf := range df.GetSubFields("n") {
+		b.g.Add(title, bf("partNumber"), Literal(chopPunctuation(sf.Data)))
+	}
+	for _, sf := range df.GetSubFields("p") {
+		b.g.Add(title, bf("partName"), Literal(chopPunctuation(sf.Data)))
+	}
+}
+
+// agent adds the Agent of a X00/X10/X11 field and returns its node.
+func (b *bibframe) agent(df DataField, pos int) RdfTerm {
+	tag := df.Tag.GetTag()
+	class := bfAgentClass[tag[1:]]
+	agent := b.node("Agent", tag, pos, 0)
+	b.g.Add(agent, RdfNamespace+"type", Iri(bf("Agent")))
+	if class != "" {
+		b.g.Add(agent, RdfNamespace+"type", Iri(bf(class)))
+	}
+	b.g.Add(agent, RdfsNamespace+"label", Literal(joinSubFields(df, "abcdqn", " ")))
+	return agent
+}
+
+func (b *bibframe) contribution(df DataField, pos int) {
+	tag := df.Tag.GetTag()
+	contribution := b.node("Contribution", tag, pos, 0)
+	b.g.Add(b.work, bf("contribution"), contribution)
+	b.g.Add(contribution, RdfNamespace+"type", Iri(bf("Contribution")))
+	if tag[0] == '1' {
+		b.g.Add(contribution, RdfNamespace+"type", Iri(BflcNamespace+"PrimaryContribution"))
+	}
+	b.g.Add(contribution, bf("agent"), b.agent(df, pos))
+
+	roleCode := "e"
+	if tag[1:] == "11" {
+		roleCode = "j"
+	}
+	n := 0
+	for _, sf := range df.GetSubFields(roleCode) {
+		n++
+		role := b.labeled(b.node("Role", tag, pos, n), "Role", chopPunctuation(sf.Data))
+		b.g.Add(contribution, bf("role"), role)
+	}
+	for _, sf := range df.GetSubFields("4") {
+		n++
+		code := strings.TrimSpace(sf.Data)
+		if strings.HasPrefix(code, "http") {
+			b.g.Add(contribution, bf("role"), Iri(code))
+		} else {
+			b.g.Add(contribution, bf("role"), Iri("http://id.loc.gov/vocabulary/relators/"+IriComponent(code)))
+		}
+	}
+	if n == 0 {
+		role := "ctb"
+		if tag[0] == '1' {
+			role = "cre"
+		}
+		b.g.Add(contribution, bf("role"), Iri("http://id.loc.gov/vocabulary/relators/"+role))
+	}
+}
+
+func (b *bibframe) subject(df DataField, pos int) {
+	tag := df.Tag.GetTag()
+	var class string
+	switch tag {
+	case "600", "610", "611":
+		class = bfAgentClass[tag[1:]]
+	case "630":
+		class = "Work"
+	case "648":
+		class = "Temporal"
+	case "651":
+		class = "Place"
+	default:
+		class = "Topic"
+	}
+
+	subject := b.node(class, tag, pos, 0)
+	b.g.Add(b.work, bf("subject"), subject)
+	b.labeled(subject, class, subjectString(df))
+
+	source := bfSubjectSource[df.GetIndicator2()]
+	if df.GetIndicator2() == "7" {
+		if code := joinSubFields(df, "2", ""); code != "" {
+			source = "http://id.loc.gov/vocabulary/subjectSchemes/" + IriComponent(code)
+		}
+	}
+	if source != "" {
+		b.g.Add(subject, bf("source"), Iri(source))
+	}
+	for _, sf := range df.GetSubFields("0") {
+		if uri := strings.TrimSpace(sf.Data); strings.HasPrefix(uri, "http") {
+			b.g.Add(subject, RdfsNamespace+"seeAlso", Iri(uri))
+		}
+	}
+}
+
+func (b *bibframe) classification(df DataField, pos int) {
+	tag := df.Tag.GetTag()
+	class := "ClassificationLcc"
+	if tag == "082" {
+		class = "ClassificationDdc"
+	}
+	for n, sf := range df.GetSubFields("a") {
+		node := b.node(class, tag, pos, n)
+		b.g.Add(b.work, bf("classification"), node)
+		b.g.Add(node, RdfNamespace+"type", Iri(bf(class)))
+		b.g.Add(node, bf("classificationPortion"), Literal(strings.TrimSpace(sf.Data)))
+		if n == 0 {
+			b.g.Add(node, bf("itemPortion"), Literal(joinSubFields(df, "b", "")))
+		}
+	}
+}
+
+func (b *bibframe) provisionActivity(df DataField, pos int) {
+	tag := df.Tag.GetTag()
+	class := "Publication"
+	if tag == "264" {
+		var ok bool
+		if class, ok = bfProvision[df.GetIndicator2()]; !ok {
+			// 264 _4 is a copyright notice date
+			b.g.Add(b.instance, bf("copyrightDate"), Literal(joinSubFields(df, "c", " ")))
+			return
+		}
+	}
+
+	activity := b.node("ProvisionActivity", tag, pos, 0)
+	b.g.Add(b.instance, bf("provisionActivity"), activity)
+	b.g.Add(activity, RdfNamespace+"type", Iri(bf("ProvisionActivity")))
+	b.g.Add(activity, RdfNamespace+"type", Iri(bf(class)))
+	for n, sf := range df.GetSubFields("a") {
+		place := b.labeled(b.node("Place", tag, pos, n), "Place", strings.Trim(chopPunctuation(sf.Data), "[]"))
+		b.g.Add(activity, bf("place"), place)
+	}
+	for n, sf := range df.GetSubFields("b") {
+		agent := b.labeled(b.node("Agent", tag, pos, n), "Agent", chopPunctuation(sf.Data))
+		b.g.Add(activity, bf("agent"), agent)
+	}
+	for _, sf := range df.GetSubFields("c") {
+		b.g.Add(activity, bf("date"), Literal(chopPunctuation(sf.Data)))
+	}
+}
+
+func (b *bibframe) identifiers(df DataField, pos int) {
+	tag := df.Tag.GetTag()
+	for n, sf := range df.GetSubFields("az") {
+		id := b.node("Identifier", tag, pos, n)
+		b.g.Add(b.instance, bf("identifiedBy"), id)
+		b.g.Add(id, RdfNamespace+"type", Iri(bf(bfIdentifier[tag])))
+		b.g.Add(id, RdfNamespace+"value", Literal(strings.TrimSpace(sf.Data)))
+		if sf.Code == "z" {
+			b.g.Add(id, bf("status"), Iri("http://id.loc.gov/vocabulary/mstatus/cancinv"))
+		}
+	}
+}
+
+func (b *bibframe) item(item RdfTerm, df DataField, pos int) {
+	tag := df.Tag.GetTag()
+	if tag == "856" {
+		for _, sf := range df.GetSubFields("u") {
+			b.g.Add(item, bf("electronicLocator"), Iri(strings.TrimSpace(sf.Data)))
+		}
+		return
+	}
+
+	if shelfMark := joinSubFields(df, "hi", " "); shelfMark != "" {
+		node := b.labeled(b.node("ShelfMark", tag, pos, 0), "ShelfMark", shelfMark)
+		b.g.Add(item, bf("shelfMark"), node)
+	}
+	for n, sf := range df.GetSubFields("a") {
+		agent := b.labeled(b.node("Agent", tag, pos, n), "Agent", strings.TrimSpace(sf.Data))
+		b.g.Add(item, bf("heldBy"), agent)
+	}
+}
@@ -0,0 +1,141 @@
+package gomarc21
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBibframeFromFile(test *testing.T) {
+	data, err := os.Open("data/test_1a.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer data.Close()
+	rec, err := ParseNextRecord(data)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	g, err := rec.Bibframe("http://example.org/")
+	if err != nil {
+		test.Fatal(err)
+	}
+	nt := g.AsNTriples()
+	for _, want := range []string{
+		"<http://example.org/ocm57175940#Work> <http://www.w3.org/1999/02/22-rdf-syntax-ns#type> <http://id.loc.gov/ontologies/bibframe/Text> .",
+		"<http://example.org/ocm57175940#Instance> <http://id.loc.gov/ontologies/bibframe/instanceOf> <http://example.org/ocm57175940#Work> .",
+		"<http://id.loc.gov/ontologies/bibframe/language> <http://id.loc.gov/vocabulary/languages/eng> .",
+		`<http://www.w3.org/2000/01/rdf-schema#label> "Swanson, Vernon E. (Vernon Emmanuel), 1922-1992" .`,
+		"<http://id.loc.gov/ontologies/bflc/PrimaryContribution> .",
+	} {
+		if !strings.Contains(nt, want) {
+			test.Errorf("N-Triples does not contain %q", want)
+		}
+	}
+
+	// the IRIs are minted from the record, so a second run gives the same output
+	again, _ := rec.Bibframe("http://example.org/")
+	if again.AsNTriples() != nt {
+		test.Error("BIBFRAME output is not stable")
+	}
+
+	// one node per agent, and a 005 only when it is a date and time
+	admin := rec.Clone()
+	admin.SetControlField("005", "2004120616142X.0")
+	for _, field := range []struct {
+		tag   Tag
+		codes string
+	}{{"040", "aa"}, {"852", "aa"}} {
+		df := DataField{Tag: field.tag, Indicator1: " ", Indicator2: " "}
+		for i, code := range field.codes {
+			df.AddSubField(string(code), fmt.Sprintf("%s-%d", field.tag, i))
+		}
+		admin.AddDataField(df)
+	}
+	g, err = admin.Bibframe("http://example.org/")
+	if err != nil {
+		test.Fatal(err)
+	}
+	labels := map[string]int{}
+	for _, line := range strings.Split(strings.TrimSpace(g.AsNTriples()), "\n") {
+		if strings.Contains(line, "rdf-schema#label") {
+			labels[strings.Fields(line)[0]]++
+		}
+	}
+	for node, count := range labels {
+		if count > 1 {
+			test.Errorf("%s has %d labels", node, count)
+		}
+	}
+	if strings.Contains(g.AsNTriples(), "changeDate") {
+		test.Error("an invalid 005 was converted")
+	}
+	if !strings.Contains(nt, `"2004-12-06T16:14:21"^^<http://www.w3.org/2001/XMLSchema#dateTime>`) {
+		test.Error("the 005 was not converted")
+	}
+
+	if _, err := (Record{}).Bibframe(""); err == nil {
+		test.Error("a record without 001 should not convert")
+	}
+
+	// the IRIs minted from record data are escaped
+	rec = rec.Clone()
+	rec.SetControlField("001", "ocm 123/456")
+	df := DataField{Tag: "856", Indicator1: "4", Indicator2: "0"}
+	df.AddSubField("u", "http://example.org/a file{1}.pdf")
+	rec.AddDataField(df)
+	g, err = rec.Bibframe("http://example.org/")
+	if err != nil {
+		test.Fatal(err)
+	}
+	nt = g.AsNTriples()
+	for _, want := range []string{
+		"<http://example.org/ocm%20123%2F456#Work> ",
+		"<http://example.org/a%20file%7B1%7D.pdf> .",
+	} {
+		if !strings.Contains(nt, want) {
+			test.Errorf("N-Triples does not contain %q", want)
+		}
+	}
+	for _, line := range strings.Split(strings.TrimSpace(nt), "\n") {
+		for _, term := range strings.SplitAfter(line, ">") {
+			if start := strings.Index(term, "<"); start >= 0 && strings.ContainsAny(term[start:], " \"{}|^`") {
+				test.Errorf("invalid IRI in %q", line)
+			}
+		}
+	}
+}
+
+func TestWriterBibframe(test *testing.T) {
+	data, err := os.Open("data/test_10.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer data.Close()
+	recs := readAll(test, NewReader(data))
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, FormatTurtle)
+	if err != nil {
+		test.Fatal(err)
+	}
+	w.BaseIri = "http://example.org/bib/"
+	for _, rec := range recs {
+		if err := w.Write(rec); err != nil {
+			test.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		test.Fatal(err)
+	}
+	ttl := buf.String()
+	if strings.Count(ttl, "@prefix bf: ") != 1 {
+		test.Error("the prefixes should be written once")
+	}
+	if strings.Count(ttl, " a bf:Instance") != len(recs) {
+		test.Error("every record should have an Instance", strings.Count(ttl, " a bf:Instance"))
+	}
+}
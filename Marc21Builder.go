@@ -0,0 +1,370 @@
+package gomarc21
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+A RecordBuilder creates a record from scratch, starting from a valid
+leader and 008 for the kind of record:
+
+    rec, err := NewRecordBuilder(RecordBook).
+        ControlField("001", "local0001").
+        Fixed(35, "eng").
+        DataField("100", "1 ", "a", "Swanson, Vernon E.").
+        DataField("245", "10", "a", "Coal sampling :", "b", "a guide.").
+        Build()
+
+The fields are validated as they are added, and the first error is
+returned by Build, which also checks the fields the kind of record needs
+(a 245 for bibliographic records, a 1XX for authority records, an 004
+and an 852 for holdings records). The leader lengths and the directory
+are computed by Build, and 005 is set to the time of the build: the
+record is ready for RecordAsMarc or RecordAsXml.
+
+Templates are records in mnemonic text (see ParseMrkRecord) with
+placeholders: {{name}} is replaced by the value of name, {{name|text}}
+by text when name has no value. A control field or a subfield with a
+placeholder without value is left out, as is a data field whose
+placeholders all lack values, such as "=100  1\$a{{author}}$eauthor."
+without author. {{today}} is the date in the yymmdd form of 008/00-05.
+
+    builder, err := NewRecordBuilderFromTemplate("book", map[string]string{
+        "title": "Coal sampling", "author": "Swanson, Vernon E."})
+
+The built-in templates (see RecordTemplates) are in the templates
+directory; other templates are read from .mrk files.
+*/
+
+// The kinds of record of NewRecordBuilder.
+const (
+	RecordBook      = "book"
+	RecordSerial    = "serial"
+	RecordAuthority = "authority"
+	RecordHoldings  = "holdings"
+)
+
+// recordDefaults are the leaders and the 008 of the kinds of record; the
+// date entered (008/00-05) is added by the builder.
+var recordDefaults = map[string]struct{ leader, fixed string }{
+	RecordBook:      {"00000nam a2200000 i 4500", "nuuuu    xx            000 0 und d"},
+	RecordSerial:    {"00000nas a2200000 i 4500", "cuuuu9999xx  u p       0    0und d"},
+	RecordAuthority: {"00000nz  a2200000n  4500", "nn aznnnaabn           n ana     d"},
+	RecordHoldings:  {"00000nx  a2200000un 4500", "0u    8   4001uuund0      "},
+}
+
+// builderLeaderPositions are the positions of the leader computed by
+// RecordAsMarc.
+var builderLeaderPositions = map[int]bool{0: true, 1: true, 2: true, 3: true, 4: true, 10: true, 11: true,
+	12: true, 13: true, 14: true, 15: true, 16: true, 20: true, 21: true, 22: true, 23: true}
+
+var (
+	builderDataTag     = regexp.MustCompile(`^[0-9A-Za-z]{3}$`)
+	builderIndicator   = regexp.MustCompile(`^[0-9a-z ]$`)
+	builderCode        = regexp.MustCompile(`^[0-9a-z]$`)
+	builderPlaceholder = regexp.MustCompile(`\{\{([A-Za-z0-9_-]+)(?:\|([^}]*))?\}\}`)
+)
+
+//go:embed templates/*.mrk
+var builtinTemplates embed.FS
+
+// RecordBuilder builds a record field by field.
+type RecordBuilder struct {
+	kind string
+	rec  Record
+	err  error
+	now  time.Time
+}
+
+// NewRecordBuilder returns a builder of a kind of record: RecordBook,
+// RecordSerial, RecordAuthority or RecordHoldings.
+func NewRecordBuilder(kind string) *RecordBuilder {
+	b := &RecordBuilder{kind: kind, now: time.Now()}
+	defaults, ok := recordDefaults[kind]
+	if !ok {
+		b.err = fmt.Errorf("unknown kind of record %q", kind)
+		return b
+	}
+	b.rec.Leader, b.err = NewLeader([]byte(defaults.leader))
+	b.rec.SetControlField("008", b.now.Format("060102")+defaults.fixed)
+	return b
+}
+
+// recordKind returns the kind of record of a leader.
+func recordKind(leader Leader) string {
+	switch {
+	case leader.TypeOfRecord == 'z':
+		return RecordAuthority
+	case strings.IndexByte("uvxy", leader.TypeOfRecord) >= 0:
+		return RecordHoldings
+	case leader.BibLevel == 's' || leader.BibLevel == 'i':
+		return RecordSerial
+	}
+	return RecordBook
+}
+
+// RecordTemplates returns the names of the built-in templates.
+func RecordTemplates() []string {
+	entries, _ := builtinTemplates.ReadDir("templates")
+	var names []string
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), ".mrk"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewRecordBuilderFromTemplate returns a builder starting from a
+// template, a built-in template or an .mrk file, with the placeholders
+// replaced by values.
+func NewRecordBuilderFromTemplate(template string, values map[string]string) (*RecordBuilder, error) {
+	text, err := builtinTemplates.ReadFile(path.Join("templates", template+".mrk"))
+	if err != nil {
+		if text, err = os.ReadFile(template); err != nil {
+			return nil, fmt.Errorf("unknown template %s", template)
+		}
+	}
+	tmpl, err := ParseMrkRecord(strings.TrimSpace(string(text)))
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %s", template, err)
+	}
+
+	now := time.Now()
+	// fill replaces the placeholders of a text, and returns how many
+	// were replaced and how many have no value.
+	fill := func(text string) (string, int, int) {
+		filled, missing := 0, 0
+		text = builderPlaceholder.ReplaceAllStringFunc(text, func(placeholder string) string {
+			match := builderPlaceholder.FindStringSubmatch(placeholder)
+			filled++
+			if value := values[match[1]]; value != "" {
+				return value
+			}
+			if match[1] == "today" {
+				return now.Format("060102")
+			}
+			if strings.Contains(placeholder, "|") {
+				return match[2]
+			}
+			filled--
+			missing++
+			return ""
+		})
+		return text, filled, missing
+	}
+
+	leader, _, missing := fill(tmpl.Leader.GetRaw())
+	if missing > 0 || len(leader) != LEADER_LEN {
+		return nil, fmt.Errorf("template %s: invalid leader %q", template, leader)
+	}
+	l, err := NewLeader([]byte(leader))
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %s", template, err)
+	}
+	b := &RecordBuilder{kind: recordKind(l), now: now}
+	b.rec.Leader = l
+	for _, cf := range tmpl.ControlFields {
+		if data, _, missing := fill(cf.Data); missing == 0 {
+			b.ControlField(string(cf.Tag), data)
+		}
+	}
+	for _, df := range tmpl.DataFields {
+		var subfields []string
+		filled, missing := 0, 0
+		for _, sf := range df.SubFields {
+			data, f, m := fill(sf.Data)
+			filled, missing = filled+f, missing+m
+			if m == 0 && data != "" {
+				subfields = append(subfields, sf.Code, data)
+			}
+		}
+		// a field whose placeholders all lack values is left out
+		if len(subfields) > 0 && (filled > 0 || missing == 0) {
+			b.DataField(string(df.Tag), df.Indicator1+df.Indicator2, subfields...)
+		}
+	}
+	if b.err != nil {
+		return nil, fmt.Errorf("template %s: %s", template, b.err)
+	}
+	return b, nil
+}
+
+// fail keeps the first error of the builder.
+func (b *RecordBuilder) fail(format string, args ...interface{}) *RecordBuilder {
+	if b.err == nil {
+		b.err = fmt.Errorf(format, args...)
+	}
+	return b
+}
+
+// Leader sets the leader from a position. The lengths and addresses
+// (00-04, 12-16) and the entry map (10-11, 20-23) are computed by Build.
+func (b *RecordBuilder) Leader(position int, value string) *RecordBuilder {
+	if b.err != nil {
+		return b
+	}
+	leader := []byte(b.rec.Leader.GetRaw())
+	if position < 0 || position+len(value) > len(leader) {
+		return b.fail("leader/%02d: %q is out of the leader", position, value)
+	}
+	for i := range value {
+		if builderLeaderPositions[position+i] {
+			return b.fail("leader/%02d is computed", position+i)
+		}
+	}
+	copy(leader[position:], value)
+	b.rec.Leader, b.err = NewLeader(leader)
+	return b
+}
+
+// Fixed sets the 008 from a position.
+func (b *RecordBuilder) Fixed(position int, value string) *RecordBuilder {
+	if b.err != nil {
+		return b
+	}
+	fixed := []byte(b.fixed())
+	if position < 0 || position+len(value) > len(fixed) {
+		return b.fail("008/%02d: %q is out of the field", position, value)
+	}
+	copy(fixed[position:], value)
+	b.rec.SetControlField("008", string(fixed))
+	return b
+}
+
+func (b *RecordBuilder) fixed() string {
+	for _, cf := range b.rec.GetControlfields("008") {
+		return cf.Data
+	}
+	return ""
+}
+
+// ControlField sets a control field (001-009). The fields other than 006
+// and 007, which are repeatable, are replaced.
+func (b *RecordBuilder) ControlField(tag string, data string) *RecordBuilder {
+	if b.err != nil {
+		return b
+	}
+	if len(tag) != 3 || tag < "001" || tag > "009" {
+		return b.fail("invalid control field tag %q", tag)
+	}
+	if data == "" || strings.ContainsAny(data, builderTerminators) {
+		return b.fail("field %s: invalid data %q", tag, data)
+	}
+	if tag == "006" || tag == "007" {
+		b.rec.AddControlField(ControlField{Tag: Tag(tag), Data: data})
+	} else {
+		b.rec.SetControlField(tag, data)
+	}
+	return b
+}
+
+// builderTerminators are the characters not allowed in the data of
+// fields.
+const builderTerminators = string(rune(END_OF_RECORD)) + string(rune(END_OF_FIELD)) + string(rune(SUBFIELD_INDICATOR))
+
+// DataField adds a data field. indicators are its two indicators, and
+// subfields the codes and the data of its subfields:
+//
+//	DataField("650", " 0", "a", "Coal", "x", "Analysis.")
+func (b *RecordBuilder) DataField(tag string, indicators string, subfields ...string) *RecordBuilder {
+	if b.err != nil {
+		return b
+	}
+	if !builderDataTag.MatchString(tag) || strings.HasPrefix(tag, "00") {
+		return b.fail("invalid data field tag %q", tag)
+	}
+	indicators = strings.ReplaceAll(indicators, "\\", " ")
+	if len(indicators) != 2 || !builderIndicator.MatchString(indicators[0:1]) || !builderIndicator.MatchString(indicators[1:2]) {
+		return b.fail("field %s: invalid indicators %q", tag, indicators)
+	}
+	if len(subfields) == 0 || len(subfields)%2 != 0 {
+		return b.fail("field %s: the subfields are not pairs of codes and data", tag)
+	}
+	df := DataField{Tag: Tag(tag), Indicator1: indicators[0:1], Indicator2: indicators[1:2]}
+	for i := 0; i < len(subfields); i += 2 {
+		code, data := subfields[i], subfields[i+1]
+		if !builderCode.MatchString(code) {
+			return b.fail("field %s: invalid subfield code %q", tag, code)
+		}
+		if data == "" || strings.ContainsAny(data, builderTerminators) {
+			return b.fail("field %s: invalid data %q in $%s", tag, data, code)
+		}
+		df.AddSubField(code, data)
+	}
+	b.rec.AddDataField(df)
+	return b
+}
+
+// Field adds a field in mnemonic text, such as "=245  10$aCoal sampling".
+func (b *RecordBuilder) Field(line string) *RecordBuilder {
+	if b.err != nil {
+		return b
+	}
+	var rec Record
+	if strings.HasPrefix(line, "=LDR") {
+		return b.fail("the leader is set with Leader")
+	}
+	if err := parseMrkLine(&rec, line); err != nil {
+		return b.fail("%s", err)
+	}
+	for _, cf := range rec.ControlFields {
+		b.ControlField(string(cf.Tag), cf.Data)
+	}
+	for _, df := range rec.DataFields {
+		var subfields []string
+		for _, sf := range df.SubFields {
+			subfields = append(subfields, sf.Code, sf.Data)
+		}
+		b.DataField(string(df.Tag), df.Indicator1+df.Indicator2, subfields...)
+	}
+	return b
+}
+
+// Build returns the record, or the first error of the builder.
+func (b *RecordBuilder) Build() (Record, error) {
+	if b.err != nil {
+		return Record{}, b.err
+	}
+	rec := b.rec.Clone()
+	rec.SetControlField("005", b.now.Format("20060102150405.0"))
+
+	fixedLength := 40
+	if b.kind == RecordHoldings {
+		fixedLength = 32
+	}
+	if fixed := b.fixed(); len(fixed) != fixedLength {
+		return Record{}, fmt.Errorf("the 008 of %s records has %d characters, not %d", b.kind, len(fixed), fixedLength)
+	}
+	headings := len(rec.GetDatafields("100,110,111,130,148,150,151,155,162,180,181,182,185"))
+	switch b.kind {
+	case RecordBook, RecordSerial:
+		if n := len(rec.GetDatafields("245")); n != 1 {
+			return Record{}, fmt.Errorf("%s records have one 245, not %d", b.kind, n)
+		}
+		if n := len(rec.GetDatafields("100,110,111,130")); n > 1 {
+			return Record{}, fmt.Errorf("%s records have at most one 1XX, not %d", b.kind, n)
+		}
+	case RecordAuthority:
+		if headings != 1 {
+			return Record{}, fmt.Errorf("authority records have one 1XX, not %d", headings)
+		}
+	case RecordHoldings:
+		if len(rec.GetControlfields("004")) == 0 || len(rec.GetDatafields("852")) == 0 {
+			return Record{}, errors.New("holdings records have an 004 and an 852")
+		}
+	}
+
+	raw, err := rec.RecordAsMarc()
+	if err != nil {
+		return Record{}, err
+	}
+	return ParseRecord(raw)
+}
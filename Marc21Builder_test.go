@@ -0,0 +1,149 @@
+package gomarc21
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordBuilder(test *testing.T) {
+	rec, err := NewRecordBuilder(RecordBook).
+		ControlField("001", "local0001").
+		Leader(17, "7").
+		Fixed(7, "1976").
+		Fixed(35, "eng").
+		DataField("245", "10", "a", "Coal sampling :", "b", "a guide /", "c", "Vernon E. Swanson.").
+		Field(`=650  \0$aCoal$xSampling.`).
+		DataField("100", "1\\", "a", "Swanson, Vernon E.").
+		Build()
+	if err != nil {
+		test.Fatal(err)
+	}
+	raw, err := rec.RecordAsMarc()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if rec.Leader.RecordLength != len(raw) || rec.Leader.GetRaw() != string(raw[:LEADER_LEN]) {
+		test.Error("wrong leader", rec.Leader.GetRaw())
+	}
+	if leader := rec.Leader.GetRaw(); leader[5:10] != "nam a" || leader[17:20] != "7i " {
+		test.Error("wrong leader values", leader)
+	}
+	fixed := rec.GetControlfields("008")[0].Data
+	if len(fixed) != 40 || fixed[6:11] != "n1976" || fixed[35:38] != "eng" {
+		test.Errorf("wrong 008 %q", fixed)
+	}
+	if version := recordVersion(rec); len(version) != 16 {
+		test.Error("wrong 005", version)
+	}
+	var tags []string
+	for _, df := range rec.DataFields {
+		tags = append(tags, string(df.Tag))
+	}
+	if strings.Join(tags, " ") != "100 245 650" || rec.DataFields[0].Indicator2 != " " {
+		test.Error("wrong fields", tags)
+	}
+	if xml, err := rec.RecordAsXml(); err != nil || !strings.Contains(xml, "Coal sampling") {
+		test.Error("wrong MARCXML", err)
+	}
+
+	for kind, fixedLength := range map[string]int{RecordSerial: 40, RecordAuthority: 40, RecordHoldings: 32} {
+		b := NewRecordBuilder(kind).ControlField("001", "x1")
+		if _, err := b.Build(); err == nil {
+			test.Errorf("%s: expected the fields needed to be missing", kind)
+		}
+		switch kind {
+		case RecordSerial:
+			b.DataField("245", "00", "a", "Water resources bulletin.")
+		case RecordAuthority:
+			b.DataField("100", "1 ", "a", "Swanson, Vernon E.")
+		case RecordHoldings:
+			b.ControlField("004", "local0001").DataField("852", "0 ", "b", "main")
+		}
+		rec, err := b.Build()
+		if err != nil {
+			test.Errorf("%s: %s", kind, err)
+			continue
+		}
+		if n := len(rec.GetControlfields("008")[0].Data); n != fixedLength || recordKind(rec.Leader) != kind {
+			test.Errorf("%s: wrong 008 length %d or leader %s", kind, n, rec.Leader.GetRaw())
+		}
+	}
+
+	for name, b := range map[string]*RecordBuilder{
+		"unknown kind":        NewRecordBuilder("map"),
+		"computed leader":     NewRecordBuilder(RecordBook).Leader(20, "4"),
+		"leader out of range": NewRecordBuilder(RecordBook).Leader(23, "ab"),
+		"008 out of range":    NewRecordBuilder(RecordBook).Fixed(39, "ab"),
+		"control tag":         NewRecordBuilder(RecordBook).ControlField("010", "x"),
+		"data tag":            NewRecordBuilder(RecordBook).DataField("24", "10", "a", "x"),
+		"control data tag":    NewRecordBuilder(RecordBook).DataField("008", "10", "a", "x"),
+		"indicators":          NewRecordBuilder(RecordBook).DataField("245", "1", "a", "x"),
+		"upper case":          NewRecordBuilder(RecordBook).DataField("245", "1A", "a", "x"),
+		"pairs":               NewRecordBuilder(RecordBook).DataField("245", "10", "a"),
+		"code":                NewRecordBuilder(RecordBook).DataField("245", "10", "$", "x"),
+		"empty":               NewRecordBuilder(RecordBook).DataField("245", "10", "a", ""),
+		"terminator":          NewRecordBuilder(RecordBook).DataField("245", "10", "a", "x\x1e"),
+		"mnemonic leader":     NewRecordBuilder(RecordBook).Field("=LDR  00000nam a2200000 i 4500"),
+		"two 245":             NewRecordBuilder(RecordBook).Field("=245  10$ax").Field("=245  10$ay"),
+		"first error":         NewRecordBuilder(RecordBook).DataField("24", "10", "a", "x").DataField("245", "10", "a", "x"),
+	} {
+		if _, err := b.Build(); err == nil {
+			test.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestRecordTemplates(test *testing.T) {
+	values := map[string]string{"id": "local0001", "org": "XYZ", "title": "Coal sampling", "name": "Swanson, Vernon E.",
+		"bib_id": "local0001", "location": "main", "year": "1976", "start": "1976"}
+	if len(RecordTemplates()) < 6 {
+		test.Error("wrong templates", RecordTemplates())
+	}
+	for _, template := range RecordTemplates() {
+		b, err := NewRecordBuilderFromTemplate(template, values)
+		if err != nil {
+			test.Errorf("%s: %s", template, err)
+			continue
+		}
+		rec, err := b.Build()
+		if err != nil {
+			test.Errorf("%s: %s", template, err)
+			continue
+		}
+		if rec.ControlNum() != "local0001" || rec.GetControlfields("003")[0].Data != "XYZ" {
+			test.Errorf("%s: wrong record\n%s", template, rec.GetMrk())
+		}
+	}
+
+	b, err := NewRecordBuilderFromTemplate("book", values)
+	if err != nil {
+		test.Fatal(err)
+	}
+	rec, err := b.Build()
+	if err != nil {
+		test.Fatal(err)
+	}
+	fixed := rec.GetControlfields("008")[0].Data
+	if fixed[6:18] != "s1976    xx " || len(rec.GetDatafields("020,100,300")) != 0 {
+		test.Errorf("wrong book\n%s", rec.GetMrk())
+	}
+	if sfs := rec.GetDatafields("264")[0].SubFields; sfs[0].Data != "[Place of publication not identified] :" || sfs[2].Data != "1976." {
+		test.Error("wrong 264", sfs)
+	}
+
+	template := filepath.Join(test.TempDir(), "local.mrk")
+	os.WriteFile(template, []byte("=LDR  00000nam a2200000 i 4500\n=008  {{today}}"+strings.Repeat(`\`, 34)+
+		"\n=245  00$a{{title}}$b{{subtitle}}\n=500  \\\\$aLocal record.\n"), 0644)
+	b, err = NewRecordBuilderFromTemplate(template, map[string]string{"title": "Local"})
+	if err != nil {
+		test.Fatal(err)
+	}
+	if rec, err := b.Build(); err != nil || len(rec.GetDatafields("245")[0].SubFields) != 1 || len(rec.GetDatafields("500")) != 1 {
+		test.Error("wrong record of a template file", err)
+	}
+	if _, err := NewRecordBuilderFromTemplate("nothing", nil); err == nil {
+		test.Error("expected an unknown template")
+	}
+}
@@ -0,0 +1,635 @@
+package gomarc21
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+/*
+Citation exports of bibliographic records.
+
+source: https://www.bibtex.org/Format/
+        https://en.wikipedia.org/wiki/RIS_(file_format)
+        https://citeproc-js.readthedocs.io/en/latest/csl-json/markup.html
+
+    Type         Leader/06-07, 502, serial host from 773 $7/03 or $x
+    Author       100/110/111, 700/710/711 ("Last, First" for personal names)
+    Editor       700/710/711 with the relator "editor" ($e) or "edt" ($4)
+    Title        245 $a$n$p, subtitle $b
+    Edition      250 $a
+    Publisher    264 _1 $b, 260 $b; thesis institution from 502
+    Place        264 _1 $a, 260 $a
+    Year         264 _1 $c, 260 $c, 008/07-10
+    Container    773 $t, volume/issue/pages from 773 $g
+    Series       490 $a, 440 $a
+    Identifiers  020 $a, 022 $a, 773 $x, 024 7_ $2 doi, 856 $u
+    Abstract     520 $a
+    Keywords     600-651
+    Language     008/35-37
+*/
+
+// Citation types, named after the CSL types.
+const (
+	CitationBook       = "book"
+	CitationArticle    = "article-journal"
+	CitationChapter    = "chapter"
+	CitationThesis     = "thesis"
+	CitationPeriodical = "periodical"
+	CitationMap        = "map"
+	CitationScore      = "musical_score"
+	CitationSound      = "song"
+	CitationVideo      = "motion_picture"
+	CitationGraphic    = "graphic"
+	CitationSoftware   = "software"
+	CitationManuscript = "manuscript"
+	CitationDocument   = "document"
+)
+
+// CitationName is a personal name split into family and given names, or
+// the name of an organization or meeting as a literal.
+type CitationName struct {
+	Family  string
+	Given   string
+	Literal string
+}
+
+// Citation holds the elements shared by the citation formats.
+type Citation struct {
+	Id             string
+	Type           string
+	Authors        []CitationName
+	Editors        []CitationName
+	Title          string
+	Subtitle       string
+	ContainerTitle string
+	Series         string
+	Edition        string
+	Publisher      string
+	Place          string
+	Year           string
+	Volume         string
+	Issue          string
+	Pages          string
+	Genre          string
+	Isbn           []string
+	Issn           []string
+	Doi            string
+	Url            string
+	Abstract       string
+	Keywords       []string
+	Language       string
+}
+
+// citationTypes maps leader/06 of non textual records to the citation type.
+var citationTypes = map[byte]string{
+	'c': CitationScore,
+	'd': CitationScore,
+	'e': CitationMap,
+	'f': CitationMap,
+	'g': CitationVideo,
+	'i': CitationSound,
+	'j': CitationSound,
+	'k': CitationGraphic,
+	'm': CitationSoftware,
+	'r': CitationDocument,
+	't': CitationManuscript,
+}
+
+var bibtexTypes = map[string]string{
+	CitationBook:       "book",
+	CitationArticle:    "article",
+	CitationChapter:    "incollection",
+	CitationThesis:     "thesis",
+	CitationManuscript: "unpublished",
+}
+
+var risTypes = map[string]string{
+	CitationBook:       "BOOK",
+	CitationArticle:    "JOUR",
+	CitationChapter:    "CHAP",
+	CitationThesis:     "THES",
+	CitationPeriodical: "JFULL",
+	CitationMap:        "MAP",
+	CitationScore:      "MUSIC",
+	CitationSound:      "SOUND",
+	CitationVideo:      "VIDEO",
+	CitationGraphic:    "ART",
+	CitationSoftware:   "COMP",
+	CitationManuscript: "MANSCPT",
+	CitationDocument:   "GEN",
+}
+
+var (
+	yearPattern   = regexp.MustCompile(`\d{4}`)
+	thesisPattern = regexp.MustCompile(`^\s*Thesis\s*\(([^)]*)\)\s*-*\s*(.*?)[,.\s]*(\d{4})?[.\s]*$`)
+	volumePattern = regexp.MustCompile(`(?i)\b(?:v|vol)\.?\s*(\d+)`)
+	issuePattern  = regexp.MustCompile(`(?i)\b(?:no|nr|issue)\.?\s*(\d+)`)
+	pagesPattern  = regexp.MustCompile(`(?i)\bp+\.?\s*(\d+(?:\s*-\s*\d+)?)`)
+)
+
+// citationType returns the citation type of the record from leader/06-07
+// and the presence of a dissertation note (502). A component part is an
+// article when its host item (773) is a serial, a chapter otherwise.
+func (rec Record) citationType() string {
+	if len(rec.GetDatafields("502")) > 0 {
+		return CitationThesis
+	}
+	if t, ok := citationTypes[rec.Leader.TypeOfRecord]; ok {
+		return t
+	}
+	switch rec.Leader.BibLevel {
+	case 'a':
+		if rec.hasSerialHost() {
+			return CitationArticle
+		}
+		return CitationChapter
+	case 'b':
+		return CitationArticle
+	case 's', 'i':
+		return CitationPeriodical
+	}
+	if rec.Leader.TypeOfRecord == 'a' {
+		return CitationBook
+	}
+	return CitationDocument
+}
+
+// hasSerialHost tells if the host item entry (773) is a serial, from the
+// bibliographic level of its control subfield ($7/03) or its ISSN ($x).
+func (rec Record) hasSerialHost() bool {
+	for _, df := range rec.GetDatafields("773") {
+		if control := firstValue(df, "7"); len(control) > 3 {
+			return control[3] == 's'
+		}
+		return firstValue(df, "x") != ""
+	}
+	return false
+}
+
+// citationName parses the name of a X00/X10/X11 field. Personal names with
+// a surname (first indicator 1) are split at the first comma.
+func citationName(df DataField) CitationName {
+	tag := df.Tag.GetTag()
+	if tag[1:] != "00" {
+		return CitationName{Literal: joinSubFields(df, "abcdnq", " ")}
+	}
+	name := joinSubFields(df, "a", " ")
+	if df.GetIndicator1() == "1" {
+		if i := strings.Index(name, ","); i > 0 {
+			return CitationName{
+				Family: strings.TrimSpace(name[:i]),
+				Given:  chopPunctuation(name[i+1:]),
+			}
+		}
+	}
+	if name == "" {
+		return CitationName{}
+	}
+	return CitationName{Literal: name}
+}
+
+// isEditor reports whether a name field has the editor relator.
+func isEditor(df DataField) bool {
+	for _, sf := range df.GetSubFields("e") {
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(sf.Data)), "ed") {
+			return true
+		}
+	}
+	for _, sf := range df.GetSubFields("4") {
+		if strings.TrimSpace(sf.Data) == "edt" {
+			return true
+		}
+	}
+	return false
+}
+
+// firstValue returns the first whitespace separated word of the first
+// subfield with one of the codes, e.g. the ISBN without its qualifier.
+func firstValue(df DataField, codes string) string {
+	for _, sf := range df.GetSubFields(codes) {
+		if fields := strings.Fields(sf.Data); len(fields) > 0 {
+			return strings.TrimRight(fields[0], ".,;:")
+		}
+	}
+	return ""
+}
+
+// Citation maps the record to the elements of the citation formats.
+func (rec Record) Citation() Citation {
+	c := Citation{Id: strings.TrimSpace(rec.ControlNum()), Type: rec.citationType()}
+
+	for _, df := range rec.GetDatafields("100,110,111,700,710,711") {
+		name := citationName(df)
+		if name == (CitationName{}) {
+			continue
+		}
+		if df.Tag.GetTag()[0] == '7' && isEditor(df) {
+			c.Editors = append(c.Editors, name)
+		} else {
+			c.Authors = append(c.Authors, name)
+		}
+	}
+
+	for _, df := range rec.GetDatafields("245") {
+		c.Title = joinSubFields(df, "anp", " ")
+		c.Subtitle = joinSubFields(df, "b", " ")
+		break
+	}
+	for _, df := range rec.GetDatafields("250") {
+		c.Edition = joinSubFields(df, "a", " ")
+		break
+	}
+	for _, df := range rec.GetDatafields("490,440") {
+		c.Series = joinSubFields(df, "a", " ")
+		break
+	}
+
+	// a 264 publication statement takes precedence over 260
+	for _, df := range rec.GetDatafields("264,260") {
+		if df.Tag.GetTag() == "264" && df.GetIndicator2() != "1" {
+			continue
+		}
+		// only the first place and publisher are cited
+		for _, sf := range df.GetSubFields("b") {
+			c.Publisher = strings.Trim(chopPunctuation(sf.Data), "[]")
+			break
+		}
+		for _, sf := range df.GetSubFields("a") {
+			c.Place = strings.Trim(chopPunctuation(sf.Data), "[]")
+			break
+		}
+		c.Year = yearPattern.FindString(joinSubFields(df, "c", " "))
+		break
+	}
+	if c.Year == "" {
+		if date := rec.fixedField("008", 7, 11); yearPattern.MatchString(date) {
+			c.Year = date
+		}
+	}
+
+	for _, df := range rec.GetDatafields("502") {
+		c.thesis(df)
+	}
+	for _, df := range rec.GetDatafields("773") {
+		c.ContainerTitle = joinSubFields(df, "t", " ")
+		related := joinSubFields(df, "g", " ")
+		if m := volumePattern.FindStringSubmatch(related); m != nil {
+			c.Volume = m[1]
+		}
+		if m := issuePattern.FindStringSubmatch(related); m != nil {
+			c.Issue = m[1]
+		}
+		if m := pagesPattern.FindStringSubmatch(related); m != nil {
+			c.Pages = strings.ReplaceAll(m[1], " ", "")
+		}
+		if issn := firstValue(df, "x"); issn != "" {
+			c.Issn = appendValue(c.Issn, issn)
+		}
+		break
+	}
+
+	for _, df := range rec.GetDatafields("020") {
+		c.Isbn = appendValue(c.Isbn, firstValue(df, "a"))
+	}
+	for _, df := range rec.GetDatafields("022") {
+		c.Issn = appendValue(c.Issn, firstValue(df, "a"))
+	}
+	for _, df := range rec.GetDatafields("024") {
+		if df.GetIndicator1() == "7" && strings.ToLower(joinSubFields(df, "2", "")) == "doi" {
+			c.Doi = firstValue(df, "a")
+		}
+	}
+	for _, df := range rec.GetDatafields("856") {
+		if c.Url = firstValue(df, "u"); c.Url != "" {
+			break
+		}
+	}
+	for _, df := range rec.GetDatafields("520") {
+		c.Abstract = joinSubFields(df, "a", " ")
+		break
+	}
+	for _, df := range rec.GetDatafields("600,610,611,630,650,651") {
+		c.Keywords = appendValue(c.Keywords, subjectString(df))
+	}
+	c.Language = rec.languageCode()
+
+	return c
+}
+
+// thesis reads the degree, institution and year of a dissertation note,
+// either from $b, $c and $d or from the text of $a, e.g.
+// "Thesis (Ph. D.)--University of Toronto, 1998."
+func (c *Citation) thesis(df DataField) {
+	degree := joinSubFields(df, "b", " ")
+	institution := joinSubFields(df, "c", " ")
+	year := yearPattern.FindString(joinSubFields(df, "d", " "))
+	if m := thesisPattern.FindStringSubmatch(joinSubFields(df, "a", " ")); m != nil {
+		if degree == "" {
+			degree = strings.TrimSpace(m[1])
+		}
+		if institution == "" {
+			institution = strings.TrimSpace(m[2])
+		}
+		if year == "" {
+			year = m[3]
+		}
+	}
+	c.Genre = degree
+	if institution != "" {
+		c.Publisher = institution
+	}
+	if c.Year == "" {
+		c.Year = year
+	}
+}
+
+// FullTitle returns the title followed by the subtitle.
+func (c Citation) FullTitle() string {
+	if c.Subtitle == "" {
+		return c.Title
+	}
+	return c.Title + ": " + c.Subtitle
+}
+
+// String returns the name in "Last, First" form.
+func (n CitationName) String() string {
+	if n.Literal != "" {
+		return n.Literal
+	}
+	if n.Given == "" {
+		return n.Family
+	}
+	return n.Family + ", " + n.Given
+}
+
+// Key returns a BibTeX citation key made of the family name of the first
+// author and the year, or of the control number when there is no author.
+// The BibTeX Writer adds a suffix (a, b, c...) to the keys repeated.
+func (c Citation) Key() string {
+	var key string
+	if len(c.Authors) > 0 {
+		name := c.Authors[0].Family
+		if name == "" {
+			name = c.Authors[0].Literal
+		}
+		key = asciiWord(name) + c.Year
+	}
+	if key == "" || key == c.Year {
+		key = asciiWord(c.Id)
+	}
+	if key == "" {
+		key = "record"
+	}
+	return key
+}
+
+// keySuffix returns the suffix of the nth repeat (from 1) of a citation
+// key: "a" to "z", then "aa", "ab" and so on.
+func keySuffix(n int) string {
+	var suffix string
+	for ; n > 0; n = (n - 1) / 26 {
+		suffix = string(rune('a'+(n-1)%26)) + suffix
+	}
+	return suffix
+}
+
+// asciiWord keeps the ASCII letters and digits of s in lower case.
+func asciiWord(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
+
+// escapeBibtex escapes the characters with a special meaning in BibTeX.
+func escapeBibtex(s string) string {
+	r := strings.NewReplacer("\\", "\\textbackslash{}", "{", "\\{", "}", "\\}", "&", "\\&", "%", "\\%", "$", "\\$", "#", "\\#", "_", "\\_")
+	return r.Replace(s)
+}
+
+// escapeBibtexUrl escapes a URL for a BibTeX url field: braces and
+// backslashes are percent-encoded so that they cannot unbalance the
+// entry, and the percent and hash signs are escaped for LaTeX.
+func escapeBibtexUrl(s string) string {
+	r := strings.NewReplacer("%", "\\%", "#", "\\#", "{", "\\%7B", "}", "\\%7D", "\\", "\\%5C")
+	return r.Replace(s)
+}
+
+func bibtexNames(names []CitationName) string {
+	var parts []string
+	for _, n := range names {
+		if n.Literal != "" {
+			// braces keep corporate names from being parsed as "First Last"
+			parts = append(parts, "{"+escapeBibtex(n.Literal)+"}")
+		} else {
+			parts = append(parts, escapeBibtex(n.String()))
+		}
+	}
+	return strings.Join(parts, " and ")
+}
+
+// AsBibtex returns the citation as a BibTeX entry.
+func (c Citation) AsBibtex() string {
+	return c.bibtexEntry(c.Key())
+}
+
+// bibtexEntry returns the citation as a BibTeX entry with the given key.
+func (c Citation) bibtexEntry(key string) string {
+	entryType, ok := bibtexTypes[c.Type]
+	if !ok {
+		entryType = "misc"
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "@%s{%s", entryType, key)
+	field := func(name string, value string) {
+		if value != "" {
+			fmt.Fprintf(&buf, ",\n  %s = {%s}", name, value)
+		}
+	}
+	field("author", bibtexNames(c.Authors))
+	field("editor", bibtexNames(c.Editors))
+	field("title", escapeBibtex(c.FullTitle()))
+	switch c.Type {
+	case CitationArticle:
+		field("journal", escapeBibtex(c.ContainerTitle))
+	case CitationChapter:
+		field("booktitle", escapeBibtex(c.ContainerTitle))
+	}
+	field("series", escapeBibtex(c.Series))
+	field("edition", escapeBibtex(c.Edition))
+	if c.Type == CitationThesis {
+		field("type", escapeBibtex(c.Genre))
+		field("school", escapeBibtex(c.Publisher))
+	} else {
+		field("publisher", escapeBibtex(c.Publisher))
+	}
+	field("address", escapeBibtex(c.Place))
+	field("year", c.Year)
+	field("volume", c.Volume)
+	field("number", c.Issue)
+	field("pages", strings.Replace(c.Pages, "-", "--", 1))
+	field("isbn", escapeBibtex(strings.Join(c.Isbn, ", ")))
+	field("issn", escapeBibtex(strings.Join(c.Issn, ", ")))
+	field("doi", escapeBibtex(c.Doi))
+	field("url", escapeBibtexUrl(c.Url))
+	field("abstract", escapeBibtex(c.Abstract))
+	field("keywords", escapeBibtex(strings.Join(c.Keywords, ", ")))
+	field("language", c.Language)
+	buf.WriteString("\n}\n")
+	return buf.String()
+}
+
+// AsRis returns the citation as a RIS tagged record.
+func (c Citation) AsRis() string {
+	var buf bytes.Buffer
+	tag := func(name string, value string) {
+		if value != "" {
+			fmt.Fprintf(&buf, "%s  - %s\r\n", name, value)
+		}
+	}
+
+	risType, ok := risTypes[c.Type]
+	if !ok {
+		risType = "GEN"
+	}
+	tag("TY", risType)
+	tag("ID", c.Id)
+	for _, n := range c.Authors {
+		tag("AU", n.String())
+	}
+	for _, n := range c.Editors {
+		tag("ED", n.String())
+	}
+	tag("TI", c.FullTitle())
+	tag("T2", c.ContainerTitle)
+	tag("T3", c.Series)
+	tag("ET", c.Edition)
+	tag("PY", c.Year)
+	tag("PB", c.Publisher)
+	tag("CY", c.Place)
+	tag("M3", c.Genre)
+	tag("VL", c.Volume)
+	tag("IS", c.Issue)
+	if pages := strings.SplitN(c.Pages, "-", 2); pages[0] != "" {
+		tag("SP", pages[0])
+		if len(pages) == 2 {
+			tag("EP", pages[1])
+		}
+	}
+	for _, sn := range append(append([]string{}, c.Isbn...), c.Issn...) {
+		tag("SN", sn)
+	}
+	tag("DO", c.Doi)
+	tag("UR", c.Url)
+	tag("AB", c.Abstract)
+	for _, kw := range c.Keywords {
+		tag("KW", kw)
+	}
+	tag("LA", c.Language)
+	buf.WriteString("ER  - \r\n")
+	return buf.String()
+}
+
+// cslName is a name variable of a CSL-JSON item.
+type cslName struct {
+	Family  string `json:"family,omitempty"`
+	Given   string `json:"given,omitempty"`
+	Literal string `json:"literal,omitempty"`
+}
+
+// cslDate is a date variable of a CSL-JSON item.
+type cslDate struct {
+	DateParts [][]json.Number `json:"date-parts"`
+}
+
+// cslItem is a CSL-JSON item.
+type cslItem struct {
+	Id              string    `json:"id"`
+	Type            string    `json:"type"`
+	Author          []cslName `json:"author,omitempty"`
+	Editor          []cslName `json:"editor,omitempty"`
+	Title           string    `json:"title,omitempty"`
+	ContainerTitle  string    `json:"container-title,omitempty"`
+	CollectionTitle string    `json:"collection-title,omitempty"`
+	Edition         string    `json:"edition,omitempty"`
+	Publisher       string    `json:"publisher,omitempty"`
+	PublisherPlace  string    `json:"publisher-place,omitempty"`
+	Issued          *cslDate  `json:"issued,omitempty"`
+	Volume          string    `json:"volume,omitempty"`
+	Issue           string    `json:"issue,omitempty"`
+	Page            string    `json:"page,omitempty"`
+	Genre           string    `json:"genre,omitempty"`
+	Isbn            string    `json:"ISBN,omitempty"`
+	Issn            string    `json:"ISSN,omitempty"`
+	Doi             string    `json:"DOI,omitempty"`
+	Url             string    `json:"URL,omitempty"`
+	Abstract        string    `json:"abstract,omitempty"`
+	Keyword         string    `json:"keyword,omitempty"`
+	Language        string    `json:"language,omitempty"`
+}
+
+func cslNames(names []CitationName) []cslName {
+	var out []cslName
+	for _, n := range names {
+		out = append(out, cslName(n))
+	}
+	return out
+}
+
+// AsCslJson returns the citation as a CSL-JSON item.
+func (c Citation) AsCslJson() (string, error) {
+	item := cslItem{
+		Id:              c.Id,
+		Type:            c.Type,
+		Author:          cslNames(c.Authors),
+		Editor:          cslNames(c.Editors),
+		Title:           c.FullTitle(),
+		ContainerTitle:  c.ContainerTitle,
+		CollectionTitle: c.Series,
+		Edition:         c.Edition,
+		Publisher:       c.Publisher,
+		PublisherPlace:  c.Place,
+		Volume:          c.Volume,
+		Issue:           c.Issue,
+		Page:            c.Pages,
+		Genre:           c.Genre,
+		Isbn:            strings.Join(c.Isbn, " "),
+		Issn:            strings.Join(c.Issn, " "),
+		Doi:             c.Doi,
+		Url:             c.Url,
+		Abstract:        c.Abstract,
+		Keyword:         strings.Join(c.Keywords, ", "),
+		Language:        c.Language,
+	}
+	if item.Id == "" {
+		item.Id = c.Key()
+	}
+	if c.Year != "" {
+		item.Issued = &cslDate{DateParts: [][]json.Number{{json.Number(c.Year)}}}
+	}
+	b, err := json.Marshal(item)
+	return string(b), err
+}
+
+// RecordAsBibtex returns the record as a BibTeX entry.
+func (rec Record) RecordAsBibtex() (string, error) {
+	return rec.Citation().AsBibtex(), nil
+}
+
+// RecordAsRis returns the record as a RIS tagged record.
+func (rec Record) RecordAsRis() (string, error) {
+	return rec.Citation().AsRis(), nil
+}
+
+// RecordAsCslJson returns the record as a CSL-JSON item.
+func (rec Record) RecordAsCslJson() (string, error) {
+	return rec.Citation().AsCslJson()
+}
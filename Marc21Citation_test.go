@@ -0,0 +1,168 @@
+package gomarc21
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCitationFromFile(test *testing.T) {
+	data, err := os.Open("data/test_1a.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer data.Close()
+	rec, err := ParseNextRecord(data)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	c := rec.Citation()
+	if c.Type != CitationBook || c.Year != "1976" || c.Place != "Washington, D.C." {
+		test.Error("citation is wrong", c)
+	}
+	if len(c.Authors) != 2 || c.Authors[0] != (CitationName{Family: "Swanson", Given: "Vernon E."}) {
+		test.Error("authors are wrong", c.Authors)
+	}
+
+	bib := c.AsBibtex()
+	for _, want := range []string{"@book{swanson1976,", "author = {Swanson, Vernon E. and Huffman, Claude}", "year = {1976}"} {
+		if !strings.Contains(bib, want) {
+			test.Errorf("BibTeX does not contain %q:\n%s", want, bib)
+		}
+	}
+
+	ris := c.AsRis()
+	if !strings.HasPrefix(ris, "TY  - BOOK\r\n") || !strings.Contains(ris, "AU  - Huffman, Claude\r\n") || !strings.HasSuffix(ris, "ER  - \r\n") {
+		test.Error("RIS is wrong", ris)
+	}
+
+	str, err := c.AsCslJson()
+	if err != nil {
+		test.Fatal(err)
+	}
+	var item map[string]interface{}
+	if err := json.Unmarshal([]byte(str), &item); err != nil {
+		test.Fatal(err)
+	}
+	if item["id"] != "ocm57175940" || item["type"] != "book" || !strings.Contains(str, `"issued":{"date-parts":[[1976]]}`) {
+		test.Error("CSL-JSON is wrong", str)
+	}
+}
+
+func TestCitationTypes(test *testing.T) {
+	leader, err := NewLeader([]byte("00000naa a2200000 a 4500"))
+	if err != nil {
+		test.Fatal(err)
+	}
+	article := Record{Leader: leader, DataFields: []DataField{
+		{Tag: "100", Indicator1: "1", Indicator2: " ", SubFields: []SubField{{Code: "a", Data: "Doe, Jane,"}}},
+		{Tag: "245", Indicator1: "1", Indicator2: "0", SubFields: []SubField{{Code: "a", Data: "Fish & chips :"}, {Code: "b", Data: "a history."}}},
+		{Tag: "773", Indicator1: "0", Indicator2: " ", SubFields: []SubField{{Code: "t", Data: "Food journal."}, {Code: "g", Data: "Vol. 12, no. 3 (2001), p. 45-67"}, {Code: "x", Data: "1234-5679"}}},
+	}}
+	c := article.Citation()
+	if c.Type != CitationArticle || c.ContainerTitle != "Food journal" || c.Volume != "12" || c.Issue != "3" || c.Pages != "45-67" {
+		test.Error("article citation is wrong", c)
+	}
+	bib := c.AsBibtex()
+	if !strings.Contains(bib, "@article{doe") || !strings.Contains(bib, "title = {Fish \\& chips: a history}") || !strings.Contains(bib, "pages = {45--67}") {
+		test.Error("article BibTeX is wrong", bib)
+	}
+	if ris := c.AsRis(); !strings.Contains(ris, "TY  - JOUR") {
+		test.Error("article RIS is wrong", ris)
+	}
+
+	// a component part of a monograph, and of a serial told by 773 $7
+	chapter := Record{Leader: leader, DataFields: []DataField{
+		{Tag: "245", Indicator1: "1", Indicator2: "0", SubFields: []SubField{{Code: "a", Data: "A chapter."}}},
+		{Tag: "773", Indicator1: "0", Indicator2: " ", SubFields: []SubField{{Code: "7", Data: "p1am"}, {Code: "t", Data: "A book."}}},
+	}}
+	if c := chapter.Citation(); c.Type != CitationChapter {
+		test.Error("chapter type is wrong", c.Type)
+	}
+	chapter.DataFields[1].SubFields[0].Data = "p1as"
+	if c := chapter.Citation(); c.Type != CitationArticle {
+		test.Error("serial component part type is wrong", c.Type)
+	}
+
+	leader, _ = NewLeader([]byte("00000nam a2200000 a 4500"))
+	thesis := Record{Leader: leader, DataFields: []DataField{
+		{Tag: "245", Indicator1: "1", Indicator2: "0", SubFields: []SubField{{Code: "a", Data: "On theses."}}},
+		{Tag: "502", Indicator1: " ", Indicator2: " ", SubFields: []SubField{{Code: "a", Data: "Thesis (Ph. D.)--University of Toronto, 1998."}}},
+		{Tag: "710", Indicator1: "2", Indicator2: " ", SubFields: []SubField{{Code: "a", Data: "University of Toronto."}}},
+	}}
+	c = thesis.Citation()
+	if c.Type != CitationThesis || c.Genre != "Ph. D." || c.Publisher != "University of Toronto" || c.Year != "1998" {
+		test.Error("thesis citation is wrong", c)
+	}
+	if bib := c.AsBibtex(); !strings.HasPrefix(bib, "@thesis{universityoftoronto1998,") || !strings.Contains(bib, "author = {{University of Toronto}}") {
+		test.Error("thesis BibTeX is wrong", bib)
+	}
+}
+
+func TestWriterCslJson(test *testing.T) {
+	data, err := os.Open("data/test_10.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer data.Close()
+	recs := readAll(test, NewReader(data))
+
+	var buf strings.Builder
+	w, err := NewWriter(&buf, FormatCsl)
+	if err != nil {
+		test.Fatal(err)
+	}
+	for _, rec := range recs {
+		if err := w.Write(rec); err != nil {
+			test.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		test.Fatal(err)
+	}
+	var items []map[string]interface{}
+	if err := json.Unmarshal([]byte(buf.String()), &items); err != nil {
+		test.Fatal(err)
+	}
+	if len(items) != len(recs) {
+		test.Error("wrong number of CSL-JSON items", len(items))
+	}
+}
+
+func TestBibtexKeys(test *testing.T) {
+	data, err := os.Open("data/test_1a.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer data.Close()
+	rec, err := ParseNextRecord(data)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	var buf strings.Builder
+	writer, err := NewWriter(&buf, FormatBibtex)
+	if err != nil {
+		test.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := writer.Write(rec); err != nil {
+			test.Fatal(err)
+		}
+	}
+	for _, want := range []string{"@book{swanson1976,", "@book{swanson1976a,", "@book{swanson1976b,"} {
+		if strings.Count(buf.String(), want) != 1 {
+			test.Errorf("BibTeX does not contain %q once:\n%s", want, buf.String())
+		}
+	}
+	if keySuffix(26) != "z" || keySuffix(27) != "aa" {
+		test.Error("wrong key suffixes", keySuffix(26), keySuffix(27))
+	}
+
+	c := Citation{Type: CitationBook, Id: "u1", Url: `http://example.org/a%20b?q={x}\y#top`}
+	if bib := c.AsBibtex(); !strings.Contains(bib, `url = {http://example.org/a\%20b?q=\%7Bx\%7D\%5Cy\#top}`) {
+		test.Error("the url is not escaped", bib)
+	}
+}
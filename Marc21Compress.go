@@ -0,0 +1,184 @@
+package gomarc21
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+/*
+Compressed input is recognized by its magic bytes, so a .mrc.gz file
+renamed to .mrc still reads correctly. Compressed output is chosen from
+the file name extension:
+
+    .gz   gzip
+    .bz2  bzip2 (input only, the standard library has no bzip2 writer)
+    .zst  zstd
+*/
+
+const (
+	CompressionNone  = iota // not compressed
+	CompressionGzip         // gzip (RFC 1952)
+	CompressionBzip2        // bzip2
+	CompressionZstd         // zstd (RFC 8878)
+)
+
+// errBzip2Output is returned for bzip2 output, which the standard library
+// cannot write.
+var errBzip2Output = errors.New("bzip2 compressed output is not supported")
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// DetectCompression returns the compression of a stream from its first bytes.
+func DetectCompression(header []byte) int {
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		return CompressionGzip
+	case bytes.HasPrefix(header, bzip2Magic):
+		return CompressionBzip2
+	case bytes.HasPrefix(header, zstdMagic):
+		return CompressionZstd
+	}
+	return CompressionNone
+}
+
+// CompressionFromName returns the compression implied by the extension of
+// a file name.
+func CompressionFromName(name string) int {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".gz", ".gzip":
+		return CompressionGzip
+	case ".bz2":
+		return CompressionBzip2
+	case ".zst", ".zstd":
+		return CompressionZstd
+	}
+	return CompressionNone
+}
+
+// TrimCompressionExt returns a file name without its compression extension,
+// e.g. "records.mrc" for "records.mrc.gz".
+func TrimCompressionExt(name string) string {
+	if CompressionFromName(name) == CompressionNone {
+		return name
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// NewDecompressingReader returns a reader that decompresses the stream when
+// it starts with a known magic number, and otherwise passes it through.
+func NewDecompressingReader(reader io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(reader)
+	header, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch DetectCompression(header) {
+	case CompressionGzip:
+		return gzip.NewReader(br)
+	case CompressionBzip2:
+		return io.NopCloser(bzip2.NewReader(br)), nil
+	case CompressionZstd:
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}
+	return io.NopCloser(br), nil
+}
+
+// NewCompressingWriter returns a writer compressing into writer. Closing
+// it flushes the compressed stream but does not close writer.
+func NewCompressingWriter(writer io.Writer, compression int) (io.WriteCloser, error) {
+	switch compression {
+	case CompressionNone:
+		return nopWriteCloser{writer}, nil
+	case CompressionGzip:
+		return gzip.NewWriter(writer), nil
+	case CompressionZstd:
+		return zstd.NewWriter(writer)
+	case CompressionBzip2:
+		return nil, errBzip2Output
+	}
+	return nil, errors.New("unknown compression")
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// OpenFile opens a file for reading, decompressing it when needed.
+func OpenFile(name string) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewDecompressingReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileReadCloser{ReadCloser: r, file: f}, nil
+}
+
+type fileReadCloser struct {
+	io.ReadCloser
+	file *os.File
+}
+
+func (f *fileReadCloser) Close() error {
+	err := f.ReadCloser.Close()
+	if cerr := f.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// CreateFile creates a file for writing, compressing it according to the
+// extension of name.
+func CreateFile(name string) (io.WriteCloser, error) {
+	compression := CompressionFromName(name)
+	if compression == CompressionBzip2 {
+		return nil, errBzip2Output
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewCompressingWriter(f, compression)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileWriteCloser{WriteCloser: w, file: f}, nil
+}
+
+type fileWriteCloser struct {
+	io.WriteCloser
+	file *os.File
+}
+
+func (f *fileWriteCloser) Close() error {
+	err := f.WriteCloser.Close()
+	if cerr := f.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,83 @@
+package gomarc21
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompressedRoundTrip(test *testing.T) {
+	raw, err := os.ReadFile("data/test_10.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	for _, name := range []string{"out.mrc", "out.mrc.gz", "out.mrc.zst"} {
+		path := filepath.Join(test.TempDir(), name)
+		w, err := CreateFile(path)
+		if err != nil {
+			test.Fatal(err)
+		}
+		if _, err := w.Write(raw); err != nil {
+			test.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			test.Fatal(err)
+		}
+
+		header := make([]byte, 4)
+		f, _ := os.Open(path)
+		f.Read(header)
+		f.Close()
+		if DetectCompression(header) != CompressionFromName(name) {
+			test.Errorf("%s: detected compression %d, expected %d", name, DetectCompression(header), CompressionFromName(name))
+		}
+
+		r, err := OpenFile(path)
+		if err != nil {
+			test.Fatal(err)
+		}
+		count := 0
+		for {
+			_, err := ParseNextRecord(r)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				test.Fatal(name, err)
+			}
+			count++
+		}
+		r.Close()
+		if count != 10 {
+			test.Errorf("%s: should read 10 records, but got %d", name, count)
+		}
+	}
+}
+
+func TestBzip2Input(test *testing.T) {
+	// "hello\n" compressed by bzip2
+	compressed := []byte{
+		0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0xc1, 0xc0,
+		0x80, 0xe2, 0x00, 0x00, 0x01, 0x41, 0x00, 0x00, 0x10, 0x02, 0x44, 0xa0,
+		0x00, 0x30, 0xcd, 0x00, 0xc3, 0x46, 0x29, 0x97, 0x17, 0x72, 0x45, 0x38,
+		0x50, 0x90, 0xc1, 0xc0, 0x80, 0xe2,
+	}
+	r, err := NewDecompressingReader(bytes.NewReader(compressed))
+	if err != nil {
+		test.Fatal(err)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if string(b) != "hello\n" {
+		test.Errorf("got %q", b)
+	}
+
+	if _, err := CreateFile(filepath.Join(test.TempDir(), "out.mrc.bz2")); err == nil {
+		test.Error("bzip2 output should not be supported")
+	}
+}
@@ -61,6 +61,6 @@ func (cf ControlField) GetData() string {
 //
 //
 func (cf ControlField) AsJson() string {
-	jsonStr := fmt.Sprintf("{ \"%s\": \"%s\" }", cf.Tag, cf.Data)
+	jsonStr := fmt.Sprintf("{ %s: %s }", jsonString(string(cf.Tag)), jsonString(cf.Data))
 	return jsonStr
 }
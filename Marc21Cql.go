@@ -0,0 +1,312 @@
+package gomarc21
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+source: https://www.loc.gov/standards/sru/cql/spec.html
+
+    CQL, the Contextual Query Language, queries are search clauses
+    combined with boolean operators, left to right unless parenthesized:
+
+    dinosaur
+    dc.title = "the lost world" and dc.creator any "conan doyle"
+    (bath.isbn = 0123456789 or bath.issn = 1234-5678) not dc.subject = cats
+
+A search clause is an index, a relation and a term; a term alone
+searches cql.serverChoice with the = relation. Relations are =, ==, <>,
+<, >, <=, >= and the words any, all, adj and exact. The booleans are and,
+or and not; prox is parsed but not supported, nor are sort clauses and
+prefix assignments. Modifiers (/ignoreCase, ...) are parsed and ignored.
+Terms may contain the wildcards * and ?.
+*/
+
+// CQL and SRU diagnostic codes, see
+// https://www.loc.gov/standards/sru/diagnostics/diagnosticsList.html
+const (
+	CqlGeneralError          = 1
+	CqlUnsupportedOperation  = 4
+	CqlUnsupportedVersion    = 5
+	CqlUnsupportedParameter  = 6
+	CqlMandatoryParameter    = 7
+	CqlSyntaxError           = 10
+	CqlUnsupportedIndex      = 16
+	CqlUnsupportedRelation   = 19
+	CqlUnsupportedBoolean    = 37
+	CqlFirstRecordOutOfRange = 61
+	CqlUnknownSchema         = 66
+	CqlUnsupportedPacking    = 71
+	CqlSortNotSupported      = 80
+)
+
+const (
+	cqlDefaultIndex        = "cql.serverChoice"
+	cqlDefaultRelation     = "="
+	cqlAllRecordsIndex     = "cql.allRecords"
+	cqlDiagnosticUriPrefix = "info:srw/diagnostic/1/"
+	cqlRelationWords       = " any all adj exact within encloses "
+	cqlBooleanWords        = " and or not prox "
+	cqlRelationSymbols     = "=<>"
+)
+
+// CqlError is an error of a CQL query, with the code of its SRU
+// diagnostic.
+type CqlError struct {
+	Code    int
+	Details string
+	Message string
+}
+
+func (e *CqlError) Error() string {
+	if e.Details == "" {
+		return e.Message
+	}
+	return e.Message + ": " + e.Details
+}
+
+// Uri returns the URI of the SRU diagnostic of the error.
+func (e *CqlError) Uri() string {
+	return fmt.Sprintf("%s%d", cqlDiagnosticUriPrefix, e.Code)
+}
+
+// CqlQuery is a node of a parsed query: either a boolean of two queries
+// or a search clause.
+type CqlQuery struct {
+	Boolean string // and, or, not or prox; empty for a search clause
+	Left    *CqlQuery
+	Right   *CqlQuery
+
+	Index    string
+	Relation string
+	Term     string
+}
+
+// String returns the query in CQL, fully parenthesized.
+func (q *CqlQuery) String() string {
+	if q.Boolean != "" {
+		return "(" + q.Left.String() + " " + q.Boolean + " " + q.Right.String() + ")"
+	}
+	return q.Index + " " + q.Relation + " " + quoteCqlTerm(q.Term)
+}
+
+func quoteCqlTerm(term string) string {
+	if term != "" && !strings.ContainsAny(term, " \t()=<>/\"") {
+		return term
+	}
+	return `"` + strings.ReplaceAll(term, `"`, `\"`) + `"`
+}
+
+// cqlToken is a token of a query. Quoted strings are always terms.
+type cqlToken struct {
+	text   string
+	quoted bool
+}
+
+// cqlParser parses a query by recursive descent.
+type cqlParser struct {
+	tokens []cqlToken
+	pos    int
+}
+
+// ParseCql parses a CQL query. Its errors are *CqlError.
+func ParseCql(query string) (*CqlQuery, error) {
+	tokens, err := lexCql(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, &CqlError{Code: CqlSyntaxError, Message: "query syntax error", Details: "empty query"}
+	}
+	p := &cqlParser{tokens: tokens}
+	if p.peek().text == ">" {
+		return nil, p.syntaxError("prefix assignments are not supported")
+	}
+	q, err := p.parseQuery()
+	if err != nil {
+		return nil, err
+	}
+	if next := p.peek(); !next.quoted && strings.EqualFold(next.text, "sortby") {
+		return nil, &CqlError{Code: CqlSortNotSupported, Message: "sort not supported"}
+	}
+	if p.pos < len(p.tokens) {
+		return nil, p.syntaxError("unexpected " + p.tokens[p.pos].text)
+	}
+	return q, nil
+}
+
+// lexCql splits a query in tokens: parentheses, slashes, relation
+// symbols, words and quoted strings.
+func lexCql(query string) ([]cqlToken, error) {
+	var tokens []cqlToken
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == ' ' || r == '\t' || r == '\r' || r == '\n':
+			i++
+		case r == '(' || r == ')' || r == '/':
+			tokens = append(tokens, cqlToken{text: string(r)})
+			i++
+		case strings.ContainsRune(cqlRelationSymbols, r):
+			symbol := string(r)
+			if i+1 < len(runes) {
+				if two := string(runes[i : i+2]); two == "==" || two == "<>" || two == "<=" || two == ">=" {
+					symbol = two
+				}
+			}
+			tokens = append(tokens, cqlToken{text: symbol})
+			i += len([]rune(symbol))
+		case r == '"':
+			var b strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+					// escaped wildcards stay escaped
+					if runes[i] == '*' || runes[i] == '?' {
+						b.WriteRune('\\')
+					}
+				}
+				b.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, &CqlError{Code: CqlSyntaxError, Message: "query syntax error", Details: "unterminated string"}
+			}
+			i++
+			tokens = append(tokens, cqlToken{text: b.String(), quoted: true})
+		default:
+			start := i
+			for i < len(runes) && !strings.ContainsRune(" \t\r\n()/\"=<>", runes[i]) {
+				i++
+			}
+			tokens = append(tokens, cqlToken{text: string(runes[start:i])})
+		}
+	}
+	return tokens, nil
+}
+
+func (p *cqlParser) peek() cqlToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return cqlToken{}
+}
+
+func (p *cqlParser) syntaxError(details string) error {
+	return &CqlError{Code: CqlSyntaxError, Message: "query syntax error", Details: details}
+}
+
+// isWord tells whether the next token is the unquoted word of a list.
+func (p *cqlParser) isWord(words string) bool {
+	next := p.peek()
+	return !next.quoted && next.text != "" && strings.Contains(words, " "+strings.ToLower(next.text)+" ")
+}
+
+// isRelation tells whether the next token is a relation.
+func (p *cqlParser) isRelation() bool {
+	next := p.peek()
+	if next.quoted || next.text == "" {
+		return false
+	}
+	if strings.ContainsRune(cqlRelationSymbols, rune(next.text[0])) {
+		return true
+	}
+	// a relation word of a context set, e.g. cql.any
+	word := strings.ToLower(next.text)
+	if i := strings.LastIndex(word, "."); i >= 0 {
+		word = word[i+1:]
+	}
+	return strings.Contains(cqlRelationWords, " "+word+" ")
+}
+
+// skipModifiers skips the modifiers following a relation or a boolean.
+func (p *cqlParser) skipModifiers() error {
+	for p.peek().text == "/" && !p.peek().quoted {
+		p.pos++
+		name := p.peek()
+		if name.text == "" || name.quoted {
+			return p.syntaxError("missing modifier")
+		}
+		p.pos++
+		if p.isRelation() && strings.ContainsRune(cqlRelationSymbols, rune(p.peek().text[0])) {
+			p.pos++
+			if p.peek().text == "" {
+				return p.syntaxError("missing modifier value")
+			}
+			p.pos++
+		}
+	}
+	return nil
+}
+
+func (p *cqlParser) parseQuery() (*CqlQuery, error) {
+	left, err := p.parseClause()
+	if err != nil {
+		return nil, err
+	}
+	for p.isWord(cqlBooleanWords) {
+		op := strings.ToLower(p.peek().text)
+		p.pos++
+		if err := p.skipModifiers(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseClause()
+		if err != nil {
+			return nil, err
+		}
+		left = &CqlQuery{Boolean: op, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *cqlParser) parseClause() (*CqlQuery, error) {
+	next := p.peek()
+	if next.text == "(" && !next.quoted {
+		p.pos++
+		q, err := p.parseQuery()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().text != ")" || p.peek().quoted {
+			return nil, p.syntaxError("missing )")
+		}
+		p.pos++
+		return q, nil
+	}
+
+	first, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	if first.quoted || !p.isRelation() {
+		return &CqlQuery{Index: cqlDefaultIndex, Relation: cqlDefaultRelation, Term: first.text}, nil
+	}
+	relation := strings.ToLower(p.peek().text)
+	if i := strings.LastIndex(relation, "."); i >= 0 {
+		relation = relation[i+1:]
+	}
+	p.pos++
+	if err := p.skipModifiers(); err != nil {
+		return nil, err
+	}
+	term, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	return &CqlQuery{Index: first.text, Relation: relation, Term: term.text}, nil
+}
+
+// term reads an index or a search term.
+func (p *cqlParser) term() (cqlToken, error) {
+	next := p.peek()
+	if next.text == "" && !next.quoted {
+		return next, p.syntaxError("missing search term")
+	}
+	if !next.quoted && (strings.ContainsAny(next.text, "()/") || p.isRelation()) {
+		return next, p.syntaxError("unexpected " + next.text)
+	}
+	p.pos++
+	return next, nil
+}
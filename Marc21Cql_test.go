@@ -0,0 +1,62 @@
+package gomarc21
+
+import "testing"
+
+func TestParseCql(test *testing.T) {
+	tests := []struct {
+		query  string
+		parsed string
+	}{
+		{"dinosaur", "cql.serverChoice = dinosaur"},
+		{`"the lost world"`, `cql.serverChoice = "the lost world"`},
+		{"dc.title = cats", "dc.title = cats"},
+		{"dc.title=cats", "dc.title = cats"},
+		{"title any \"cats dogs\"", `title any "cats dogs"`},
+		{"dc.creator cql.all \"conan doyle\"", `dc.creator all "conan doyle"`},
+		{"bath.isbn == 0123456789", "bath.isbn == 0123456789"},
+		{"dc.date >= 2000", "dc.date >= 2000"},
+		{"dc.title <> cats", "dc.title <> cats"},
+		{"dc.title =/ignoreCase/relevant cats", "dc.title = cats"},
+		{"a and b or c", "((cql.serverChoice = a and cql.serverChoice = b) or cql.serverChoice = c)"},
+		{"a AND (b NOT c)", "(cql.serverChoice = a and (cql.serverChoice = b not cql.serverChoice = c))"},
+		{"a prox/distance=1 b", "(cql.serverChoice = a prox cql.serverChoice = b)"},
+		{`dc.title = "cat\*"`, `dc.title = cat\*`},
+		{`dc.title = "say \"hi\""`, `dc.title = "say \"hi\""`},
+		{"dc.title = cat*", "dc.title = cat*"},
+		{`"and"`, "cql.serverChoice = and"},
+	}
+	for _, t := range tests {
+		q, err := ParseCql(t.query)
+		if err != nil {
+			test.Errorf("%s: %s", t.query, err)
+			continue
+		}
+		if q.String() != t.parsed && "("+q.String()+")" != t.parsed {
+			test.Errorf("%s: expected %s, got %s", t.query, t.parsed, q)
+		}
+	}
+
+	for query, code := range map[string]int{
+		"":                    CqlSyntaxError,
+		"(a and b":            CqlSyntaxError,
+		"a and":               CqlSyntaxError,
+		"dc.title =":          CqlSyntaxError,
+		`dc.title = "cats`:    CqlSyntaxError,
+		"a b":                 CqlSyntaxError,
+		"a)":                  CqlSyntaxError,
+		"> dc = \"info:x\" a": CqlSyntaxError,
+		"a sortby dc.title":   CqlSortNotSupported,
+		"dc.title = cats / x": CqlSyntaxError,
+	} {
+		_, err := ParseCql(query)
+		cqlErr, ok := err.(*CqlError)
+		if !ok || cqlErr.Code != code {
+			test.Errorf("%q: expected diagnostic %d, got %v", query, code, err)
+		}
+	}
+
+	err := &CqlError{Code: CqlUnsupportedIndex, Message: "unsupported index", Details: "dc.x"}
+	if err.Uri() != "info:srw/diagnostic/1/16" || err.Error() != "unsupported index: dc.x" {
+		test.Error("wrong error", err.Uri(), err)
+	}
+}
@@ -138,6 +138,6 @@ func (df DataField) AsJson() string {
 	}
 	sfStr = sfStr[:len(sfStr)-1]
 	sfStr += "]"
-	jsonStr := fmt.Sprintf("{ \"%s\": { \"ind1\": \"%s\", \"ind2\": \"%s\", %s }  }", df.Tag, df.Indicator1, df.Indicator2, sfStr)
+	jsonStr := fmt.Sprintf("{ %s: { \"ind1\": %s, \"ind2\": %s, %s }  }", jsonString(string(df.Tag)), jsonString(df.Indicator1), jsonString(df.Indicator2), sfStr)
 	return jsonStr
 }
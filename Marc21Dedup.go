@@ -0,0 +1,341 @@
+package gomarc21
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/*
+Duplicate detection builds match keys from each record:
+
+    isbn   the valid ISBN of 020 $a as ISBN-13 (see Record.Isbns)
+    issn   the valid ISSN of 022 $a (see Record.Issns)
+    oclc   the OCLC numbers of 035 $a and 001 (see Record.OclcNumbers)
+    lccn   the valid LCCN of 010 $a (see Record.Lccns)
+    title  a fuzzy key made of the NACO normalized 245 $a$b$n$p without
+           its nonfiling characters, the surname of the main entry and the
+           year of publication
+
+A rule is a set of key kinds which must all match for two records to be
+duplicates, e.g. "isbn+title". Two records are in the same cluster when
+any of the rules matches them, directly or through other records.
+Rules are written separated by semicolons:
+
+    oclc;lccn;isbn;issn+title;title
+
+A rule made only of title keys does not cluster records whose identifiers
+conflict, that is when both have ISBNs, ISSNs, OCLC numbers or LCCNs and
+none of them are shared: they are different editions with the same title.
+*/
+
+// Match key kinds.
+const (
+	KeyIsbn  = "isbn"
+	KeyIssn  = "issn"
+	KeyOclc  = "oclc"
+	KeyLccn  = "lccn"
+	KeyTitle = "title"
+)
+
+// DefaultDedupRules are the rules used when none are given.
+const DefaultDedupRules = "oclc;lccn;isbn;issn+title;title"
+
+// identifierKinds are the key kinds which identify an edition.
+var identifierKinds = []string{KeyIsbn, KeyIssn, KeyOclc, KeyLccn}
+
+// encodingLevelRank orders the encoding levels (leader/17) from the most
+// to the least complete, OCLC levels included.
+var encodingLevelRank = map[byte]int{
+	' ': 0, '1': 1, 'I': 2, '4': 3, 'L': 4, '2': 5, 'K': 6, '7': 7,
+	'M': 8, '5': 9, '3': 10, '8': 11, 'J': 12, 'u': 13, 'z': 14,
+}
+
+// DedupCluster is a group of duplicate records, given by their position
+// in the order they were added.
+type DedupCluster struct {
+	Records []int    // positions of the records, in order
+	Winner  int      // position of the record to keep
+	Rules   []string // the rules which matched records of the cluster
+}
+
+// Deduplicator finds duplicate records.
+type Deduplicator struct {
+	Rules       [][]string
+	records     []Record
+	parent      []int
+	seen        map[string]int
+	matched     map[int]map[string]bool
+	identifiers []map[string]map[string]bool // the identifiers of each cluster by its root
+}
+
+// ParseDedupRules parses rules such as "oclc;isbn;issn+title".
+func ParseDedupRules(spec string) ([][]string, error) {
+	var rules [][]string
+	for _, rule := range strings.Split(spec, ";") {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+		var kinds []string
+		for _, kind := range strings.Split(rule, "+") {
+			kind = strings.ToLower(strings.TrimSpace(kind))
+			switch kind {
+			case KeyIsbn, KeyIssn, KeyOclc, KeyLccn, KeyTitle:
+				kinds = append(kinds, kind)
+			default:
+				return nil, fmt.Errorf("unknown match key %q", kind)
+			}
+		}
+		rules = append(rules, kinds)
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("no match rules in %q", spec)
+	}
+	return rules, nil
+}
+
+// NewDeduplicator returns a Deduplicator clustering records with rules.
+func NewDeduplicator(rules [][]string) *Deduplicator {
+	return &Deduplicator{Rules: rules, seen: map[string]int{}, matched: map[int]map[string]bool{}}
+}
+
+// MatchKeys returns the match keys of the record by kind.
+func (rec Record) MatchKeys() map[string][]string {
+	keys := map[string][]string{}
+	for kind, values := range map[string][]string{
+		KeyIsbn: rec.Isbns(),
+		KeyIssn: rec.Issns(),
+		KeyOclc: rec.OclcNumbers(),
+		KeyLccn: rec.Lccns(),
+	} {
+		if len(values) > 0 {
+			keys[kind] = values
+		}
+	}
+	if title := rec.titleKey(); title != "" {
+		keys[KeyTitle] = []string{title}
+	}
+	return keys
+}
+
+// titleKey returns the fuzzy title/author/date key of the record.
+func (rec Record) titleKey() string {
+	var title string
+	for _, df := range rec.GetDatafields("245") {
+		heading := DataField{Tag: df.Tag}
+		for _, sf := range df.GetSubFields("abnp") {
+			heading.SubFields = append(heading.SubFields, SubField{Code: "a", Data: sf.Data})
+		}
+		if len(heading.SubFields) > 0 {
+			data := []rune(heading.SubFields[0].Data)
+			if skip := int(df.GetIndicator2()[0] - '0'); skip > 0 && skip < 10 && skip < len(data) {
+				heading.SubFields[0].Data = string(data[skip:])
+			}
+		}
+		for _, sf := range heading.SubFields {
+			title += " " + NacoNormalize(sf.Data)
+		}
+		break
+	}
+	title = strings.Join(strings.Fields(title), " ")
+	if title == "" {
+		return ""
+	}
+	if runes := []rune(title); len(runes) > 40 {
+		title = string(runes[:40])
+	}
+
+	var author string
+	for _, df := range rec.GetDatafields("100,110,111") {
+		if words := strings.Fields(NacoNormalize(joinSubFields(df, "a", " "))); len(words) > 0 {
+			author = words[0]
+		}
+		break
+	}
+	return title + "/" + author + "/" + rec.Citation().Year
+}
+
+// ruleKeys returns the composite keys of a rule for the record: one per
+// combination of the values of its kinds.
+func ruleKeys(rule []string, keys map[string][]string) []string {
+	combined := []string{strings.Join(rule, "+")}
+	for _, kind := range rule {
+		var next []string
+		for _, prefix := range combined {
+			for _, v := range keys[kind] {
+				next = append(next, prefix+"\t"+v)
+			}
+		}
+		combined = next
+	}
+	return combined
+}
+
+// identifiersConflict tells if two sets of identifiers by kind have a kind
+// with values in both and none in common.
+func identifiersConflict(a, b map[string]map[string]bool) bool {
+	for _, kind := range identifierKinds {
+		if len(a[kind]) == 0 || len(b[kind]) == 0 {
+			continue
+		}
+		shared := false
+		for v := range a[kind] {
+			shared = shared || b[kind][v]
+		}
+		if !shared {
+			return true
+		}
+	}
+	return false
+}
+
+// titleOnly tells if a rule is made only of title keys.
+func titleOnly(rule []string) bool {
+	for _, kind := range rule {
+		if kind != KeyTitle {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *Deduplicator) find(i int) int {
+	for d.parent[i] != i {
+		d.parent[i] = d.parent[d.parent[i]]
+		i = d.parent[i]
+	}
+	return d.parent[i]
+}
+
+// Add adds a record and clusters it with the records added before.
+func (d *Deduplicator) Add(rec Record) {
+	pos := len(d.records)
+	d.records = append(d.records, rec)
+	d.parent = append(d.parent, pos)
+
+	keys := rec.MatchKeys()
+	identifiers := map[string]map[string]bool{}
+	for _, kind := range identifierKinds {
+		for _, v := range keys[kind] {
+			if identifiers[kind] == nil {
+				identifiers[kind] = map[string]bool{}
+			}
+			identifiers[kind][v] = true
+		}
+	}
+	d.identifiers = append(d.identifiers, identifiers)
+
+	for _, rule := range d.Rules {
+		for _, key := range ruleKeys(rule, keys) {
+			other, ok := d.seen[key]
+			if !ok {
+				d.seen[key] = pos
+				continue
+			}
+			a, b := d.find(other), d.find(pos)
+			if a != b {
+				if titleOnly(rule) && identifiersConflict(d.identifiers[a], d.identifiers[b]) {
+					continue
+				}
+				d.parent[b] = a
+				for kind, values := range d.identifiers[b] {
+					if d.identifiers[a][kind] == nil {
+						d.identifiers[a][kind] = map[string]bool{}
+					}
+					for v := range values {
+						d.identifiers[a][kind][v] = true
+					}
+				}
+			}
+			name := strings.Join(rule, "+")
+			for _, p := range []int{other, pos} {
+				if d.matched[p] == nil {
+					d.matched[p] = map[string]bool{}
+				}
+				d.matched[p][name] = true
+			}
+		}
+	}
+}
+
+// Records returns the records added so far.
+func (d *Deduplicator) Records() []Record {
+	return d.records
+}
+
+// better reports whether record i should be kept rather than record j: a
+// more complete encoding level first, then more fields, then the first
+// one.
+func (d *Deduplicator) better(i, j int) bool {
+	a, b := d.records[i], d.records[j]
+	rankA, okA := encodingLevelRank[a.Leader.EncodingLevel]
+	rankB, okB := encodingLevelRank[b.Leader.EncodingLevel]
+	if !okA {
+		rankA = len(encodingLevelRank)
+	}
+	if !okB {
+		rankB = len(encodingLevelRank)
+	}
+	if rankA != rankB {
+		return rankA < rankB
+	}
+	fieldsA := len(a.ControlFields) + len(a.DataFields)
+	fieldsB := len(b.ControlFields) + len(b.DataFields)
+	if fieldsA != fieldsB {
+		return fieldsA > fieldsB
+	}
+	return i < j
+}
+
+// Clusters returns the clusters of more than one record, in the order of
+// their first record.
+func (d *Deduplicator) Clusters() []DedupCluster {
+	byRoot := map[int]*DedupCluster{}
+	var roots []int
+	for i := range d.records {
+		root := d.find(i)
+		c, ok := byRoot[root]
+		if !ok {
+			c = &DedupCluster{Winner: i}
+			byRoot[root] = c
+			roots = append(roots, root)
+		}
+		c.Records = append(c.Records, i)
+		if d.better(i, c.Winner) {
+			c.Winner = i
+		}
+		for rule := range d.matched[i] {
+			c.Rules = appendValue(c.Rules, rule)
+		}
+	}
+
+	var clusters []DedupCluster
+	for _, root := range roots {
+		if c := byRoot[root]; len(c.Records) > 1 {
+			sort.Strings(c.Rules)
+			clusters = append(clusters, *c)
+		}
+	}
+	return clusters
+}
+
+// Unique returns the records without their duplicates: the winner of each
+// cluster and the records without duplicates, in the order they were
+// added.
+func (d *Deduplicator) Unique() []Record {
+	losers := map[int]bool{}
+	for _, c := range d.Clusters() {
+		for _, i := range c.Records {
+			if i != c.Winner {
+				losers[i] = true
+			}
+		}
+	}
+	var unique []Record
+	for i, rec := range d.records {
+		if !losers[i] {
+			unique = append(unique, rec)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,151 @@
+package gomarc21
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func dedupRecord(id string, encodingLevel byte, fields ...DataField) Record {
+	leader, _ := NewLeader([]byte("00000nam a2200000 a 4500"))
+	leader.EncodingLevel = encodingLevel
+	return Record{Leader: leader, ControlFields: []ControlField{{Tag: "001", Data: id}}, DataFields: fields}
+}
+
+func dedupField(tag Tag, ind2 string, subfields ...string) DataField {
+	df := DataField{Tag: tag, Indicator1: " ", Indicator2: ind2}
+	for i := 0; i+1 < len(subfields); i += 2 {
+		df.SubFields = append(df.SubFields, SubField{Code: subfields[i], Data: subfields[i+1]})
+	}
+	return df
+}
+
+func TestMatchKeys(test *testing.T) {
+	rec := dedupRecord("ocm00012345", ' ',
+		dedupField("010", " ", "a", "  85-2 "),
+		dedupField("020", " ", "a", "0-306-40615-2 (pbk.)"),
+		dedupField("022", " ", "a", "0317-8471"),
+		dedupField("035", " ", "a", "(OCoLC)ocn000987654"),
+		dedupField("100", " ", "a", "Smith, John,", "d", "1950-"),
+		dedupField("245", "4", "a", "The Grapes of wrath :", "b", "a novel /", "c", "John Smith."),
+		dedupField("264", "1", "c", "c1999."),
+	)
+	keys := rec.MatchKeys()
+	expected := map[string]string{
+		KeyIsbn:  "9780306406157",
+		KeyIssn:  "03178471",
+		KeyLccn:  "85000002",
+		KeyTitle: "GRAPES OF WRATH A NOVEL/SMITH/1999",
+	}
+	for kind, value := range expected {
+		if len(keys[kind]) != 1 || keys[kind][0] != value {
+			test.Errorf("%s key: expected %q, got %q", kind, value, keys[kind])
+		}
+	}
+	if len(keys[KeyOclc]) != 2 || keys[KeyOclc][0] != "987654" || keys[KeyOclc][1] != "12345" {
+		test.Error("oclc keys are wrong", keys[KeyOclc])
+	}
+}
+
+func TestTitleKeyRunes(test *testing.T) {
+	rec := dedupRecord("a", ' ',
+		dedupField("245", "2", "a", "L’été acadien : une très longue histoire des années quatre-vingt."),
+	)
+	key := rec.titleKey()
+	if !utf8.ValidString(key) || !strings.HasPrefix(key, "ETE ACADIEN") {
+		test.Error("title key is wrong", key)
+	}
+	if title := strings.Split(key, "/")[0]; utf8.RuneCountInString(title) != 40 {
+		test.Error("title key is not cut at 40 characters", title)
+	}
+}
+
+func TestDeduplicator(test *testing.T) {
+	records := []Record{
+		dedupRecord("a", '5', dedupField("020", " ", "a", "0306406152"), dedupField("245", "0", "a", "Signals.")),
+		dedupRecord("b", ' ', dedupField("020", " ", "a", "978-0-306-40615-7"), dedupField("245", "0", "a", "Signals")),
+		dedupRecord("c", ' ', dedupField("245", "0", "a", "Noise")),
+		dedupRecord("d", ' ', dedupField("245", "0", "a", "Noise"), dedupField("500", " ", "a", "A note.")),
+		dedupRecord("e", ' ', dedupField("245", "0", "a", "Quiet")),
+	}
+
+	rules, err := ParseDedupRules(DefaultDedupRules)
+	if err != nil {
+		test.Fatal(err)
+	}
+	dedup := NewDeduplicator(rules)
+	for _, rec := range records {
+		dedup.Add(rec)
+	}
+	clusters := dedup.Clusters()
+	if len(clusters) != 2 {
+		test.Fatal("wrong number of clusters", clusters)
+	}
+	// the full level record wins over the preliminary one
+	if len(clusters[0].Records) != 2 || clusters[0].Winner != 1 {
+		test.Error("first cluster is wrong", clusters[0])
+	}
+	if len(clusters[0].Rules) != 2 || clusters[0].Rules[0] != "isbn" || clusters[0].Rules[1] != "title" {
+		test.Error("rules of the first cluster are wrong", clusters[0].Rules)
+	}
+	// at the same level the record with more fields wins
+	if clusters[1].Winner != 3 {
+		test.Error("second cluster is wrong", clusters[1])
+	}
+
+	unique := dedup.Unique()
+	var ids []string
+	for _, rec := range unique {
+		ids = append(ids, rec.ControlNum())
+	}
+	if len(ids) != 3 || ids[0] != "b" || ids[1] != "d" || ids[2] != "e" {
+		test.Error("unique records are wrong", ids)
+	}
+
+	// without the title key only the ISBN matches
+	dedup = NewDeduplicator([][]string{{KeyIsbn}})
+	for _, rec := range records {
+		dedup.Add(rec)
+	}
+	if clusters := dedup.Clusters(); len(clusters) != 1 || clusters[0].Rules[0] != "isbn" {
+		test.Error("isbn clusters are wrong", clusters)
+	}
+
+	// the same title with conflicting ISBNs are different editions
+	dedup = NewDeduplicator(rules)
+	for _, rec := range []Record{
+		dedupRecord("f", ' ', dedupField("020", " ", "a", "0306406152"), dedupField("245", "0", "a", "Signals")),
+		dedupRecord("g", ' ', dedupField("020", " ", "a", "0-19-852663-6"), dedupField("245", "0", "a", "Signals")),
+		dedupRecord("h", ' ', dedupField("245", "0", "a", "Signals")),
+	} {
+		dedup.Add(rec)
+	}
+	if clusters := dedup.Clusters(); len(clusters) != 1 || len(clusters[0].Records) != 2 || clusters[0].Records[1] != 2 {
+		test.Error("editions were clustered", clusters)
+	}
+
+	if _, err := ParseDedupRules("isbn+author"); err == nil {
+		test.Error("unknown key should not parse")
+	}
+}
+
+func TestDeduplicatorFile(test *testing.T) {
+	file, err := OpenFile("data/test_10.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer file.Close()
+
+	dedup := NewDeduplicator([][]string{{KeyOclc}})
+	records := readAll(test, NewReader(file))
+	for _, rec := range append(records, records[0]) {
+		dedup.Add(rec)
+	}
+	clusters := dedup.Clusters()
+	if len(clusters) != 1 || len(clusters[0].Records) != 2 || clusters[0].Records[1] != len(records) {
+		test.Error("the repeated record was not found", clusters)
+	}
+	if len(dedup.Unique()) != len(records) {
+		test.Error("wrong number of unique records", len(dedup.Unique()))
+	}
+}
@@ -0,0 +1,49 @@
+package gomarc21
+
+import (
+	"strings"
+)
+
+// DiffRecords compares two records field by field in mnemonic form and
+// returns the lines which differ, prefixed with "- " when they are only
+// in a and "+ " when they are only in b, in record order. Records which
+// are the same give no lines.
+func DiffRecords(a Record, b Record) []string {
+	before := strings.Split(strings.TrimSuffix(a.GetMrk(), "\n"), "\n")
+	after := strings.Split(strings.TrimSuffix(b.GetMrk(), "\n"), "\n")
+
+	// longest common subsequence of the lines, from the end
+	common := make([][]int, len(before)+1)
+	for i := range common {
+		common[i] = make([]int, len(after)+1)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			switch {
+			case before[i] == after[j]:
+				common[i][j] = common[i+1][j+1] + 1
+			case common[i+1][j] >= common[i][j+1]:
+				common[i][j] = common[i+1][j]
+			default:
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	var lines []string
+	i, j := 0, 0
+	for i < len(before) || j < len(after) {
+		switch {
+		case i < len(before) && j < len(after) && before[i] == after[j]:
+			i++
+			j++
+		case j == len(after) || (i < len(before) && common[i+1][j] >= common[i][j+1]):
+			lines = append(lines, "- "+before[i])
+			i++
+		default:
+			lines = append(lines, "+ "+after[j])
+			j++
+		}
+	}
+	return lines
+}
@@ -0,0 +1,32 @@
+package gomarc21
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffRecords(test *testing.T) {
+	a := Record{
+		ControlFields: []ControlField{{Tag: "001", Data: "1"}},
+		DataFields: []DataField{
+			{Tag: "245", Indicator1: "1", Indicator2: "0", SubFields: []SubField{{Code: "a", Data: "A title."}}},
+			{Tag: "500", Indicator1: " ", Indicator2: " ", SubFields: []SubField{{Code: "a", Data: "A note."}}},
+		},
+	}
+	if diff := DiffRecords(a, a.Clone()); len(diff) != 0 {
+		test.Error("the same records differ", diff)
+	}
+
+	b := a.Clone()
+	b.DataFields[0].SubFields[0].Data = "Another title."
+	b.AddDataField(DataField{Tag: "650", Indicator1: " ", Indicator2: "0", SubFields: []SubField{{Code: "a", Data: "Cats."}}})
+	diff := DiffRecords(a, b)
+	expected := []string{
+		"- =245  10$aA title.",
+		"+ =245  10$aAnother title.",
+		"+ =650  \\0$aCats.",
+	}
+	if strings.Join(diff, "\n") != strings.Join(expected, "\n") {
+		test.Errorf("expected %q, got %q", expected, diff)
+	}
+}
@@ -0,0 +1,312 @@
+package gomarc21
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+)
+
+/*
+source: https://www.loc.gov/marc/marc2dc.html
+
+    MARC to Dublin Core Crosswalk (unqualified)
+
+    Title        245 $a$b$f$g$h$k$n$p$s
+    Creator      100, 110, 111
+    Contributor  700, 710, 711, 720
+    Subject      600, 610, 611, 630, 650, 653
+    Description  500-599, except 506, 530, 540, 546
+    Publisher    260 $a$b, 264 $a$b
+    Date         260 $c, 264 $c
+    Type         Leader/06, 655
+    Format       856 $q
+    Identifier   020 $a, 022 $a, 024 $a, 856 $u
+    Source       534 $t, 786 $o$t
+    Language     008/35-37, 041 $a$b$d$e$f$g$h$j
+    Relation     530, 760-787 $o$t
+    Coverage     651, 752
+    Rights       506, 540
+*/
+
+const (
+	OaiDcNamespace = "http://www.openarchives.org/OAI/2.0/oai_dc/"
+	DcNamespace    = "http://purl.org/dc/elements/1.1/"
+	OaiDcSchema    = "http://www.openarchives.org/OAI/2.0/oai_dc.xsd"
+)
+
+// DublinCore holds the fifteen unqualified Dublin Core elements.
+type DublinCore struct {
+	Title       []string `json:"title,omitempty"`
+	Creator     []string `json:"creator,omitempty"`
+	Contributor []string `json:"contributor,omitempty"`
+	Subject     []string `json:"subject,omitempty"`
+	Description []string `json:"description,omitempty"`
+	Publisher   []string `json:"publisher,omitempty"`
+	Date        []string `json:"date,omitempty"`
+	Type        []string `json:"type,omitempty"`
+	Format      []string `json:"format,omitempty"`
+	Identifier  []string `json:"identifier,omitempty"`
+	Source      []string `json:"source,omitempty"`
+	Language    []string `json:"language,omitempty"`
+	Relation    []string `json:"relation,omitempty"`
+	Coverage    []string `json:"coverage,omitempty"`
+	Rights      []string `json:"rights,omitempty"`
+}
+
+// dcTypes maps leader/06 to the DCMI type vocabulary.
+var dcTypes = map[byte]string{
+	'a': "Text",
+	'c': "Text",
+	'd': "Text",
+	'e': "Image",
+	'f': "Image",
+	'g': "Image",
+	'i': "Sound",
+	'j': "Sound",
+	'k': "Image",
+	'm': "Software",
+	'o': "Collection",
+	'p': "Collection",
+	'r': "PhysicalObject",
+	't': "Text",
+}
+
+// DublinCore maps the record to Dublin Core following the LC crosswalk.
+func (rec Record) DublinCore() DublinCore {
+	dc := DublinCore{}
+
+	for _, df := range rec.GetDatafields("245") {
+		dc.Title = appendValue(dc.Title, joinSubFields(df, "abfghknps", " "))
+	}
+	for _, df := range rec.GetDatafields("100,110,111") {
+		dc.Creator = appendValue(dc.Creator, joinSubFields(df, "abcdq", " "))
+	}
+	for _, df := range rec.GetDatafields("700,710,711,720") {
+		dc.Contributor = appendValue(dc.Contributor, joinSubFields(df, "abcdq", " "))
+	}
+	for _, df := range rec.GetDatafields("600,610,611,630,650,653") {
+		dc.Subject = appendValue(dc.Subject, subjectString(df))
+	}
+	for _, df := range rec.DataFields {
+		tag := df.Tag.GetTag()
+		if tag >= "500" && tag <= "599" && tag != "506" && tag != "530" && tag != "540" && tag != "546" {
+			dc.Description = appendValue(dc.Description, joinSubFields(df, "a", " "))
+		}
+	}
+	for _, df := range rec.GetDatafields("260,264") {
+		dc.Publisher = appendValue(dc.Publisher, joinSubFields(df, "ab", " "))
+		dc.Date = appendValue(dc.Date, joinSubFields(df, "c", " "))
+	}
+
+	if t, ok := dcTypes[rec.Leader.TypeOfRecord]; ok {
+		dc.Type = append(dc.Type, t)
+	}
+	for _, df := range rec.GetDatafields("655") {
+		dc.Type = appendValue(dc.Type, subjectString(df))
+	}
+
+	for _, df := range rec.GetDatafields("856") {
+		dc.Format = appendValue(dc.Format, joinSubFields(df, "q", " "))
+	}
+	for _, df := range rec.GetDatafields("020,022,024") {
+		dc.Identifier = appendValue(dc.Identifier, joinSubFields(df, "a", " "))
+	}
+	for _, df := range rec.GetDatafields("856") {
+		for _, sf := range df.GetSubFields("u") {
+			dc.Identifier = appendValue(dc.Identifier, sf.Data)
+		}
+	}
+
+	for _, df := range rec.GetDatafields("534") {
+		dc.Source = appendValue(dc.Source, joinSubFields(df, "t", " "))
+	}
+	for _, df := range rec.GetDatafields("786") {
+		dc.Source = appendValue(dc.Source, joinSubFields(df, "ot", " "))
+	}
+
+	if lang := rec.languageCode(); lang != "" {
+		dc.Language = append(dc.Language, lang)
+	}
+	for _, df := range rec.GetDatafields("041") {
+		for _, sf := range df.GetSubFields("abdefghj") {
+			dc.Language = appendValue(dc.Language, sf.Data)
+		}
+	}
+
+	for _, df := range rec.GetDatafields("530") {
+		dc.Relation = appendValue(dc.Relation, joinSubFields(df, "a", " "))
+	}
+	for _, df := range rec.DataFields {
+		tag := df.Tag.GetTag()
+		if tag >= "760" && tag <= "787" {
+			dc.Relation = appendValue(dc.Relation, joinSubFields(df, "ot", " "))
+		}
+	}
+
+	for _, df := range rec.GetDatafields("651") {
+		dc.Coverage = appendValue(dc.Coverage, subjectString(df))
+	}
+	for _, df := range rec.GetDatafields("752") {
+		dc.Coverage = appendValue(dc.Coverage, joinSubFields(df, "abcd", "--"))
+	}
+
+	for _, df := range rec.GetDatafields("506,540") {
+		dc.Rights = appendValue(dc.Rights, joinSubFields(df, "a", " "))
+	}
+
+	return dc
+}
+
+// languageCode returns the language code in 008/35-37 of a bibliographic
+// record, or an empty string when it is blank or undetermined.
+func (rec Record) languageCode() string {
+	if !isBibliographic(rec.Leader.TypeOfRecord) {
+		return ""
+	}
+	for _, cf := range rec.ControlFields {
+		if cf.Tag.GetTag() == "008" && len(cf.Data) >= 38 {
+			lang := strings.TrimSpace(cf.Data[35:38])
+			if lang != "" && lang != "|||" {
+				return lang
+			}
+		}
+	}
+	return ""
+}
+
+// joinSubFields joins the data of the subfields of a field with the given
+// codes, in field order, and removes the trailing ISBD punctuation.
+func joinSubFields(df DataField, codes string, sep string) string {
+	var values []string
+	for _, sf := range df.GetSubFields(codes) {
+		if v := strings.TrimSpace(sf.Data); v != "" {
+			values = append(values, v)
+		}
+	}
+	return chopPunctuation(strings.Join(values, sep))
+}
+
+// subjectString renders a subject heading with its subdivisions
+// ($v, $x, $y, $z) separated by "--".
+func subjectString(df DataField) string {
+	var parts []string
+	var main []string
+	for _, sf := range df.SubFields {
+		if strings.Contains("vxyz", sf.Code) {
+			parts = append(parts, chopPunctuation(sf.Data))
+		} else if strings.Contains("abcdfgklmnopqrst", sf.Code) {
+			main = append(main, strings.TrimSpace(sf.Data))
+		}
+	}
+	heading := chopPunctuation(strings.Join(main, " "))
+	if heading == "" {
+		return strings.Join(parts, "--")
+	}
+	return strings.Join(append([]string{heading}, parts...), "--")
+}
+
+// chopPunctuation removes the trailing ISBD punctuation (" /", " :", " ;",
+// ",", ".") left over from the cataloguing of a value.
+func chopPunctuation(s string) string {
+	s = strings.TrimSpace(s)
+	for len(s) > 0 {
+		last := s[len(s)-1]
+		if strings.IndexByte(" ,;:/=", last) >= 0 {
+			s = strings.TrimSpace(s[:len(s)-1])
+			continue
+		}
+		if last == '.' && !keepPeriod(s) {
+			s = strings.TrimSpace(s[:len(s)-1])
+			continue
+		}
+		break
+	}
+	return s
+}
+
+// keepPeriod reports whether the final period of s belongs to an ellipsis
+// or to a single letter initial or abbreviation such as "Vernon E." or
+// "D.C.".
+func keepPeriod(s string) bool {
+	if strings.HasSuffix(s, "...") {
+		return true
+	}
+	n := len(s)
+	return n == 2 || (n >= 3 && (s[n-3] == ' ' || s[n-3] == '.'))
+}
+
+func appendValue(values []string, value string) []string {
+	if value == "" {
+		return values
+	}
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// elements returns the element names and values in the order of the
+// oai_dc schema.
+func (dc DublinCore) elements() []struct {
+	name   string
+	values []string
+} {
+	return []struct {
+		name   string
+		values []string
+	}{
+		{"title", dc.Title},
+		{"creator", dc.Creator},
+		{"subject", dc.Subject},
+		{"description", dc.Description},
+		{"publisher", dc.Publisher},
+		{"contributor", dc.Contributor},
+		{"date", dc.Date},
+		{"type", dc.Type},
+		{"format", dc.Format},
+		{"identifier", dc.Identifier},
+		{"source", dc.Source},
+		{"language", dc.Language},
+		{"relation", dc.Relation},
+		{"coverage", dc.Coverage},
+		{"rights", dc.Rights},
+	}
+}
+
+// AsXml returns the record as an oai_dc:dc element.
+func (dc DublinCore) AsXml() (string, error) {
+	var buf bytes.Buffer
+	buf.WriteString(`<oai_dc:dc xmlns:oai_dc="` + OaiDcNamespace + `" xmlns:dc="` + DcNamespace +
+		`" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="` +
+		OaiDcNamespace + " " + OaiDcSchema + `">`)
+	for _, e := range dc.elements() {
+		for _, v := range e.values {
+			buf.WriteString("<dc:" + e.name + ">")
+			if err := xml.EscapeText(&buf, []byte(v)); err != nil {
+				return "", err
+			}
+			buf.WriteString("</dc:" + e.name + ">")
+		}
+	}
+	buf.WriteString("</oai_dc:dc>")
+	return buf.String(), nil
+}
+
+// AsJson returns the record as a JSON object keyed by element name.
+func (dc DublinCore) AsJson() (string, error) {
+	b, err := json.Marshal(dc)
+	return string(b), err
+}
+
+// RecordAsDcXml returns the record in Dublin Core as an oai_dc:dc element.
+func (rec Record) RecordAsDcXml() (string, error) {
+	return rec.DublinCore().AsXml()
+}
+
+// RecordAsDcJson returns the record in Dublin Core as a JSON object.
+func (rec Record) RecordAsDcJson() (string, error) {
+	return rec.DublinCore().AsJson()
+}
@@ -0,0 +1,78 @@
+package gomarc21
+
+import (
+	"encoding/xml"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDublinCore(test *testing.T) {
+	data, err := os.Open("data/test_1a.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer data.Close()
+	rec, err := ParseNextRecord(data)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dc := rec.DublinCore()
+	expected := DublinCore{
+		Title:       []string{"Guidelines for sample collecting and analytical methods used in the U.S. Geological Survey for determining chemical composition of coal [electronic resource]"},
+		Creator:     []string{"Swanson, Vernon E. (Vernon Emmanuel), 1922-1992"},
+		Contributor: []string{"Huffman, Claude"},
+		Subject:     []string{"Coal--Analysis", "Coal--Sampling"},
+		Description: []string{
+			"Title from title screen (viewed on Dec. 06, 2004)",
+			"Includes bibliographical references",
+			"Mode of access: Internet from the USGS Web site. Address as of 12/06/04: http://pubs.usgs.gov/circ/c735/index.htm; current access is available via PURL",
+		},
+		Publisher:  []string{"[Washington, D.C.] : U.S. Dept. of the Interior, U.S. Geological Survey"},
+		Date:       []string{"1976"},
+		Type:       []string{"Text"},
+		Identifier: []string{"http://purl.access.gpo.gov/GPO/LPS56007"},
+		Language:   []string{"eng"},
+		Relation:   []string{"Guidelines for sample collecting and analytical methods used in the U.S. Geological Survey for determining chemical composition of coal"},
+	}
+	if !reflect.DeepEqual(dc, expected) {
+		test.Errorf("got\n%#v\nexpected\n%#v", dc, expected)
+	}
+
+	str, err := rec.RecordAsDcXml()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if err := xml.Unmarshal([]byte(str), new(interface{})); err != nil {
+		test.Error("oai_dc output is not well formed", err)
+	}
+	if !strings.HasPrefix(str, "<oai_dc:dc ") || !strings.Contains(str, "<dc:date>1976</dc:date>") {
+		test.Error("oai_dc output is wrong", str)
+	}
+
+	str, err = rec.RecordAsDcJson()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if !strings.Contains(str, `"date":["1976"]`) {
+		test.Error("json output is wrong", str)
+	}
+}
+
+func TestChopPunctuation(test *testing.T) {
+	values := map[string]string{
+		"Coal /":             "Coal",
+		"1976.":              "1976",
+		"Swanson, Vernon E.": "Swanson, Vernon E.",
+		"To be continued...": "To be continued...",
+		"Washington, D.C. :": "Washington, D.C.",
+		"Huffman, Claude.":   "Huffman, Claude",
+	}
+	for in, out := range values {
+		if chopPunctuation(in) != out {
+			test.Errorf("%q should be %q, but got %q", in, out, chopPunctuation(in))
+		}
+	}
+}
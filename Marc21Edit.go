@@ -0,0 +1,389 @@
+package gomarc21
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+Edit rules describe recurring changes to records, in YAML or JSON:
+
+    rules:
+      - name: delete the local fields
+        action: delete_field
+        field: 9..
+      - name: add our code to the 040
+        unless: 040$d{=\XYZ}
+        action: add_subfield
+        field: 040
+        code: d
+        value: XYZ
+      - action: regex_replace
+        field: 856$z
+        pattern: (?i)^click here.*
+        replacement: Online version
+      - action: copy_001_to_035
+        prefix: (XYZ)
+
+The fields are selected with specs (see Spec). A rule applies to a record
+when its when spec, if any, selects something and its unless spec, if
+any, selects nothing. The actions are:
+
+    add_field       add value, a field in mnemonic form ("=500  \\$aNote.")
+    add_subfield    add the subfield code with value to the fields
+    delete_field    delete the fields
+    replace_field   replace the fields with value, in mnemonic form
+    set_indicator   set the indicator (1 or 2) of the fields to value
+    regex_replace   replace pattern with replacement in the subfields of
+                    the spec (all when none) or in the control fields;
+                    replacement may refer to groups as $1
+    move_subfield   move the subfields of the spec to to: another code of
+                    the same field ($k), or the first field with another
+                    tag (500 or 500$a), added when there is none
+    copy_001_to_035 add the 001 to a 035 $a, prefixed with prefix or with
+                    the 003 in parentheses, unless it is already there
+*/
+
+// Edit actions.
+const (
+	EditAddField       = "add_field"
+	EditAddSubField    = "add_subfield"
+	EditDeleteField    = "delete_field"
+	EditReplaceField   = "replace_field"
+	EditSetIndicator   = "set_indicator"
+	EditRegexReplace   = "regex_replace"
+	EditMoveSubField   = "move_subfield"
+	EditCopyControlNum = "copy_001_to_035"
+)
+
+// EditRule is a rule of a rule file.
+type EditRule struct {
+	Name        string `json:"name,omitempty" yaml:"name,omitempty"`
+	When        string `json:"when,omitempty" yaml:"when,omitempty"`
+	Unless      string `json:"unless,omitempty" yaml:"unless,omitempty"`
+	Action      string `json:"action" yaml:"action"`
+	Field       string `json:"field,omitempty" yaml:"field,omitempty"`
+	Value       string `json:"value,omitempty" yaml:"value,omitempty"`
+	Code        string `json:"code,omitempty" yaml:"code,omitempty"`
+	Indicator   int    `json:"indicator,omitempty" yaml:"indicator,omitempty"`
+	Pattern     string `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	Replacement string `json:"replacement,omitempty" yaml:"replacement,omitempty"`
+	To          string `json:"to,omitempty" yaml:"to,omitempty"`
+	Prefix      string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+}
+
+// EditRules is the content of a rule file.
+type EditRules struct {
+	Rules []EditRule `json:"rules" yaml:"rules"`
+}
+
+// ParseEditRules parses rules in JSON, when the data starts with a brace,
+// or in YAML. Unknown keys are errors.
+func ParseEditRules(data []byte) ([]EditRule, error) {
+	var rules EditRules
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&rules); err != nil {
+			return nil, err
+		}
+		return rules.Rules, nil
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&rules); err != nil {
+		return nil, err
+	}
+	return rules.Rules, nil
+}
+
+// ReadEditRules reads a rule file.
+func ReadEditRules(file string) ([]EditRule, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseEditRules(data)
+}
+
+// editRule is a rule with its specs, pattern and field parsed.
+type editRule struct {
+	EditRule
+	when, unless, field, to *Spec
+	pattern                 *regexp.Regexp
+	value                   Record // the field of value
+}
+
+// Editor applies edit rules to records.
+type Editor struct {
+	rules []editRule
+}
+
+// NewEditor checks the rules and returns an Editor applying them.
+func NewEditor(rules []EditRule) (*Editor, error) {
+	e := &Editor{}
+	for n, rule := range rules {
+		r, err := compileEditRule(rule)
+		if err != nil {
+			name := rule.Name
+			if name == "" {
+				name = fmt.Sprintf("%d", n+1)
+			}
+			return nil, fmt.Errorf("rule %s: %s", name, err)
+		}
+		e.rules = append(e.rules, r)
+	}
+	return e, nil
+}
+
+func compileEditRule(rule EditRule) (editRule, error) {
+	r := editRule{EditRule: rule}
+	parse := func(spec string) (*Spec, error) {
+		if spec == "" {
+			return nil, nil
+		}
+		s, err := ParseSpec(spec)
+		return &s, err
+	}
+	var err error
+	if r.when, err = parse(rule.When); err != nil {
+		return r, err
+	}
+	if r.unless, err = parse(rule.Unless); err != nil {
+		return r, err
+	}
+	if r.field, err = parse(rule.Field); err != nil {
+		return r, err
+	}
+
+	needsField := true
+	switch rule.Action {
+	case EditAddField, EditReplaceField:
+		needsField = rule.Action == EditReplaceField
+		if err := parseMrkLine(&r.value, rule.Value); err != nil {
+			return r, err
+		}
+		if len(r.value.ControlFields)+len(r.value.DataFields) != 1 {
+			return r, fmt.Errorf("value should be a control or data field")
+		}
+	case EditAddSubField:
+		if len(rule.Code) != 1 {
+			return r, fmt.Errorf("code should be a subfield code")
+		}
+	case EditDeleteField:
+	case EditSetIndicator:
+		if rule.Indicator != 1 && rule.Indicator != 2 {
+			return r, fmt.Errorf("indicator should be 1 or 2")
+		}
+		if len(rule.Value) > 1 {
+			return r, fmt.Errorf("value should be a single character")
+		}
+	case EditRegexReplace:
+		if r.pattern, err = regexp.Compile(rule.Pattern); err != nil {
+			return r, err
+		}
+	case EditMoveSubField:
+		if r.field != nil && r.field.Codes == "" {
+			return r, fmt.Errorf("field should select subfields")
+		}
+		to := rule.To
+		if strings.HasPrefix(to, "$") {
+			to = "..." + to
+		}
+		if r.to, err = parse(to); err != nil {
+			return r, err
+		}
+		if r.to == nil || len(r.to.Codes) > 1 {
+			return r, fmt.Errorf("to should be a subfield code or a tag with an optional code")
+		}
+	case EditCopyControlNum:
+		needsField = false
+	default:
+		return r, fmt.Errorf("unknown action %q", rule.Action)
+	}
+	if needsField && r.field == nil {
+		return r, fmt.Errorf("%s needs a field", rule.Action)
+	}
+	return r, nil
+}
+
+// Edit returns a copy of the record changed by the rules and the number
+// of changes made.
+func (e *Editor) Edit(rec Record) (Record, int) {
+	out := rec.Clone()
+	changes := 0
+	for _, r := range e.rules {
+		if r.when != nil && len(out.Select(*r.when)) == 0 {
+			continue
+		}
+		if r.unless != nil && len(out.Select(*r.unless)) > 0 {
+			continue
+		}
+		changes += r.apply(&out)
+	}
+	return out, changes
+}
+
+// apply applies the rule to the record and returns the number of changes.
+func (r editRule) apply(rec *Record) int {
+	switch r.Action {
+	case EditAddField:
+		for _, cf := range r.value.ControlFields {
+			rec.AddControlField(cf)
+		}
+		for _, df := range r.value.DataFields {
+			df.SubFields = append([]SubField{}, df.SubFields...)
+			rec.AddDataField(df)
+		}
+		return 1
+	case EditDeleteField:
+		return rec.DeleteFields(*r.field)
+	case EditReplaceField:
+		return r.replaceField(rec)
+	case EditCopyControlNum:
+		return copyControlNum(rec, r.Prefix)
+	}
+
+	if r.field.isControl() {
+		changes := 0
+		if r.Action == EditRegexReplace {
+			for _, pos := range rec.SelectControlFields(*r.field) {
+				data := r.pattern.ReplaceAllString(rec.ControlFields[pos].Data, r.Replacement)
+				if data != rec.ControlFields[pos].Data {
+					rec.ControlFields[pos].Data = data
+					changes++
+				}
+			}
+		}
+		return changes
+	}
+
+	positions := rec.SelectDataFields(*r.field)
+	if r.Action == EditMoveSubField {
+		return r.moveSubFields(rec, positions)
+	}
+	changes := 0
+	for _, pos := range positions {
+		df := &rec.DataFields[pos]
+		switch r.Action {
+		case EditAddSubField:
+			df.AddSubField(r.Code, r.Value)
+			changes++
+		case EditSetIndicator:
+			before := *df
+			df.SetIndicator(r.Indicator, r.Value)
+			if df.GetIndicator1() != before.GetIndicator1() || df.GetIndicator2() != before.GetIndicator2() {
+				changes++
+			}
+		case EditRegexReplace:
+			for i, sf := range df.SubFields {
+				if r.field.Codes != "" && !strings.Contains(r.field.Codes, sf.Code) {
+					continue
+				}
+				if data := r.pattern.ReplaceAllString(sf.Data, r.Replacement); data != sf.Data {
+					df.SubFields[i].Data = data
+					changes++
+				}
+			}
+		}
+	}
+	return changes
+}
+
+// replaceField replaces the selected fields with the field of the value.
+func (r editRule) replaceField(rec *Record) int {
+	if len(r.value.ControlFields) == 1 {
+		positions := rec.SelectControlFields(*r.field)
+		for _, pos := range positions {
+			rec.ControlFields[pos] = r.value.ControlFields[0]
+		}
+		return len(positions)
+	}
+	positions := rec.SelectDataFields(*r.field)
+	for _, pos := range positions {
+		df := r.value.DataFields[0]
+		df.SubFields = append([]SubField{}, df.SubFields...)
+		rec.DataFields[pos] = df
+	}
+	return len(positions)
+}
+
+// moveSubFields moves the subfields of the selected fields to another
+// code or another field.
+func (r editRule) moveSubFields(rec *Record, positions []int) int {
+	var moved []SubField
+	for _, pos := range positions {
+		df := &rec.DataFields[pos]
+		if r.to.Tag == "..." {
+			for i, sf := range df.SubFields {
+				if strings.Contains(r.field.Codes, sf.Code) {
+					df.SubFields[i].Code = r.to.Codes
+					moved = append(moved, sf)
+				}
+			}
+			continue
+		}
+		for _, sf := range df.SubFields {
+			if strings.Contains(r.field.Codes, sf.Code) {
+				if r.to.Codes != "" {
+					sf.Code = r.to.Codes
+				}
+				moved = append(moved, sf)
+			}
+		}
+		df.RemoveSubFields(r.field.Codes)
+	}
+	if len(moved) == 0 || r.to.Tag == "..." {
+		return len(moved)
+	}
+
+	// empty fields are deleted, from the last to keep the positions valid
+	for i := len(positions) - 1; i >= 0; i-- {
+		if len(rec.DataFields[positions[i]].SubFields) == 0 {
+			rec.DataFields = append(rec.DataFields[:positions[i]], rec.DataFields[positions[i]+1:]...)
+		}
+	}
+	target := -1
+	for pos, df := range rec.DataFields {
+		if df.Tag.GetTag() == r.to.Tag {
+			target = pos
+			break
+		}
+	}
+	if target < 0 {
+		target = rec.AddDataField(DataField{Tag: Tag(r.to.Tag), Indicator1: " ", Indicator2: " "})
+	}
+	rec.DataFields[target].SubFields = append(rec.DataFields[target].SubFields, moved...)
+	return len(moved)
+}
+
+// copyControlNum adds the 001 to a 035 $a unless it is already there.
+func copyControlNum(rec *Record, prefix string) int {
+	id := strings.TrimSpace(rec.ControlNum())
+	if id == "" {
+		return 0
+	}
+	if prefix == "" {
+		for _, cf := range rec.GetControlfields("003") {
+			if org := strings.TrimSpace(cf.Data); org != "" {
+				prefix = "(" + org + ")"
+			}
+		}
+	}
+	value := prefix + id
+	for _, df := range rec.GetDatafields("035") {
+		for _, sf := range df.GetSubFields("a") {
+			if strings.TrimSpace(sf.Data) == value {
+				return 0
+			}
+		}
+	}
+	rec.AddDataField(DataField{Tag: "035", Indicator1: " ", Indicator2: " ", SubFields: []SubField{{Code: "a", Data: value}}})
+	return 1
+}
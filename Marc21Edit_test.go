@@ -0,0 +1,115 @@
+package gomarc21
+
+import (
+	"strings"
+	"testing"
+)
+
+const testEditRules = `
+rules:
+  - name: delete the local fields
+    action: delete_field
+    field: 9..
+  - name: add our code to the 040
+    unless: 040$d{=\XYZ}
+    action: add_subfield
+    field: "040"
+    code: d
+    value: XYZ
+  - action: regex_replace
+    field: 856$z
+    pattern: (?i)^view online.*
+    replacement: Online version
+  - action: set_indicator
+    field: 650{$x=\Sampling.}
+    indicator: 2
+    value: "7"
+  - action: add_field
+    when: 650{^2=7}
+    unless: 500{$a=\Some subjects were changed.}
+    value: =500  \\$aSome subjects were changed.
+  - action: move_subfield
+    field: 245$h
+    to: 500$a
+  - action: regex_replace
+    field: "001"
+    pattern: ^ocm
+    replacement: XYZ
+  - action: copy_001_to_035
+    prefix: (XYZ)
+`
+
+func TestEditRules(test *testing.T) {
+	rules, err := ParseEditRules([]byte(testEditRules))
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(rules) != 8 || rules[1].Field != "040" || rules[3].Indicator != 2 {
+		test.Fatal("rules were not parsed", rules)
+	}
+	editor, err := NewEditor(rules)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	file, err := OpenFile("data/test_10.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer file.Close()
+	rec := readAll(test, NewReader(file))[0]
+
+	edited, changes := editor.Edit(rec)
+	// 5 deleted fields, 1 added subfield, 1 replacement, 1 indicator, 1
+	// added field, 1 moved subfield, 1 replacement and 1 added 035
+	if changes != 12 {
+		test.Error("wrong number of changes", changes)
+	}
+	check := func(spec string, expected string) {
+		values := edited.Select(MustParseSpec(spec))
+		if strings.Join(values, "|") != expected {
+			test.Errorf("%s: expected %q, got %q", spec, expected, values)
+		}
+	}
+	check("040$d{=\\XYZ}", "XYZ")
+	check("040$d", "MvI|MvI|XYZ")
+	check("856$z", "Online version")
+	check("650[1]^2", "7")
+	check("500[0]$a", "Title from title screen (viewed on Dec. 06, 2004)|[electronic resource] /")
+	check("500[#]$a", "Some subjects were changed.")
+	check("001", "XYZ57175940")
+	check("035$a", "(XYZ)XYZ57175940")
+	if len(edited.Select(MustParseSpec("9.."))) != 0 || len(edited.Select(MustParseSpec("245$h"))) != 0 {
+		test.Error("fields were not deleted or moved")
+	}
+	if len(rec.Select(MustParseSpec("9.."))) != 5 || rec.ControlNum() != "ocm57175940" {
+		test.Error("the original record was changed")
+	}
+
+	// the rules are not applied twice
+	_, changes = editor.Edit(edited)
+	if changes != 0 {
+		test.Error("wrong number of changes the second time", changes)
+	}
+
+	json := `{"rules": [{"action": "delete_field", "field": "856"}]}`
+	if rules, err := ParseEditRules([]byte(json)); err != nil || len(rules) != 1 {
+		test.Error("JSON rules were not parsed", rules, err)
+	}
+	for _, bad := range []string{
+		`{"rules": [{"action": "delete_field", "tag": "856"}]}`,
+		"rules:\n  - action: shuffle\n    field: 245\n",
+		"rules:\n  - action: delete_field\n",
+		"rules:\n  - action: set_indicator\n    field: 245\n    indicator: 3\n",
+		"rules:\n  - action: move_subfield\n    field: 245\n    to: $k\n",
+		"rules:\n  - action: add_field\n    value: 500 a note\n",
+	} {
+		rules, err := ParseEditRules([]byte(bad))
+		if err == nil {
+			_, err = NewEditor(rules)
+		}
+		if err == nil {
+			test.Errorf("rules %q should not be accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package gomarc21
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+source: https://www.loc.gov/marc/holdings/
+        ANSI/NISO Z39.71 Holdings Statements for Bibliographic Items
+
+    852      Location
+    853-855  Captions and Pattern (basic bibliographic unit, supplementary
+             material, indexes)
+    863-865  Enumeration and Chronology, linked to the captions by the
+             link number of $8 (863 $8 1.2 is the second occurrence for the
+             caption of 853 $8 1)
+    866-868  Textual Holdings
+
+A caption and pattern field such as
+
+    =853  20$81$av.$bno.$i(year)$j(month)$wm
+
+and an enumeration and chronology field such as
+
+    =863  40$81.1$a1-10$b1-12$i1990-1999$j01-12
+
+make the holdings statement "v.1:no.1 (1990:Jan.)-v.10:no.12 (1999:Dec.)".
+Captions in parentheses are not displayed.
+*/
+
+// Types of holdings statements.
+const (
+	HoldingsBasic      = "basic"      // 853/863/866
+	HoldingsSupplement = "supplement" // 854/864/867
+	HoldingsIndex      = "index"      // 855/865/868
+)
+
+// holdingsTypes maps the last digit of 85X/86X tags to the type of
+// holdings.
+var holdingsTypes = map[byte]string{
+	'3': HoldingsBasic,
+	'4': HoldingsSupplement,
+	'5': HoldingsIndex,
+	'6': HoldingsBasic,
+	'7': HoldingsSupplement,
+	'8': HoldingsIndex,
+}
+
+var holdingsTypeOrder = map[string]int{
+	HoldingsBasic:      0,
+	HoldingsSupplement: 1,
+	HoldingsIndex:      2,
+}
+
+// shelvingSchemes decodes the first indicator of 852.
+var shelvingSchemes = map[string]string{
+	" ": "no information provided",
+	"0": "Library of Congress classification",
+	"1": "Dewey Decimal classification",
+	"2": "National Library of Medicine classification",
+	"3": "Superintendent of Documents classification",
+	"4": "Shelving control number",
+	"5": "Title",
+	"6": "Shelved separately",
+	"7": "Source specified in subfield $2",
+	"8": "Other scheme",
+}
+
+// chronologyMonths maps the month and season codes of chronology values
+// to their display form.
+var chronologyMonths = map[string]string{
+	"01": "Jan.", "02": "Feb.", "03": "Mar.", "04": "Apr.", "05": "May", "06": "June",
+	"07": "July", "08": "Aug.", "09": "Sept.", "10": "Oct.", "11": "Nov.", "12": "Dec.",
+	"21": "Spring", "22": "Summer", "23": "Autumn", "24": "Winter",
+}
+
+// Location is a decoded 852 location field.
+type Location struct {
+	ShelvingScheme   string
+	Institution      string   // $a
+	Sublocation      string   // $b
+	ShelvingLocation string   // $c
+	Classification   string   // $h
+	ItemPart         string   // $i
+	ShelvingControl  string   // $j
+	Prefix           string   // $k
+	Suffix           string   // $m
+	Copy             string   // $t
+	NonpublicNotes   []string // $x
+	PublicNotes      []string // $z
+}
+
+// CallNumber returns the call number made of the prefix, classification
+// and item parts and suffix, or the shelving control number.
+func (l Location) CallNumber() string {
+	var parts []string
+	for _, p := range []string{l.Prefix, l.Classification, l.ItemPart, l.Suffix} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	if len(parts) == 0 {
+		return l.ShelvingControl
+	}
+	return strings.Join(parts, " ")
+}
+
+// HoldingsStatement is a holdings statement made from a pair of caption
+// and enumeration fields, or a textual holdings field.
+type HoldingsStatement struct {
+	Type      string
+	Link      int // link number of $8
+	Sequence  int // sequence number of $8
+	Statement string
+	Notes     []string // $z
+	Textual   bool     // from 866-868
+}
+
+// IsHoldings reports whether the record is a holdings record (leader/06
+// u, v, x or y).
+func (rec Record) IsHoldings() bool {
+	return strings.IndexByte("uvxy", rec.Leader.TypeOfRecord) >= 0
+}
+
+// Locations returns the decoded 852 fields of the record.
+func (rec Record) Locations() []Location {
+	var locations []Location
+	for _, df := range rec.GetDatafields("852") {
+		l := Location{ShelvingScheme: shelvingSchemes[df.GetIndicator1()]}
+		for _, sf := range df.SubFields {
+			v := strings.TrimSpace(sf.Data)
+			switch sf.Code {
+			case "a":
+				l.Institution = v
+			case "b":
+				l.Sublocation = v
+			case "c":
+				l.ShelvingLocation = v
+			case "h":
+				l.Classification = v
+			case "i":
+				l.ItemPart = v
+			case "j":
+				l.ShelvingControl = v
+			case "k":
+				l.Prefix = v
+			case "m":
+				l.Suffix = v
+			case "t":
+				l.Copy = v
+			case "x":
+				l.NonpublicNotes = append(l.NonpublicNotes, v)
+			case "z":
+				l.PublicNotes = append(l.PublicNotes, v)
+			}
+		}
+		locations = append(locations, l)
+	}
+	return locations
+}
+
+// linkNumbers parses the link and sequence numbers of $8, e.g. "1.2".
+func linkNumbers(df DataField) (link int, sequence int) {
+	for _, sf := range df.GetSubFields("8") {
+		parts := strings.SplitN(strings.TrimSpace(sf.Data), ".", 2)
+		link, _ = strconv.Atoi(parts[0])
+		if len(parts) == 2 {
+			sequence, _ = strconv.Atoi(parts[1])
+		}
+		break
+	}
+	return link, sequence
+}
+
+// HoldingsStatements returns the holdings statements of the record: the
+// 863-865 fields expanded with the captions of their 853-855 fields, and
+// the 866-868 textual holdings as they are. The statements are ordered by
+// type, link and sequence number.
+func (rec Record) HoldingsStatements() []HoldingsStatement {
+	captions := map[string]DataField{}
+	for _, df := range rec.GetDatafields("853,854,855") {
+		link, _ := linkNumbers(df)
+		captions[df.Tag.GetTag()[2:]+"."+strconv.Itoa(link)] = df
+	}
+
+	var statements []HoldingsStatement
+	for _, df := range rec.DataFields {
+		tag := df.Tag.GetTag()
+		if len(tag) != 3 || tag[:2] != "86" || holdingsTypes[tag[2]] == "" {
+			continue
+		}
+		s := HoldingsStatement{Type: holdingsTypes[tag[2]]}
+		s.Link, s.Sequence = linkNumbers(df)
+		for _, sf := range df.GetSubFields("z") {
+			s.Notes = append(s.Notes, strings.TrimSpace(sf.Data))
+		}
+		if tag[2] >= '6' {
+			s.Textual = true
+			s.Statement = joinSubFields(df, "a", " ")
+		} else {
+			// 863 pairs with 853, 864 with 854 and 865 with 855
+			caption := captions[tag[2:]+"."+strconv.Itoa(s.Link)]
+			s.Statement = holdingsStatement(caption, df)
+		}
+		if s.Statement != "" || len(s.Notes) > 0 {
+			statements = append(statements, s)
+		}
+	}
+
+	sort.SliceStable(statements, func(i, j int) bool {
+		a, b := statements[i], statements[j]
+		if a.Type != b.Type {
+			return holdingsTypeOrder[a.Type] < holdingsTypeOrder[b.Type]
+		}
+		if a.Link != b.Link {
+			return a.Link < b.Link
+		}
+		return a.Sequence < b.Sequence
+	})
+	return statements
+}
+
+// holdingsStatement expands the enumeration and chronology of a 863-865
+// with the captions of its 853-855.
+func holdingsStatement(caption DataField, df DataField) string {
+	captionOf := func(code string) string {
+		for _, sf := range caption.GetSubFields(code) {
+			return strings.TrimSpace(sf.Data)
+		}
+		return ""
+	}
+
+	var enumStart, enumEnd, chronStart, chronEnd []string
+	isRange, openEnded := false, false
+	for _, sf := range df.SubFields {
+		if len(sf.Code) != 1 || !strings.Contains("abcdefghijklm", sf.Code) {
+			continue
+		}
+		start := strings.TrimSpace(sf.Data)
+		end := start
+		if i := strings.Index(start, "-"); i >= 0 {
+			isRange = true
+			start, end = start[:i], start[i+1:]
+			if end == "" {
+				openEnded = true
+			}
+		}
+
+		label := captionOf(sf.Code)
+		if sf.Code >= "i" {
+			if label == "(month)" || label == "(season)" {
+				start, end = chronologyValue(start), chronologyValue(end)
+			}
+			if strings.HasPrefix(label, "(") {
+				label = ""
+			}
+			chronStart = append(chronStart, label+start)
+			chronEnd = append(chronEnd, label+end)
+			continue
+		}
+		if strings.HasPrefix(label, "(") {
+			label = ""
+		}
+		enumStart = append(enumStart, label+start)
+		enumEnd = append(enumEnd, label+end)
+	}
+
+	statement := holdingsPart(enumStart, chronStart)
+	if isRange {
+		statement += "-"
+		if !openEnded {
+			statement += holdingsPart(enumEnd, chronEnd)
+		}
+	}
+	return statement
+}
+
+// holdingsPart formats one end of a holdings statement, e.g.
+// "v.1:no.1 (1990:Jan.)".
+func holdingsPart(enumeration []string, chronology []string) string {
+	enum := strings.Join(enumeration, ":")
+	chron := strings.Join(chronology, ":")
+	switch {
+	case enum == "":
+		return chron
+	case chron == "":
+		return enum
+	}
+	return enum + " (" + chron + ")"
+}
+
+// chronologyValue returns the display form of a month or season code.
+func chronologyValue(code string) string {
+	if v, ok := chronologyMonths[code]; ok {
+		return v
+	}
+	return code
+}
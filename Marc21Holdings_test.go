@@ -0,0 +1,69 @@
+package gomarc21
+
+import (
+	"testing"
+)
+
+func TestHoldings(test *testing.T) {
+	leader, err := NewLeader([]byte("00000cy  a22000003n 4500"))
+	if err != nil {
+		test.Fatal(err)
+	}
+	rec := Record{Leader: leader, DataFields: []DataField{
+		{Tag: "852", Indicator1: "0", Indicator2: "1", SubFields: []SubField{
+			{Code: "a", Data: "CaOONL"}, {Code: "b", Data: "MAIN"}, {Code: "h", Data: "QE1"}, {Code: "i", Data: ".G46"}, {Code: "z", Data: "Current issues in reading room"},
+		}},
+		{Tag: "853", Indicator1: "2", Indicator2: "0", SubFields: []SubField{
+			{Code: "8", Data: "1"}, {Code: "a", Data: "v."}, {Code: "i", Data: "(year)"},
+		}},
+		{Tag: "853", Indicator1: "2", Indicator2: "0", SubFields: []SubField{
+			{Code: "8", Data: "2"}, {Code: "a", Data: "v."}, {Code: "b", Data: "no."}, {Code: "i", Data: "(year)"}, {Code: "j", Data: "(month)"},
+		}},
+		{Tag: "855", Indicator1: " ", Indicator2: " ", SubFields: []SubField{
+			{Code: "8", Data: "1"}, {Code: "a", Data: "v."},
+		}},
+		{Tag: "863", Indicator1: "4", Indicator2: "1", SubFields: []SubField{
+			{Code: "8", Data: "2.1"}, {Code: "a", Data: "11-12"}, {Code: "b", Data: "1-6"}, {Code: "i", Data: "2000"}, {Code: "j", Data: "01-06"},
+		}},
+		{Tag: "863", Indicator1: "4", Indicator2: "1", SubFields: []SubField{
+			{Code: "8", Data: "1.1"}, {Code: "a", Data: "1-10"}, {Code: "i", Data: "1990-1999"}, {Code: "w", Data: "g"},
+		}},
+		{Tag: "863", Indicator1: "4", Indicator2: "1", SubFields: []SubField{
+			{Code: "8", Data: "2.2"}, {Code: "a", Data: "14-"}, {Code: "i", Data: "2002-"},
+		}},
+		{Tag: "865", Indicator1: "4", Indicator2: "1", SubFields: []SubField{
+			{Code: "8", Data: "1.1"}, {Code: "a", Data: "1-10"}, {Code: "z", Data: "Cumulative index"},
+		}},
+		{Tag: "867", Indicator1: "4", Indicator2: "1", SubFields: []SubField{
+			{Code: "8", Data: "1"}, {Code: "a", Data: "Supplements 1-3 (1995-1997)"},
+		}},
+	}}
+
+	if !rec.IsHoldings() {
+		test.Error("record should be a holdings record")
+	}
+
+	locations := rec.Locations()
+	if len(locations) != 1 || locations[0].CallNumber() != "QE1 .G46" || locations[0].ShelvingScheme != "Library of Congress classification" ||
+		locations[0].Sublocation != "MAIN" || len(locations[0].PublicNotes) != 1 {
+		test.Error("locations are wrong", locations)
+	}
+
+	want := []HoldingsStatement{
+		{Type: HoldingsBasic, Link: 1, Sequence: 1, Statement: "v.1 (1990)-v.10 (1999)"},
+		{Type: HoldingsBasic, Link: 2, Sequence: 1, Statement: "v.11:no.1 (2000:Jan.)-v.12:no.6 (2000:June)"},
+		{Type: HoldingsBasic, Link: 2, Sequence: 2, Statement: "v.14 (2002)-"},
+		{Type: HoldingsSupplement, Link: 1, Statement: "Supplements 1-3 (1995-1997)", Textual: true},
+		{Type: HoldingsIndex, Link: 1, Sequence: 1, Statement: "v.1-v.10", Notes: []string{"Cumulative index"}},
+	}
+	got := rec.HoldingsStatements()
+	if len(got) != len(want) {
+		test.Fatal("wrong number of statements", got)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.Type != w.Type || g.Link != w.Link || g.Sequence != w.Sequence || g.Statement != w.Statement || g.Textual != w.Textual || len(g.Notes) != len(w.Notes) {
+			test.Errorf("statement %d is %+v, want %+v", i, g, w)
+		}
+	}
+}
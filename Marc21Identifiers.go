@@ -0,0 +1,381 @@
+package gomarc21
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+Standard identifiers are recorded as raw strings, often with hyphens and
+qualifiers:
+
+    020 $a 0-306-40615-2 (pbk.)     ISBN, $z canceled/invalid
+    022 $a 0317-8471                ISSN, $y incorrect, $z canceled
+    010 $a    85000002 //r86        LCCN, $z canceled/invalid
+    035 $a (OCoLC)ocm00012345       OCLC number, $z canceled/invalid
+
+The normalized forms have no hyphens, blanks, qualifiers or prefixes:
+
+    ISBN  10 or 13 characters, the check character X in upper case
+    ISSN  8 characters, the check character X in upper case
+    LCCN  source: https://www.loc.gov/marc/lccn-namespace.html
+          blanks removed, everything from a slash removed, and the hyphen
+          removed with the serial number after it left-filled with zeros
+          to six digits; "n78-890351" is "n78890351"
+    OCLC  the number without (OCoLC), ocm, ocn or on prefix and without
+          leading zeros
+*/
+
+// Identifier is a standard identifier of a record.
+type Identifier struct {
+	Type       string // KeyIsbn, KeyIssn, KeyLccn or KeyOclc
+	Tag        string
+	Position   int // index of the field in Record.DataFields
+	SubField   int // index of the subfield in DataField.SubFields
+	Raw        string
+	Normalized string
+	Qualifier  string // what follows an ISBN or ISSN, e.g. "(pbk.)"
+	Valid      bool
+	Problem    string // why it is not valid
+}
+
+// splitQualifier splits the identifier from the qualifier following it.
+func splitQualifier(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexAny(s, " \t("); i >= 0 {
+		return s[:i], strings.TrimSpace(s[i:])
+	}
+	return s, ""
+}
+
+// NormalizeIsbn returns the ISBN without hyphens, blanks and qualifier.
+func NormalizeIsbn(s string) string {
+	isbn, _ := splitQualifier(s)
+	return strings.ToUpper(strings.ReplaceAll(isbn, "-", ""))
+}
+
+// isbnProblem returns why a normalized ISBN is not valid, or "".
+func isbnProblem(isbn string) string {
+	switch len(isbn) {
+	case 10:
+		if strings.Trim(isbn[:9], "0123456789") != "" || strings.Trim(isbn[9:], "0123456789X") != "" {
+			return "invalid characters"
+		}
+		if isbn10CheckDigit(isbn) != isbn[9] {
+			return "wrong check digit"
+		}
+	case 13:
+		if strings.Trim(isbn, "0123456789") != "" {
+			return "invalid characters"
+		}
+		if !strings.HasPrefix(isbn, "978") && !strings.HasPrefix(isbn, "979") {
+			return "wrong prefix"
+		}
+		if isbn13CheckDigit(isbn) != isbn[12] {
+			return "wrong check digit"
+		}
+	default:
+		return "wrong length"
+	}
+	return ""
+}
+
+func isbn10CheckDigit(isbn string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(isbn[i]-'0') * (10 - i)
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+	return byte('0' + check)
+}
+
+func isbn13CheckDigit(isbn string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += int(isbn[i]-'0') * weight
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// ValidIsbn reports whether an ISBN-10 or ISBN-13 has a valid check digit.
+// Hyphens and qualifiers are ignored.
+func ValidIsbn(s string) bool {
+	return isbnProblem(NormalizeIsbn(s)) == ""
+}
+
+// Isbn13 returns the ISBN-13 form of a valid ISBN.
+func Isbn13(s string) (string, error) {
+	isbn := NormalizeIsbn(s)
+	if problem := isbnProblem(isbn); problem != "" {
+		return "", fmt.Errorf("invalid ISBN %q: %s", s, problem)
+	}
+	if len(isbn) == 13 {
+		return isbn, nil
+	}
+	isbn = "978" + isbn[:9]
+	return isbn + string(isbn13CheckDigit(isbn)), nil
+}
+
+// Isbn10 returns the ISBN-10 form of a valid ISBN. ISBN-13 starting with
+// 979 have none.
+func Isbn10(s string) (string, error) {
+	isbn := NormalizeIsbn(s)
+	if problem := isbnProblem(isbn); problem != "" {
+		return "", fmt.Errorf("invalid ISBN %q: %s", s, problem)
+	}
+	if len(isbn) == 10 {
+		return isbn, nil
+	}
+	if !strings.HasPrefix(isbn, "978") {
+		return "", fmt.Errorf("ISBN %q has no ISBN-10 form", s)
+	}
+	isbn = isbn[3:12]
+	return isbn + string(isbn10CheckDigit(isbn)), nil
+}
+
+// NormalizeIssn returns the ISSN without hyphen, blanks and qualifier.
+func NormalizeIssn(s string) string {
+	issn, _ := splitQualifier(s)
+	return strings.ToUpper(strings.ReplaceAll(issn, "-", ""))
+}
+
+// issnProblem returns why a normalized ISSN is not valid, or "".
+func issnProblem(issn string) string {
+	if len(issn) != 8 {
+		return "wrong length"
+	}
+	if strings.Trim(issn[:7], "0123456789") != "" || strings.Trim(issn[7:], "0123456789X") != "" {
+		return "invalid characters"
+	}
+	sum := 0
+	for i := 0; i < 7; i++ {
+		sum += int(issn[i]-'0') * (8 - i)
+	}
+	check := byte('0' + (11-sum%11)%11)
+	if check == '0'+10 {
+		check = 'X'
+	}
+	if check != issn[7] {
+		return "wrong check digit"
+	}
+	return ""
+}
+
+// ValidIssn reports whether an ISSN has a valid check digit.
+func ValidIssn(s string) bool {
+	return issnProblem(NormalizeIssn(s)) == ""
+}
+
+// NormalizeLccn returns the normalized form of an LCCN.
+func NormalizeLccn(s string) string {
+	s = strings.Join(strings.Fields(s), "")
+	if i := strings.Index(s, "/"); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.Index(s, "-"); i >= 0 {
+		serial := s[i+1:]
+		if len(serial) > 6 || strings.Trim(serial, "0123456789") != "" {
+			// not a serial number, the hyphen is kept so that it is invalid
+			return s
+		}
+		for len(serial) < 6 {
+			serial = "0" + serial
+		}
+		s = s[:i] + serial
+	}
+	return s
+}
+
+// lccnProblem returns why a normalized LCCN is not valid, or "": it should
+// be an alphabetic prefix of up to three letters followed by a year of two
+// or four digits and a serial number of six digits.
+func lccnProblem(lccn string) string {
+	digits := strings.TrimLeft(lccn, "abcdefghijklmnopqrstuvwxyz")
+	if len(lccn)-len(digits) > 3 || strings.Trim(digits, "0123456789") != "" {
+		return "invalid characters"
+	}
+	if len(digits) != 8 && len(digits) != 10 {
+		return "wrong length"
+	}
+	return ""
+}
+
+// ValidLccn reports whether an LCCN is well formed once normalized.
+func ValidLccn(s string) bool {
+	return lccnProblem(NormalizeLccn(s)) == ""
+}
+
+// NormalizeOclc returns an OCLC number without prefixes and leading zeros.
+func NormalizeOclc(s string) string {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "(OCoLC)")
+	for _, prefix := range []string{"ocm", "ocn", "on"} {
+		if strings.HasPrefix(s, prefix) {
+			s = s[len(prefix):]
+			break
+		}
+	}
+	return strings.TrimLeft(strings.TrimSpace(s), "0")
+}
+
+// ValidOclc reports whether an OCLC number is a number once normalized.
+func ValidOclc(s string) bool {
+	n := NormalizeOclc(s)
+	return n != "" && strings.Trim(n, "0123456789") == ""
+}
+
+// identifierTags maps the identifier fields to the type of identifier.
+var identifierTags = map[string]string{
+	"010": KeyLccn,
+	"020": KeyIsbn,
+	"022": KeyIssn,
+	"035": KeyOclc,
+}
+
+// Identifiers returns the standard identifiers of $a of the 010, 020, 022
+// and 035 fields. The 035 are only those of OCLC, with the (OCoLC) prefix.
+func (rec Record) Identifiers() []Identifier {
+	var ids []Identifier
+	for pos, df := range rec.DataFields {
+		kind, ok := identifierTags[df.Tag.GetTag()]
+		if !ok {
+			continue
+		}
+		for i, sf := range df.SubFields {
+			if sf.Code != "a" || strings.TrimSpace(sf.Data) == "" {
+				continue
+			}
+			id := Identifier{Type: kind, Tag: df.Tag.GetTag(), Position: pos, SubField: i, Raw: sf.Data}
+			switch kind {
+			case KeyIsbn:
+				_, id.Qualifier = splitQualifier(sf.Data)
+				id.Normalized = NormalizeIsbn(sf.Data)
+				id.Problem = isbnProblem(id.Normalized)
+			case KeyIssn:
+				_, id.Qualifier = splitQualifier(sf.Data)
+				id.Normalized = NormalizeIssn(sf.Data)
+				id.Problem = issnProblem(id.Normalized)
+			case KeyLccn:
+				id.Normalized = NormalizeLccn(sf.Data)
+				id.Problem = lccnProblem(id.Normalized)
+			case KeyOclc:
+				if !strings.HasPrefix(strings.TrimSpace(sf.Data), "(OCoLC)") {
+					continue
+				}
+				id.Normalized = NormalizeOclc(sf.Data)
+				if !ValidOclc(sf.Data) {
+					id.Problem = "not a number"
+				}
+			}
+			id.Valid = id.Problem == ""
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// validIdentifiers returns the valid normalized identifiers of a type.
+func (rec Record) validIdentifiers(kind string) []string {
+	var values []string
+	for _, id := range rec.Identifiers() {
+		if id.Type == kind && id.Valid {
+			values = appendValue(values, id.Normalized)
+		}
+	}
+	return values
+}
+
+// Isbns returns the valid ISBN of the record as ISBN-13.
+func (rec Record) Isbns() []string {
+	var isbns []string
+	for _, isbn := range rec.validIdentifiers(KeyIsbn) {
+		isbn13, _ := Isbn13(isbn)
+		isbns = appendValue(isbns, isbn13)
+	}
+	return isbns
+}
+
+// Issns returns the valid normalized ISSN of the record.
+func (rec Record) Issns() []string {
+	return rec.validIdentifiers(KeyIssn)
+}
+
+// Lccns returns the valid normalized LCCN of the record.
+func (rec Record) Lccns() []string {
+	return rec.validIdentifiers(KeyLccn)
+}
+
+// OclcNumbers returns the valid normalized OCLC numbers of the 035 and of
+// the 001 when it is an OCLC number (003 OCoLC or ocm, ocn, on prefix).
+func (rec Record) OclcNumbers() []string {
+	numbers := rec.validIdentifiers(KeyOclc)
+	id := strings.TrimSpace(rec.ControlNum())
+	org := ""
+	for _, cf := range rec.GetControlfields("003") {
+		org = strings.TrimSpace(cf.Data)
+	}
+	if org == "OCoLC" || strings.HasPrefix(id, "ocm") || strings.HasPrefix(id, "ocn") || strings.HasPrefix(id, "on") {
+		if ValidOclc(id) {
+			numbers = appendValue(numbers, NormalizeOclc(id))
+		}
+	}
+	return numbers
+}
+
+// MoveInvalidIdentifiers returns a copy of the record where the invalid
+// identifiers of $a are moved to $z, or to $y (incorrect ISSN) for the
+// 022, and the identifiers that were moved.
+func (rec Record) MoveInvalidIdentifiers() (Record, []Identifier) {
+	var moved []Identifier
+	out := rec
+	out.DataFields = append([]DataField{}, rec.DataFields...)
+	for _, id := range rec.Identifiers() {
+		if id.Valid {
+			continue
+		}
+		df := out.DataFields[id.Position]
+		if len(moved) == 0 || moved[len(moved)-1].Position != id.Position {
+			df.SubFields = append([]SubField{}, df.SubFields...)
+		}
+		code := "z"
+		if id.Type == KeyIssn {
+			code = "y"
+		}
+		df.SubFields[id.SubField].Code = code
+		out.DataFields[id.Position] = df
+		moved = append(moved, id)
+	}
+	return out, moved
+}
+
+// identifierNames are the display names of the identifier types.
+var identifierNames = map[string]string{
+	KeyIsbn: "ISBN",
+	KeyIssn: "ISSN",
+	KeyLccn: "LCCN",
+	KeyOclc: "OCLC number",
+}
+
+// IdentifierLintRule reports the invalid ISBN, ISSN, LCCN and OCLC numbers.
+var IdentifierLintRule = LintRule{
+	Name:        "identifiers",
+	Description: "ISBN, ISSN, LCCN and OCLC numbers are well formed and have valid check digits",
+	Check: func(rec Record) []LintIssue {
+		var issues []LintIssue
+		for _, id := range rec.Identifiers() {
+			if !id.Valid {
+				issues = append(issues, LintIssue{
+					Tag:     id.Tag,
+					Message: fmt.Sprintf("invalid %s %q: %s", identifierNames[id.Type], strings.TrimSpace(id.Raw), id.Problem),
+				})
+			}
+		}
+		return issues
+	},
+}
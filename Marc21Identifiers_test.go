@@ -0,0 +1,133 @@
+package gomarc21
+
+import (
+	"testing"
+)
+
+func TestIsbn(test *testing.T) {
+	tests := []struct {
+		raw    string
+		valid  bool
+		isbn13 string
+		isbn10 string
+	}{
+		{"0-306-40615-2 (pbk.)", true, "9780306406157", "0306406152"},
+		{"9780306406157", true, "9780306406157", "0306406152"},
+		{"080442957x", true, "9780804429573", "080442957X"},
+		{"979-10-90636-07-1", true, "9791090636071", ""},
+		{"0306406153", false, "", ""},
+		{"9780306406158 (hbk.)", false, "", ""},
+		{"12345", false, "", ""},
+	}
+	for _, t := range tests {
+		if ValidIsbn(t.raw) != t.valid {
+			test.Errorf("ValidIsbn(%q) should be %v", t.raw, t.valid)
+		}
+		if isbn13, err := Isbn13(t.raw); isbn13 != t.isbn13 || (err == nil) != t.valid {
+			test.Errorf("Isbn13(%q): expected %q, got %q, %v", t.raw, t.isbn13, isbn13, err)
+		}
+		if isbn10, _ := Isbn10(t.raw); isbn10 != t.isbn10 {
+			test.Errorf("Isbn10(%q): expected %q, got %q", t.raw, t.isbn10, isbn10)
+		}
+	}
+}
+
+func TestIssnLccnOclc(test *testing.T) {
+	for raw, valid := range map[string]bool{"0317-8471": true, "2434-561x": true, "0317-8472": false, "0317847": false} {
+		if ValidIssn(raw) != valid {
+			test.Errorf("ValidIssn(%q) should be %v", raw, valid)
+		}
+	}
+
+	lccns := map[string]string{
+		"n78-890351":         "n78890351",
+		"  85000002 ":        "85000002",
+		"85-2":               "85000002",
+		"2001-000002":        "2001000002",
+		"75-425165//r75":     "75425165",
+		" 79139101 /AC/r932": "79139101",
+	}
+	for raw, normalized := range lccns {
+		if got := NormalizeLccn(raw); got != normalized || !ValidLccn(raw) {
+			test.Errorf("NormalizeLccn(%q): expected %q, got %q", raw, normalized, got)
+		}
+	}
+	if ValidLccn("85-12345678") || ValidLccn("abcd85000002") {
+		test.Error("invalid LCCN was accepted")
+	}
+
+	for raw, normalized := range map[string]string{"(OCoLC)ocm00012345": "12345", "(OCoLC)1234567890": "1234567890", "on1234567890": "1234567890"} {
+		if got := NormalizeOclc(raw); got != normalized || !ValidOclc(raw) {
+			test.Errorf("NormalizeOclc(%q): expected %q, got %q", raw, normalized, got)
+		}
+	}
+	if ValidOclc("(OCoLC)abc") {
+		test.Error("invalid OCLC number was accepted")
+	}
+}
+
+func TestRecordIdentifiers(test *testing.T) {
+	rec := Record{
+		ControlFields: []ControlField{{Tag: "001", Data: "ocm00012345"}},
+		DataFields: []DataField{
+			{Tag: "010", Indicator1: " ", Indicator2: " ", SubFields: []SubField{{Code: "a", Data: "   85000002 "}}},
+			{Tag: "020", Indicator1: " ", Indicator2: " ", SubFields: []SubField{{Code: "a", Data: "0-306-40615-2 (pbk.)"}}},
+			{Tag: "020", Indicator1: " ", Indicator2: " ", SubFields: []SubField{{Code: "a", Data: "0306406153"}, {Code: "q", Data: "hardcover"}}},
+			{Tag: "022", Indicator1: " ", Indicator2: " ", SubFields: []SubField{{Code: "a", Data: "0317-8472"}}},
+			{Tag: "035", Indicator1: " ", Indicator2: " ", SubFields: []SubField{{Code: "a", Data: "(OCoLC)987654"}}},
+			{Tag: "035", Indicator1: " ", Indicator2: " ", SubFields: []SubField{{Code: "a", Data: "(CaOONL)1234"}}},
+		},
+	}
+
+	ids := rec.Identifiers()
+	if len(ids) != 5 {
+		test.Fatal("wrong number of identifiers", ids)
+	}
+	if ids[1].Normalized != "0306406152" || ids[1].Qualifier != "(pbk.)" || !ids[1].Valid {
+		test.Error("ISBN is wrong", ids[1])
+	}
+	if ids[2].Valid || ids[2].Problem != "wrong check digit" {
+		test.Error("invalid ISBN is wrong", ids[2])
+	}
+	if isbns := rec.Isbns(); len(isbns) != 1 || isbns[0] != "9780306406157" {
+		test.Error("Isbns is wrong", isbns)
+	}
+	if issns := rec.Issns(); len(issns) != 0 {
+		test.Error("Issns is wrong", issns)
+	}
+	if lccns := rec.Lccns(); len(lccns) != 1 || lccns[0] != "85000002" {
+		test.Error("Lccns is wrong", lccns)
+	}
+	if numbers := rec.OclcNumbers(); len(numbers) != 2 || numbers[0] != "987654" || numbers[1] != "12345" {
+		test.Error("OclcNumbers is wrong", numbers)
+	}
+
+	issues := rec.Lint([]LintRule{IdentifierLintRule})
+	if len(issues) != 2 || issues[0].Tag != "020" || issues[1].Tag != "022" || issues[0].Rule != "identifiers" {
+		test.Error("lint issues are wrong", issues)
+	}
+	if issues[0].String() != `[identifiers] 020: invalid ISBN "0306406153": wrong check digit` {
+		test.Error("lint issue is wrong", issues[0].String())
+	}
+
+	fixed, moved := rec.MoveInvalidIdentifiers()
+	if len(moved) != 2 {
+		test.Error("wrong number of moved identifiers", moved)
+	}
+	if fixed.DataFields[2].SubFields[0].Code != "z" || fixed.DataFields[3].SubFields[0].Code != "y" || fixed.DataFields[1].SubFields[0].Code != "a" {
+		test.Error("invalid identifiers were not moved", fixed.DataFields)
+	}
+	if rec.DataFields[2].SubFields[0].Code != "a" {
+		test.Error("the original record was changed")
+	}
+	if len(fixed.Lint([]LintRule{IdentifierLintRule})) != 0 {
+		test.Error("the fixed record still has issues")
+	}
+
+	if _, err := ParseLintRules("identifiers,nothing"); err == nil {
+		test.Error("unknown lint rule should not parse")
+	}
+	if rules, err := ParseLintRules(""); err != nil || len(rules) != len(LintRules) {
+		test.Error("all the lint rules should be returned", rules, err)
+	}
+}
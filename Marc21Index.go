@@ -0,0 +1,371 @@
+package gomarc21
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+An Index records where each record of a MARC file starts and how long it
+is, keyed by the control number (001) and, optionally, by the $a values
+of other fields such as 035 or 020. With an index a record can be read
+from a large file through io.ReaderAt without scanning the whole file.
+
+The index is persisted in a sidecar file next to the MARC file (see
+IndexFileName), one entry per line:
+
+    <key> TAB <byte offset> TAB <record length>
+
+preceded by a line with an empty key giving the size and the modification
+time (in nanoseconds since the epoch) of the MARC file indexed and the
+additional tags indexed, so that an index of a file changed since or of
+other tags is rebuilt:
+
+    TAB <size> TAB <modification time> TAB <tags>
+*/
+
+// ErrRecordNotFound is returned when no record matches the requested key.
+var ErrRecordNotFound = errors.New("record not found")
+
+// IndexEntry locates a single record inside a MARC file.
+type IndexEntry struct {
+	Offset int64
+	Length int
+}
+
+// Index maps record keys to the location of the records in a MARC file.
+type Index struct {
+	Entries map[string][]IndexEntry
+
+	// Tags are the additional tags indexed, see BuildIndex.
+	Tags string
+
+	// Size and ModTime are the size and the modification time of the
+	// MARC file indexed, when known.
+	Size    int64
+	ModTime time.Time
+}
+
+// IndexFileName returns the name of the sidecar index file for a MARC file.
+func IndexFileName(marcFile string) string {
+	return marcFile + ".idx"
+}
+
+// NewIndex returns an empty index.
+func NewIndex() *Index {
+	return &Index{Entries: map[string][]IndexEntry{}}
+}
+
+// BuildIndex scans the records of a reader and indexes them by control
+// number. tags is a comma separated list of additional data field tags
+// (e.g. "035,020") whose $a values are indexed as well; it may be empty.
+func BuildIndex(reader io.Reader, tags string) (*Index, error) {
+	idx := NewIndex()
+	idx.Tags = indexTags(tags)
+	tags = idx.Tags
+	var offset int64
+	for {
+		rawRec, err := NextRecord(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return idx, fmt.Errorf("record at offset %d: %s", offset, err)
+		}
+
+		rec, err := ParseRecord(rawRec)
+		if err != nil {
+			return idx, fmt.Errorf("record at offset %d: %s", offset, err)
+		}
+
+		entry := IndexEntry{Offset: offset, Length: len(rawRec)}
+		idx.Add(rec.ControlNum(), entry)
+		if tags != "" {
+			for _, df := range rec.GetDatafields(tags) {
+				for _, sf := range df.GetSubFields("a") {
+					idx.Add(sf.Data, entry)
+				}
+			}
+		}
+		offset += int64(len(rawRec))
+	}
+	return idx, nil
+}
+
+// indexTags returns a list of tags in the form kept by the index: sorted,
+// without blanks and repeats.
+func indexTags(tags string) string {
+	var list []string
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			list = append(list, tag)
+		}
+	}
+	sort.Strings(list)
+	unique := list[:0]
+	for i, tag := range list {
+		if i == 0 || tag != list[i-1] {
+			unique = append(unique, tag)
+		}
+	}
+	return strings.Join(unique, ",")
+}
+
+// Add adds an entry under a key. Blank keys are ignored.
+func (idx *Index) Add(key string, entry IndexEntry) {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return
+	}
+	for _, e := range idx.Entries[key] {
+		if e == entry {
+			return
+		}
+	}
+	idx.Entries[key] = append(idx.Entries[key], entry)
+}
+
+// Lookup returns the entries stored under a key.
+func (idx *Index) Lookup(key string) []IndexEntry {
+	return idx.Entries[strings.TrimSpace(key)]
+}
+
+// Keys returns all the keys of the index in sorted order.
+func (idx *Index) Keys() []string {
+	keys := make([]string, 0, len(idx.Entries))
+	for k := range idx.Entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Write writes the index in the sidecar file format.
+func (idx *Index) Write(writer io.Writer) error {
+	w := bufio.NewWriter(writer)
+	if !idx.ModTime.IsZero() {
+		if _, err := fmt.Fprintf(w, "\t%d\t%d\t%s\n", idx.Size, idx.ModTime.UnixNano(), idx.Tags); err != nil {
+			return err
+		}
+	}
+	for _, key := range idx.Keys() {
+		for _, e := range idx.Entries[key] {
+			if _, err := fmt.Fprintf(w, "%s\t%d\t%d\n", key, e.Offset, e.Length); err != nil {
+				return err
+			}
+		}
+	}
+	return w.Flush()
+}
+
+// ReadIndex reads an index written by Index.Write.
+func ReadIndex(reader io.Reader) (*Index, error) {
+	idx := NewIndex()
+	scanner := bufio.NewScanner(reader)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if scanner.Text() == "" {
+			continue
+		}
+		cols := strings.Split(scanner.Text(), "\t")
+		if cols[0] == "" && len(cols) == 4 {
+			// the tags indexed, after the size and the modification time
+			idx.Tags = cols[3]
+			cols = cols[:3]
+		}
+		if len(cols) != 3 {
+			return nil, fmt.Errorf("index line %d: expected 3 columns, but found %d", line, len(cols))
+		}
+		offset, err := strconv.ParseInt(cols[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("index line %d: invalid offset %q", line, cols[1])
+		}
+		if cols[0] == "" {
+			// the size and the modification time of the MARC file
+			modTime, err := strconv.ParseInt(cols[2], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("index line %d: invalid modification time %q", line, cols[2])
+			}
+			idx.Size, idx.ModTime = offset, time.Unix(0, modTime)
+			continue
+		}
+		length, err := strconv.Atoi(cols[2])
+		if err != nil {
+			return nil, fmt.Errorf("index line %d: invalid length %q", line, cols[2])
+		}
+		idx.Add(cols[0], IndexEntry{Offset: offset, Length: length})
+	}
+	return idx, scanner.Err()
+}
+
+// WriteIndexFile builds the index of a MARC file and saves it in the
+// sidecar file.
+func WriteIndexFile(marcFile string, tags string) (*Index, error) {
+	data, err := os.Open(marcFile)
+	if err != nil {
+		return nil, err
+	}
+	defer data.Close()
+	info, err := data.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := BuildIndex(data, tags)
+	if err != nil {
+		return nil, err
+	}
+	idx.Size, idx.ModTime = info.Size(), info.ModTime()
+
+	out, err := os.Create(IndexFileName(marcFile))
+	if err != nil {
+		return nil, err
+	}
+	if err := idx.Write(out); err != nil {
+		out.Close()
+		return nil, err
+	}
+	return idx, out.Close()
+}
+
+// IndexedFile gives random access to the records of a MARC file.
+type IndexedFile struct {
+	reader io.ReaderAt
+	closer io.Closer
+	Index  *Index
+}
+
+// NewIndexedFile returns an IndexedFile reading records from reader at
+// the locations given by idx.
+func NewIndexedFile(reader io.ReaderAt, idx *Index) *IndexedFile {
+	return &IndexedFile{reader: reader, Index: idx}
+}
+
+// OpenIndexedFile opens a MARC file together with its sidecar index.
+// The index is built (with tags, see BuildIndex) and saved when the
+// sidecar file does not exist yet, cannot be read, is of the MARC file
+// as it was before a change or is of other tags.
+func OpenIndexedFile(marcFile string, tags string) (*IndexedFile, error) {
+	info, err := os.Stat(marcFile)
+	if err != nil {
+		return nil, err
+	}
+	var idx *Index
+	if sidecar, err := os.Open(IndexFileName(marcFile)); err == nil {
+		idx, err = ReadIndex(sidecar)
+		sidecar.Close()
+		if err != nil || idx.Size != info.Size() || !idx.ModTime.Equal(info.ModTime()) || idx.Tags != indexTags(tags) {
+			idx = nil
+		}
+	}
+	if idx == nil {
+		if idx, err = WriteIndexFile(marcFile, tags); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := os.Open(marcFile)
+	if err != nil {
+		return nil, err
+	}
+	f := NewIndexedFile(data, idx)
+	f.closer = data
+	return f, nil
+}
+
+// GetRaw returns the unparsed bytes of the first record stored under id.
+func (f *IndexedFile) GetRaw(id string) ([]byte, error) {
+	entries := f.Index.Lookup(id)
+	if len(entries) == 0 {
+		return nil, ErrRecordNotFound
+	}
+	rawRec, _, err := f.readAt(entries[0], id)
+	return rawRec, err
+}
+
+// Get returns the first record stored under id.
+func (f *IndexedFile) Get(id string) (Record, error) {
+	entries := f.Index.Lookup(id)
+	if len(entries) == 0 {
+		return Record{}, ErrRecordNotFound
+	}
+	_, rec, err := f.readAt(entries[0], id)
+	return rec, err
+}
+
+// GetAll returns all the records stored under id.
+func (f *IndexedFile) GetAll(id string) ([]Record, error) {
+	var recs []Record
+	for _, e := range f.Index.Lookup(id) {
+		_, rec, err := f.readAt(e, id)
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, rec)
+	}
+	if len(recs) == 0 {
+		return nil, ErrRecordNotFound
+	}
+	return recs, nil
+}
+
+// readAt reads and parses the record of an entry, checking that it has
+// the key it is indexed under: the index of a file changed since it was
+// built points at the wrong bytes.
+func (f *IndexedFile) readAt(e IndexEntry, key string) ([]byte, Record, error) {
+	if e.Length <= LEADER_LEN {
+		return nil, Record{}, fmt.Errorf("invalid record length %d at offset %d", e.Length, e.Offset)
+	}
+	rawRec := make([]byte, e.Length)
+	if _, err := f.reader.ReadAt(rawRec, e.Offset); err != nil {
+		return nil, Record{}, err
+	}
+	if rawRec[len(rawRec)-1] != END_OF_RECORD {
+		return nil, Record{}, fmt.Errorf("no record terminator at offset %d, the index may be stale", e.Offset)
+	}
+	rec, err := ParseRecord(rawRec)
+	if err != nil {
+		return nil, Record{}, err
+	}
+	if !recordHasKey(rec, key, f.Index.Tags) {
+		return nil, Record{}, fmt.Errorf("the record at offset %d is not %s, the index may be stale", e.Offset, key)
+	}
+	return rawRec, rec, nil
+}
+
+// recordHasKey tells if key is the control number of rec or one of the
+// $a values of the additional tags indexed.
+func recordHasKey(rec Record, key string, tags string) bool {
+	key = strings.TrimSpace(key)
+	if strings.TrimSpace(rec.ControlNum()) == key {
+		return true
+	}
+	if tags == "" {
+		return false
+	}
+	for _, df := range rec.GetDatafields(tags) {
+		for _, sf := range df.GetSubFields("a") {
+			if strings.TrimSpace(sf.Data) == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Close closes the underlying MARC file when it was opened by
+// OpenIndexedFile.
+func (f *IndexedFile) Close() error {
+	if f.closer == nil {
+		return nil
+	}
+	return f.closer.Close()
+}
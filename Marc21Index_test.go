@@ -0,0 +1,127 @@
+package gomarc21
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBuildIndex(test *testing.T) {
+	data, err := os.Open("data/test_10.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer data.Close()
+
+	idx, err := BuildIndex(data, "086, 086")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	entries := idx.Lookup("ocm57177939")
+	if len(entries) != 1 || entries[0].Offset != 4471 || entries[0].Length != 2160 {
+		test.Error("ocm57177939 should be at 4471 with length 2160, but got", entries)
+	}
+	if len(idx.Lookup("I 19.4/2:735")) != 1 {
+		test.Error("086 $a should be indexed")
+	}
+
+	idx.Size, idx.ModTime = 21013, time.Unix(1100000000, 5)
+	var buf bytes.Buffer
+	if err := idx.Write(&buf); err != nil {
+		test.Fatal(err)
+	}
+	idx2, err := ReadIndex(&buf)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(idx2.Entries) != len(idx.Entries) || idx2.Lookup("ocm57177939")[0] != entries[0] ||
+		idx2.Size != idx.Size || !idx2.ModTime.Equal(idx.ModTime) || idx2.Tags != "086" {
+		test.Error("index round trip failed")
+	}
+}
+
+func TestIndexedFileGet(test *testing.T) {
+	raw, err := os.ReadFile("data/test_10.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+	marcFile := filepath.Join(test.TempDir(), "test_10.mrc")
+	if err := os.WriteFile(marcFile, raw, 0640); err != nil {
+		test.Fatal(err)
+	}
+
+	f, err := OpenIndexedFile(marcFile, "")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := os.Stat(IndexFileName(marcFile)); err != nil {
+		test.Error("the sidecar index should be written", err)
+	}
+
+	rec, err := f.Get("ocm57178216")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if rec.ControlNum() != "ocm57178216" {
+		test.Error("got the wrong record", rec.ControlNum())
+	}
+
+	if _, err := f.Get("missing"); err != ErrRecordNotFound {
+		test.Error("missing id should return ErrRecordNotFound, but got", err)
+	}
+
+	// the second open reads the sidecar file instead of rebuilding it
+	f2, err := OpenIndexedFile(marcFile, "")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f2.Close()
+	recs, err := f2.GetAll("ocm57175940")
+	if err != nil || len(recs) != 1 {
+		test.Error("GetAll failed", err)
+	}
+
+	// a changed file: the index read before the change points at the
+	// wrong records, the sidecar file is rebuilt
+	if err := os.WriteFile(marcFile, raw[1805:], 0640); err != nil {
+		test.Fatal(err)
+	}
+	os.Chtimes(marcFile, time.Now(), time.Now().Add(time.Hour))
+	stale := NewIndexedFile(bytes.NewReader(raw[1805:]), f2.Index)
+	if rec, err := stale.Get("ocm57178216"); err == nil {
+		test.Error("a stale index returned", rec.ControlNum())
+	}
+	f3, err := OpenIndexedFile(marcFile, "")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f3.Close()
+	if rec, err := f3.Get("ocm57178216"); err != nil || rec.ControlNum() != "ocm57178216" {
+		test.Error("the index was not rebuilt", err)
+	}
+	if _, err := f3.Get("ocm57175940"); err != ErrRecordNotFound {
+		test.Error("the removed record should not be found, but got", err)
+	}
+
+	// an index of other tags is rebuilt
+	f4, err := OpenIndexedFile(marcFile, "086")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f4.Close()
+	if recs, err := f4.GetAll("GA 1.13:GAO-05-30"); err != nil || len(recs) == 0 {
+		test.Error("the index was not rebuilt with the tags", err)
+	}
+
+	// only the $a of the tags indexed are keys: the record has GPO in
+	// its 040 $a
+	f4.Index.Entries["GPO"] = f4.Index.Lookup("ocm57178216")
+	if rec, err := f4.Get("GPO"); err == nil {
+		test.Error("a record without the key was returned", rec.ControlNum())
+	}
+}
@@ -0,0 +1,128 @@
+package gomarc21
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+Items (copies) are often exported by integrated library systems as fields
+embedded in the bibliographic records, one field per item. The tag and
+the subfields used differ from system to system, so an ItemMapping says
+which subfields hold which item element. The preset mappings are:
+
+    koha    952 $p barcode, $o call number, $a library, $c location,
+                $7 status (not for loan), $y item type
+    sierra  949 $i barcode, $a call number, $l location, $s status,
+                $t item type
+    alma    852 $p barcode, $h $i call number, $a library, $c location,
+                $x status
+
+A mapping can also be written as a spec, e.g.
+
+    952:barcode=p,callnumber=o,library=a,location=c,status=7,itemtype=y
+*/
+
+// ItemMapping maps the subfields of an embedded item field to the item
+// elements. Each element is a list of subfield codes; the data of the
+// subfields are joined with spaces.
+type ItemMapping struct {
+	Tag        string
+	Barcode    string
+	CallNumber string
+	Library    string
+	Location   string
+	Status     string
+	ItemType   string
+}
+
+// ItemMappings are the preset mappings of some common systems.
+var ItemMappings = map[string]ItemMapping{
+	"koha":   {Tag: "952", Barcode: "p", CallNumber: "o", Library: "a", Location: "c", Status: "7", ItemType: "y"},
+	"sierra": {Tag: "949", Barcode: "i", CallNumber: "a", Location: "l", Status: "s", ItemType: "t"},
+	"alma":   {Tag: "852", Barcode: "p", CallNumber: "hi", Library: "a", Location: "c", Status: "x"},
+}
+
+// Item is an item (copy) of a bibliographic record.
+type Item struct {
+	Barcode    string    `json:"barcode,omitempty"`
+	CallNumber string    `json:"call_number,omitempty"`
+	Library    string    `json:"library,omitempty"`
+	Location   string    `json:"location,omitempty"`
+	Status     string    `json:"status,omitempty"`
+	ItemType   string    `json:"item_type,omitempty"`
+	Field      DataField `json:"-"`
+}
+
+// ParseItemMapping parses a mapping spec such as
+// "949:barcode=i,callnumber=a,location=l,status=s" or returns the preset
+// mapping with that name.
+func ParseItemMapping(spec string) (ItemMapping, error) {
+	if m, ok := ItemMappings[strings.ToLower(spec)]; ok {
+		return m, nil
+	}
+
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts[0]) != 3 {
+		return ItemMapping{}, fmt.Errorf("invalid item mapping %q: it should start with a tag", spec)
+	}
+	m := ItemMapping{Tag: parts[0]}
+	if len(parts) == 1 {
+		return m, nil
+	}
+	for _, element := range strings.Split(parts[1], ",") {
+		kv := strings.SplitN(strings.TrimSpace(element), "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return ItemMapping{}, fmt.Errorf("invalid item mapping element %q", element)
+		}
+		switch strings.ToLower(kv[0]) {
+		case "barcode":
+			m.Barcode = kv[1]
+		case "callnumber", "call_number":
+			m.CallNumber = kv[1]
+		case "library":
+			m.Library = kv[1]
+		case "location":
+			m.Location = kv[1]
+		case "status":
+			m.Status = kv[1]
+		case "itemtype", "item_type":
+			m.ItemType = kv[1]
+		default:
+			return ItemMapping{}, fmt.Errorf("unknown item element %q", kv[0])
+		}
+	}
+	return m, nil
+}
+
+// itemValue joins the data of the subfields with the given codes.
+func itemValue(df DataField, codes string) string {
+	if codes == "" {
+		return ""
+	}
+	var values []string
+	for _, sf := range df.GetSubFields(codes) {
+		if v := strings.TrimSpace(sf.Data); v != "" {
+			values = append(values, v)
+		}
+	}
+	return strings.Join(values, " ")
+}
+
+// Items returns the items embedded in the record as fields of the mapping
+// tag.
+func (rec Record) Items(mapping ItemMapping) []Item {
+	var items []Item
+	for _, df := range rec.GetDatafields(mapping.Tag) {
+		items = append(items, Item{
+			Barcode:    itemValue(df, mapping.Barcode),
+			CallNumber: itemValue(df, mapping.CallNumber),
+			Library:    itemValue(df, mapping.Library),
+			Location:   itemValue(df, mapping.Location),
+			Status:     itemValue(df, mapping.Status),
+			ItemType:   itemValue(df, mapping.ItemType),
+			Field:      df,
+		})
+	}
+	return items
+}
@@ -0,0 +1,50 @@
+package gomarc21
+
+import (
+	"testing"
+)
+
+func TestItems(test *testing.T) {
+	rec := Record{DataFields: []DataField{
+		{Tag: "245", Indicator1: "1", Indicator2: "0", SubFields: []SubField{{Code: "a", Data: "A title."}}},
+		{Tag: "952", Indicator1: " ", Indicator2: " ", SubFields: []SubField{
+			{Code: "a", Data: "MAIN"}, {Code: "c", Data: "STACKS"}, {Code: "o", Data: "QA76.73.G63 D66 2016"}, {Code: "p", Data: "31234000123456"}, {Code: "7", Data: "0"}, {Code: "y", Data: "BOOK"},
+		}},
+		{Tag: "952", Indicator1: " ", Indicator2: " ", SubFields: []SubField{
+			{Code: "a", Data: "BRANCH"}, {Code: "p", Data: "31234000654321"}, {Code: "7", Data: "1"},
+		}},
+		{Tag: "949", Indicator1: " ", Indicator2: "1", SubFields: []SubField{
+			{Code: "a", Data: "005.133"}, {Code: "b", Data: "GO"}, {Code: "i", Data: "39876"}, {Code: "l", Data: "adult"}, {Code: "s", Data: "-"},
+		}},
+	}}
+
+	items := rec.Items(ItemMappings["koha"])
+	if len(items) != 2 {
+		test.Fatal("wrong number of items", items)
+	}
+	if items[0].Barcode != "31234000123456" || items[0].CallNumber != "QA76.73.G63 D66 2016" || items[0].Library != "MAIN" ||
+		items[0].Location != "STACKS" || items[0].Status != "0" || items[0].ItemType != "BOOK" {
+		test.Error("first item is wrong", items[0])
+	}
+	if items[1].Barcode != "31234000654321" || items[1].CallNumber != "" || items[1].Status != "1" {
+		test.Error("second item is wrong", items[1])
+	}
+
+	mapping, err := ParseItemMapping("949:barcode=i,callnumber=ab,location=l,status=s")
+	if err != nil {
+		test.Fatal(err)
+	}
+	items = rec.Items(mapping)
+	if len(items) != 1 || items[0].Barcode != "39876" || items[0].CallNumber != "005.133 GO" || items[0].Location != "adult" || items[0].Status != "-" {
+		test.Error("item of the parsed mapping is wrong", items)
+	}
+
+	if m, err := ParseItemMapping("Sierra"); err != nil || m.Tag != "949" {
+		test.Error("preset mapping was not found", m, err)
+	}
+	for _, spec := range []string{"95", "952:barcode", "952:shelf=a"} {
+		if _, err := ParseItemMapping(spec); err == nil {
+			test.Errorf("mapping %q should not parse", spec)
+		}
+	}
+}
@@ -1,10 +1,21 @@
 package gomarc21
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 )
 
+// jsonString quotes a value as a JSON string, without escaping HTML
+// characters.
+func jsonString(value string) string {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(value)
+	return string(bytes.TrimRight(b.Bytes(), "\n"))
+}
+
 func (record Record) RecordAsJson() (string, error) {
 	j := JsonRecord{
 		Leader:        string(record.Leader.raw),
@@ -32,7 +43,6 @@ func (record Record) RecordAsJson() (string, error) {
 	fieldStr += "]"
 
 	b := "{  \"leader\":" + string(leaderJson) + "," + fieldStr + "}"
-	fmt.Print(string(b))
 
 	return string(b), err
 }
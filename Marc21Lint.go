@@ -0,0 +1,68 @@
+package gomarc21
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LintIssue is a problem found in a record by a lint rule.
+type LintIssue struct {
+	Rule    string `json:"rule"`
+	Tag     string `json:"tag,omitempty"`
+	Message string `json:"message"`
+}
+
+func (issue LintIssue) String() string {
+	if issue.Tag == "" {
+		return fmt.Sprintf("[%s] %s", issue.Rule, issue.Message)
+	}
+	return fmt.Sprintf("[%s] %s: %s", issue.Rule, issue.Tag, issue.Message)
+}
+
+// LintRule checks one aspect of a record.
+type LintRule struct {
+	Name        string
+	Description string
+	Check       func(rec Record) []LintIssue
+}
+
+// LintRules are the available lint rules by name.
+var LintRules = map[string]LintRule{
+	IdentifierLintRule.Name: IdentifierLintRule,
+}
+
+// ParseLintRules returns the rules with the given comma separated names,
+// or all the rules when names is empty.
+func ParseLintRules(names string) ([]LintRule, error) {
+	if strings.TrimSpace(names) == "" {
+		all := make([]string, 0, len(LintRules))
+		for name := range LintRules {
+			all = append(all, name)
+		}
+		sort.Strings(all)
+		names = strings.Join(all, ",")
+	}
+
+	var rules []LintRule
+	for _, name := range strings.Split(names, ",") {
+		rule, ok := LintRules[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown lint rule %q", name)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Lint checks the record with the rules and returns the issues found.
+func (rec Record) Lint(rules []LintRule) []LintIssue {
+	var issues []LintIssue
+	for _, rule := range rules {
+		for _, issue := range rule.Check(rec) {
+			issue.Rule = rule.Name
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
@@ -0,0 +1,730 @@
+package gomarc21
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+)
+
+/*
+MARC 21 to MODS 3.7, following the mappings of the LC MARC21slim2MODS3-7
+stylesheet:
+
+source: https://www.loc.gov/standards/mods/mods-mapping.html
+        https://www.loc.gov/standards/mods/v3/MARC21slim2MODS3-7.xsl
+
+    titleInfo            245 (nonSort from ind2), 130/240 uniform,
+                         210 abbreviated, 246 alternative, 242 translated
+    name                 100/110/111, 700/710/711 with roles from $e/$j/$4
+    typeOfResource       Leader/06, Leader/07
+    genre                655
+    originInfo           008/07-10, 008/15-17, 250, 260, 264, Leader/07
+    language             008/35-37, 041
+    physicalDescription  008 form, 300, 337, 338, 856 $q
+    abstract             520
+    tableOfContents      505
+    targetAudience       521
+    note                 5XX
+    subject              600, 610, 611, 630, 648, 650, 651, 653
+    classification       050, 060, 080, 082, 086
+    relatedItem          440, 490, 800, 810, 811, 830, 76X-78X
+    identifier           010, 020, 022, 024, 035
+    location             856
+    accessCondition      506, 540
+    recordInfo           001, 003, 005, 008/00-05, 040, Leader/18
+*/
+
+const (
+	ModsNamespace = "http://www.loc.gov/mods/v3"
+	ModsVersion   = "3.7"
+
+	ModsCollectionHeader = "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<modsCollection xmlns=\"" + ModsNamespace + "\">\n"
+	ModsCollectionFooter = "</modsCollection>\n"
+)
+
+// Mods is a MODS record.
+type Mods struct {
+	XMLName             xml.Name                 `xml:"http://www.loc.gov/mods/v3 mods"`
+	Version             string                   `xml:"version,attr"`
+	TitleInfo           []ModsTitleInfo          `xml:"titleInfo"`
+	Name                []ModsName               `xml:"name"`
+	TypeOfResource      *ModsTypeOfResource      `xml:"typeOfResource"`
+	Genre               []ModsTerm               `xml:"genre"`
+	OriginInfo          []ModsOriginInfo         `xml:"originInfo"`
+	Language            []ModsLanguage           `xml:"language"`
+	PhysicalDescription *ModsPhysicalDescription `xml:"physicalDescription"`
+	Abstract            []ModsTerm               `xml:"abstract"`
+	TableOfContents     []ModsTerm               `xml:"tableOfContents"`
+	TargetAudience      []ModsTerm               `xml:"targetAudience"`
+	Note                []ModsTerm               `xml:"note"`
+	Subject             []ModsSubject            `xml:"subject"`
+	Classification      []ModsTerm               `xml:"classification"`
+	RelatedItem         []ModsRelatedItem        `xml:"relatedItem"`
+	Identifier          []ModsTerm               `xml:"identifier"`
+	Location            []ModsLocation           `xml:"location"`
+	AccessCondition     []ModsTerm               `xml:"accessCondition"`
+	RecordInfo          *ModsRecordInfo          `xml:"recordInfo"`
+}
+
+// ModsTerm is a MODS element holding text and the common attributes.
+type ModsTerm struct {
+	Type      string `xml:"type,attr,omitempty"`
+	Authority string `xml:"authority,attr,omitempty"`
+	Encoding  string `xml:"encoding,attr,omitempty"`
+	KeyDate   string `xml:"keyDate,attr,omitempty"`
+	Source    string `xml:"source,attr,omitempty"`
+	Invalid   string `xml:"invalid,attr,omitempty"`
+	Value     string `xml:",chardata"`
+}
+
+type ModsTitleInfo struct {
+	Type       string   `xml:"type,attr,omitempty"`
+	NonSort    string   `xml:"nonSort,omitempty"`
+	Title      string   `xml:"title"`
+	SubTitle   string   `xml:"subTitle,omitempty"`
+	PartNumber []string `xml:"partNumber,omitempty"`
+	PartName   []string `xml:"partName,omitempty"`
+}
+
+type ModsName struct {
+	Type     string     `xml:"type,attr,omitempty"`
+	Usage    string     `xml:"usage,attr,omitempty"`
+	NamePart []ModsTerm `xml:"namePart"`
+	Role     []ModsRole `xml:"role,omitempty"`
+}
+
+type ModsRole struct {
+	RoleTerm []ModsTerm `xml:"roleTerm"`
+}
+
+type ModsTypeOfResource struct {
+	Manuscript string `xml:"manuscript,attr,omitempty"`
+	Collection string `xml:"collection,attr,omitempty"`
+	Value      string `xml:",chardata"`
+}
+
+type ModsOriginInfo struct {
+	EventType  string      `xml:"eventType,attr,omitempty"`
+	Place      []ModsPlace `xml:"place,omitempty"`
+	Publisher  []string    `xml:"publisher,omitempty"`
+	DateIssued []ModsTerm  `xml:"dateIssued,omitempty"`
+	Edition    string      `xml:"edition,omitempty"`
+	Issuance   string      `xml:"issuance,omitempty"`
+}
+
+type ModsPlace struct {
+	PlaceTerm ModsTerm `xml:"placeTerm"`
+}
+
+type ModsLanguage struct {
+	LanguageTerm ModsTerm `xml:"languageTerm"`
+}
+
+type ModsPhysicalDescription struct {
+	Form              []ModsTerm `xml:"form,omitempty"`
+	InternetMediaType []string   `xml:"internetMediaType,omitempty"`
+	Extent            []string   `xml:"extent,omitempty"`
+}
+
+// ModsSubject keeps the subdivisions (topic, geographic, temporal, genre)
+// of a heading in the order they appear in the MARC field.
+type ModsSubject struct {
+	Authority string         `xml:"authority,attr,omitempty"`
+	Name      *ModsName      `xml:"name,omitempty"`
+	TitleInfo *ModsTitleInfo `xml:"titleInfo,omitempty"`
+	Parts     []ModsElement
+}
+
+// ModsElement is a text element whose name is only known at run time.
+type ModsElement struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+type ModsRelatedItem struct {
+	Type       string          `xml:"type,attr,omitempty"`
+	TitleInfo  []ModsTitleInfo `xml:"titleInfo,omitempty"`
+	Name       []ModsName      `xml:"name,omitempty"`
+	Note       []ModsTerm      `xml:"note,omitempty"`
+	Identifier []ModsTerm      `xml:"identifier,omitempty"`
+}
+
+type ModsLocation struct {
+	Url []ModsUrl `xml:"url"`
+}
+
+type ModsUrl struct {
+	Note  string `xml:"note,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+type ModsRecordInfo struct {
+	DescriptionStandard  string        `xml:"descriptionStandard,omitempty"`
+	RecordContentSource  *ModsTerm     `xml:"recordContentSource,omitempty"`
+	RecordCreationDate   *ModsTerm     `xml:"recordCreationDate,omitempty"`
+	RecordChangeDate     *ModsTerm     `xml:"recordChangeDate,omitempty"`
+	RecordIdentifier     *ModsTerm     `xml:"recordIdentifier,omitempty"`
+	RecordOrigin         string        `xml:"recordOrigin,omitempty"`
+	LanguageOfCataloging *ModsLanguage `xml:"languageOfCataloging,omitempty"`
+}
+
+// modsTypeOfResource maps leader/06 to the MODS typeOfResource values.
+var modsTypeOfResource = map[byte]string{
+	'a': "text",
+	'c': "notated music",
+	'd': "notated music",
+	'e': "cartographic",
+	'f': "cartographic",
+	'g': "moving image",
+	'i': "sound recording-nonmusical",
+	'j': "sound recording-musical",
+	'k': "still image",
+	'm': "software, multimedia",
+	'o': "mixed material",
+	'p': "mixed material",
+	'r': "three dimensional object",
+	't': "text",
+}
+
+// modsSubjectAuthority maps the second indicator of 6XX fields to the
+// subject thesaurus.
+var modsSubjectAuthority = map[string]string{
+	"0": "lcsh",
+	"1": "lcshac",
+	"2": "mesh",
+	"3": "nal",
+	"5": "csh",
+	"6": "rvm",
+}
+
+// modsRelatedItemType maps the linking entry fields to relatedItem types.
+var modsRelatedItemType = map[string]string{
+	"760": "series",
+	"762": "constituent",
+	"765": "original",
+	"767": "otherVersion",
+	"773": "host",
+	"774": "constituent",
+	"775": "otherVersion",
+	"776": "otherFormat",
+	"780": "preceding",
+	"785": "succeeding",
+	"786": "original",
+}
+
+// modsNoteType maps 5XX tags to note types.
+var modsNoteType = map[string]string{
+	"500": "",
+	"501": "",
+	"502": "thesis",
+	"504": "bibliography",
+	"508": "creation/production credits",
+	"510": "citation/reference",
+	"511": "performers",
+	"515": "numbering",
+	"518": "venue",
+	"524": "preferred citation",
+	"530": "additional physical form",
+	"533": "reproduction",
+	"534": "original version",
+	"535": "original location",
+	"536": "funding",
+	"538": "system details",
+	"541": "acquisition",
+	"545": "biographical/historical",
+	"546": "language",
+	"561": "ownership",
+	"562": "version identification",
+	"581": "publications",
+	"583": "action",
+	"585": "exhibitions",
+}
+
+// Mods maps the record to MODS 3.7.
+func (rec Record) Mods() Mods {
+	m := Mods{Version: ModsVersion}
+	leader := rec.Leader
+
+	m.TitleInfo = rec.modsTitles()
+	for _, df := range rec.GetDatafields("100,110,111,700,710,711") {
+		m.Name = append(m.Name, modsName(df))
+	}
+
+	if t, ok := modsTypeOfResource[leader.TypeOfRecord]; ok {
+		m.TypeOfResource = &ModsTypeOfResource{Value: t}
+		if strings.IndexByte("dft", leader.TypeOfRecord) >= 0 {
+			m.TypeOfResource.Manuscript = "yes"
+		}
+		if leader.BibLevel == 'c' {
+			m.TypeOfResource.Collection = "yes"
+		}
+	}
+
+	for _, df := range rec.GetDatafields("655") {
+		m.Genre = append(m.Genre, ModsTerm{Authority: subjectAuthority(df), Value: subjectString(df)})
+	}
+
+	m.OriginInfo = rec.modsOriginInfo()
+	m.Language = rec.modsLanguages()
+	m.PhysicalDescription = rec.modsPhysicalDescription()
+
+	for _, df := range rec.GetDatafields("520") {
+		m.Abstract = append(m.Abstract, ModsTerm{Value: joinSubFields(df, "ab", " ")})
+	}
+	for _, df := range rec.GetDatafields("505") {
+		m.TableOfContents = append(m.TableOfContents, ModsTerm{Value: joinSubFields(df, "agrt", " ")})
+	}
+	for _, df := range rec.GetDatafields("521") {
+		m.TargetAudience = append(m.TargetAudience, ModsTerm{Value: joinSubFields(df, "ab", " ")})
+	}
+	for _, df := range rec.DataFields {
+		if noteType, ok := modsNoteType[df.Tag.GetTag()]; ok {
+			m.Note = append(m.Note, ModsTerm{Type: noteType, Value: joinSubFields(df, "abcdefghijklmnopqrstuvwxyz", " ")})
+		}
+	}
+
+	for _, df := range rec.GetDatafields("600,610,611,630,648,650,651,653") {
+		m.Subject = append(m.Subject, modsSubject(df))
+	}
+
+	m.Classification = rec.modsClassifications()
+	m.RelatedItem = rec.modsRelatedItems()
+	m.Identifier = rec.modsIdentifiers()
+
+	for _, df := range rec.GetDatafields("856") {
+		loc := ModsLocation{}
+		note := joinSubFields(df, "3z", " ")
+		for _, sf := range df.GetSubFields("u") {
+			loc.Url = append(loc.Url, ModsUrl{Note: note, Value: sf.Data})
+		}
+		if len(loc.Url) > 0 {
+			m.Location = append(m.Location, loc)
+		}
+	}
+
+	for _, df := range rec.GetDatafields("506") {
+		m.AccessCondition = append(m.AccessCondition, ModsTerm{Type: "restriction on access", Value: joinSubFields(df, "abcd", " ")})
+	}
+	for _, df := range rec.GetDatafields("540") {
+		m.AccessCondition = append(m.AccessCondition, ModsTerm{Type: "use and reproduction", Value: joinSubFields(df, "abcd", " ")})
+	}
+
+	m.RecordInfo = rec.modsRecordInfo()
+	return m
+}
+
+func (rec Record) modsTitles() (titles []ModsTitleInfo) {
+	for _, df := range rec.GetDatafields("245") {
+		title := modsTitleInfo(df, "afgks", "")
+		// the nonfiling characters are counted in characters, not bytes
+		runes := []rune(title.Title)
+		if n, err := strconv.Atoi(df.GetIndicator2()); err == nil && n > 0 && n < len(runes) {
+			title.NonSort = string(runes[:n])
+			title.Title = string(runes[n:])
+		}
+		titles = append(titles, title)
+	}
+	for _, df := range rec.GetDatafields("210") {
+		titles = append(titles, modsTitleInfo(df, "a", "abbreviated"))
+	}
+	for _, df := range rec.GetDatafields("242") {
+		titles = append(titles, modsTitleInfo(df, "a", "translated"))
+	}
+	for _, df := range rec.GetDatafields("130,240") {
+		titles = append(titles, modsTitleInfo(df, "adfklmors", "uniform"))
+	}
+	for _, df := range rec.GetDatafields("246") {
+		titles = append(titles, modsTitleInfo(df, "af", "alternative"))
+	}
+	return titles
+}
+
+// modsTitleInfo builds a titleInfo from the title subfields given by codes
+// plus the $b subtitle, $n part numbers and $p part names of a field.
+func modsTitleInfo(df DataField, codes string, titleType string) ModsTitleInfo {
+	t := ModsTitleInfo{
+		Type:     titleType,
+		Title:    joinSubFields(df, codes, " "),
+		SubTitle: joinSubFields(df, "b", " "),
+	}
+	for _, sf := range df.GetSubFields("n") {
+		t.PartNumber = append(t.PartNumber, chopPunctuation(sf.Data))
+	}
+	for _, sf := range df.GetSubFields("p") {
+		t.PartName = append(t.PartName, chopPunctuation(sf.Data))
+	}
+	return t
+}
+
+func modsName(df DataField) ModsName {
+	tag := df.Tag.GetTag()
+	name := ModsName{}
+	if tag[0] == '1' {
+		name.Usage = "primary"
+	}
+
+	roleCode := "e"
+	switch tag[1:] {
+	case "00":
+		name.Type = "personal"
+		name.NamePart = append(name.NamePart, ModsTerm{Value: joinSubFields(df, "aq", " ")})
+		if v := joinSubFields(df, "bc", " "); v != "" {
+			name.NamePart = append(name.NamePart, ModsTerm{Type: "termsOfAddress", Value: v})
+		}
+		if v := joinSubFields(df, "d", " "); v != "" {
+			name.NamePart = append(name.NamePart, ModsTerm{Type: "date", Value: v})
+		}
+	case "10":
+		name.Type = "corporate"
+		for _, sf := range df.GetSubFields("ab") {
+			name.NamePart = append(name.NamePart, ModsTerm{Value: chopPunctuation(sf.Data)})
+		}
+		if v := joinSubFields(df, "d", " "); v != "" {
+			name.NamePart = append(name.NamePart, ModsTerm{Type: "date", Value: v})
+		}
+	case "11":
+		name.Type = "conference"
+		name.NamePart = append(name.NamePart, ModsTerm{Value: joinSubFields(df, "acdnq", " ")})
+		roleCode = "j"
+	}
+
+	role := ModsRole{}
+	for _, sf := range df.GetSubFields(roleCode) {
+		role.RoleTerm = append(role.RoleTerm, ModsTerm{Type: "text", Authority: "marcrelator", Value: chopPunctuation(sf.Data)})
+	}
+	for _, sf := range df.GetSubFields("4") {
+		role.RoleTerm = append(role.RoleTerm, ModsTerm{Type: "code", Authority: "marcrelator", Value: strings.TrimSpace(sf.Data)})
+	}
+	if len(role.RoleTerm) == 0 && tag[0] == '1' {
+		role.RoleTerm = append(role.RoleTerm, ModsTerm{Type: "text", Authority: "marcrelator", Value: "creator"})
+	}
+	if len(role.RoleTerm) > 0 {
+		name.Role = append(name.Role, role)
+	}
+	return name
+}
+
+func (rec Record) modsOriginInfo() []ModsOriginInfo {
+	info := ModsOriginInfo{}
+
+	if country := strings.Trim(rec.fixedField("008", 15, 18), " |"); country != "" && isBibliographic(rec.Leader.TypeOfRecord) {
+		info.Place = append(info.Place, ModsPlace{PlaceTerm: ModsTerm{Type: "code", Authority: "marccountry", Value: country}})
+	}
+	for _, df := range rec.GetDatafields("260,264") {
+		if df.Tag.GetTag() == "264" && df.GetIndicator2() != "1" {
+			continue
+		}
+		for _, sf := range df.GetSubFields("a") {
+			info.Place = append(info.Place, ModsPlace{PlaceTerm: ModsTerm{Type: "text", Value: strings.Trim(chopPunctuation(sf.Data), "[]")}})
+		}
+		for _, sf := range df.GetSubFields("b") {
+			info.Publisher = append(info.Publisher, chopPunctuation(sf.Data))
+		}
+		for _, sf := range df.GetSubFields("c") {
+			info.DateIssued = append(info.DateIssued, ModsTerm{Value: chopPunctuation(sf.Data)})
+		}
+	}
+	if isBibliographic(rec.Leader.TypeOfRecord) {
+		if date1 := strings.Trim(rec.fixedField("008", 7, 11), " |"); date1 != "" {
+			info.DateIssued = append(info.DateIssued, ModsTerm{Encoding: "marc", KeyDate: "yes", Value: date1})
+		}
+	}
+	for _, df := range rec.GetDatafields("250") {
+		info.Edition = joinSubFields(df, "ab", " ")
+	}
+
+	switch rec.Leader.BibLevel {
+	case 'm':
+		if rec.Leader.MultipartLevel == 'a' {
+			info.Issuance = "multipart monograph"
+		} else {
+			info.Issuance = "single unit"
+		}
+	case 'a', 'c', 'd':
+		info.Issuance = "single unit"
+	case 'b', 's':
+		info.Issuance = "serial"
+	case 'i':
+		info.Issuance = "integrating resource"
+	}
+
+	if len(info.Place) == 0 && len(info.Publisher) == 0 && len(info.DateIssued) == 0 && info.Edition == "" && info.Issuance == "" {
+		return nil
+	}
+	return []ModsOriginInfo{info}
+}
+
+func (rec Record) modsLanguages() (langs []ModsLanguage) {
+	seen := map[string]bool{}
+	add := func(code string) {
+		code = strings.TrimSpace(code)
+		if code == "" || seen[code] {
+			return
+		}
+		seen[code] = true
+		langs = append(langs, ModsLanguage{LanguageTerm: ModsTerm{Type: "code", Authority: "iso639-2b", Value: code}})
+	}
+
+	add(rec.languageCode())
+	for _, df := range rec.GetDatafields("041") {
+		for _, sf := range df.GetSubFields("adj") {
+			// $a may hold several codes run together, e.g. "engfre"
+			for i := 0; i+3 <= len(sf.Data); i += 3 {
+				add(sf.Data[i : i+3])
+			}
+		}
+	}
+	return langs
+}
+
+// modsForm maps the form of item code (008/23 or 008/29) to MODS form.
+var modsForm = map[byte]string{
+	'a': "microfilm",
+	'b': "microfiche",
+	'c': "microopaque",
+	'd': "large print",
+	'f': "braille",
+	'o': "electronic",
+	'q': "electronic",
+	'r': "regular print reproduction",
+	's': "electronic",
+}
+
+func (rec Record) modsPhysicalDescription() *ModsPhysicalDescription {
+	pd := ModsPhysicalDescription{}
+
+	formPos := 23
+	if strings.IndexByte("efgkor", rec.Leader.TypeOfRecord) >= 0 {
+		formPos = 29
+	}
+	if isBibliographic(rec.Leader.TypeOfRecord) {
+		if code := rec.fixedField("008", formPos, formPos+1); code != "" {
+			if form, ok := modsForm[code[0]]; ok {
+				pd.Form = append(pd.Form, ModsTerm{Authority: "marcform", Value: form})
+			}
+		}
+	}
+	for _, df := range rec.GetDatafields("337") {
+		pd.Form = append(pd.Form, ModsTerm{Authority: "rdamedia", Type: "media", Value: joinSubFields(df, "a", " ")})
+	}
+	for _, df := range rec.GetDatafields("338") {
+		pd.Form = append(pd.Form, ModsTerm{Authority: "rdacarrier", Type: "carrier", Value: joinSubFields(df, "a", " ")})
+	}
+	for _, df := range rec.GetDatafields("856") {
+		for _, sf := range df.GetSubFields("q") {
+			pd.InternetMediaType = append(pd.InternetMediaType, sf.Data)
+		}
+	}
+	for _, df := range rec.GetDatafields("300") {
+		pd.Extent = append(pd.Extent, joinSubFields(df, "abcefg", " "))
+	}
+
+	if len(pd.Form) == 0 && len(pd.InternetMediaType) == 0 && len(pd.Extent) == 0 {
+		return nil
+	}
+	return &pd
+}
+
+// subjectAuthority returns the thesaurus of a 6XX field from its second
+// indicator, or from $2 when the indicator is 7.
+func subjectAuthority(df DataField) string {
+	if df.GetIndicator2() == "7" {
+		return joinSubFields(df, "2", "")
+	}
+	return modsSubjectAuthority[df.GetIndicator2()]
+}
+
+func modsSubject(df DataField) ModsSubject {
+	subject := ModsSubject{Authority: subjectAuthority(df)}
+	part := func(name string, value string) {
+		if value = chopPunctuation(value); value != "" {
+			subject.Parts = append(subject.Parts, ModsElement{XMLName: xml.Name{Local: name}, Value: value})
+		}
+	}
+
+	switch df.Tag.GetTag() {
+	case "600", "610", "611":
+		name := modsName(df)
+		name.Usage = ""
+		name.Role = nil
+		subject.Name = &name
+		if v := joinSubFields(df, "t", " "); v != "" {
+			subject.TitleInfo = &ModsTitleInfo{Title: v}
+		}
+	case "630":
+		t := modsTitleInfo(df, "adfhklmors", "")
+		subject.TitleInfo = &t
+	case "648":
+		part("temporal", joinSubFields(df, "a", " "))
+	case "650":
+		part("topic", joinSubFields(df, "abcd", " "))
+	case "651":
+		part("geographic", joinSubFields(df, "a", " "))
+	case "653":
+		subject.Authority = ""
+		for _, sf := range df.GetSubFields("a") {
+			part("topic", sf.Data)
+		}
+	}
+
+	for _, sf := range df.SubFields {
+		switch sf.Code {
+		case "v":
+			part("genre", sf.Data)
+		case "x":
+			part("topic", sf.Data)
+		case "y":
+			part("temporal", sf.Data)
+		case "z":
+			part("geographic", sf.Data)
+		}
+	}
+	return subject
+}
+
+func (rec Record) modsClassifications() (classes []ModsTerm) {
+	authorities := map[string]string{"050": "lcc", "060": "nlm", "080": "udc", "082": "ddc"}
+	for _, df := range rec.GetDatafields("050,060,080,082,086") {
+		tag := df.Tag.GetTag()
+		authority := authorities[tag]
+		if tag == "086" {
+			switch df.GetIndicator1() {
+			case "0":
+				authority = "sudocs"
+			case "1":
+				authority = "candoc"
+			default:
+				authority = joinSubFields(df, "2", "")
+			}
+		}
+		if v := joinSubFields(df, "ab", " "); v != "" {
+			classes = append(classes, ModsTerm{Authority: authority, Value: v})
+		}
+	}
+	return classes
+}
+
+func (rec Record) modsRelatedItems() (items []ModsRelatedItem) {
+	for _, df := range rec.GetDatafields("440,490,800,810,811,830") {
+		item := ModsRelatedItem{Type: "series"}
+		switch df.Tag.GetTag() {
+		case "800", "810", "811":
+			name := modsName(df)
+			name.Usage = ""
+			name.Role = nil
+			item.Name = append(item.Name, name)
+			item.TitleInfo = append(item.TitleInfo, modsTitleInfo(df, "tfkl", ""))
+		case "490":
+			if df.GetIndicator1() == "1" {
+				// traced in 8XX
+				continue
+			}
+			item.TitleInfo = append(item.TitleInfo, modsTitleInfo(df, "a", ""))
+		default:
+			item.TitleInfo = append(item.TitleInfo, modsTitleInfo(df, "a", ""))
+		}
+		for _, sf := range df.GetSubFields("v") {
+			item.TitleInfo[0].PartNumber = append(item.TitleInfo[0].PartNumber, chopPunctuation(sf.Data))
+		}
+		items = append(items, item)
+	}
+
+	for _, df := range rec.DataFields {
+		tag := df.Tag.GetTag()
+		if tag < "760" || tag > "787" {
+			continue
+		}
+		item := ModsRelatedItem{Type: modsRelatedItemType[tag]}
+		if v := joinSubFields(df, "t", " "); v != "" {
+			item.TitleInfo = append(item.TitleInfo, ModsTitleInfo{Title: v})
+		}
+		if v := joinSubFields(df, "a", " "); v != "" {
+			item.Name = append(item.Name, ModsName{NamePart: []ModsTerm{{Value: v}}})
+		}
+		for _, sf := range df.GetSubFields("n") {
+			item.Note = append(item.Note, ModsTerm{Value: chopPunctuation(sf.Data)})
+		}
+		for _, sf := range df.GetSubFields("wxz") {
+			idType := map[string]string{"w": "local", "x": "issn", "z": "isbn"}[sf.Code]
+			item.Identifier = append(item.Identifier, ModsTerm{Type: idType, Value: chopPunctuation(sf.Data)})
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func (rec Record) modsIdentifiers() (ids []ModsTerm) {
+	for _, df := range rec.GetDatafields("010,020,022,024,035") {
+		tag := df.Tag.GetTag()
+		idType := map[string]string{"010": "lccn", "020": "isbn", "022": "issn"}[tag]
+		if tag == "024" {
+			idType = map[string]string{"0": "isrc", "1": "upc", "2": "ismn", "3": "ean", "4": "sici"}[df.GetIndicator1()]
+			if df.GetIndicator1() == "7" {
+				idType = joinSubFields(df, "2", "")
+			}
+		}
+		for _, sf := range df.GetSubFields("a") {
+			value := strings.TrimSpace(sf.Data)
+			t := idType
+			if tag == "035" {
+				t = "local"
+				if strings.HasPrefix(value, "(OCoLC)") {
+					t = "oclc"
+				}
+			}
+			ids = append(ids, ModsTerm{Type: t, Value: value})
+		}
+		for _, sf := range df.GetSubFields("z") {
+			if tag != "035" {
+				ids = append(ids, ModsTerm{Type: idType, Invalid: "yes", Value: strings.TrimSpace(sf.Data)})
+			}
+		}
+	}
+	return ids
+}
+
+func (rec Record) modsRecordInfo() *ModsRecordInfo {
+	ri := ModsRecordInfo{RecordOrigin: "Converted from MARC 21 to MODS version " + ModsVersion + " by gomarc21"}
+
+	switch rec.Leader.DescrCatForm {
+	case 'a':
+		ri.DescriptionStandard = "aacr"
+	case 'i':
+		ri.DescriptionStandard = "isbd"
+	}
+	for _, df := range rec.GetDatafields("040") {
+		if v := joinSubFields(df, "e", ""); v != "" {
+			ri.DescriptionStandard = v
+		}
+		if v := joinSubFields(df, "a", ""); v != "" {
+			ri.RecordContentSource = &ModsTerm{Authority: "marcorg", Value: v}
+		}
+		if v := joinSubFields(df, "b", ""); v != "" {
+			ri.LanguageOfCataloging = &ModsLanguage{LanguageTerm: ModsTerm{Type: "code", Authority: "iso639-2b", Value: v}}
+		}
+	}
+	if v := rec.fixedField("008", 0, 6); v != "" {
+		ri.RecordCreationDate = &ModsTerm{Encoding: "marc", Value: v}
+	}
+	if v := rec.fixedField("005", 0, 14); v != "" {
+		ri.RecordChangeDate = &ModsTerm{Encoding: "iso8601", Value: v}
+	}
+	if id := strings.TrimSpace(rec.ControlNum()); id != "" {
+		ri.RecordIdentifier = &ModsTerm{Value: id}
+		for _, cf := range rec.GetControlfields("003") {
+			ri.RecordIdentifier.Source = strings.TrimSpace(cf.Data)
+		}
+	}
+	return &ri
+}
+
+// AsXml returns the MODS record as XML.
+func (m Mods) AsXml() (string, error) {
+	b, err := xml.Marshal(m)
+	return string(b), err
+}
+
+// RecordAsMods returns the record as a MODS 3.7 XML document element.
+func (rec Record) RecordAsMods() (string, error) {
+	return rec.Mods().AsXml()
+}
@@ -0,0 +1,113 @@
+package gomarc21
+
+import (
+	"encoding/xml"
+	"os"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestModsFromFile(test *testing.T) {
+	data, err := os.Open("data/test_1a.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer data.Close()
+	rec, err := ParseNextRecord(data)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	m := rec.Mods()
+	if len(m.TitleInfo) != 1 || m.TitleInfo[0].Title != "Guidelines for sample collecting and analytical methods used in the U.S. Geological Survey for determining chemical composition of coal" {
+		test.Error("titleInfo is wrong", m.TitleInfo)
+	}
+	if len(m.Name) != 2 || m.Name[0].Usage != "primary" || m.Name[0].Role[0].RoleTerm[0].Value != "creator" {
+		test.Error("names are wrong", m.Name)
+	}
+	if m.Name[0].NamePart[1].Type != "date" || m.Name[0].NamePart[1].Value != "1922-1992" {
+		test.Error("name date is wrong", m.Name[0].NamePart)
+	}
+	if m.TypeOfResource.Value != "text" {
+		test.Error("typeOfResource is wrong", m.TypeOfResource)
+	}
+	if m.OriginInfo[0].Issuance != "single unit" || m.OriginInfo[0].Place[1].PlaceTerm.Value != "Washington, D.C." || m.OriginInfo[0].Publisher[0] != "U.S. Dept. of the Interior, U.S. Geological Survey" {
+		test.Error("originInfo is wrong", m.OriginInfo)
+	}
+	if len(m.RelatedItem) != 2 || m.RelatedItem[0].Type != "series" || m.RelatedItem[1].Type != "otherFormat" {
+		test.Error("relatedItems are wrong", m.RelatedItem)
+	}
+	if m.RecordInfo.RecordIdentifier.Value != "ocm57175940" || m.RecordInfo.DescriptionStandard != "isbd" {
+		test.Error("recordInfo is wrong", m.RecordInfo)
+	}
+
+	str, err := rec.RecordAsMods()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if err := xml.Unmarshal([]byte(str), new(interface{})); err != nil {
+		test.Error("MODS output is not well formed", err)
+	}
+	if !strings.HasPrefix(str, `<mods xmlns="http://www.loc.gov/mods/v3" version="3.7">`) {
+		test.Error("MODS root element is wrong", str[:80])
+	}
+	if !strings.Contains(str, `<subject authority="lcsh"><topic>Coal</topic><topic>Analysis</topic></subject>`) {
+		test.Error("subject is wrong", str)
+	}
+}
+
+func TestModsTitleAndSubject(test *testing.T) {
+	leader, _ := NewLeader([]byte("00000nam a2200000 a 4500"))
+	rec := Record{
+		Leader: leader,
+		DataFields: []DataField{
+			{Tag: "245", Indicator1: "1", Indicator2: "4", SubFields: []SubField{
+				{Code: "a", Data: "The history of Acadia :"},
+				{Code: "b", Data: "a survey /"},
+				{Code: "c", Data: "by J. Smith."},
+			}},
+			{Tag: "700", Indicator1: "1", Indicator2: " ", SubFields: []SubField{
+				{Code: "a", Data: "Doe, Jane,"},
+				{Code: "e", Data: "editor."},
+				{Code: "4", Data: "edt"},
+			}},
+			{Tag: "651", Indicator1: " ", Indicator2: "5", SubFields: []SubField{
+				{Code: "a", Data: "Nova Scotia"},
+				{Code: "x", Data: "History"},
+				{Code: "y", Data: "1713-1775."},
+			}},
+		},
+	}
+
+	m := rec.Mods()
+	title := m.TitleInfo[0]
+	if title.NonSort != "The " || title.Title != "history of Acadia" || title.SubTitle != "a survey" {
+		test.Errorf("titleInfo is wrong %+v", title)
+	}
+	// the nonfiling characters of a title starting with multibyte ones
+	rec.DataFields[0] = DataField{Tag: "245", Indicator1: "1", Indicator2: "2", SubFields: []SubField{
+		{Code: "a", Data: "L’été acadien."},
+	}}
+	if title := rec.Mods().TitleInfo[0]; title.NonSort != "L’" || !strings.HasPrefix(title.Title, "été acadien") {
+		test.Errorf("titleInfo with multibyte characters is wrong %+v", title)
+	}
+	if mods, err := rec.RecordAsMods(); err != nil || !utf8.ValidString(mods) || !strings.Contains(mods, "<nonSort>L’</nonSort>") {
+		test.Error("invalid MODS", err, mods)
+	}
+	roles := m.Name[0].Role[0].RoleTerm
+	if len(roles) != 2 || roles[0].Value != "editor" || roles[1].Type != "code" || roles[1].Value != "edt" {
+		test.Error("roles are wrong", roles)
+	}
+
+	subject := m.Subject[0]
+	if subject.Authority != "csh" || len(subject.Parts) != 3 {
+		test.Fatal("subject is wrong", subject)
+	}
+	expected := []string{"geographic:Nova Scotia", "topic:History", "temporal:1713-1775"}
+	for i, part := range subject.Parts {
+		if part.XMLName.Local+":"+part.Value != expected[i] {
+			test.Error("subject part is wrong", part)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package gomarc21
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/*
+MARCMaker mnemonic text (.mrk), as written by GetMrk and MarcEdit:
+
+    =LDR  01349cz  a2200301n  4500
+    =001  cash10001\
+    =008  850805\neanknnbabn\\\\\\\\\\\a\ana\\\\\\
+    =150  \\$aAcadians$xExpulsion, 1755
+
+A backslash stands for a blank in the leader, the control fields and the
+indicators, and "{dollar}" for a "$" in subfield data. Records are
+separated by blank lines.
+*/
+
+// mrkUnescape reads the mnemonics of subfield data.
+var mrkUnescape = strings.NewReplacer("{dollar}", "$", "{bsol}", "\\")
+
+// parseMrkLine adds a single "=TAG  data" line to a record.
+func parseMrkLine(rec *Record, line string) error {
+	if len(line) < 4 || line[0] != '=' {
+		return fmt.Errorf("invalid mnemonic line %q", line)
+	}
+	tag := line[1:4]
+	data := line[4:]
+	// the tag is followed by two spaces, but some tools write only one
+	if strings.HasPrefix(data, "  ") {
+		data = data[2:]
+	} else {
+		data = strings.TrimPrefix(data, " ")
+	}
+
+	switch {
+	case tag == "LDR":
+		leader := []byte(fmt.Sprintf("%-24s", strings.ReplaceAll(data, "\\", " ")))[:LEADER_LEN]
+		for i, c := range leader {
+			if (i < 5 || (i >= 12 && i < 17)) && (c < '0' || c > '9') {
+				leader[i] = '0'
+			}
+		}
+		var err error
+		rec.Leader, err = NewLeader(leader)
+		return err
+	case tag < "010" && tag >= "000":
+		rec.ControlFields = append(rec.ControlFields, ControlField{Tag: Tag(tag), Data: strings.ReplaceAll(data, "\\", " ")})
+	default:
+		if len(data) < 2 {
+			return fmt.Errorf("field %s has no indicators", tag)
+		}
+		df := DataField{
+			Tag:        Tag(tag),
+			Indicator1: strings.ReplaceAll(data[0:1], "\\", " "),
+			Indicator2: strings.ReplaceAll(data[1:2], "\\", " "),
+		}
+		for _, sf := range strings.Split(data[2:], "$")[1:] {
+			if sf == "" {
+				continue
+			}
+			df.SubFields = append(df.SubFields, SubField{Code: sf[0:1], Data: mrkUnescape.Replace(sf[1:])})
+		}
+		rec.DataFields = append(rec.DataFields, df)
+	}
+	return nil
+}
+
+// ParseMrkRecord parses a single record in mnemonic text.
+func ParseMrkRecord(text string) (Record, error) {
+	rec := Record{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(strings.TrimPrefix(line, "\uFEFF"), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if err := parseMrkLine(&rec, line); err != nil {
+			return rec, err
+		}
+	}
+	if len(rec.Leader.GetRaw()) == 0 {
+		return rec, errors.New("mnemonic record has no leader")
+	}
+	return rec, nil
+}
+
+// nextMrk reads the lines of the next mnemonic record, up to a blank line
+// or the leader of the following record.
+func (r *Reader) nextMrk() (Record, error) {
+	var lines []string
+	for {
+		b, err := r.reader.Peek(5)
+		if len(lines) > 0 && err == nil && string(b) == "=LDR " {
+			break
+		}
+		line, err := r.reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if strings.TrimSpace(line) == "" {
+			if len(lines) > 0 {
+				break
+			}
+		} else {
+			lines = append(lines, line)
+		}
+		if err != nil {
+			if len(lines) == 0 {
+				return Record{}, err
+			}
+			break
+		}
+	}
+	return ParseMrkRecord(strings.Join(lines, "\n"))
+}
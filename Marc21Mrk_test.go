@@ -0,0 +1,48 @@
+package gomarc21
+
+import (
+	"os"
+	"testing"
+)
+
+func TestReaderMrk(test *testing.T) {
+	data, err := os.Open("data/test02.mrk")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer data.Close()
+
+	reader := NewReader(data)
+	recs := readAll(test, reader)
+	if format, _ := reader.Format(); format != FormatMrk {
+		test.Error("mnemonic format was not detected", format)
+	}
+	if len(recs) != 1 {
+		test.Fatal("wrong number of records", len(recs))
+	}
+	rec := recs[0]
+	if rec.ControlNum() != "cash10001 " || rec.Leader.TypeOfRecord != 'z' {
+		test.Error("control fields or leader are wrong", rec.ControlNum(), rec.Leader)
+	}
+	df := rec.GetDatafields("750")[1]
+	if df.GetIndicator1() != " " || df.GetIndicator2() != "6" || df.SubFields[0].Data != "Déportation des Acadiens, 1755" {
+		test.Error("data field is wrong", df)
+	}
+}
+
+func TestMrkRoundTrip(test *testing.T) {
+	data, err := os.Open("data/test_10.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer data.Close()
+	for _, rec := range readAll(test, NewReader(data)) {
+		parsed, err := ParseMrkRecord(rec.GetMrk())
+		if err != nil {
+			test.Fatal(err)
+		}
+		if parsed.GetMrk() != rec.GetMrk() {
+			test.Errorf("mnemonic round trip differs:\n%s\n%s", rec.GetMrk(), parsed.GetMrk())
+		}
+	}
+}
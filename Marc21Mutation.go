@@ -0,0 +1,105 @@
+package gomarc21
+
+import (
+	"strings"
+)
+
+// Clone returns a copy of the record which can be changed without
+// changing the record.
+func (rec Record) Clone() Record {
+	out := rec
+	out.ControlFields = append([]ControlField{}, rec.ControlFields...)
+	out.DataFields = make([]DataField, len(rec.DataFields))
+	for i, df := range rec.DataFields {
+		df.SubFields = append([]SubField{}, df.SubFields...)
+		out.DataFields[i] = df
+	}
+	return out
+}
+
+// AddControlField adds a control field after the control fields with a
+// lower or equal tag.
+func (rec *Record) AddControlField(cf ControlField) {
+	pos := len(rec.ControlFields)
+	for pos > 0 && rec.ControlFields[pos-1].Tag.GetTag() > cf.Tag.GetTag() {
+		pos--
+	}
+	rec.ControlFields = append(rec.ControlFields, ControlField{})
+	copy(rec.ControlFields[pos+1:], rec.ControlFields[pos:])
+	rec.ControlFields[pos] = cf
+}
+
+// SetControlField replaces the data of the first control field with the
+// tag, or adds the field when the record has none.
+func (rec *Record) SetControlField(tag string, data string) {
+	for i, cf := range rec.ControlFields {
+		if cf.Tag.GetTag() == tag {
+			rec.ControlFields[i].Data = data
+			return
+		}
+	}
+	rec.AddControlField(ControlField{Tag: Tag(tag), Data: data})
+}
+
+// AddDataField adds a data field after the data fields with a lower or
+// equal tag, and returns its position in Record.DataFields.
+func (rec *Record) AddDataField(df DataField) int {
+	pos := len(rec.DataFields)
+	for pos > 0 && rec.DataFields[pos-1].Tag.GetTag() > df.Tag.GetTag() {
+		pos--
+	}
+	rec.DataFields = append(rec.DataFields, DataField{})
+	copy(rec.DataFields[pos+1:], rec.DataFields[pos:])
+	rec.DataFields[pos] = df
+	return pos
+}
+
+// DeleteFields deletes the fields the spec selects and returns how many
+// were deleted.
+func (rec *Record) DeleteFields(spec Spec) int {
+	deleted := 0
+	if spec.isControl() {
+		positions := rec.SelectControlFields(spec)
+		deleted = len(positions)
+		for i := len(positions) - 1; i >= 0; i-- {
+			rec.ControlFields = append(rec.ControlFields[:positions[i]], rec.ControlFields[positions[i]+1:]...)
+		}
+		return deleted
+	}
+	positions := rec.SelectDataFields(spec)
+	for i := len(positions) - 1; i >= 0; i-- {
+		rec.DataFields = append(rec.DataFields[:positions[i]], rec.DataFields[positions[i]+1:]...)
+	}
+	return len(positions)
+}
+
+// AddSubField appends a subfield to the field.
+func (df *DataField) AddSubField(code string, data string) {
+	df.SubFields = append(df.SubFields, SubField{Code: code, Data: data})
+}
+
+// RemoveSubFields removes the subfields with one of the codes and returns
+// how many were removed.
+func (df *DataField) RemoveSubFields(codes string) int {
+	kept := df.SubFields[:0]
+	for _, sf := range df.SubFields {
+		if !strings.Contains(codes, sf.Code) {
+			kept = append(kept, sf)
+		}
+	}
+	removed := len(df.SubFields) - len(kept)
+	df.SubFields = kept
+	return removed
+}
+
+// SetIndicator sets the first (n = 1) or second (n = 2) indicator.
+func (df *DataField) SetIndicator(n int, value string) {
+	if value == "" {
+		value = " "
+	}
+	if n == 1 {
+		df.Indicator1 = value
+	} else {
+		df.Indicator2 = value
+	}
+}
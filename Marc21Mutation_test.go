@@ -0,0 +1,54 @@
+package gomarc21
+
+import (
+	"testing"
+)
+
+func TestMutation(test *testing.T) {
+	rec := Record{
+		ControlFields: []ControlField{{Tag: "001", Data: "1"}, {Tag: "008", Data: "850805s1985"}},
+		DataFields: []DataField{
+			{Tag: "100", Indicator1: "1", Indicator2: " ", SubFields: []SubField{{Code: "a", Data: "Smith, John."}}},
+			{Tag: "245", Indicator1: "1", Indicator2: "0", SubFields: []SubField{{Code: "a", Data: "A title."}}},
+			{Tag: "952", Indicator1: " ", Indicator2: " ", SubFields: []SubField{{Code: "p", Data: "123"}}},
+		},
+	}
+
+	clone := rec.Clone()
+	clone.DataFields[0].SubFields[0].Data = "changed"
+	if rec.DataFields[0].SubFields[0].Data != "Smith, John." {
+		test.Error("changing the clone changed the record")
+	}
+
+	clone.AddControlField(ControlField{Tag: "003", Data: "XYZ"})
+	clone.SetControlField("001", "2")
+	clone.SetControlField("005", "20240101000000.0")
+	var tags []string
+	for _, cf := range clone.ControlFields {
+		tags = append(tags, cf.Tag.GetTag()+"="+cf.Data)
+	}
+	if len(tags) != 4 || tags[0] != "001=2" || tags[1] != "003=XYZ" || tags[2] != "005=20240101000000.0" {
+		test.Error("control fields are wrong", tags)
+	}
+
+	pos := clone.AddDataField(DataField{Tag: "500", Indicator1: " ", Indicator2: " "})
+	if pos != 2 || clone.DataFields[3].Tag != "952" {
+		test.Error("500 was added at the wrong position", pos)
+	}
+	clone.DataFields[pos].AddSubField("a", "A note.")
+	clone.DataFields[pos].AddSubField("5", "XYZ")
+	if n := clone.DataFields[pos].RemoveSubFields("5"); n != 1 || len(clone.DataFields[pos].SubFields) != 1 {
+		test.Error("$5 was not removed", clone.DataFields[pos])
+	}
+	clone.DataFields[1].SetIndicator(2, "4")
+	if clone.DataFields[1].Indicator2 != "4" || rec.DataFields[1].Indicator2 != "0" {
+		test.Error("indicator was not set", clone.DataFields[1])
+	}
+
+	if n := clone.DeleteFields(MustParseSpec("9..")); n != 1 || len(clone.DataFields) != 3 {
+		test.Error("952 was not deleted", clone.DataFields)
+	}
+	if n := clone.DeleteFields(MustParseSpec("00.{/0-1=85}")); n != 1 || len(clone.ControlFields) != 3 {
+		test.Error("008 was not deleted", clone.ControlFields)
+	}
+}
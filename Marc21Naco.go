@@ -0,0 +1,134 @@
+package gomarc21
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+/*
+source: https://www.loc.gov/aba/pcc/naco/normrule-2.html
+
+    Authority File Comparison Rules (NACO Normalization)
+
+    1. Diacritics are deleted and lower case letters are converted to
+       upper case.
+    2. Special letters are replaced by their equivalents:
+           Æ æ -> AE     Œ œ -> OE     Ø ø -> O      Đ đ Ð ð -> D
+           Þ þ -> TH     Ł ł -> L      ß -> SS       ı -> I
+       and superscript and subscript digits by digits.
+    3. The apostrophe, the brackets ([ ]), and the alif (ʼ), ayn (ʻ),
+       soft sign (ʹ) and hard sign (ʺ) are deleted.
+    4. The following characters are converted to blanks:
+           ! " ( ) - { } < > ; : . ? ¿ ¡ / \ * | % = ± ⁺ ⁻ ® ℗ © ° ^ _ ` ~
+       as is the comma, except for the first comma in subfield $a.
+    5. Other characters, such as & @ # $ + ♭ ♯, are retained.
+    6. Leading and trailing blanks are deleted and multiple blanks are
+       reduced to one.
+    7. Subfield delimiters and codes are retained, so that "$aA$xB" and
+       "$aA B" do not normalize to the same string; a subfield left empty by
+       the normalization is dropped.
+*/
+
+// nacoLetters maps the special letters to their normalized equivalents.
+// Lower case letters are converted to upper case before the lookup.
+var nacoLetters = map[rune]string{
+	'Æ': "AE",
+	'Œ': "OE",
+	'Ø': "O",
+	'Đ': "D",
+	'Ð': "D",
+	'Þ': "TH",
+	'Ł': "L",
+	'ß': "SS",
+	'ẞ': "SS",
+	'ı': "I",
+}
+
+// nacoDeleted are the characters deleted by the normalization.
+const nacoDeleted = "'[]ʼʻʹʺ"
+
+// nacoBlanks are the characters converted to blanks by the normalization.
+const nacoBlanks = "!\"()-{}<>;:.?¿¡/\\*|%=±⁺⁻®℗©°^_`~"
+
+// nacoDigits maps superscript and subscript digits to digits.
+var nacoDigits = map[rune]rune{
+	'⁰': '0', '¹': '1', '²': '2', '³': '3', '⁴': '4', '⁵': '5', '⁶': '6', '⁷': '7', '⁸': '8', '⁹': '9',
+	'₀': '0', '₁': '1', '₂': '2', '₃': '3', '₄': '4', '₅': '5', '₆': '6', '₇': '7', '₈': '8', '₉': '9',
+}
+
+// NacoNormalize normalizes a string following the NACO normalization
+// rules. Every comma is converted to a blank; see SubField.NacoNormalize
+// to keep the first comma of $a.
+func NacoNormalize(s string) string {
+	return nacoNormalize(s, false)
+}
+
+func nacoNormalize(s string, keepFirstComma bool) string {
+	var b strings.Builder
+	blank := true // no blank at the start
+	writeBlank := func() {
+		if !blank {
+			b.WriteByte(' ')
+			blank = true
+		}
+	}
+
+	for _, r := range norm.NFD.String(s) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// diacritics
+		case r == ',' && keepFirstComma:
+			// the comma is kept attached to the preceding word
+			out := strings.TrimRight(b.String(), " ")
+			b.Reset()
+			b.WriteString(out)
+			b.WriteByte(',')
+			blank = false
+			keepFirstComma = false
+			writeBlank()
+		case r == ',' || unicode.IsSpace(r) || strings.ContainsRune(nacoBlanks, r):
+			writeBlank()
+		case strings.ContainsRune(nacoDeleted, r):
+		default:
+			r = unicode.ToUpper(r)
+			if d, ok := nacoDigits[r]; ok {
+				r = d
+			}
+			if letters, ok := nacoLetters[r]; ok {
+				b.WriteString(letters)
+			} else {
+				b.WriteRune(r)
+			}
+			blank = false
+		}
+	}
+	return strings.TrimRight(b.String(), " ")
+}
+
+// NacoNormalize returns the normalized data of the subfield. The first
+// comma of a $a is kept.
+func (sf SubField) NacoNormalize() string {
+	normalized := nacoNormalize(sf.Data, sf.Code == "a")
+	return strings.TrimSuffix(normalized, ",")
+}
+
+// NacoNormalize returns the normalized subfields of the field with the
+// given codes, or of all the alphabetic subfields when codes is empty, as
+// "$aSMITH, JOHN$d1900 1980".
+func (df DataField) NacoNormalize(codes string) string {
+	var b strings.Builder
+	for _, sf := range df.SubFields {
+		if codes == "" && (sf.Code == "" || !unicode.IsLetter(rune(sf.Code[0]))) {
+			continue
+		}
+		if codes != "" && !strings.Contains(codes, sf.Code) {
+			continue
+		}
+		if v := sf.NacoNormalize(); v != "" {
+			b.WriteString("$" + sf.Code + v)
+		}
+	}
+	return b.String()
+}
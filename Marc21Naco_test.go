@@ -0,0 +1,101 @@
+package gomarc21
+
+import (
+	"testing"
+)
+
+func TestNacoNormalize(test *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		// case and diacritics
+		{"Dvořák, Antonín", "DVORAK ANTONIN"},
+		{"Gödel, Escher, Bach", "GODEL ESCHER BACH"},
+		{"Ça ira", "CA IRA"},
+		// special letters
+		{"Ærø", "AERO"},
+		{"Œuvres", "OEUVRES"},
+		{"Łódź", "LODZ"},
+		{"Þór", "THOR"},
+		{"Straße", "STRASSE"},
+		{"Đorđević", "DORDEVIC"},
+		{"Ísland ðing", "ISLAND DING"},
+		// deleted characters
+		{"O'Brien", "OBRIEN"},
+		{"[Washington, D.C.]", "WASHINGTON D C"},
+		{"ʻAbd al-Ḥamīd", "ABD AL HAMID"},
+		{"Obʺedinenie", "OBEDINENIE"},
+		// characters converted to blanks
+		{"Fish (Food) -- Cooking.", "FISH FOOD COOKING"},
+		{"Why? Because!", "WHY BECAUSE"},
+		{"¿Qué pasa? ¡Ay!", "QUE PASA AY"},
+		{"A/B\\C*D|E%F=G", "A B C D E F G"},
+		{"{x}<y>;z:", "X Y Z"},
+		{"©1999 ℗2000 ®", "1999 2000"},
+		{"20° ± 5", "20 5"},
+		{"a^b_c`d~e", "A B C D E"},
+		{"\"Quoted\"", "QUOTED"},
+		// retained characters
+		{"AT&T", "AT&T"},
+		{"C++ & C#", "C++ & C#"},
+		{"user@example", "USER@EXAMPLE"},
+		{"$5 books", "$5 BOOKS"},
+		{"Symphony in B♭", "SYMPHONY IN B♭"},
+		// digits
+		{"H₂O and E=mc²", "H2O AND E MC2"},
+		// blanks
+		{"  Too   many    blanks  ", "TOO MANY BLANKS"},
+		{"Tab\tand\nnewline", "TAB AND NEWLINE"},
+		{"", ""},
+		{"...", ""},
+	}
+	for _, c := range cases {
+		if got := NacoNormalize(c.in); got != c.want {
+			test.Errorf("NacoNormalize(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestNacoNormalizeSubField(test *testing.T) {
+	cases := []struct {
+		sf   SubField
+		want string
+	}{
+		{SubField{Code: "a", Data: "Smith, John, "}, "SMITH, JOHN"},
+		{SubField{Code: "a", Data: "Smith , John"}, "SMITH, JOHN"},
+		{SubField{Code: "a", Data: "Brontë, Charlotte,"}, "BRONTE, CHARLOTTE"},
+		{SubField{Code: "a", Data: "Smith,"}, "SMITH"},
+		{SubField{Code: "a", Data: "Expulsion of the Acadians, Canada, 1755"}, "EXPULSION OF THE ACADIANS, CANADA 1755"},
+		{SubField{Code: "x", Data: "Expulsion, 1755."}, "EXPULSION 1755"},
+		{SubField{Code: "d", Data: "1816-1855."}, "1816 1855"},
+	}
+	for _, c := range cases {
+		if got := c.sf.NacoNormalize(); got != c.want {
+			test.Errorf("%v.NacoNormalize() = %q, want %q", c.sf, got, c.want)
+		}
+	}
+}
+
+func TestNacoNormalizeDataField(test *testing.T) {
+	df := DataField{Tag: "100", Indicator1: "1", Indicator2: " ", SubFields: []SubField{
+		{Code: "a", Data: "Brontë, Charlotte,"},
+		{Code: "d", Data: "1816-1855,"},
+		{Code: "e", Data: "author."},
+		{Code: "0", Data: "http://id.loc.gov/authorities/names/n79056670"},
+		{Code: "q", Data: "[]"},
+	}}
+	if got := df.NacoNormalize(""); got != "$aBRONTE, CHARLOTTE$d1816 1855$eAUTHOR" {
+		test.Error("normalized field is wrong", got)
+	}
+	if got := df.NacoNormalize("ad"); got != "$aBRONTE, CHARLOTTE$d1816 1855" {
+		test.Error("normalized subfields are wrong", got)
+	}
+
+	// subfield boundaries are significant
+	topic := DataField{Tag: "650", SubFields: []SubField{{Code: "a", Data: "Acadians"}, {Code: "x", Data: "Expulsion, 1755."}}}
+	phrase := DataField{Tag: "650", SubFields: []SubField{{Code: "a", Data: "Acadians Expulsion 1755"}}}
+	if topic.NacoNormalize("") == phrase.NacoNormalize("") {
+		test.Error("subfield delimiters should be retained")
+	}
+}
@@ -0,0 +1,819 @@
+package gomarc21
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+source: http://www.openarchives.org/OAI/openarchivesprotocol.html
+
+    The Open Archives Initiative Protocol for Metadata Harvesting
+    (OAI-PMH) 2.0 has six verbs, requested with HTTP GET or POST:
+
+    Identify             the repository
+    ListMetadataFormats  the formats of the records (or of one record)
+    ListSets             the set structure of the repository
+    ListIdentifiers      the headers of the records, by format, date and set
+    ListRecords          the records, by format, date and set
+    GetRecord            one record in one format
+
+An OaiProvider serves the records in MARCXML (marc21) and unqualified
+Dublin Core (oai_dc). The identifier of a record is the control number
+(001) with a prefix, its datestamp is the date and time of latest
+transaction (005), and a record whose leader/05 is "d" is reported as
+deleted. Sets come from the values of MARCspec fields (see OaiSetConfig),
+e.g. the set "type:a" holds the records with "a" at leader/06 when
+"type" is configured with LDR/06; requesting "type" gives all of them.
+
+Long lists are split in pages of PageSize with resumption tokens. The
+tokens carry the whole request, so the provider keeps no state between
+requests.
+*/
+
+const (
+	OaiNamespace       = "http://www.openarchives.org/OAI/2.0/"
+	OaiSchema          = "http://www.openarchives.org/OAI/2.0/OAI-PMH.xsd"
+	MarcXmlNamespace   = "http://www.loc.gov/MARC21/slim"
+	MarcXmlSchema      = "http://www.loc.gov/standards/marcxml/schema/MARC21slim.xsd"
+	OaiPrefixMarc21    = "marc21"
+	OaiPrefixDc        = "oai_dc"
+	OaiDatestampLayout = "2006-01-02T15:04:05Z"
+	OaiDayLayout       = "2006-01-02"
+	DefaultOaiPageSize = 100
+)
+
+// OAI-PMH error codes.
+const (
+	OaiBadArgument             = "badArgument"
+	OaiBadResumptionToken      = "badResumptionToken"
+	OaiBadVerb                 = "badVerb"
+	OaiCannotDisseminateFormat = "cannotDisseminateFormat"
+	OaiIdDoesNotExist          = "idDoesNotExist"
+	OaiNoRecordsMatch          = "noRecordsMatch"
+	OaiNoMetadataFormats       = "noMetadataFormats"
+	OaiNoSetHierarchy          = "noSetHierarchy"
+)
+
+// OaiFormats are the formats the provider disseminates.
+var OaiFormats = []OaiMetadataFormat{
+	{Prefix: OaiPrefixMarc21, Schema: MarcXmlSchema, Namespace: MarcXmlNamespace},
+	{Prefix: OaiPrefixDc, Schema: OaiDcSchema, Namespace: OaiDcNamespace},
+}
+
+// oaiVerbArguments gives the arguments of each verb and whether they are
+// required, optional or exclusive.
+var oaiVerbArguments = map[string]map[string]string{
+	"Identify":            {},
+	"ListMetadataFormats": {"identifier": "optional"},
+	"ListSets":            {"resumptionToken": "exclusive"},
+	"GetRecord":           {"identifier": "required", "metadataPrefix": "required"},
+	"ListIdentifiers": {"metadataPrefix": "required", "from": "optional", "until": "optional",
+		"set": "optional", "resumptionToken": "exclusive"},
+	"ListRecords": {"metadataPrefix": "required", "from": "optional", "until": "optional",
+		"set": "optional", "resumptionToken": "exclusive"},
+}
+
+// OaiResponse is an OAI-PMH response document. Only the element of the
+// verb, or the errors, are set.
+type OaiResponse struct {
+	XMLName             xml.Name            `xml:"OAI-PMH"`
+	Xmlns               string              `xml:"xmlns,attr,omitempty"`
+	XmlnsXsi            string              `xml:"xmlns:xsi,attr,omitempty"`
+	SchemaLocation      string              `xml:"xsi:schemaLocation,attr,omitempty"`
+	ResponseDate        string              `xml:"responseDate"`
+	Request             OaiRequest          `xml:"request"`
+	Errors              []OaiError          `xml:"error"`
+	Identify            *OaiIdentify        `xml:"Identify"`
+	ListMetadataFormats *OaiMetadataFormats `xml:"ListMetadataFormats"`
+	ListSets            *OaiSets            `xml:"ListSets"`
+	GetRecord           *OaiGetRecord       `xml:"GetRecord"`
+	ListIdentifiers     *OaiListIdentifiers `xml:"ListIdentifiers"`
+	ListRecords         *OaiListRecords     `xml:"ListRecords"`
+}
+
+// OaiRequest echoes the request in a response.
+type OaiRequest struct {
+	BaseUrl         string `xml:",chardata"`
+	Verb            string `xml:"verb,attr,omitempty"`
+	Identifier      string `xml:"identifier,attr,omitempty"`
+	MetadataPrefix  string `xml:"metadataPrefix,attr,omitempty"`
+	From            string `xml:"from,attr,omitempty"`
+	Until           string `xml:"until,attr,omitempty"`
+	Set             string `xml:"set,attr,omitempty"`
+	ResumptionToken string `xml:"resumptionToken,attr,omitempty"`
+}
+
+// OaiError is an error reported by a repository.
+type OaiError struct {
+	Code    string `xml:"code,attr"`
+	Message string `xml:",chardata"`
+}
+
+func (e OaiError) Error() string {
+	if e.Message == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Message
+}
+
+// OaiIdentify describes a repository.
+type OaiIdentify struct {
+	RepositoryName    string   `xml:"repositoryName"`
+	BaseUrl           string   `xml:"baseURL"`
+	ProtocolVersion   string   `xml:"protocolVersion"`
+	AdminEmail        []string `xml:"adminEmail"`
+	EarliestDatestamp string   `xml:"earliestDatestamp"`
+	DeletedRecord     string   `xml:"deletedRecord"`
+	Granularity       string   `xml:"granularity"`
+}
+
+// OaiMetadataFormat is a format disseminated by a repository.
+type OaiMetadataFormat struct {
+	Prefix    string `xml:"metadataPrefix"`
+	Schema    string `xml:"schema"`
+	Namespace string `xml:"metadataNamespace"`
+}
+
+// OaiMetadataFormats lists metadata formats.
+type OaiMetadataFormats struct {
+	Formats []OaiMetadataFormat `xml:"metadataFormat"`
+}
+
+// OaiSet is a set of a repository.
+type OaiSet struct {
+	Spec string `xml:"setSpec"`
+	Name string `xml:"setName"`
+}
+
+// OaiSets lists sets.
+type OaiSets struct {
+	Sets            []OaiSet            `xml:"set"`
+	ResumptionToken *OaiResumptionToken `xml:"resumptionToken"`
+}
+
+// OaiHeader identifies a record.
+type OaiHeader struct {
+	Status     string   `xml:"status,attr,omitempty"`
+	Identifier string   `xml:"identifier"`
+	Datestamp  string   `xml:"datestamp"`
+	SetSpecs   []string `xml:"setSpec"`
+}
+
+// Deleted tells whether the header is of a deleted record.
+func (h OaiHeader) Deleted() bool {
+	return h.Status == "deleted"
+}
+
+// OaiMetadata holds the metadata of a record as XML.
+type OaiMetadata struct {
+	Xml string `xml:",innerxml"`
+}
+
+// OaiRecord is a record with its header. Deleted records have no
+// metadata.
+type OaiRecord struct {
+	Header   OaiHeader    `xml:"header"`
+	Metadata *OaiMetadata `xml:"metadata"`
+}
+
+// OaiGetRecord holds the record of GetRecord.
+type OaiGetRecord struct {
+	Record OaiRecord `xml:"record"`
+}
+
+// OaiListIdentifiers lists headers.
+type OaiListIdentifiers struct {
+	Headers         []OaiHeader         `xml:"header"`
+	ResumptionToken *OaiResumptionToken `xml:"resumptionToken"`
+}
+
+// OaiListRecords lists records.
+type OaiListRecords struct {
+	Records         []OaiRecord         `xml:"record"`
+	ResumptionToken *OaiResumptionToken `xml:"resumptionToken"`
+}
+
+// OaiResumptionToken continues an incomplete list. The token is empty in
+// the last page of the list.
+type OaiResumptionToken struct {
+	Token            string `xml:",chardata"`
+	CompleteListSize int    `xml:"completeListSize,attr,omitempty"`
+	Cursor           int    `xml:"cursor,attr"`
+}
+
+// OaiSetConfig makes a set of each value a MARCspec selects, named
+// Spec + ":" + value, under the set Spec named Name. For instance
+// {Spec: "location", Name: "Locations", Field: "852$b"}.
+type OaiSetConfig struct {
+	Spec  string
+	Name  string
+	Field string
+}
+
+// OaiConfig configures an OaiProvider.
+type OaiConfig struct {
+	RepositoryName string
+	// BaseUrl defaults to the URL of the request.
+	BaseUrl    string
+	AdminEmail []string
+	// IdentifierPrefix is put before the 001 to make the identifiers.
+	// It defaults to "oai:<host of BaseUrl>:".
+	IdentifierPrefix string
+	// PageSize is the number of headers or records of a list page,
+	// DefaultOaiPageSize when zero.
+	PageSize int
+	Sets     []OaiSetConfig
+}
+
+// oaiEntry is a record of the repository.
+type oaiEntry struct {
+	id        string
+	header    OaiHeader
+	datestamp time.Time
+	record    *Record
+}
+
+// OaiProvider is an OAI-PMH 2.0 repository serving MARC records over
+// HTTP.
+type OaiProvider struct {
+	Config OaiConfig
+
+	mu       sync.Mutex
+	get      func(id string) (Record, error)
+	setSpecs []Spec
+	entries  map[string]*oaiEntry
+	sorted   []*oaiEntry
+	sets     map[string]string
+	closer   io.Closer
+}
+
+// NewOaiProvider returns an empty provider. get reads the record of a
+// control number; when it is nil the records given to Add are kept in
+// memory.
+func NewOaiProvider(config OaiConfig, get func(id string) (Record, error)) (*OaiProvider, error) {
+	p := &OaiProvider{Config: config, get: get, entries: map[string]*oaiEntry{}, sets: map[string]string{}}
+	if p.Config.PageSize <= 0 {
+		p.Config.PageSize = DefaultOaiPageSize
+	}
+	if p.Config.IdentifierPrefix == "" {
+		host := "localhost"
+		if u, err := url.Parse(p.Config.BaseUrl); err == nil && u.Hostname() != "" {
+			host = u.Hostname()
+		}
+		p.Config.IdentifierPrefix = "oai:" + host + ":"
+	}
+	if p.Config.RepositoryName == "" {
+		p.Config.RepositoryName = "MARC records"
+	}
+	for _, set := range p.Config.Sets {
+		if set.Spec == "" || strings.ContainsAny(set.Spec, ": ") {
+			return nil, fmt.Errorf("invalid set spec %q", set.Spec)
+		}
+		spec, err := ParseSpec(set.Field)
+		if err != nil {
+			return nil, fmt.Errorf("set %s: %s", set.Spec, err)
+		}
+		p.setSpecs = append(p.setSpecs, spec)
+		p.sets[set.Spec] = set.Name
+		if set.Name == "" {
+			p.sets[set.Spec] = set.Spec
+		}
+	}
+	return p, nil
+}
+
+// OpenOaiProvider returns a provider for the records of a file, reading
+// the binary MARC ones through the index of the file.
+func OpenOaiProvider(marcFile string, config OaiConfig) (*OaiProvider, error) {
+	f, err := openRecordFile(marcFile)
+	if err != nil {
+		return nil, err
+	}
+	return openOaiProvider(f, config)
+}
+
+// OpenStoreOaiProvider returns a provider for the records of a store (see
+// OpenStore), reading them from the store when requested.
+func OpenStoreOaiProvider(storeFile string, config OaiConfig) (*OaiProvider, error) {
+	f, err := openRecordStore(storeFile)
+	if err != nil {
+		return nil, err
+	}
+	return openOaiProvider(f, config)
+}
+
+// openOaiProvider returns a provider for the records of f, which is
+// closed with the provider.
+func openOaiProvider(f *recordFile, config OaiConfig) (*OaiProvider, error) {
+	p, err := NewOaiProvider(config, f.get())
+	if err == nil {
+		p.closer = f
+		err = f.each(p.Add)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// Close closes the file of the records when the provider opened it.
+func (p *OaiProvider) Close() error {
+	if p.closer == nil {
+		return nil
+	}
+	return p.closer.Close()
+}
+
+// Add adds a record to the repository, replacing the record with the
+// same control number. Records without a control number are ignored.
+func (p *OaiProvider) Add(rec Record) {
+	id := strings.TrimSpace(rec.ControlNum())
+	if id == "" {
+		return
+	}
+	datestamp := recordDatestamp(rec)
+	entry := &oaiEntry{
+		id:        id,
+		datestamp: datestamp,
+		header: OaiHeader{
+			Identifier: p.Config.IdentifierPrefix + id,
+			Datestamp:  datestamp.Format(OaiDatestampLayout),
+		},
+	}
+	if rec.Leader.RecordStatus == 'd' {
+		entry.header.Status = "deleted"
+	}
+	if p.get == nil {
+		entry.record = &rec
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, spec := range p.setSpecs {
+		seen := map[string]bool{}
+		for _, value := range rec.Select(spec) {
+			value = oaiSetValue(value)
+			if value == "" || seen[value] {
+				continue
+			}
+			seen[value] = true
+			setSpec := p.Config.Sets[i].Spec + ":" + value
+			entry.header.SetSpecs = append(entry.header.SetSpecs, setSpec)
+			if _, ok := p.sets[setSpec]; !ok {
+				p.sets[setSpec] = strings.TrimSpace(value)
+			}
+		}
+	}
+	p.entries[id] = entry
+	p.sorted = nil
+}
+
+// recordDatestamp returns the time of the 005 of a record, or the Unix
+// epoch when it has none.
+func recordDatestamp(rec Record) time.Time {
+	for _, cf := range rec.GetControlfields("005") {
+		data := strings.TrimSpace(cf.Data)
+		for _, layout := range []string{"20060102150405", "20060102"} {
+			if len(data) >= len(layout) {
+				if t, err := time.Parse(layout, data[:len(layout)]); err == nil {
+					return t
+				}
+			}
+		}
+	}
+	return time.Unix(0, 0).UTC()
+}
+
+// oaiSetValue makes a value usable in a setSpec, which allows only the
+// unreserved characters of URIs.
+func oaiSetValue(value string) string {
+	value = strings.TrimSpace(value)
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', strings.ContainsRune("-_.!~*'()", r):
+			return r
+		}
+		return '_'
+	}, value)
+}
+
+// entryList returns the entries ordered by datestamp and control number.
+func (p *OaiProvider) entryList() []*oaiEntry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sorted == nil {
+		p.sorted = make([]*oaiEntry, 0, len(p.entries))
+		for _, e := range p.entries {
+			p.sorted = append(p.sorted, e)
+		}
+		sort.Slice(p.sorted, func(i, j int) bool {
+			a, b := p.sorted[i], p.sorted[j]
+			if !a.datestamp.Equal(b.datestamp) {
+				return a.datestamp.Before(b.datestamp)
+			}
+			return a.id < b.id
+		})
+	}
+	return p.sorted
+}
+
+// ServeHTTP answers an OAI-PMH request.
+func (p *OaiProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	args := r.URL.Query()
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		args = r.PostForm
+	}
+
+	baseUrl := p.Config.BaseUrl
+	if baseUrl == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		baseUrl = scheme + "://" + r.Host + r.URL.Path
+	}
+
+	response, err := p.Respond(args, baseUrl)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	io.WriteString(w, xml.Header)
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(response); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+// Respond answers the request given by args. OAI-PMH errors are in the
+// response; the error is for failures reading the records.
+func (p *OaiProvider) Respond(args url.Values, baseUrl string) (*OaiResponse, error) {
+	response := &OaiResponse{
+		Xmlns:          OaiNamespace,
+		XmlnsXsi:       "http://www.w3.org/2001/XMLSchema-instance",
+		SchemaLocation: OaiNamespace + " " + OaiSchema,
+		ResponseDate:   time.Now().UTC().Format(OaiDatestampLayout),
+		Request:        OaiRequest{BaseUrl: baseUrl},
+	}
+
+	if oaiErr := checkOaiArguments(args); oaiErr != nil {
+		response.Errors = []OaiError{*oaiErr}
+		return response, nil
+	}
+	// the request is echoed only when it is valid
+	response.Request = OaiRequest{
+		BaseUrl:         baseUrl,
+		Verb:            args.Get("verb"),
+		Identifier:      args.Get("identifier"),
+		MetadataPrefix:  args.Get("metadataPrefix"),
+		From:            args.Get("from"),
+		Until:           args.Get("until"),
+		Set:             args.Get("set"),
+		ResumptionToken: args.Get("resumptionToken"),
+	}
+
+	var oaiErr *OaiError
+	var err error
+	switch args.Get("verb") {
+	case "Identify":
+		response.Identify = p.identify(baseUrl)
+	case "ListMetadataFormats":
+		response.ListMetadataFormats, oaiErr = p.listMetadataFormats(args.Get("identifier"))
+	case "ListSets":
+		response.ListSets, oaiErr = p.listSets(args.Get("resumptionToken"))
+	case "GetRecord":
+		response.GetRecord, oaiErr, err = p.getRecord(args.Get("identifier"), args.Get("metadataPrefix"))
+	case "ListIdentifiers", "ListRecords":
+		response.ListIdentifiers, response.ListRecords, oaiErr, err = p.list(args)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if oaiErr != nil {
+		response.Errors = []OaiError{*oaiErr}
+		if oaiErr.Code == OaiBadArgument {
+			response.Request = OaiRequest{BaseUrl: baseUrl}
+		}
+	}
+	return response, nil
+}
+
+// checkOaiArguments checks the verb and its arguments.
+func checkOaiArguments(args url.Values) *OaiError {
+	verbs := args["verb"]
+	if len(verbs) != 1 {
+		return &OaiError{OaiBadVerb, "missing or repeated verb"}
+	}
+	arguments, ok := oaiVerbArguments[verbs[0]]
+	if !ok {
+		return &OaiError{OaiBadVerb, "illegal verb " + verbs[0]}
+	}
+
+	exclusive := false
+	for name, values := range args {
+		if name == "verb" {
+			continue
+		}
+		kind, ok := arguments[name]
+		if !ok {
+			return &OaiError{OaiBadArgument, "illegal argument " + name}
+		}
+		if len(values) != 1 {
+			return &OaiError{OaiBadArgument, "repeated argument " + name}
+		}
+		if kind == "exclusive" {
+			exclusive = true
+		}
+	}
+	if exclusive {
+		if len(args) != 2 {
+			return &OaiError{OaiBadArgument, "resumptionToken is an exclusive argument"}
+		}
+		return nil
+	}
+	for name, kind := range arguments {
+		if kind == "required" && args.Get(name) == "" {
+			return &OaiError{OaiBadArgument, "missing argument " + name}
+		}
+	}
+	return nil
+}
+
+func (p *OaiProvider) identify(baseUrl string) *OaiIdentify {
+	earliest := time.Unix(0, 0).UTC()
+	if entries := p.entryList(); len(entries) > 0 {
+		earliest = entries[0].datestamp
+	}
+	return &OaiIdentify{
+		RepositoryName:    p.Config.RepositoryName,
+		BaseUrl:           baseUrl,
+		ProtocolVersion:   "2.0",
+		AdminEmail:        p.Config.AdminEmail,
+		EarliestDatestamp: earliest.Format(OaiDatestampLayout),
+		DeletedRecord:     "transient",
+		Granularity:       "YYYY-MM-DDThh:mm:ssZ",
+	}
+}
+
+// entry returns the entry of an OAI identifier.
+func (p *OaiProvider) entry(identifier string) *oaiEntry {
+	if !strings.HasPrefix(identifier, p.Config.IdentifierPrefix) {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.entries[strings.TrimPrefix(identifier, p.Config.IdentifierPrefix)]
+}
+
+func (p *OaiProvider) listMetadataFormats(identifier string) (*OaiMetadataFormats, *OaiError) {
+	if identifier != "" && p.entry(identifier) == nil {
+		return nil, &OaiError{OaiIdDoesNotExist, identifier}
+	}
+	return &OaiMetadataFormats{Formats: OaiFormats}, nil
+}
+
+func (p *OaiProvider) listSets(token string) (*OaiSets, *OaiError) {
+	if token != "" {
+		return nil, &OaiError{OaiBadResumptionToken, "the sets are listed at once"}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.sets) == 0 {
+		return nil, &OaiError{OaiNoSetHierarchy, "the repository has no sets"}
+	}
+	sets := &OaiSets{}
+	for spec, name := range p.sets {
+		sets.Sets = append(sets.Sets, OaiSet{Spec: spec, Name: name})
+	}
+	sort.Slice(sets.Sets, func(i, j int) bool { return sets.Sets[i].Spec < sets.Sets[j].Spec })
+	return sets, nil
+}
+
+func (p *OaiProvider) getRecord(identifier string, prefix string) (*OaiGetRecord, *OaiError, error) {
+	if !validOaiPrefix(prefix) {
+		return nil, &OaiError{OaiCannotDisseminateFormat, prefix}, nil
+	}
+	entry := p.entry(identifier)
+	if entry == nil {
+		return nil, &OaiError{OaiIdDoesNotExist, identifier}, nil
+	}
+	record, err := p.record(entry, prefix)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &OaiGetRecord{Record: record}, nil, nil
+}
+
+func validOaiPrefix(prefix string) bool {
+	for _, format := range OaiFormats {
+		if format.Prefix == prefix {
+			return true
+		}
+	}
+	return false
+}
+
+// record returns the header and metadata of an entry.
+func (p *OaiProvider) record(entry *oaiEntry, prefix string) (OaiRecord, error) {
+	record := OaiRecord{Header: entry.header}
+	if entry.header.Deleted() {
+		return record, nil
+	}
+
+	var rec Record
+	if entry.record != nil {
+		rec = *entry.record
+	} else {
+		var err error
+		if rec, err = p.get(entry.id); err != nil {
+			return record, fmt.Errorf("record %s: %s", entry.id, err)
+		}
+	}
+	metadata, err := oaiMetadata(rec, prefix)
+	if err != nil {
+		return record, fmt.Errorf("record %s: %s", entry.id, err)
+	}
+	record.Metadata = &OaiMetadata{Xml: metadata}
+	return record, nil
+}
+
+// oaiMetadata returns a record in a metadata format.
+func oaiMetadata(rec Record, prefix string) (string, error) {
+	if prefix == OaiPrefixDc {
+		return rec.RecordAsDcXml()
+	}
+	str, err := rec.RecordAsXml()
+	if err != nil {
+		return "", err
+	}
+	return strings.Replace(str, "<record>", `<record xmlns="`+MarcXmlNamespace+`">`, 1), nil
+}
+
+// oaiQuery is the selection of a list request, and the position of a
+// page of its list.
+type oaiQuery struct {
+	prefix string
+	from   string
+	until  string
+	set    string
+	cursor int
+}
+
+// token encodes the query as a resumption token.
+func (q oaiQuery) token() string {
+	fields := []string{q.prefix, q.from, q.until, q.set, strconv.Itoa(q.cursor)}
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.Join(fields, "\x1f")))
+}
+
+func parseOaiToken(token string) (oaiQuery, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return oaiQuery{}, false
+	}
+	fields := strings.Split(string(b), "\x1f")
+	if len(fields) != 5 {
+		return oaiQuery{}, false
+	}
+	cursor, err := strconv.Atoi(fields[4])
+	if err != nil || cursor < 0 {
+		return oaiQuery{}, false
+	}
+	return oaiQuery{prefix: fields[0], from: fields[1], until: fields[2], set: fields[3], cursor: cursor}, true
+}
+
+// parseOaiDate parses a from or until argument, returning its
+// granularity. An until day includes the whole day.
+func parseOaiDate(value string, until bool) (time.Time, string, error) {
+	if t, err := time.Parse(OaiDatestampLayout, value); err == nil {
+		return t, "seconds", nil
+	}
+	t, err := time.Parse(OaiDayLayout, value)
+	if err != nil {
+		return t, "", fmt.Errorf("invalid date %q", value)
+	}
+	if until {
+		t = t.Add(24*time.Hour - time.Second)
+	}
+	return t, "day", nil
+}
+
+// list answers ListIdentifiers and ListRecords.
+func (p *OaiProvider) list(args url.Values) (*OaiListIdentifiers, *OaiListRecords, *OaiError, error) {
+	q := oaiQuery{prefix: args.Get("metadataPrefix"), from: args.Get("from"), until: args.Get("until"), set: args.Get("set")}
+	token := args.Get("resumptionToken")
+	if token != "" {
+		var ok bool
+		if q, ok = parseOaiToken(token); !ok {
+			return nil, nil, &OaiError{OaiBadResumptionToken, token}, nil
+		}
+	}
+
+	if !validOaiPrefix(q.prefix) {
+		return nil, nil, &OaiError{OaiCannotDisseminateFormat, q.prefix}, nil
+	}
+	from, until := time.Time{}, time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+	var fromGranularity, untilGranularity string
+	var err error
+	if q.from != "" {
+		if from, fromGranularity, err = parseOaiDate(q.from, false); err != nil {
+			return nil, nil, &OaiError{OaiBadArgument, err.Error()}, nil
+		}
+	}
+	if q.until != "" {
+		if until, untilGranularity, err = parseOaiDate(q.until, true); err != nil {
+			return nil, nil, &OaiError{OaiBadArgument, err.Error()}, nil
+		}
+	}
+	if fromGranularity != "" && untilGranularity != "" && fromGranularity != untilGranularity {
+		return nil, nil, &OaiError{OaiBadArgument, "from and until have different granularities"}, nil
+	}
+	if q.set != "" {
+		p.mu.Lock()
+		hasSets := len(p.sets) > 0
+		p.mu.Unlock()
+		if !hasSets {
+			return nil, nil, &OaiError{OaiNoSetHierarchy, "the repository has no sets"}, nil
+		}
+	}
+
+	var matches []*oaiEntry
+	for _, e := range p.entryList() {
+		if e.datestamp.Before(from) || e.datestamp.After(until) || !e.inSet(q.set) {
+			continue
+		}
+		matches = append(matches, e)
+	}
+	if q.cursor > 0 && q.cursor >= len(matches) {
+		return nil, nil, &OaiError{OaiBadResumptionToken, "the list has changed"}, nil
+	}
+	if len(matches) == 0 {
+		return nil, nil, &OaiError{OaiNoRecordsMatch, ""}, nil
+	}
+
+	end := q.cursor + p.Config.PageSize
+	if end > len(matches) {
+		end = len(matches)
+	}
+	var resumption *OaiResumptionToken
+	if token != "" || end < len(matches) {
+		resumption = &OaiResumptionToken{CompleteListSize: len(matches), Cursor: q.cursor}
+		if end < len(matches) {
+			next := q
+			next.cursor = end
+			resumption.Token = next.token()
+		}
+	}
+
+	if args.Get("verb") == "ListIdentifiers" {
+		list := &OaiListIdentifiers{ResumptionToken: resumption}
+		for _, e := range matches[q.cursor:end] {
+			list.Headers = append(list.Headers, e.header)
+		}
+		return list, nil, nil, nil
+	}
+	list := &OaiListRecords{ResumptionToken: resumption}
+	for _, e := range matches[q.cursor:end] {
+		record, err := p.record(e, q.prefix)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		list.Records = append(list.Records, record)
+	}
+	return nil, list, nil, nil
+}
+
+// inSet tells whether the entry is in a set or in a set below it.
+func (e *oaiEntry) inSet(set string) bool {
+	if set == "" {
+		return true
+	}
+	for _, spec := range e.header.SetSpecs {
+		if spec == set || strings.HasPrefix(spec, set+":") {
+			return true
+		}
+	}
+	return false
+}
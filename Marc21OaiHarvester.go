@@ -0,0 +1,271 @@
+package gomarc21
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+/*
+An OaiHarvester reads the records of an OAI-PMH repository with
+ListRecords, following the resumption tokens, and returns them one at a
+time like a Reader:
+
+    harvester := NewOaiHarvester("https://example.org/oai")
+    harvester.From = "2024-01-01"
+    for {
+        harvested, err := harvester.Next()
+        if err == io.EOF {
+            break
+        }
+        ...
+    }
+
+The metadata format should be MARCXML (marc21 by default). Deleted
+records have a header and no record.
+
+Requests failing with a network error or a 429 or 5xx status are retried,
+waiting RetryDelay or what the Retry-After header asks. A resumption
+token refused with badResumptionToken, which is how repositories report
+expired tokens, is retried too; when it is still refused the list is
+requested again from the datestamp of the last record harvested, at the
+granularity of Until or From or else of the repository (Identify). The
+records already returned are skipped by identifier over the whole
+harvest. OAI-PMH does not require the records to be listed in datestamp
+order: with a repository listing them otherwise, a restart misses the
+records not harvested yet whose datestamps are before the last one, and
+the harvest should be run again from From when one was restarted (see
+Restarts).
+*/
+
+// DefaultOaiRetries is the number of times a failed request is retried.
+const DefaultOaiRetries = 3
+
+// OaiHarvestedRecord is a record read from a repository. Record is empty
+// when the record is deleted.
+type OaiHarvestedRecord struct {
+	Header OaiHeader
+	Record Record
+}
+
+// OaiHarvester reads records from an OAI-PMH repository.
+type OaiHarvester struct {
+	BaseUrl        string
+	MetadataPrefix string
+	From           string
+	Until          string
+	Set            string
+	Client         *http.Client
+	Retries        int
+	RetryDelay     time.Duration
+
+	// Restarts is the number of times the list was requested again after
+	// a refused resumption token.
+	Restarts int
+
+	started bool
+	from    string
+	token   string
+	page    []OaiRecord
+
+	// the datestamp of the last record and the identifiers returned, to
+	// skip them when the list is requested again
+	lastDatestamp string
+	seen          map[string]bool
+	restartedAt   string
+	granularity   string
+}
+
+// NewOaiHarvester returns a harvester of the marc21 records of the
+// repository at baseUrl.
+func NewOaiHarvester(baseUrl string) *OaiHarvester {
+	return &OaiHarvester{
+		BaseUrl:        baseUrl,
+		MetadataPrefix: OaiPrefixMarc21,
+		Client:         http.DefaultClient,
+		Retries:        DefaultOaiRetries,
+		RetryDelay:     time.Second,
+	}
+}
+
+// Next returns the next record of the repository, or io.EOF when there
+// are no more records.
+func (h *OaiHarvester) Next() (OaiHarvestedRecord, error) {
+	for {
+		for len(h.page) == 0 {
+			if h.started && h.token == "" {
+				return OaiHarvestedRecord{}, io.EOF
+			}
+			if err := h.nextPage(); err != nil {
+				return OaiHarvestedRecord{}, err
+			}
+		}
+		record := h.page[0]
+		h.page = h.page[1:]
+
+		header := record.Header
+		if h.seen[header.Identifier] {
+			continue
+		}
+		h.seen[header.Identifier] = true
+		h.lastDatestamp = header.Datestamp
+
+		harvested := OaiHarvestedRecord{Header: header}
+		if header.Deleted() || record.Metadata == nil {
+			return harvested, nil
+		}
+		rec, err := ParseXmlRecord([]byte(record.Metadata.Xml))
+		if err != nil {
+			return harvested, fmt.Errorf("%s: %s", header.Identifier, err)
+		}
+		harvested.Record = rec
+		return harvested, nil
+	}
+}
+
+// nextPage requests the next page of the list.
+func (h *OaiHarvester) nextPage() error {
+	if !h.started {
+		h.started = true
+		h.from = h.From
+		h.seen = map[string]bool{}
+	}
+	response, err := h.list()
+	if err != nil {
+		return err
+	}
+	for attempt := 0; oaiResponseError(response, OaiBadResumptionToken) && attempt < h.Retries; attempt++ {
+		time.Sleep(h.RetryDelay)
+		if response, err = h.list(); err != nil {
+			return err
+		}
+	}
+
+	if oaiResponseError(response, OaiBadResumptionToken) {
+		// start again after the records already harvested, unless that
+		// was tried from the same record
+		restart := h.lastDatestamp + " " + strconv.Itoa(len(h.seen))
+		if h.lastDatestamp == "" || restart == h.restartedAt {
+			return response.Errors[0]
+		}
+		h.restartedAt = restart
+		h.Restarts++
+		h.token = ""
+		h.from = h.lastDatestamp
+		if h.restartGranularity() == oaiDayGranularity && len(h.from) > len(OaiDayLayout) {
+			h.from = h.from[:len(OaiDayLayout)]
+		}
+		if response, err = h.list(); err != nil {
+			return err
+		}
+	}
+
+	if len(response.Errors) > 0 {
+		h.token = ""
+		if oaiResponseError(response, OaiNoRecordsMatch) {
+			return nil
+		}
+		return response.Errors[0]
+	}
+	if response.ListRecords == nil {
+		return fmt.Errorf("%s: no ListRecords in the response", h.BaseUrl)
+	}
+	h.page = response.ListRecords.Records
+	h.token = ""
+	if token := response.ListRecords.ResumptionToken; token != nil {
+		h.token = token.Token
+	}
+	return nil
+}
+
+// oaiDayGranularity is the granularity of the repositories taking days
+// only in from and until.
+const oaiDayGranularity = "YYYY-MM-DD"
+
+// restartGranularity returns the granularity of the from argument of a
+// restarted list: the one of Until or From, which it has to match, or
+// else the one of the repository. Days, which all the repositories
+// support, are used when Identify fails.
+func (h *OaiHarvester) restartGranularity() string {
+	for _, date := range []string{h.Until, h.From} {
+		if date != "" {
+			if len(date) == len(OaiDayLayout) {
+				return oaiDayGranularity
+			}
+			return "YYYY-MM-DDThh:mm:ssZ"
+		}
+	}
+	if h.granularity == "" {
+		h.granularity = oaiDayGranularity
+		response, err := h.Request(url.Values{"verb": {"Identify"}})
+		if err == nil && response.Identify != nil && response.Identify.Granularity != "" {
+			h.granularity = response.Identify.Granularity
+		}
+	}
+	return h.granularity
+}
+
+func oaiResponseError(response *OaiResponse, code string) bool {
+	return len(response.Errors) > 0 && response.Errors[0].Code == code
+}
+
+// list requests ListRecords with the resumption token, or with the
+// selection of the harvester when there is none.
+func (h *OaiHarvester) list() (*OaiResponse, error) {
+	args := url.Values{"verb": {"ListRecords"}}
+	if h.token != "" {
+		args.Set("resumptionToken", h.token)
+	} else {
+		args.Set("metadataPrefix", h.MetadataPrefix)
+		for name, value := range map[string]string{"from": h.from, "until": h.Until, "set": h.Set} {
+			if value != "" {
+				args.Set(name, value)
+			}
+		}
+	}
+	return h.Request(args)
+}
+
+// Request sends a request to the repository and decodes the response,
+// retrying failed requests.
+func (h *OaiHarvester) Request(args url.Values) (*OaiResponse, error) {
+	requestUrl := h.BaseUrl + "?" + args.Encode()
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= h.Retries; attempt++ {
+		delay := h.RetryDelay
+		resp, err := client.Get(requestUrl)
+		if err == nil {
+			if resp.StatusCode == http.StatusOK {
+				var response OaiResponse
+				err = xml.NewDecoder(resp.Body).Decode(&response)
+				resp.Body.Close()
+				if err != nil {
+					return nil, fmt.Errorf("%s: %s", requestUrl, err)
+				}
+				return &response, nil
+			}
+			resp.Body.Close()
+			err = fmt.Errorf("%s: %s", requestUrl, resp.Status)
+			if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+				return nil, err
+			}
+			if seconds, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil {
+				delay = time.Duration(seconds) * time.Second
+			}
+		}
+		lastErr = err
+		if attempt < h.Retries {
+			time.Sleep(delay)
+		}
+	}
+	return nil, lastErr
+}
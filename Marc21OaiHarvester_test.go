@@ -0,0 +1,120 @@
+package gomarc21
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// harvestAll harvests a repository, returning the identifiers of the
+// records, with "deleted " before the deleted ones.
+func harvestAll(test *testing.T, harvester *OaiHarvester) []string {
+	test.Helper()
+	var ids []string
+	for {
+		harvested, err := harvester.Next()
+		if err == io.EOF {
+			return ids
+		}
+		if err != nil {
+			test.Fatal(err)
+		}
+		id := harvested.Header.Identifier
+		switch {
+		case harvested.Header.Deleted():
+			id = "deleted " + id
+		case "oai:example.org:"+harvested.Record.ControlNum() != id:
+			test.Errorf("%s: wrong record %s", id, harvested.Record.ControlNum())
+		}
+		ids = append(ids, id)
+	}
+}
+
+func TestOaiHarvester(test *testing.T) {
+	provider, _ := newTestOaiProvider(test)
+
+	// the first request fails, and the tokens are refused once, or always
+	requests := 0
+	refuseTokens := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		if token := r.URL.Query().Get("resumptionToken"); token != "" && refuseTokens != 0 {
+			if refuseTokens > 0 {
+				refuseTokens--
+			}
+			r.URL.RawQuery = "verb=ListRecords&resumptionToken=expired"
+		}
+		provider.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	newHarvester := func() *OaiHarvester {
+		harvester := NewOaiHarvester(server.URL)
+		harvester.RetryDelay = 0
+		return harvester
+	}
+
+	refuseTokens = 1
+	ids := harvestAll(test, newHarvester())
+	if len(ids) != 10 || ids[0] != "oai:example.org:ocm57175940" || ids[1] != "deleted oai:example.org:ocm57177924" {
+		test.Error("wrong records", ids)
+	}
+	if refuseTokens != 0 {
+		test.Error("the token was not refused")
+	}
+
+	refuseTokens = -1
+	if restarted := harvestAll(test, newHarvester()); strings.Join(restarted, " ") != strings.Join(ids, " ") {
+		test.Error("wrong records harvested again", restarted)
+	}
+
+	// a repository taking days only, which refuses a token until the
+	// list is requested again
+	refusals := DefaultOaiRetries + 1
+	dayServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if len(query.Get("from")) > len(OaiDayLayout) {
+			r.URL.RawQuery = "verb=ListRecords&metadataPrefix=marc21&from=seconds"
+		} else if query.Get("resumptionToken") != "" && refusals > 0 {
+			refusals--
+			r.URL.RawQuery = "verb=ListRecords&resumptionToken=expired"
+		}
+		recorder := httptest.NewRecorder()
+		provider.ServeHTTP(recorder, r)
+		w.Header().Set("Content-Type", recorder.Header().Get("Content-Type"))
+		io.WriteString(w, strings.Replace(recorder.Body.String(), "YYYY-MM-DDThh:mm:ssZ", "YYYY-MM-DD", 1))
+	}))
+	defer dayServer.Close()
+	harvester := NewOaiHarvester(dayServer.URL)
+	harvester.RetryDelay = 0
+	if days := harvestAll(test, harvester); strings.Join(days, " ") != strings.Join(ids, " ") || harvester.Restarts == 0 {
+		test.Error("wrong records harvested by days", days, harvester.Restarts)
+	}
+
+	refuseTokens = 0
+	harvester = newHarvester()
+	harvester.From = "2004-12-07"
+	harvester.Until = "2004-12-31"
+	harvester.Set = "status:c"
+	if ids := harvestAll(test, harvester); strings.Join(ids, " ") != "oai:example.org:ocm57178104" {
+		test.Error("wrong selected records", ids)
+	}
+
+	harvester = newHarvester()
+	harvester.From = "2100-01-01"
+	if ids := harvestAll(test, harvester); len(ids) != 0 {
+		test.Error("no records should match", ids)
+	}
+
+	harvester = newHarvester()
+	harvester.MetadataPrefix = "mods"
+	if _, err := harvester.Next(); err == nil || err.(OaiError).Code != OaiCannotDisseminateFormat {
+		test.Error("wrong error", err)
+	}
+}
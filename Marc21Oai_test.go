@@ -0,0 +1,251 @@
+package gomarc21
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// oaiGet requests a provider and decodes the response.
+func oaiGet(test *testing.T, server *httptest.Server, query string) OaiResponse {
+	test.Helper()
+	resp, err := http.Get(server.URL + "/oai?" + query)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/xml") {
+		test.Fatalf("%s: status %d: %s", query, resp.StatusCode, body)
+	}
+	var response OaiResponse
+	if err := xml.Unmarshal(body, &response); err != nil {
+		test.Fatalf("%s: %s\n%s", query, err, body)
+	}
+	return response
+}
+
+func oaiErrorCode(response OaiResponse) string {
+	if len(response.Errors) == 0 {
+		return ""
+	}
+	return response.Errors[0].Code
+}
+
+// newTestOaiProvider returns a provider of the test records, with pages of
+// 3 records, sets of the record status and the second record deleted.
+func newTestOaiProvider(test *testing.T) (*OaiProvider, []Record) {
+	file, err := OpenFile("data/test_10.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer file.Close()
+	recs := readAll(test, NewReader(file))
+
+	provider, err := NewOaiProvider(OaiConfig{
+		RepositoryName: "Test records",
+		BaseUrl:        "http://example.org/oai",
+		PageSize:       3,
+		Sets:           []OaiSetConfig{{Spec: "status", Name: "Record status", Field: "LDR/05"}},
+	}, nil)
+	if err != nil {
+		test.Fatal(err)
+	}
+	deleted := recs[1].Clone()
+	raw := []byte(deleted.Leader.GetRaw())
+	raw[5] = 'd'
+	if deleted.Leader, err = NewLeader(raw); err != nil {
+		test.Fatal(err)
+	}
+	for _, rec := range append(recs, deleted) {
+		provider.Add(rec)
+	}
+	return provider, recs
+}
+
+func TestOaiProvider(test *testing.T) {
+	provider, recs := newTestOaiProvider(test)
+	server := httptest.NewServer(provider)
+	defer server.Close()
+
+	response := oaiGet(test, server, "verb=Identify")
+	if response.Identify == nil || response.Identify.ProtocolVersion != "2.0" ||
+		response.Identify.EarliestDatestamp != "2004-12-06T16:14:21Z" || response.Request.Verb != "Identify" {
+		test.Fatal("wrong Identify", response.Identify, response.Request)
+	}
+
+	response = oaiGet(test, server, "verb=ListMetadataFormats&identifier=oai:example.org:ocm57175940")
+	if response.ListMetadataFormats == nil || len(response.ListMetadataFormats.Formats) != 2 {
+		test.Error("wrong ListMetadataFormats", response.ListMetadataFormats)
+	}
+
+	response = oaiGet(test, server, "verb=ListSets")
+	var sets []string
+	for _, set := range response.ListSets.Sets {
+		sets = append(sets, set.Spec+"="+set.Name)
+	}
+	if strings.Join(sets, "|") != "status=Record status|status:c=c|status:d=d|status:n=n" {
+		test.Error("wrong sets", sets)
+	}
+
+	// the pages of a list
+	var ids []string
+	query := "verb=ListIdentifiers&metadataPrefix=marc21"
+	for pages := 1; ; pages++ {
+		response = oaiGet(test, server, query)
+		for _, header := range response.ListIdentifiers.Headers {
+			ids = append(ids, header.Identifier)
+		}
+		token := response.ListIdentifiers.ResumptionToken
+		if token == nil || token.CompleteListSize != 10 || token.Cursor != (pages-1)*3 {
+			test.Fatal("wrong resumption token", token)
+		}
+		if token.Token == "" {
+			if pages != 4 {
+				test.Error("wrong number of pages", pages)
+			}
+			break
+		}
+		query = "verb=ListIdentifiers&resumptionToken=" + url.QueryEscape(token.Token)
+	}
+	if len(ids) != 10 || ids[0] != "oai:example.org:ocm57175940" || ids[9] != "oai:example.org:ocm57178089" {
+		test.Error("wrong identifiers", ids)
+	}
+
+	response = oaiGet(test, server, "verb=ListRecords&metadataPrefix=marc21&from=2005-01-01")
+	records := response.ListRecords.Records
+	if len(records) != 2 || response.ListRecords.ResumptionToken != nil {
+		test.Fatal("wrong records from 2005", len(records))
+	}
+	rec, err := ParseXmlRecord([]byte(records[1].Metadata.Xml))
+	if err != nil || rec.ControlNum() != "ocm57178089" || len(rec.DataFields) != len(recs[5].DataFields) {
+		test.Error("wrong MARCXML record", rec.ControlNum(), err)
+	}
+
+	response = oaiGet(test, server, "verb=ListRecords&metadataPrefix=oai_dc&from=2004-12-07T07:00:00Z&until=2004-12-07T08:00:00Z&set=status:n")
+	records = response.ListRecords.Records
+	if len(records) != 1 || !strings.Contains(records[0].Metadata.Xml, "<dc:title>") ||
+		records[0].Header.SetSpecs[0] != "status:n" {
+		test.Error("wrong Dublin Core records", records)
+	}
+
+	response = oaiGet(test, server, "verb=GetRecord&metadataPrefix=oai_dc&identifier=oai:example.org:ocm57177924")
+	if header := response.GetRecord.Record.Header; !header.Deleted() || response.GetRecord.Record.Metadata != nil {
+		test.Error("the record is not deleted", header)
+	}
+
+	for query, code := range map[string]string{
+		"verb=Shuffle":                                                                      OaiBadVerb,
+		"verb=Identify&verb=Identify":                                                       OaiBadVerb,
+		"verb=Identify&set=a":                                                               OaiBadArgument,
+		"verb=GetRecord&identifier=x":                                                       OaiBadArgument,
+		"verb=ListRecords&metadataPrefix=mods":                                              OaiCannotDisseminateFormat,
+		"verb=ListRecords&resumptionToken=abc":                                              OaiBadResumptionToken,
+		"verb=ListSets&resumptionToken=abc":                                                 OaiBadResumptionToken,
+		"verb=ListRecords&metadataPrefix=marc21&resumptionToken=abc":                        OaiBadArgument,
+		"verb=ListRecords&metadataPrefix=marc21&from=2100-01-01":                            OaiNoRecordsMatch,
+		"verb=ListRecords&metadataPrefix=marc21&set=status:x":                               OaiNoRecordsMatch,
+		"verb=ListRecords&metadataPrefix=marc21&from=2004-01-01&until=2005-01-01T00:00:00Z": OaiBadArgument,
+		"verb=ListRecords&metadataPrefix=marc21&from=yesterday":                             OaiBadArgument,
+		"verb=GetRecord&metadataPrefix=marc21&identifier=oai:example.org:nothing":           OaiIdDoesNotExist,
+		"verb=ListMetadataFormats&identifier=nothing":                                       OaiIdDoesNotExist,
+	} {
+		response = oaiGet(test, server, query)
+		if oaiErrorCode(response) != code {
+			test.Errorf("%s: expected %s, got %v", query, code, response.Errors)
+		}
+		// the arguments of bad requests are not echoed
+		if (code == OaiBadVerb || code == OaiBadArgument) != (response.Request.Verb == "") {
+			test.Errorf("%s: the wrong request was echoed", query)
+		}
+	}
+
+	resp, err := http.PostForm(server.URL+"/oai", url.Values{"verb": {"GetRecord"},
+		"metadataPrefix": {"marc21"}, "identifier": {"oai:example.org:ocm57178216"}})
+	if err != nil {
+		test.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `<record xmlns="http://www.loc.gov/MARC21/slim">`) {
+		test.Error("wrong POST response", string(body))
+	}
+}
+
+func TestOpenOaiProvider(test *testing.T) {
+	data, err := os.ReadFile("data/test_10.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+	marcFile := filepath.Join(test.TempDir(), "records.mrc")
+	if err := os.WriteFile(marcFile, data, 0644); err != nil {
+		test.Fatal(err)
+	}
+
+	provider, err := OpenOaiProvider(marcFile, OaiConfig{IdentifierPrefix: "oai:test:"})
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer provider.Close()
+	server := httptest.NewServer(provider)
+	defer server.Close()
+
+	response := oaiGet(test, server, "verb=ListRecords&metadataPrefix=marc21")
+	if len(response.ListRecords.Records) != 10 || response.ListRecords.ResumptionToken != nil {
+		test.Fatal("wrong number of records", len(response.ListRecords.Records))
+	}
+	response = oaiGet(test, server, "verb=GetRecord&metadataPrefix=marc21&identifier=oai:test:ocm57178104")
+	rec, err := ParseXmlRecord([]byte(response.GetRecord.Record.Metadata.Xml))
+	if err != nil || rec.ControlNum() != "ocm57178104" {
+		test.Error("wrong record", err)
+	}
+	if response := oaiGet(test, server, "verb=ListSets"); oaiErrorCode(response) != OaiNoSetHierarchy {
+		test.Error("the repository should have no sets")
+	}
+	if _, err := os.Stat(IndexFileName(marcFile)); err != nil {
+		test.Error("the file was not indexed", err)
+	}
+
+	// the records of a store
+	storeFile := filepath.Join(test.TempDir(), "records.db")
+	store, err := OpenStore(storeFile, StoreConfig{})
+	if err != nil {
+		test.Fatal(err)
+	}
+	err = eachRecord(marcFile, func(rec Record) {
+		if err := store.Put(rec); err != nil {
+			test.Fatal(err)
+		}
+	})
+	if err != nil {
+		test.Fatal(err)
+	}
+	store.Close()
+	stored, err := OpenStoreOaiProvider(storeFile, OaiConfig{IdentifierPrefix: "oai:test:"})
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer stored.Close()
+	server = httptest.NewServer(stored)
+	defer server.Close()
+	response = oaiGet(test, server, "verb=ListIdentifiers&metadataPrefix=marc21")
+	if len(response.ListIdentifiers.Headers) != 10 {
+		test.Error("wrong number of stored records", len(response.ListIdentifiers.Headers))
+	}
+	response = oaiGet(test, server, "verb=GetRecord&metadataPrefix=marc21&identifier=oai:test:ocm57178104")
+	if rec, err := ParseXmlRecord([]byte(response.GetRecord.Record.Metadata.Xml)); err != nil || rec.ControlNum() != "ocm57178104" {
+		test.Error("wrong stored record", err)
+	}
+	if _, err := OpenStoreOaiProvider(filepath.Join(test.TempDir(), "missing.db"), OaiConfig{}); err == nil {
+		test.Error("a missing store was opened")
+	}
+}
@@ -0,0 +1,329 @@
+package gomarc21
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+/*
+A minimal RDF graph model used by the linked data conversions, with
+N-Triples, Turtle and JSON-LD serializations.
+
+source: https://www.w3.org/TR/n-triples/
+        https://www.w3.org/TR/turtle/
+        https://www.w3.org/TR/json-ld11/
+*/
+
+const (
+	RdfIri     = iota // an IRI
+	RdfBlank          // a blank node
+	RdfLiteral        // a literal
+)
+
+const (
+	RdfNamespace  = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	RdfsNamespace = "http://www.w3.org/2000/01/rdf-schema#"
+	XsdNamespace  = "http://www.w3.org/2001/XMLSchema#"
+)
+
+// RdfTerm is a node or a literal of an RDF graph.
+type RdfTerm struct {
+	Kind     int
+	Value    string
+	Datatype string
+	Lang     string
+}
+
+// Iri returns an IRI term. The characters an IRI cannot hold (spaces,
+// controls, <>"{}|^` and \) are percent-encoded, so that record data
+// such as 856 $u always makes valid N-Triples and Turtle.
+func Iri(iri string) RdfTerm {
+	return RdfTerm{Kind: RdfIri, Value: escapeIri(iri)}
+}
+
+// IriComponent percent-encodes a value for use as one segment of an IRI,
+// e.g. a control number appended to a base IRI.
+func IriComponent(value string) string {
+	return url.PathEscape(value)
+}
+
+// escapeIri percent-encodes the characters not allowed in an IRIREF.
+func escapeIri(iri string) string {
+	var buf strings.Builder
+	for i := 0; i < len(iri); i++ {
+		c := iri[i]
+		if c <= ' ' || c == 0x7f || strings.IndexByte("<>\"{}|^`\\", c) >= 0 {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		} else {
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+// Blank returns a blank node term with the given label.
+func Blank(label string) RdfTerm {
+	return RdfTerm{Kind: RdfBlank, Value: label}
+}
+
+// Literal returns a plain literal term.
+func Literal(value string) RdfTerm {
+	return RdfTerm{Kind: RdfLiteral, Value: value}
+}
+
+// TypedLiteral returns a literal term with a datatype IRI.
+func TypedLiteral(value string, datatype string) RdfTerm {
+	return RdfTerm{Kind: RdfLiteral, Value: value, Datatype: datatype}
+}
+
+// Triple is a single RDF statement.
+type Triple struct {
+	Subject   RdfTerm
+	Predicate RdfTerm
+	Object    RdfTerm
+}
+
+// RdfGraph is an ordered set of triples plus the namespace prefixes used
+// to abbreviate IRIs in Turtle and JSON-LD.
+type RdfGraph struct {
+	Prefixes map[string]string
+	Triples  []Triple
+	seen     map[Triple]bool
+}
+
+// NewRdfGraph returns an empty graph knowing the rdf, rdfs and xsd prefixes.
+func NewRdfGraph() *RdfGraph {
+	return &RdfGraph{
+		Prefixes: map[string]string{
+			"rdf":  RdfNamespace,
+			"rdfs": RdfsNamespace,
+			"xsd":  XsdNamespace,
+		},
+		seen: map[Triple]bool{},
+	}
+}
+
+// Add adds a triple to the graph. Duplicate triples and empty literals
+// are ignored.
+func (g *RdfGraph) Add(subject RdfTerm, predicate string, object RdfTerm) {
+	if object.Kind == RdfLiteral && object.Value == "" {
+		return
+	}
+	t := Triple{Subject: subject, Predicate: Iri(predicate), Object: object}
+	if g.seen == nil {
+		g.seen = map[Triple]bool{}
+	}
+	if g.seen[t] {
+		return
+	}
+	g.seen[t] = true
+	g.Triples = append(g.Triples, t)
+}
+
+// sortedPrefixes returns the prefix names in sorted order.
+func (g *RdfGraph) sortedPrefixes() []string {
+	names := make([]string, 0, len(g.Prefixes))
+	for name := range g.Prefixes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// compact abbreviates an IRI with a prefix, or returns "" when no prefix
+// applies or the local name cannot be written as a prefixed name.
+func (g *RdfGraph) compact(iri string) string {
+	for _, name := range g.sortedPrefixes() {
+		ns := g.Prefixes[name]
+		if strings.HasPrefix(iri, ns) {
+			local := iri[len(ns):]
+			if isPrefixedLocalName(local) {
+				return name + ":" + local
+			}
+		}
+	}
+	return ""
+}
+
+func isPrefixedLocalName(local string) bool {
+	if local == "" {
+		return false
+	}
+	for i, c := range local {
+		isAlnum := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+		if !isAlnum && c != '_' && (i == 0 || c != '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// escapeRdfString escapes a string for a N-Triples or Turtle literal.
+func escapeRdfString(s string) string {
+	r := strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n", "\r", "\\r", "\t", "\\t")
+	return r.Replace(s)
+}
+
+// ntriplesTerm renders a term in N-Triples syntax.
+func ntriplesTerm(t RdfTerm) string {
+	switch t.Kind {
+	case RdfIri:
+		return "<" + t.Value + ">"
+	case RdfBlank:
+		return "_:" + t.Value
+	}
+	lit := "\"" + escapeRdfString(t.Value) + "\""
+	if t.Lang != "" {
+		return lit + "@" + t.Lang
+	}
+	if t.Datatype != "" {
+		return lit + "^^<" + t.Datatype + ">"
+	}
+	return lit
+}
+
+// AsNTriples returns the graph in N-Triples.
+func (g *RdfGraph) AsNTriples() string {
+	var buf bytes.Buffer
+	for _, t := range g.Triples {
+		fmt.Fprintf(&buf, "%s %s %s .\n", ntriplesTerm(t.Subject), ntriplesTerm(t.Predicate), ntriplesTerm(t.Object))
+	}
+	return buf.String()
+}
+
+// turtleTerm renders a term in Turtle syntax, using prefixed names where
+// possible.
+func (g *RdfGraph) turtleTerm(t RdfTerm) string {
+	switch t.Kind {
+	case RdfIri:
+		if t.Value == RdfNamespace+"type" {
+			return "a"
+		}
+		if name := g.compact(t.Value); name != "" {
+			return name
+		}
+	case RdfLiteral:
+		if t.Datatype != "" && t.Lang == "" {
+			if name := g.compact(t.Datatype); name != "" {
+				return "\"" + escapeRdfString(t.Value) + "\"^^" + name
+			}
+		}
+	}
+	return ntriplesTerm(t)
+}
+
+// TurtlePrefixes returns the @prefix directives of the graph.
+func (g *RdfGraph) TurtlePrefixes() string {
+	var buf bytes.Buffer
+	for _, name := range g.sortedPrefixes() {
+		fmt.Fprintf(&buf, "@prefix %s: <%s> .\n", name, g.Prefixes[name])
+	}
+	return buf.String()
+}
+
+// subjects returns the subjects of the graph in order of first appearance
+// with their triples.
+func (g *RdfGraph) subjects() ([]RdfTerm, map[RdfTerm][]Triple) {
+	var order []RdfTerm
+	bySubject := map[RdfTerm][]Triple{}
+	for _, t := range g.Triples {
+		if _, ok := bySubject[t.Subject]; !ok {
+			order = append(order, t.Subject)
+		}
+		bySubject[t.Subject] = append(bySubject[t.Subject], t)
+	}
+	return order, bySubject
+}
+
+// TurtleStatements returns the triples of the graph in Turtle, grouped by
+// subject and predicate, without the prefix directives.
+func (g *RdfGraph) TurtleStatements() string {
+	var buf bytes.Buffer
+	order, bySubject := g.subjects()
+	for _, s := range order {
+		buf.WriteString(g.turtleTerm(s))
+		triples := bySubject[s]
+		for i := 0; i < len(triples); {
+			p := triples[i].Predicate
+			var objects []string
+			for ; i < len(triples) && triples[i].Predicate == p; i++ {
+				objects = append(objects, g.turtleTerm(triples[i].Object))
+			}
+			fmt.Fprintf(&buf, "\n    %s %s", g.turtleTerm(p), strings.Join(objects, ", "))
+			if i < len(triples) {
+				buf.WriteString(" ;")
+			}
+		}
+		buf.WriteString(" .\n\n")
+	}
+	return buf.String()
+}
+
+// AsTurtle returns the graph in Turtle.
+func (g *RdfGraph) AsTurtle() string {
+	return g.TurtlePrefixes() + "\n" + g.TurtleStatements()
+}
+
+// jsonLdKey returns the JSON-LD key for an IRI, compacted when possible.
+func (g *RdfGraph) jsonLdKey(iri string) string {
+	if name := g.compact(iri); name != "" {
+		return name
+	}
+	return iri
+}
+
+// AsJsonLd returns the graph as a flattened JSON-LD document with the
+// prefixes in its @context.
+func (g *RdfGraph) AsJsonLd() (string, error) {
+	context := map[string]string{}
+	for name, ns := range g.Prefixes {
+		context[name] = ns
+	}
+
+	nodeId := func(t RdfTerm) string {
+		if t.Kind == RdfBlank {
+			return "_:" + t.Value
+		}
+		return g.jsonLdKey(t.Value)
+	}
+
+	var nodes []map[string]interface{}
+	order, bySubject := g.subjects()
+	for _, s := range order {
+		node := map[string]interface{}{"@id": nodeId(s)}
+		for _, t := range bySubject[s] {
+			if t.Predicate.Value == RdfNamespace+"type" {
+				types, _ := node["@type"].([]string)
+				node["@type"] = append(types, g.jsonLdKey(t.Object.Value))
+				continue
+			}
+
+			var value map[string]string
+			switch t.Object.Kind {
+			case RdfLiteral:
+				value = map[string]string{"@value": t.Object.Value}
+				if t.Object.Lang != "" {
+					value["@language"] = t.Object.Lang
+				} else if t.Object.Datatype != "" {
+					value["@type"] = g.jsonLdKey(t.Object.Datatype)
+				}
+			default:
+				value = map[string]string{"@id": nodeId(t.Object)}
+			}
+			key := g.jsonLdKey(t.Predicate.Value)
+			values, _ := node[key].([]map[string]string)
+			node[key] = append(values, value)
+		}
+		nodes = append(nodes, node)
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"@context": context,
+		"@graph":   nodes,
+	})
+	return string(b), err
+}
@@ -0,0 +1,48 @@
+package gomarc21
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRdfGraph(test *testing.T) {
+	g := NewRdfGraph()
+	g.Prefixes["ex"] = "http://example.org/ns#"
+	s := Iri("http://example.org/a")
+	g.Add(s, RdfNamespace+"type", Iri("http://example.org/ns#Thing"))
+	g.Add(s, RdfsNamespace+"label", Literal("A \"quoted\"\nlabel"))
+	g.Add(s, RdfsNamespace+"label", Literal("A \"quoted\"\nlabel"))
+	g.Add(s, RdfsNamespace+"comment", Literal(""))
+	g.Add(s, "http://example.org/ns#date", TypedLiteral("2021", XsdNamespace+"gYear"))
+	if len(g.Triples) != 3 {
+		test.Fatal("duplicate or empty triples were added", g.Triples)
+	}
+
+	nt := g.AsNTriples()
+	if !strings.Contains(nt, `<http://example.org/a> <http://www.w3.org/2000/01/rdf-schema#label> "A \"quoted\"\nlabel" .`) {
+		test.Error("N-Triples literal is wrong", nt)
+	}
+
+	ttl := g.AsTurtle()
+	for _, want := range []string{"@prefix ex: <http://example.org/ns#> .", "a ex:Thing ;", `ex:date "2021"^^xsd:gYear .`} {
+		if !strings.Contains(ttl, want) {
+			test.Errorf("Turtle does not contain %q:\n%s", want, ttl)
+		}
+	}
+
+	ld, err := g.AsJsonLd()
+	if err != nil {
+		test.Fatal(err)
+	}
+	var doc struct {
+		Context map[string]string        `json:"@context"`
+		Graph   []map[string]interface{} `json:"@graph"`
+	}
+	if err := json.Unmarshal([]byte(ld), &doc); err != nil {
+		test.Fatal(err)
+	}
+	if doc.Context["ex"] != "http://example.org/ns#" || len(doc.Graph) != 1 || doc.Graph[0]["@id"] != "http://example.org/a" {
+		test.Error("JSON-LD is wrong", ld)
+	}
+}
@@ -0,0 +1,133 @@
+package gomarc21
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// Reader reads records from a stream of binary MARC, MARCXML or mnemonic
+// text. The format is detected from the first bytes of the stream unless
+// it is set with NewFormatReader.
+type Reader struct {
+	reader  *bufio.Reader
+	format  string
+	decoder *xml.Decoder
+}
+
+// NewReader returns a Reader detecting the format of reader.
+func NewReader(reader io.Reader) *Reader {
+	return &Reader{reader: bufio.NewReader(reader)}
+}
+
+// NewFormatReader returns a Reader reading records in format from reader.
+func NewFormatReader(reader io.Reader, format string) *Reader {
+	return &Reader{reader: bufio.NewReader(reader), format: format}
+}
+
+// Format returns the format of the stream, detecting it if needed. It
+// returns an empty string for an empty stream.
+func (r *Reader) Format() (string, error) {
+	if r.format != "" {
+		return r.format, nil
+	}
+	for {
+		b, err := r.reader.Peek(1)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case b[0] == ' ' || b[0] == '\t' || b[0] == '\r' || b[0] == '\n':
+			r.reader.ReadByte()
+			continue
+		case b[0] == 0xEF: // UTF-8 byte order mark
+			bom, err := r.reader.Peek(3)
+			if err != nil || bom[1] != 0xBB || bom[2] != 0xBF {
+				return "", fmt.Errorf("unrecognized record format (first byte %q)", b[0])
+			}
+			r.reader.Discard(3)
+			continue
+		case b[0] == '<':
+			r.format = FormatXml
+		case b[0] >= '0' && b[0] <= '9':
+			r.format = FormatMarc
+		case b[0] == '=':
+			r.format = FormatMrk
+		default:
+			return "", fmt.Errorf("unrecognized record format (first byte %q)", b[0])
+		}
+		return r.format, nil
+	}
+}
+
+// Next returns the next record of the stream, or io.EOF when there are no
+// more records.
+func (r *Reader) Next() (Record, error) {
+	format, err := r.Format()
+	if err != nil {
+		return Record{}, err
+	}
+
+	switch format {
+	case FormatMarc:
+		return ParseNextRecord(r.reader)
+	case FormatXml:
+		return r.nextXml()
+	case FormatMrk:
+		return r.nextMrk()
+	}
+	return Record{}, fmt.Errorf("reading %s records is not supported", format)
+}
+
+func (r *Reader) nextXml() (Record, error) {
+	if r.decoder == nil {
+		r.decoder = xml.NewDecoder(r.reader)
+	}
+	for {
+		token, err := r.decoder.Token()
+		if err != nil {
+			return Record{}, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+		var x XmlRecord
+		if err := r.decoder.DecodeElement(&x, &start); err != nil {
+			return Record{}, err
+		}
+		return x.Record()
+	}
+}
+
+// ParseXmlRecord parses a single MARCXML record element.
+func ParseXmlRecord(data []byte) (Record, error) {
+	var x XmlRecord
+	if err := xml.Unmarshal(data, &x); err != nil {
+		return Record{}, err
+	}
+	return x.Record()
+}
+
+// Record converts a decoded MARCXML record to a Record. Record length and
+// base address of data are often blank or stale in MARCXML leaders, so
+// non-digits there are read as zeros.
+func (x XmlRecord) Record() (Record, error) {
+	leader := []byte(fmt.Sprintf("%-24s", x.Leader))[:LEADER_LEN]
+	for i, c := range leader {
+		if (i < 5 || (i >= 12 && i < 17)) && (c < '0' || c > '9') {
+			leader[i] = '0'
+		}
+	}
+
+	var err error
+	rec := Record{}
+	rec.Leader, err = NewLeader(leader)
+	if err != nil {
+		return rec, err
+	}
+	rec.ControlFields = x.ControlFields
+	rec.DataFields = x.DataFields
+	return rec, nil
+}
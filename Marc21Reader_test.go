@@ -0,0 +1,84 @@
+package gomarc21
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func readAll(test *testing.T, reader *Reader) []Record {
+	var recs []Record
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			test.Fatal(err)
+		}
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+func TestReaderXml(test *testing.T) {
+	xmlData, err := os.Open("data/test_10.xml")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer xmlData.Close()
+	marcData, err := os.Open("data/test_10.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer marcData.Close()
+
+	xmlReader := NewReader(xmlData)
+	xmlRecs := readAll(test, xmlReader)
+	if format, _ := xmlReader.Format(); format != FormatXml {
+		test.Error("format should be xml, but got", format)
+	}
+	marcReader := NewReader(marcData)
+	marcRecs := readAll(test, marcReader)
+	if format, _ := marcReader.Format(); format != FormatMarc {
+		test.Error("format should be marc, but got", format)
+	}
+
+	if len(xmlRecs) != 10 || len(marcRecs) != 10 {
+		test.Fatal("both files should contain 10 records", len(xmlRecs), len(marcRecs))
+	}
+	for i := range xmlRecs {
+		if xmlRecs[i].GetMrk() != marcRecs[i].GetMrk() {
+			test.Errorf("record %d differs\n%s\n%s", i, xmlRecs[i].GetMrk(), marcRecs[i].GetMrk())
+		}
+	}
+}
+
+func TestReaderByteOrderMark(test *testing.T) {
+	reader := NewReader(strings.NewReader("\xEF\xBB\xBF=LDR  00000nam  2200000   4500\n=001  bom1\n"))
+	if recs := readAll(test, reader); len(recs) != 1 || recs[0].ControlNum() != "bom1" {
+		test.Error("the record after a byte order mark was not read", recs)
+	}
+
+	// only a complete byte order mark is skipped
+	for _, data := range []string{"\xEF=LDR", "\xEF\xBB=LDR", "\xEF\xBB"} {
+		if format, err := NewReader(strings.NewReader(data)).Format(); err == nil {
+			test.Errorf("%q should not be recognized, but got %s", data, format)
+		}
+	}
+}
+
+func TestParseXmlRecord(test *testing.T) {
+	rec, err := ParseXmlRecord([]byte(`<marc:record xmlns:marc="http://www.loc.gov/MARC21/slim">
+		<marc:leader>     nam a22     7a 4500</marc:leader>
+		<marc:controlfield tag="001">12345</marc:controlfield>
+		<marc:datafield tag="245" ind1="1" ind2="0"><marc:subfield code="a">A title</marc:subfield></marc:datafield>
+	</marc:record>`))
+	if err != nil {
+		test.Fatal(err)
+	}
+	if rec.ControlNum() != "12345" || rec.Title() != "=245  10$aA title" {
+		test.Error("record is wrong", rec.GetMrk())
+	}
+}
@@ -39,6 +39,24 @@ func (rec Record) ControlNum() string {
 	return ""
 }
 
+// GetControlfields returns controlfields for the record that match the
+// specified comma separated list of tags. If no tags are specified
+// (empty string) then all controlfields are returned
+func (rec Record) GetControlfields(tags string) (cfs []ControlField) {
+	if tags == "" {
+		return rec.ControlFields
+	}
+
+	for _, t := range strings.Split(tags, ",") {
+		for _, cf := range rec.ControlFields {
+			if cf.Tag.GetTag() == t {
+				cfs = append(cfs, cf)
+			}
+		}
+	}
+	return cfs
+}
+
 // ControlNum returns the control number (tag 001) for the record.
 func (rec Record) Title() string {
 	for _, cf := range rec.DataFields {
@@ -51,7 +69,11 @@ func (rec Record) Title() string {
 
 // parse directory of a marc record
 func ParseDirectory(rawRec []byte) (dir []DirectoryEntry, err error) {
-	for i := LEADER_LEN; rawRec[i] != END_OF_FIELD; i += 12 {
+	i := LEADER_LEN
+	for ; i < len(rawRec) && rawRec[i] != END_OF_FIELD; i += 12 {
+		if i+12 > len(rawRec) {
+			break
+		}
 		var entry DirectoryEntry
 
 		entry, err = NewDirectoryEntry(rawRec[i : i+12])
@@ -60,9 +82,22 @@ func ParseDirectory(rawRec []byte) (dir []DirectoryEntry, err error) {
 		}
 		dir = append(dir, entry)
 	}
+	if i >= len(rawRec) || rawRec[i] != END_OF_FIELD {
+		return nil, errors.New("the directory does not end with a field terminator")
+	}
 	return dir, nil
 }
 
+// fieldBytes returns the bytes of the field of a directory entry, or an
+// error when the entry points outside the record.
+func fieldBytes(rawRec []byte, baseAddress int, d DirectoryEntry) ([]byte, error) {
+	start := baseAddress + d.StartingPosition
+	if baseAddress < LEADER_LEN || d.StartingPosition < 0 || d.FieldLength < 1 || start+d.FieldLength > len(rawRec) {
+		return nil, fmt.Errorf("field %s at %d with length %d is outside the record", d.Tag.GetTag(), d.StartingPosition, d.FieldLength)
+	}
+	return rawRec[start : start+d.FieldLength], nil
+}
+
 // parse leader of a marc record
 func ParseLeader(rawRec []byte) (Leader Leader, err error) {
 	leader, err := NewLeader(rawRec)
@@ -86,8 +121,10 @@ func ParseControlFields(rawRec []byte, baseAddress int, dir []DirectoryEntry) (c
 			return nil, errors.New("issues in the control tags")
 		}
 		if isControlTag {
-			start := baseAddress + d.StartingPosition
-			b := rawRec[start : start+d.FieldLength]
+			b, err := fieldBytes(rawRec, baseAddress, d)
+			if err != nil {
+				return nil, err
+			}
 
 			if b[len(b)-1] == END_OF_FIELD {
 				if d.Tag.GetTag() == "001" {
@@ -121,12 +158,17 @@ func ParseDataFields(rawRec []byte, baseAddress int, dir []DirectoryEntry) (dfs
 		}
 
 		if !isControlTag {
-			start := baseAddress + d.StartingPosition
-			b := rawRec[start : start+d.FieldLength]
+			b, err := fieldBytes(rawRec, baseAddress, d)
+			if err != nil {
+				return nil, err
+			}
 
 			if b[len(b)-1] != END_OF_FIELD {
 				return nil, errors.New("extractDatafields: Field terminator not found at end of field")
 			}
+			if len(b) < 3 {
+				return nil, fmt.Errorf("field %s is too short for its indicators", d.Tag.GetTag())
+			}
 
 			df := DataField{
 				Tag:        d.Tag,
@@ -173,6 +215,9 @@ func ParseRecord(rawRec []byte) (rec Record, err error) {
 
 	rec = Record{}
 
+	if len(rawRec) < LEADER_LEN {
+		return rec, errors.New("the record is shorter than a leader")
+	}
 	rec.Leader, err = ParseLeader(rawRec[:24])
 	if err != nil {
 		log.Print(err)
@@ -245,7 +290,7 @@ func NextRecord(reader io.Reader) (rawRec []byte, err error) {
 	// Read the first 5 bytes, determine the record length and
 	//    read the remainder of the record
 	rawLen := make([]byte, 5)
-	_, err = reader.Read(rawLen)
+	_, err = io.ReadFull(reader, rawLen)
 	if err != nil {
 		return nil, err
 	}
@@ -268,8 +313,9 @@ func NextRecord(reader io.Reader) (rawRec []byte, err error) {
 	// ensure that the raw len is available for the leader
 	copy(rawRec, rawLen)
 
-	// Read the remainder of the record
-	_, err = reader.Read(rawRec[5:recLen])
+	// Read the remainder of the record; decompressing and buffered
+	// readers may return less than asked for by a single Read
+	_, err = io.ReadFull(reader, rawRec[5:recLen])
 	if err != nil {
 		return nil, err
 	}
@@ -299,3 +345,15 @@ func ParseNextRecord(reader io.Reader) (record Record, err error) {
 
 	return record, nil
 }
+
+// fixedField returns the character positions start to end (exclusive) of
+// the first controlfield with the tag, or an empty string when the field
+// is missing or too short.
+func (rec Record) fixedField(tag string, start, end int) string {
+	for _, cf := range rec.GetControlfields(tag) {
+		if len(cf.Data) >= end {
+			return cf.Data[start:end]
+		}
+	}
+	return ""
+}
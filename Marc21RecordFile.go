@@ -0,0 +1,104 @@
+package gomarc21
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// openRecordIndex opens a file of binary MARC with its index, see
+// OpenIndexedFile. It returns nil for the other formats and for
+// compressed files, whose records cannot be read at an offset.
+func openRecordIndex(marcFile string) (*IndexedFile, error) {
+	if FormatFromName(marcFile) != FormatMarc || TrimCompressionExt(marcFile) != marcFile {
+		return nil, nil
+	}
+	return OpenIndexedFile(marcFile, "")
+}
+
+// recordFile is a file of records served by the OAI-PMH, SRU and REST
+// servers. Records in binary MARC are read from the file through its
+// index (see OpenIndexedFile) when requested; records in other formats or
+// in compressed files are kept in memory by the servers. The records of a
+// store (see OpenStore) are read from the store.
+type recordFile struct {
+	name    string
+	indexed *IndexedFile
+	store   *Store
+}
+
+// openRecordFile opens a file of records with its index, see
+// openRecordIndex.
+func openRecordFile(marcFile string) (*recordFile, error) {
+	indexed, err := openRecordIndex(marcFile)
+	if err != nil {
+		return nil, err
+	}
+	return &recordFile{name: marcFile, indexed: indexed}, nil
+}
+
+// openRecordStore opens an existing store of records.
+func openRecordStore(storeFile string) (*recordFile, error) {
+	if _, err := os.Stat(storeFile); err != nil {
+		return nil, err
+	}
+	store, err := OpenStore(storeFile, StoreConfig{})
+	if err != nil {
+		return nil, err
+	}
+	return &recordFile{name: storeFile, store: store}, nil
+}
+
+// get returns the function reading a record through the index or from the
+// store, or nil when the records are not indexed.
+func (f *recordFile) get() func(id string) (Record, error) {
+	switch {
+	case f.store != nil:
+		return f.store.Get
+	case f.indexed != nil:
+		return f.indexed.Get
+	}
+	return nil
+}
+
+// each calls fn with each record of the file.
+func (f *recordFile) each(fn func(rec Record)) error {
+	if f.store != nil {
+		return f.store.Each(func(rec Record) error {
+			fn(rec)
+			return nil
+		})
+	}
+	return eachRecord(f.name, fn)
+}
+
+// Close closes the file of the index or the store, if any.
+func (f *recordFile) Close() error {
+	switch {
+	case f.store != nil:
+		return f.store.Close()
+	case f.indexed != nil:
+		return f.indexed.Close()
+	}
+	return nil
+}
+
+// eachRecord calls fn with each record of a file.
+func eachRecord(marcFile string, fn func(rec Record)) error {
+	in, err := OpenFile(marcFile)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	reader := NewReader(in)
+	for count := 1; ; count++ {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("record %d: %s", count, err)
+		}
+		fn(rec)
+	}
+}
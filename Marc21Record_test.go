@@ -84,6 +84,34 @@ func TestParseDirectory(test *testing.T) {
 
 }
 
+func TestParseMalformedRecord(test *testing.T) {
+	data, err := os.ReadFile("data/test_10.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+	rawRec := data[:1805]
+	corrupt := func(at int, value string) []byte {
+		corrupted := append([]byte(nil), rawRec...)
+		copy(corrupted[at:], value)
+		return corrupted
+	}
+	for name, malformed := range map[string][]byte{
+		"shorter than a leader": []byte("00010nam"),
+		"leader only":           []byte("00000000000000000000000\x1d"),
+		"no directory end":      append(append([]byte(nil), rawRec[:LEADER_LEN]...), "0010012000000050017000"...),
+		"field length":          corrupt(LEADER_LEN+3, "9999"),
+		"starting position":     corrupt(LEADER_LEN+7, "99999"),
+		"negative position":     corrupt(LEADER_LEN+12+7, "-0001"),
+		"base address":          corrupt(12, "00000"),
+		"data field too short":  corrupt(LEADER_LEN+5*12+3, "0001"),
+		"truncated":             rawRec[:600],
+	} {
+		if _, err := ParseRecord(malformed); err == nil {
+			test.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
 // parse leader of a marc record
 func TestParseLeader(test *testing.T) {
 }
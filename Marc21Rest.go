@@ -0,0 +1,429 @@
+package gomarc21
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+A RestServer serves records over HTTP:
+
+    POST /convert        converts the records of the request body
+    POST /lint           lints the records of the request body
+    GET  /records/{id}   returns a record by control number
+
+The records of a request are in binary MARC, MARCXML or MARCMaker text,
+given by the Content-Type (application/marc, application/marcxml+xml,
+text/x-mrk) or detected. Responses are in the format asked for by the
+format parameter (a format name such as mods) or the Accept header:
+
+    application/marc            binary MARC
+    application/marcxml+xml     MARCXML (the default)
+    application/json            JSON, an array of records for /convert
+    application/x-ndjson        JSON, one record per line
+    text/x-mrk                  MARCMaker text
+
+Converted records are written as they are read, so responses stream.
+Request bodies larger than MaxRequestSize are refused with 413.
+Errors are JSON objects: {"error": "..."}.
+*/
+
+// DefaultRestMaxRequestSize is the largest request body of a server
+// without MaxRequestSize.
+const DefaultRestMaxRequestSize = 32 << 20
+
+// restFlushRecords is the number of records written between flushes of a
+// streamed response.
+const restFlushRecords = 100
+
+// RestMediaTypes are the media types of the formats.
+var RestMediaTypes = map[string]string{
+	FormatMarc:      "application/marc",
+	FormatXml:       "application/marcxml+xml",
+	FormatJson:      "application/x-ndjson",
+	FormatJsonArray: "application/json",
+	FormatMrk:       "text/x-mrk",
+	FormatDc:        "application/xml",
+	FormatDcJson:    "application/x-ndjson",
+	FormatMods:      "application/mods+xml",
+	FormatNt:        "application/n-triples",
+	FormatTurtle:    "text/turtle",
+	FormatJsonLd:    "application/ld+json",
+	FormatBibtex:    "application/x-bibtex",
+	FormatRis:       "application/x-research-info-systems",
+	FormatCsl:       "application/vnd.citationstyles.csl+json",
+}
+
+// restAcceptFormats maps the media types of the Accept header to formats,
+// for batches of records.
+var restAcceptFormats = map[string]string{
+	"application/marc":                        FormatMarc,
+	"application/marcxml+xml":                 FormatXml,
+	"application/xml":                         FormatXml,
+	"text/xml":                                FormatXml,
+	"application/json":                        FormatJsonArray,
+	"application/x-ndjson":                    FormatJson,
+	"text/x-mrk":                              FormatMrk,
+	"text/plain":                              FormatMrk,
+	"application/mods+xml":                    FormatMods,
+	"application/n-triples":                   FormatNt,
+	"text/turtle":                             FormatTurtle,
+	"application/ld+json":                     FormatJsonLd,
+	"application/x-bibtex":                    FormatBibtex,
+	"application/x-research-info-systems":     FormatRis,
+	"application/vnd.citationstyles.csl+json": FormatCsl,
+}
+
+// restContentFormats maps the media types of request bodies to formats.
+var restContentFormats = map[string]string{
+	"application/marc":         FormatMarc,
+	"application/octet-stream": "",
+	"application/marcxml+xml":  FormatXml,
+	"application/xml":          FormatXml,
+	"text/xml":                 FormatXml,
+	"text/x-mrk":               FormatMrk,
+	"text/plain":               FormatMrk,
+}
+
+// RestConfig configures a RestServer.
+type RestConfig struct {
+	// MaxRequestSize is the largest request body in bytes,
+	// DefaultRestMaxRequestSize when zero.
+	MaxRequestSize int64
+	// LintRules are the rules of /lint without a rules parameter, all the
+	// rules when empty.
+	LintRules []LintRule
+}
+
+// RestServer is an HTTP server converting, linting and returning records.
+type RestServer struct {
+	Config RestConfig
+
+	get    func(id string) (Record, error)
+	mux    *http.ServeMux
+	closer io.Closer
+}
+
+// NewRestServer returns a server of the records read by get, which returns
+// ErrRecordNotFound for unknown control numbers. /records is not served
+// when get is nil.
+func NewRestServer(config RestConfig, get func(id string) (Record, error)) *RestServer {
+	s := &RestServer{Config: config, get: get, mux: http.NewServeMux()}
+	if s.Config.MaxRequestSize <= 0 {
+		s.Config.MaxRequestSize = DefaultRestMaxRequestSize
+	}
+	if len(s.Config.LintRules) == 0 {
+		s.Config.LintRules, _ = ParseLintRules("")
+	}
+	s.mux.HandleFunc("POST /convert", s.convert)
+	s.mux.HandleFunc("POST /lint", s.lint)
+	if get != nil {
+		s.mux.HandleFunc("GET /records/{id}", s.record)
+	}
+	return s
+}
+
+// OpenRestServer returns a server of the records of a file by control
+// number. Without an index, the first record of each control number is
+// kept in memory.
+func OpenRestServer(marcFile string, config RestConfig) (*RestServer, error) {
+	f, err := openRecordFile(marcFile)
+	if err != nil {
+		return nil, err
+	}
+	get := f.get()
+	if get == nil {
+		recs := map[string]Record{}
+		err = f.each(func(rec Record) {
+			if id := strings.TrimSpace(rec.ControlNum()); id != "" {
+				if _, ok := recs[id]; !ok {
+					recs[id] = rec
+				}
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		get = func(id string) (Record, error) {
+			rec, ok := recs[id]
+			if !ok {
+				return Record{}, ErrRecordNotFound
+			}
+			return rec, nil
+		}
+	}
+	s := NewRestServer(config, get)
+	s.closer = f
+	return s, nil
+}
+
+// Close closes the file of the records when the server opened it.
+func (s *RestServer) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+func (s *RestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// restError writes an error response.
+func restError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// negotiateFormat returns the format of a response: the format parameter,
+// or the format of the media type of the Accept header with the highest
+// quality, or defaultFormat.
+func negotiateFormat(r *http.Request, formats map[string]string, defaultFormat string) (string, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		if _, ok := RestMediaTypes[format]; !ok {
+			return "", fmt.Errorf("unsupported format %q", format)
+		}
+		return format, nil
+	}
+	accept := r.Header.Get("Accept")
+	if strings.TrimSpace(accept) == "" {
+		return defaultFormat, nil
+	}
+
+	type choice struct {
+		format  string
+		quality float64
+	}
+	var choices []choice
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if quality <= 0 {
+			continue
+		}
+		if mediaType == "*/*" || mediaType == "application/*" {
+			choices = append(choices, choice{defaultFormat, quality - 0.001})
+		} else if format, ok := formats[mediaType]; ok {
+			choices = append(choices, choice{format, quality})
+		}
+	}
+	if len(choices) == 0 {
+		return "", fmt.Errorf("none of the media types accepted is supported: %s", accept)
+	}
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].quality > choices[j].quality })
+	return choices[0].format, nil
+}
+
+// requestReader returns a reader of the records of a request body, of the
+// format of its Content-Type or detected.
+func (s *RestServer) requestReader(w http.ResponseWriter, r *http.Request) (*Reader, int, error) {
+	if r.ContentLength > s.Config.MaxRequestSize {
+		return nil, http.StatusRequestEntityTooLarge,
+			fmt.Errorf("the request body is larger than %d bytes", s.Config.MaxRequestSize)
+	}
+	// the response is written while the body is read
+	http.NewResponseController(w).EnableFullDuplex()
+	body := http.MaxBytesReader(w, r.Body, s.Config.MaxRequestSize)
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return NewReader(body), 0, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, http.StatusUnsupportedMediaType, err
+	}
+	format, ok := restContentFormats[mediaType]
+	if !ok {
+		return nil, http.StatusUnsupportedMediaType, fmt.Errorf("unsupported content type %s", mediaType)
+	}
+	if format == "" {
+		return NewReader(body), 0, nil
+	}
+	return NewFormatReader(body, format), 0, nil
+}
+
+// readStatus returns the status of an error reading a request body.
+func readStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+func (s *RestServer) convert(w http.ResponseWriter, r *http.Request) {
+	format, err := negotiateFormat(r, restAcceptFormats, FormatXml)
+	if err != nil {
+		restError(w, http.StatusNotAcceptable, err)
+		return
+	}
+	reader, status, err := s.requestReader(w, r)
+	if err != nil {
+		restError(w, status, err)
+		return
+	}
+
+	// the first record is read before the response starts, to report
+	// a body that is not records
+	rec, err := reader.Next()
+	if err != nil && err != io.EOF {
+		restError(w, readStatus(err), err)
+		return
+	}
+	w.Header().Set("Content-Type", RestMediaTypes[format])
+	writer, _ := NewWriter(w, format)
+	flusher, _ := w.(http.Flusher)
+	for count := 1; err == nil; count++ {
+		if err := writer.Write(rec); err != nil {
+			fmt.Fprintf(os.Stderr, "convert: record %d: %s\n", count, err)
+			return
+		}
+		if flusher != nil && count%restFlushRecords == 0 {
+			flusher.Flush()
+		}
+		rec, err = reader.Next()
+	}
+	if err != io.EOF {
+		// the response has started: it is left incomplete
+		fmt.Fprintf(os.Stderr, "convert: %s\n", err)
+		return
+	}
+	writer.Close()
+}
+
+// RestLintRecord is the lint result of a record.
+type RestLintRecord struct {
+	Position int         `json:"position"`
+	Id       string      `json:"id"`
+	Issues   []LintIssue `json:"issues"`
+}
+
+// RestLintResponse is the response of /lint. Records without issues are
+// not listed.
+type RestLintResponse struct {
+	Records []RestLintRecord `json:"records"`
+	Count   int              `json:"count"`
+	Issues  int              `json:"issues"`
+	Error   string           `json:"error,omitempty"`
+}
+
+func (s *RestServer) lint(w http.ResponseWriter, r *http.Request) {
+	rules := s.Config.LintRules
+	if names := r.URL.Query().Get("rules"); names != "" {
+		var err error
+		if rules, err = ParseLintRules(names); err != nil {
+			restError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	reader, status, err := s.requestReader(w, r)
+	if err != nil {
+		restError(w, status, err)
+		return
+	}
+	rec, err := reader.Next()
+	if err != nil && err != io.EOF {
+		restError(w, readStatus(err), err)
+		return
+	}
+
+	// the response is the JSON of a RestLintResponse, written record by
+	// record
+	w.Header().Set("Content-Type", "application/json")
+	io.WriteString(w, `{"records":[`)
+	count, issues, listed := 0, 0, 0
+	for ; err == nil; rec, err = reader.Next() {
+		count++
+		found := rec.Lint(rules)
+		if len(found) == 0 {
+			continue
+		}
+		issues += len(found)
+		data, _ := json.Marshal(RestLintRecord{Position: count, Id: strings.TrimSpace(rec.ControlNum()), Issues: found})
+		if listed > 0 {
+			io.WriteString(w, ",")
+		}
+		io.WriteString(w, "\n")
+		w.Write(data)
+		listed++
+	}
+	fmt.Fprintf(w, "\n],\"count\":%d,\"issues\":%d", count, issues)
+	if err != io.EOF {
+		data, _ := json.Marshal(err.Error())
+		fmt.Fprintf(w, ",\"error\":%s", data)
+	}
+	io.WriteString(w, "}\n")
+}
+
+func (s *RestServer) record(w http.ResponseWriter, r *http.Request) {
+	// a single record is a JSON object, not an array
+	formats := map[string]string{"application/json": FormatJson}
+	for mediaType, format := range restAcceptFormats {
+		if _, ok := formats[mediaType]; !ok {
+			formats[mediaType] = format
+		}
+	}
+	format, err := negotiateFormat(r, formats, FormatXml)
+	if err != nil {
+		restError(w, http.StatusNotAcceptable, err)
+		return
+	}
+	id := r.PathValue("id")
+	rec, err := s.get(id)
+	if errors.Is(err, ErrRecordNotFound) {
+		restError(w, http.StatusNotFound, fmt.Errorf("record %s not found", id))
+		return
+	}
+	if err != nil {
+		restError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	var data []byte
+	switch format {
+	case FormatXml:
+		var str string
+		if str, err = oaiMetadata(rec, OaiPrefixMarc21); err == nil {
+			data = []byte(xml.Header + str + "\n")
+		}
+	case FormatJson:
+		w.Header().Set("Content-Type", "application/json")
+		var str string
+		if str, err = rec.RecordAsJson(); err == nil {
+			data = []byte(str + "\n")
+		}
+	default:
+		var b strings.Builder
+		writer, _ := NewWriter(&b, format)
+		if err = writer.Write(rec); err == nil {
+			err = writer.Close()
+		}
+		data = []byte(b.String())
+	}
+	if err != nil {
+		restError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", RestMediaTypes[format])
+	}
+	w.Write(data)
+}
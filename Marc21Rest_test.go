@@ -0,0 +1,162 @@
+package gomarc21
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// restRequest sends a request to a server and returns the response and
+// its body.
+func restRequest(test *testing.T, server *httptest.Server, method string, path string, body []byte,
+	headers map[string]string) (*http.Response, []byte) {
+	test.Helper()
+	req, err := http.NewRequest(method, server.URL+path, bytes.NewReader(body))
+	if err != nil {
+		test.Fatal(err)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		test.Fatal(err)
+	}
+	return resp, data
+}
+
+func TestRestServer(test *testing.T) {
+	data, err := os.ReadFile("data/test_10.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+	marcFile := filepath.Join(test.TempDir(), "records.mrc")
+	if err := os.WriteFile(marcFile, data, 0644); err != nil {
+		test.Fatal(err)
+	}
+	rest, err := OpenRestServer(marcFile, RestConfig{MaxRequestSize: int64(len(data))})
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer rest.Close()
+	server := httptest.NewServer(rest)
+	defer server.Close()
+
+	// conversions
+	resp, body := restRequest(test, server, "POST", "/convert", data, nil)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/marcxml+xml" {
+		test.Fatal("wrong response", resp.Status, resp.Header.Get("Content-Type"))
+	}
+	if recs := readAll(test, NewReader(bytes.NewReader(body))); len(recs) != 10 || recs[9].ControlNum() != "ocm57178216" {
+		test.Error("wrong MARCXML records", len(recs))
+	}
+
+	resp, body = restRequest(test, server, "POST", "/convert", data,
+		map[string]string{"Content-Type": "application/marc", "Accept": "application/json"})
+	var items []map[string]interface{}
+	if err := json.Unmarshal(body, &items); err != nil || len(items) != 10 || resp.Header.Get("Content-Type") != "application/json" {
+		test.Error("wrong JSON records", len(items), err)
+	}
+
+	resp, body = restRequest(test, server, "POST", "/convert", data,
+		map[string]string{"Accept": "application/marc;q=0.5, text/x-mrk, */*;q=0.1"})
+	if !strings.HasPrefix(string(body), "=LDR  ") || resp.Header.Get("Content-Type") != "text/x-mrk" {
+		test.Error("wrong MARCMaker records", resp.Header.Get("Content-Type"))
+	}
+	mrk := body
+	resp, body = restRequest(test, server, "POST", "/convert?format=marc", mrk, map[string]string{"Content-Type": "text/x-mrk"})
+	if recs := readAll(test, NewReader(bytes.NewReader(body))); len(recs) != 10 || resp.Header.Get("Content-Type") != "application/marc" {
+		test.Error("wrong binary records", len(recs))
+	}
+
+	for _, t := range []struct {
+		path    string
+		body    []byte
+		headers map[string]string
+		status  int
+	}{
+		{"/convert", data, map[string]string{"Accept": "image/png"}, http.StatusNotAcceptable},
+		{"/convert?format=pdf", data, nil, http.StatusNotAcceptable},
+		{"/convert", data, map[string]string{"Content-Type": "application/pdf"}, http.StatusUnsupportedMediaType},
+		{"/convert", []byte("nothing"), nil, http.StatusBadRequest},
+		{"/convert", append(data, data...), nil, http.StatusRequestEntityTooLarge},
+		{"/lint?rules=nothing", data, nil, http.StatusBadRequest},
+	} {
+		resp, body := restRequest(test, server, "POST", t.path, t.body, t.headers)
+		var response map[string]string
+		if resp.StatusCode != t.status || json.Unmarshal(body, &response) != nil || response["error"] == "" {
+			test.Errorf("%s %v: expected %d, got %s %s", t.path, t.headers, t.status, resp.Status, body)
+		}
+	}
+
+	// linting
+	recs := readAll(test, NewReader(bytes.NewReader(data)))
+	invalid := recs[0].Clone()
+	df := DataField{Tag: "020", Indicator1: " ", Indicator2: " "}
+	df.AddSubField("a", "0306406153")
+	invalid.AddDataField(df)
+	var batch bytes.Buffer
+	for _, rec := range []Record{recs[1], invalid} {
+		raw, err := rec.RecordAsMarc()
+		if err != nil {
+			test.Fatal(err)
+		}
+		batch.Write(raw)
+	}
+	resp, body = restRequest(test, server, "POST", "/lint", batch.Bytes(), nil)
+	var lint RestLintResponse
+	if err := json.Unmarshal(body, &lint); err != nil {
+		test.Fatal(err, string(body))
+	}
+	if lint.Count != 2 || lint.Issues != 1 || len(lint.Records) != 1 || lint.Records[0].Position != 2 ||
+		lint.Records[0].Id != "ocm57175940" || lint.Records[0].Issues[0].Rule != IdentifierLintRule.Name {
+		test.Error("wrong lint response", string(body))
+	}
+
+	// a directory entry with a field length past the end of the record
+	malformed := append([]byte(nil), data[:1805]...)
+	copy(malformed[LEADER_LEN+3:], "9999")
+	resp, body = restRequest(test, server, "POST", "/lint", malformed, nil)
+	var response map[string]string
+	if resp.StatusCode != http.StatusBadRequest || json.Unmarshal(body, &response) != nil || response["error"] == "" {
+		test.Error("expected 400, got", resp.Status, string(body))
+	}
+	resp, body = restRequest(test, server, "POST", "/lint", append(batch.Bytes(), malformed...), nil)
+	lint = RestLintResponse{}
+	if err := json.Unmarshal(body, &lint); err != nil || lint.Count != 2 || lint.Error == "" {
+		test.Error("wrong lint response of a malformed record", string(body))
+	}
+	if resp, _ := restRequest(test, server, "POST", "/convert", malformed, nil); resp.StatusCode != http.StatusBadRequest {
+		test.Error("expected 400, got", resp.Status)
+	}
+
+	// records by id
+	resp, body = restRequest(test, server, "GET", "/records/ocm57178104", nil, nil)
+	rec, err := ParseXmlRecord(body)
+	if resp.StatusCode != http.StatusOK || err != nil || rec.ControlNum() != "ocm57178104" {
+		test.Error("wrong MARCXML record", resp.Status, err)
+	}
+	resp, body = restRequest(test, server, "GET", "/records/ocm57178104", nil, map[string]string{"Accept": "application/json"})
+	var object map[string]interface{}
+	if err := json.Unmarshal(body, &object); err != nil || object["leader"] == nil {
+		test.Error("wrong JSON record", err, string(body))
+	}
+	resp, body = restRequest(test, server, "GET", "/records/ocm57178104", nil, map[string]string{"Accept": "application/marc"})
+	if rec, err := ParseRecord(body); err != nil || rec.ControlNum() != "ocm57178104" {
+		test.Error("wrong binary record", err)
+	}
+	if resp, _ := restRequest(test, server, "GET", "/records/nothing", nil, nil); resp.StatusCode != http.StatusNotFound {
+		test.Error("expected 404, got", resp.Status)
+	}
+}
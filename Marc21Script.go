@@ -0,0 +1,559 @@
+package gomarc21
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+/*
+source: https://github.com/google/starlark-go/blob/master/doc/spec.md
+
+Scripts are written in Starlark, a dialect of Python, and define a
+transform function called with each record:
+
+    def transform(record):
+        for f in record.fields("650{^2=7}{$2=\\fast}"):
+            f.remove_subfields("0")
+        if not record.values("245$a"):
+            return False  # drop the record
+        record.add_field("500", subfields=[("a", "Processed.")])
+
+The record is changed in place; returning False drops it.
+
+    record.leader                  the leader, can be set
+    record.id                      the 001
+    record.fields(spec="")         the fields (all, or those the spec selects)
+    record.values(spec)            the values the spec selects (see Spec)
+    record.add_field(tag, ind1=" ", ind2=" ", subfields=[], data="")
+                                   add a field in tag order and return it
+    record.remove(field or list)   remove fields, return how many
+    record.mrk()                   the record in mnemonic form
+
+    field.tag, field.is_control
+    field.data                     the data of a control field, can be set
+    field.ind1, field.ind2         the indicators, can be set
+    field.subfields                list of (code, value), can be set
+    field.value(code)              the first value of the code, or None
+    field.values(codes="")         the values of the codes (all when empty)
+    field.add_subfield(code, value)
+    field.set_subfield(code, value)  replace the first value or add it
+    field.remove_subfields(codes)  remove subfields, return how many
+*/
+
+// DefaultScriptMaxSteps limits the computation steps of a script for one
+// record, so that a loop which never ends fails the record.
+const DefaultScriptMaxSteps = 10000000
+
+// Script is a compiled transformation script.
+type Script struct {
+	Name      string
+	MaxSteps  uint64
+	transform starlark.Callable
+}
+
+// scriptOptions are the Starlark dialect options of the scripts.
+var scriptOptions = &syntax.FileOptions{
+	Set:             true,
+	While:           true,
+	TopLevelControl: true,
+	GlobalReassign:  true,
+}
+
+// CompileScript compiles a script, given as a string or []byte, which
+// should define a transform function.
+func CompileScript(name string, src interface{}) (*Script, error) {
+	thread := &starlark.Thread{Name: name}
+	globals, err := starlark.ExecFileOptions(scriptOptions, thread, name, src, nil)
+	if err != nil {
+		return nil, scriptError(err)
+	}
+	transform, ok := globals["transform"].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("%s: no transform function", name)
+	}
+	return &Script{Name: name, MaxSteps: DefaultScriptMaxSteps, transform: transform}, nil
+}
+
+// ReadScript reads and compiles a script file.
+func ReadScript(file string) (*Script, error) {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return CompileScript(file, src)
+}
+
+// scriptError returns the error with its Starlark backtrace.
+func scriptError(err error) error {
+	if evalErr, ok := err.(*starlark.EvalError); ok {
+		return fmt.Errorf("%s", evalErr.Backtrace())
+	}
+	return err
+}
+
+// Transform runs the script on a copy of the record and returns the
+// changed copy and whether to keep it. When the script fails the record
+// is returned unchanged with the error.
+func (s *Script) Transform(rec Record) (Record, bool, error) {
+	thread := &starlark.Thread{Name: s.Name}
+	if s.MaxSteps > 0 {
+		thread.SetMaxExecutionSteps(s.MaxSteps)
+	}
+	r := newScriptRecord(rec)
+	result, err := starlark.Call(thread, s.transform, starlark.Tuple{r}, nil)
+	if err != nil {
+		return rec, true, scriptError(err)
+	}
+	out, _, _ := r.record()
+	return out, result != starlark.False, nil
+}
+
+// scriptRecord is the record given to the scripts.
+type scriptRecord struct {
+	leader Leader
+	fields []*scriptField
+	frozen bool
+}
+
+// scriptField is a field of a scriptRecord.
+type scriptField struct {
+	tag       string
+	control   bool
+	data      string
+	ind1      string
+	ind2      string
+	subfields []SubField
+	frozen    bool
+}
+
+func newScriptRecord(rec Record) *scriptRecord {
+	r := &scriptRecord{leader: rec.Leader}
+	for _, cf := range rec.ControlFields {
+		r.fields = append(r.fields, &scriptField{tag: cf.Tag.GetTag(), control: true, data: cf.Data})
+	}
+	for _, df := range rec.DataFields {
+		r.fields = append(r.fields, &scriptField{tag: df.Tag.GetTag(), ind1: df.GetIndicator1(), ind2: df.GetIndicator2(),
+			subfields: append([]SubField{}, df.SubFields...)})
+	}
+	return r
+}
+
+// record returns the record the script made, and the positions in r.fields
+// of its control and data fields.
+func (r *scriptRecord) record() (Record, []int, []int) {
+	rec := Record{Leader: r.leader}
+	var controls, datas []int
+	for i, f := range r.fields {
+		if f.control {
+			rec.ControlFields = append(rec.ControlFields, ControlField{Tag: Tag(f.tag), Data: f.data})
+			controls = append(controls, i)
+		} else {
+			rec.DataFields = append(rec.DataFields, DataField{Tag: Tag(f.tag), Indicator1: f.ind1, Indicator2: f.ind2,
+				SubFields: append([]SubField{}, f.subfields...)})
+			datas = append(datas, i)
+		}
+	}
+	return rec, controls, datas
+}
+
+func (r *scriptRecord) String() string        { return "<record " + r.id() + ">" }
+func (r *scriptRecord) Type() string          { return "record" }
+func (r *scriptRecord) Freeze()               { r.frozen = true }
+func (r *scriptRecord) Truth() starlark.Bool  { return starlark.True }
+func (r *scriptRecord) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable type: record") }
+
+func (r *scriptRecord) id() string {
+	for _, f := range r.fields {
+		if f.tag == "001" {
+			return strings.TrimSpace(f.data)
+		}
+	}
+	return ""
+}
+
+var scriptRecordMethods = map[string]func(r *scriptRecord, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error){
+	"fields":    (*scriptRecord).fieldsMethod,
+	"values":    (*scriptRecord).valuesMethod,
+	"add_field": (*scriptRecord).addFieldMethod,
+	"remove":    (*scriptRecord).removeMethod,
+	"mrk": func(r *scriptRecord, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if err := starlark.UnpackArgs("mrk", args, kwargs); err != nil {
+			return nil, err
+		}
+		rec, _, _ := r.record()
+		return starlark.String(rec.GetMrk()), nil
+	},
+}
+
+func (r *scriptRecord) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "leader":
+		return starlark.String(r.leader.GetRaw()), nil
+	case "id":
+		return starlark.String(r.id()), nil
+	}
+	if method, ok := scriptRecordMethods[name]; ok {
+		return starlark.NewBuiltin(name, func(_ *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			return method(r, args, kwargs)
+		}), nil
+	}
+	return nil, nil
+}
+
+func (r *scriptRecord) AttrNames() []string {
+	names := []string{"id", "leader"}
+	for name := range scriptRecordMethods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *scriptRecord) SetField(name string, value starlark.Value) error {
+	if r.frozen {
+		return fmt.Errorf("cannot set %s of a frozen record", name)
+	}
+	if name != "leader" {
+		return starlark.NoSuchAttrError(fmt.Sprintf("cannot set %s of a record", name))
+	}
+	s, ok := starlark.AsString(value)
+	if !ok {
+		return fmt.Errorf("leader should be a string, not %s", value.Type())
+	}
+	leader, err := NewLeader([]byte(s))
+	if err != nil {
+		return err
+	}
+	r.leader = leader
+	return nil
+}
+
+func (r *scriptRecord) checkMutable(method string) error {
+	if r.frozen {
+		return fmt.Errorf("%s: the record is frozen", method)
+	}
+	return nil
+}
+
+func (r *scriptRecord) fieldsMethod(args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var specText string
+	if err := starlark.UnpackArgs("fields", args, kwargs, "spec?", &specText); err != nil {
+		return nil, err
+	}
+	var fields []starlark.Value
+	if specText == "" {
+		for _, f := range r.fields {
+			fields = append(fields, f)
+		}
+		return starlark.NewList(fields), nil
+	}
+
+	spec, err := ParseSpec(specText)
+	if err != nil {
+		return nil, err
+	}
+	rec, controls, datas := r.record()
+	for _, pos := range rec.SelectControlFields(spec) {
+		fields = append(fields, r.fields[controls[pos]])
+	}
+	for _, pos := range rec.SelectDataFields(spec) {
+		fields = append(fields, r.fields[datas[pos]])
+	}
+	return starlark.NewList(fields), nil
+}
+
+func (r *scriptRecord) valuesMethod(args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var specText string
+	if err := starlark.UnpackArgs("values", args, kwargs, "spec", &specText); err != nil {
+		return nil, err
+	}
+	spec, err := ParseSpec(specText)
+	if err != nil {
+		return nil, err
+	}
+	rec, _, _ := r.record()
+	return stringList(rec.Select(spec)), nil
+}
+
+func (r *scriptRecord) addFieldMethod(args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	f := &scriptField{ind1: " ", ind2: " "}
+	var subfields starlark.Iterable
+	if err := starlark.UnpackArgs("add_field", args, kwargs,
+		"tag", &f.tag, "ind1?", &f.ind1, "ind2?", &f.ind2, "subfields?", &subfields, "data?", &f.data); err != nil {
+		return nil, err
+	}
+	if err := r.checkMutable("add_field"); err != nil {
+		return nil, err
+	}
+	if _, err := NewTagByStr(f.tag); err != nil || len(f.tag) != 3 {
+		return nil, fmt.Errorf("add_field: invalid tag %q", f.tag)
+	}
+	f.control = f.tag < "010"
+	if subfields != nil {
+		var err error
+		if f.subfields, err = toSubFields("add_field", subfields); err != nil {
+			return nil, err
+		}
+	}
+
+	// after the fields of the same kind with a lower or equal tag
+	pos := len(r.fields)
+	for pos > 0 && (r.fields[pos-1].control != f.control || r.fields[pos-1].tag > f.tag) {
+		if r.fields[pos-1].control && !f.control {
+			break
+		}
+		pos--
+	}
+	r.fields = append(r.fields, nil)
+	copy(r.fields[pos+1:], r.fields[pos:])
+	r.fields[pos] = f
+	return f, nil
+}
+
+func (r *scriptRecord) removeMethod(args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var target starlark.Value
+	if err := starlark.UnpackArgs("remove", args, kwargs, "field", &target); err != nil {
+		return nil, err
+	}
+	if err := r.checkMutable("remove"); err != nil {
+		return nil, err
+	}
+	removed := map[*scriptField]bool{}
+	if f, ok := target.(*scriptField); ok {
+		removed[f] = true
+	} else if iterable, ok := target.(starlark.Iterable); ok {
+		iter := iterable.Iterate()
+		defer iter.Done()
+		var v starlark.Value
+		for iter.Next(&v) {
+			f, ok := v.(*scriptField)
+			if !ok {
+				return nil, fmt.Errorf("remove: %s is not a field", v.Type())
+			}
+			removed[f] = true
+		}
+	} else {
+		return nil, fmt.Errorf("remove: %s is not a field", target.Type())
+	}
+
+	kept := r.fields[:0]
+	count := 0
+	for _, f := range r.fields {
+		if removed[f] {
+			count++
+		} else {
+			kept = append(kept, f)
+		}
+	}
+	r.fields = kept
+	return starlark.MakeInt(count), nil
+}
+
+// toSubFields converts a list of (code, value) pairs.
+func toSubFields(method string, iterable starlark.Iterable) ([]SubField, error) {
+	var subfields []SubField
+	iter := iterable.Iterate()
+	defer iter.Done()
+	var v starlark.Value
+	for iter.Next(&v) {
+		pair, ok := v.(starlark.Indexable)
+		if !ok || pair.Len() != 2 {
+			return nil, fmt.Errorf("%s: a subfield should be a (code, value) pair, not %s", method, v)
+		}
+		code, ok1 := starlark.AsString(pair.Index(0))
+		value, ok2 := starlark.AsString(pair.Index(1))
+		if !ok1 || !ok2 || len(code) != 1 {
+			return nil, fmt.Errorf("%s: invalid subfield %s", method, v)
+		}
+		subfields = append(subfields, SubField{Code: code, Data: value})
+	}
+	return subfields, nil
+}
+
+func stringList(values []string) *starlark.List {
+	list := make([]starlark.Value, len(values))
+	for i, v := range values {
+		list[i] = starlark.String(v)
+	}
+	return starlark.NewList(list)
+}
+
+func (f *scriptField) String() string {
+	if f.control {
+		return ControlField{Tag: Tag(f.tag), Data: f.data}.String()
+	}
+	return DataField{Tag: Tag(f.tag), Indicator1: f.ind1, Indicator2: f.ind2, SubFields: f.subfields}.String()
+}
+func (f *scriptField) Type() string          { return "field" }
+func (f *scriptField) Freeze()               { f.frozen = true }
+func (f *scriptField) Truth() starlark.Bool  { return starlark.True }
+func (f *scriptField) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable type: field") }
+
+var scriptFieldMethods = map[string]func(f *scriptField, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error){
+	"value":            (*scriptField).valueMethod,
+	"values":           (*scriptField).valuesMethod,
+	"add_subfield":     (*scriptField).addSubFieldMethod,
+	"set_subfield":     (*scriptField).setSubFieldMethod,
+	"remove_subfields": (*scriptField).removeSubFieldsMethod,
+}
+
+func (f *scriptField) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "tag":
+		return starlark.String(f.tag), nil
+	case "is_control":
+		return starlark.Bool(f.control), nil
+	case "data":
+		return starlark.String(f.data), nil
+	case "ind1":
+		return starlark.String(f.ind1), nil
+	case "ind2":
+		return starlark.String(f.ind2), nil
+	case "subfields":
+		pairs := make([]starlark.Value, len(f.subfields))
+		for i, sf := range f.subfields {
+			pairs[i] = starlark.Tuple{starlark.String(sf.Code), starlark.String(sf.Data)}
+		}
+		return starlark.NewList(pairs), nil
+	}
+	if method, ok := scriptFieldMethods[name]; ok {
+		return starlark.NewBuiltin(name, func(_ *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			return method(f, args, kwargs)
+		}), nil
+	}
+	return nil, nil
+}
+
+func (f *scriptField) AttrNames() []string {
+	names := []string{"data", "ind1", "ind2", "is_control", "subfields", "tag"}
+	for name := range scriptFieldMethods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (f *scriptField) SetField(name string, value starlark.Value) error {
+	if f.frozen {
+		return fmt.Errorf("cannot set %s of a frozen field", name)
+	}
+	if name == "subfields" {
+		iterable, ok := value.(starlark.Iterable)
+		if !ok || f.control {
+			return fmt.Errorf("subfields should be a list of (code, value) pairs of a data field")
+		}
+		subfields, err := toSubFields("subfields", iterable)
+		if err != nil {
+			return err
+		}
+		f.subfields = subfields
+		return nil
+	}
+
+	s, ok := starlark.AsString(value)
+	if !ok {
+		return fmt.Errorf("%s should be a string, not %s", name, value.Type())
+	}
+	switch {
+	case name == "data" && f.control:
+		f.data = s
+	case (name == "ind1" || name == "ind2") && !f.control:
+		if len(s) != 1 {
+			return fmt.Errorf("%s should be a single character", name)
+		}
+		if name == "ind1" {
+			f.ind1 = s
+		} else {
+			f.ind2 = s
+		}
+	default:
+		return starlark.NoSuchAttrError(fmt.Sprintf("cannot set %s of a field %s", name, f.tag))
+	}
+	return nil
+}
+
+func (f *scriptField) checkMutable(method string) error {
+	if f.frozen {
+		return fmt.Errorf("%s: the field is frozen", method)
+	}
+	if f.control {
+		return fmt.Errorf("%s: %s is a control field", method, f.tag)
+	}
+	return nil
+}
+
+func (f *scriptField) valueMethod(args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var code string
+	if err := starlark.UnpackArgs("value", args, kwargs, "code", &code); err != nil {
+		return nil, err
+	}
+	for _, sf := range f.subfields {
+		if sf.Code == code {
+			return starlark.String(sf.Data), nil
+		}
+	}
+	return starlark.None, nil
+}
+
+func (f *scriptField) valuesMethod(args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var codes string
+	if err := starlark.UnpackArgs("values", args, kwargs, "codes?", &codes); err != nil {
+		return nil, err
+	}
+	var values []string
+	for _, sf := range f.subfields {
+		if codes == "" || strings.Contains(codes, sf.Code) {
+			values = append(values, sf.Data)
+		}
+	}
+	return stringList(values), nil
+}
+
+func (f *scriptField) addSubFieldMethod(args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var code, value string
+	if err := starlark.UnpackArgs("add_subfield", args, kwargs, "code", &code, "value", &value); err != nil {
+		return nil, err
+	}
+	if err := f.checkMutable("add_subfield"); err != nil {
+		return nil, err
+	}
+	f.subfields = append(f.subfields, SubField{Code: code, Data: value})
+	return starlark.None, nil
+}
+
+func (f *scriptField) setSubFieldMethod(args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var code, value string
+	if err := starlark.UnpackArgs("set_subfield", args, kwargs, "code", &code, "value", &value); err != nil {
+		return nil, err
+	}
+	if err := f.checkMutable("set_subfield"); err != nil {
+		return nil, err
+	}
+	for i, sf := range f.subfields {
+		if sf.Code == code {
+			f.subfields[i].Data = value
+			return starlark.None, nil
+		}
+	}
+	f.subfields = append(f.subfields, SubField{Code: code, Data: value})
+	return starlark.None, nil
+}
+
+func (f *scriptField) removeSubFieldsMethod(args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var codes string
+	if err := starlark.UnpackArgs("remove_subfields", args, kwargs, "codes", &codes); err != nil {
+		return nil, err
+	}
+	if err := f.checkMutable("remove_subfields"); err != nil {
+		return nil, err
+	}
+	df := DataField{SubFields: f.subfields}
+	removed := df.RemoveSubFields(codes)
+	f.subfields = df.SubFields
+	return starlark.MakeInt(removed), nil
+}
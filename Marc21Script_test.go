@@ -0,0 +1,90 @@
+package gomarc21
+
+import (
+	"strings"
+	"testing"
+)
+
+const testScript = `
+def transform(record):
+    if record.id == "drop":
+        return False
+    for f in record.fields("650"):
+        f.ind2 = "7"
+        f.add_subfield("2", "local")
+    for f in record.fields("9.."):
+        record.remove(f)
+    title = record.fields("245")[0]
+    title.set_subfield("h", "[online]")
+    title.remove_subfields("c")
+    note = record.add_field("500", subfields=[("a", "Script: " + title.value("a"))])
+    note.subfields = note.subfields + [("5", "XYZ")]
+    record.add_field("003", data="XYZ")
+    record.leader = record.leader[:5] + "c" + record.leader[6:]
+    if len(record.values("040$d")) != 2:
+        fail("wrong 040$d")
+`
+
+func TestScript(test *testing.T) {
+	script, err := CompileScript("test.star", testScript)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	file, err := OpenFile("data/test_10.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer file.Close()
+	rec := readAll(test, NewReader(file))[0]
+
+	result, keep, err := script.Transform(rec)
+	if err != nil || !keep {
+		test.Fatal("transform failed", keep, err)
+	}
+	check := func(spec string, expected string) {
+		values := result.Select(MustParseSpec(spec))
+		if strings.Join(values, "|") != expected {
+			test.Errorf("%s: expected %q, got %q", spec, expected, values)
+		}
+	}
+	check("LDR/5", "c")
+	check("003", "XYZ")
+	check("650^2", "7|7")
+	check("650$2", "local|local")
+	check("245$h", "[online]")
+	check("245$c", "")
+	check("500[#]$a", "Script: Guidelines for sample collecting and analytical methods used in the U.S. Geological Survey for determining chemical composition of coal")
+	check("500[#]$5", "XYZ")
+	check("9..", "")
+	if result.ControlFields[1].Tag != "003" || len(rec.Select(MustParseSpec("9.."))) != 5 {
+		test.Error("the 003 is misplaced or the original record was changed")
+	}
+
+	diff := DiffRecords(rec, result)
+	if len(diff) == 0 || !strings.HasPrefix(diff[0], "- =LDR") || !strings.HasPrefix(diff[1], "+ =LDR") {
+		test.Error("wrong diff", diff)
+	}
+
+	// a failing record is returned unchanged
+	failing, err := CompileScript("fail.star", "def transform(record):\n    record.add_field(\"500\")\n    return 1 / 0\n")
+	if err != nil {
+		test.Fatal(err)
+	}
+	result, keep, err = failing.Transform(rec)
+	if err == nil || !keep || len(DiffRecords(rec, result)) != 0 {
+		test.Error("the failing script changed the record", err)
+	}
+
+	looping, _ := CompileScript("loop.star", "def transform(record):\n    while True:\n        pass\n")
+	looping.MaxSteps = 1000
+	if _, _, err := looping.Transform(rec); err == nil {
+		test.Error("the loop was not stopped")
+	}
+
+	for _, bad := range []string{"x = 1", "def transform(record):\n    return (", "fail('at load')"} {
+		if _, err := CompileScript("bad.star", bad); err == nil {
+			test.Errorf("%q should not compile", bad)
+		}
+	}
+}
@@ -0,0 +1,486 @@
+package gomarc21
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+A SearchIndex is an inverted index of the records of a file, for a quick
+local catalog:
+
+    index, _ := OpenSearchIndex("records.mrc")
+    result, _ := index.Search(`climate change type:a`, 20)
+
+The values of each SearchField are split into terms by the analyzer of
+the field and the positions of the terms are kept, so phrases can be
+searched. A query is a list of clauses which all have to match:
+
+    word              a term of the title, author or subject fields
+    "two words"       a phrase of one of these fields
+    field:word        a term or a phrase of a field (title, author,
+    field:"a phrase"  subject, isbn, id, type, language)
+    -clause           the clause must not match
+
+Hits are sorted by relevance (the frequency of the terms weighted by
+their rarity and by the boost of the fields), and the facets of the hits
+count their types of record (leader/06) and languages (008/35-37).
+
+The index is saved in a sidecar file next to the MARC file (see
+SearchIndexFileName), and rebuilt when the MARC file has changed.
+*/
+
+// searchIndexVersion is the version of the format of the index files.
+const searchIndexVersion = 1
+
+// searchValueGap separates the positions of the terms of two values, so
+// phrases do not match across values.
+const searchValueGap = 100
+
+// SearchField is a field of a SearchIndex.
+type SearchField struct {
+	Name string
+	// Specs are the MARCspecs of the values of the field, or Values
+	// returns them.
+	Specs  []string
+	Values func(rec Record) []string
+	// Analyze splits a value into terms.
+	Analyze func(value string) []string
+	// Boost weighs the terms of the field in the relevance of the hits.
+	Boost float64
+	// Default fields are searched by clauses without a field.
+	Default bool
+	// Facet fields are counted in the facets of the results.
+	Facet bool
+}
+
+// AnalyzeText splits a value into words after NACO normalization.
+func AnalyzeText(value string) []string {
+	return strings.Fields(NacoNormalize(value))
+}
+
+// AnalyzeExact returns a value as a single term, trimmed and in lower
+// case.
+func AnalyzeExact(value string) []string {
+	if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+		return []string{value}
+	}
+	return nil
+}
+
+// AnalyzeIsbn returns the ISBN-13 of a valid ISBN, otherwise the
+// normalized ISBN, as a single term.
+func AnalyzeIsbn(value string) []string {
+	return AnalyzeExact(normalizeSruIsbn(value))
+}
+
+// DefaultSearchFields are the fields of the indexes opened with
+// OpenSearchIndex.
+var DefaultSearchFields = []SearchField{
+	{Name: "title", Specs: sruTitleSpecs, Analyze: AnalyzeText, Boost: 2, Default: true},
+	{Name: "author", Specs: sruCreatorSpecs, Analyze: AnalyzeText, Boost: 1.5, Default: true},
+	{Name: "subject", Specs: sruSubjectSpecs, Analyze: AnalyzeText, Boost: 1, Default: true},
+	{Name: "isbn", Values: Record.Isbns, Analyze: AnalyzeIsbn, Boost: 1},
+	{Name: "id", Specs: []string{"001"}, Analyze: AnalyzeExact, Boost: 1},
+	{Name: "type", Specs: []string{"LDR/06"}, Analyze: AnalyzeExact, Boost: 1, Facet: true},
+	{Name: "language", Specs: []string{"008/35-37"}, Analyze: AnalyzeExact, Boost: 1, Facet: true},
+}
+
+// SearchDoc is a record of a SearchIndex.
+type SearchDoc struct {
+	Id    string
+	Title string
+	// Position is the position of the record in the file, from 1.
+	Position int
+}
+
+// SearchPosting lists the positions of a term in a record.
+type SearchPosting struct {
+	Doc       int
+	Positions []int
+}
+
+// SearchIndex is an inverted index of records.
+type SearchIndex struct {
+	Version int
+	// Size and ModTime are the size and the modification time of the
+	// indexed file.
+	Size    int64
+	ModTime time.Time
+	Docs    []SearchDoc
+	// Postings are the postings of the terms of each field.
+	Postings map[string]map[string][]SearchPosting
+
+	fields []SearchField
+	specs  map[string][]Spec
+}
+
+// SearchHit is a record found by a search.
+type SearchHit struct {
+	SearchDoc
+	Score float64
+}
+
+// SearchResult is the result of a search.
+type SearchResult struct {
+	Total int
+	Hits  []SearchHit
+	// Facets count the values of the facet fields in the records found.
+	Facets map[string]map[string]int
+}
+
+// SearchIndexFileName returns the name of the sidecar search index file
+// of a MARC file.
+func SearchIndexFileName(marcFile string) string {
+	return marcFile + ".search"
+}
+
+// NewSearchIndex returns an index without records, of the given fields
+// or of DefaultSearchFields.
+func NewSearchIndex(fields []SearchField) (*SearchIndex, error) {
+	if len(fields) == 0 {
+		fields = DefaultSearchFields
+	}
+	idx := &SearchIndex{Version: searchIndexVersion, Postings: map[string]map[string][]SearchPosting{},
+		fields: fields, specs: map[string][]Spec{}}
+	for _, field := range fields {
+		if field.Analyze == nil {
+			return nil, fmt.Errorf("field %s has no analyzer", field.Name)
+		}
+		for _, text := range field.Specs {
+			spec, err := ParseSpec(text)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %s", field.Name, err)
+			}
+			idx.specs[field.Name] = append(idx.specs[field.Name], spec)
+		}
+	}
+	return idx, nil
+}
+
+// Add adds a record to the index.
+func (idx *SearchIndex) Add(rec Record) {
+	doc := len(idx.Docs)
+	title := ""
+	for _, df := range rec.GetDatafields("245") {
+		title = joinSubFields(df, "ab", " ")
+		break
+	}
+	idx.Docs = append(idx.Docs, SearchDoc{Id: strings.TrimSpace(rec.ControlNum()), Title: title, Position: doc + 1})
+
+	for _, field := range idx.fields {
+		var values []string
+		if field.Values != nil {
+			values = field.Values(rec)
+		}
+		for _, spec := range idx.specs[field.Name] {
+			values = append(values, rec.Select(spec)...)
+		}
+		terms := map[string][]int{}
+		position := 0
+		for _, value := range values {
+			analyzed := field.Analyze(value)
+			for i, term := range analyzed {
+				terms[term] = append(terms[term], position+i)
+			}
+			position += len(analyzed) + searchValueGap
+		}
+		if len(terms) == 0 {
+			continue
+		}
+		postings := idx.Postings[field.Name]
+		if postings == nil {
+			postings = map[string][]SearchPosting{}
+			idx.Postings[field.Name] = postings
+		}
+		for term, positions := range terms {
+			postings[term] = append(postings[term], SearchPosting{Doc: doc, Positions: positions})
+		}
+	}
+}
+
+// BuildSearchIndex indexes the records of a file, with the given fields or
+// with DefaultSearchFields.
+func BuildSearchIndex(marcFile string, fields []SearchField) (*SearchIndex, error) {
+	info, err := os.Stat(marcFile)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := NewSearchIndex(fields)
+	if err != nil {
+		return nil, err
+	}
+	idx.Size, idx.ModTime = info.Size(), info.ModTime()
+	if err := eachRecord(marcFile, idx.Add); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// Write writes the index in the sidecar file format.
+func (idx *SearchIndex) Write(writer io.Writer) error {
+	return gob.NewEncoder(writer).Encode(idx)
+}
+
+// ReadSearchIndex reads an index of DefaultSearchFields written by
+// SearchIndex.Write.
+func ReadSearchIndex(reader io.Reader) (*SearchIndex, error) {
+	idx, err := NewSearchIndex(nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := gob.NewDecoder(reader).Decode(idx); err != nil {
+		return nil, err
+	}
+	if idx.Version != searchIndexVersion {
+		return nil, fmt.Errorf("unsupported search index version %d", idx.Version)
+	}
+	return idx, nil
+}
+
+// OpenSearchIndex returns the index of DefaultSearchFields of a MARC
+// file, read from its sidecar file. The index is built and saved when the
+// sidecar file does not exist, or is older than the MARC file.
+func OpenSearchIndex(marcFile string) (*SearchIndex, error) {
+	info, err := os.Stat(marcFile)
+	if err != nil {
+		return nil, err
+	}
+	if sidecar, err := os.Open(SearchIndexFileName(marcFile)); err == nil {
+		idx, err := ReadSearchIndex(sidecar)
+		sidecar.Close()
+		if err == nil && idx.Size == info.Size() && idx.ModTime.Equal(info.ModTime()) {
+			return idx, nil
+		}
+	}
+	return WriteSearchIndexFile(marcFile)
+}
+
+// WriteSearchIndexFile builds the index of DefaultSearchFields of a MARC
+// file and saves it in the sidecar file.
+func WriteSearchIndexFile(marcFile string) (*SearchIndex, error) {
+	idx, err := BuildSearchIndex(marcFile, nil)
+	if err != nil {
+		return nil, err
+	}
+	out, err := os.Create(SearchIndexFileName(marcFile))
+	if err != nil {
+		return nil, err
+	}
+	if err := idx.Write(out); err != nil {
+		out.Close()
+		return nil, err
+	}
+	return idx, out.Close()
+}
+
+// searchClause is a clause of a query.
+type searchClause struct {
+	field   string // empty for the default fields
+	text    string
+	negated bool
+}
+
+// parseSearchQuery splits a query into clauses.
+func (idx *SearchIndex) parseSearchQuery(query string) ([]searchClause, error) {
+	var clauses []searchClause
+	for i := 0; i < len(query); {
+		if query[i] == ' ' || query[i] == '\t' {
+			i++
+			continue
+		}
+		var clause searchClause
+		if query[i] == '-' && i+1 < len(query) && query[i+1] != ' ' {
+			clause.negated = true
+			i++
+		}
+		if colon := strings.IndexAny(query[i:], ": \t\""); colon > 0 && query[i+colon] == ':' {
+			if _, ok := idx.field(query[i : i+colon]); ok {
+				clause.field = query[i : i+colon]
+				i += colon + 1
+			}
+		}
+		if i < len(query) && query[i] == '"' {
+			end := strings.IndexByte(query[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated phrase %s", query[i:])
+			}
+			clause.text = query[i+1 : i+1+end]
+			i += end + 2
+		} else {
+			end := strings.IndexAny(query[i:], " \t")
+			if end < 0 {
+				end = len(query) - i
+			}
+			clause.text = query[i : i+end]
+			i += end
+		}
+		clauses = append(clauses, clause)
+	}
+	if len(clauses) == 0 {
+		return nil, errors.New("empty query")
+	}
+	return clauses, nil
+}
+
+// field returns the field of a name.
+func (idx *SearchIndex) field(name string) (SearchField, bool) {
+	for _, field := range idx.fields {
+		if strings.EqualFold(field.Name, name) {
+			return field, true
+		}
+	}
+	return SearchField{}, false
+}
+
+// match returns the scores of the records matching a clause.
+func (idx *SearchIndex) match(clause searchClause) (map[int]float64, error) {
+	fields := idx.fields
+	if clause.field != "" {
+		field, _ := idx.field(clause.field)
+		fields = []SearchField{field}
+	}
+	scores := map[int]float64{}
+	analyzed := false
+	for _, field := range fields {
+		if clause.field == "" && !field.Default {
+			continue
+		}
+		terms := field.Analyze(clause.text)
+		if len(terms) == 0 {
+			continue
+		}
+		analyzed = true
+		frequencies := idx.matchTerms(field.Name, terms)
+		idf := math.Log(1 + float64(len(idx.Docs))/float64(len(frequencies)+1))
+		boost := field.Boost
+		if boost == 0 {
+			boost = 1
+		}
+		for doc, frequency := range frequencies {
+			scores[doc] += float64(frequency) * idf * boost
+		}
+	}
+	if !analyzed {
+		return nil, fmt.Errorf("nothing to search in %q", clause.text)
+	}
+	return scores, nil
+}
+
+// matchTerms returns the number of times the terms follow each other in
+// a field of each record.
+func (idx *SearchIndex) matchTerms(field string, terms []string) map[int]int {
+	frequencies := map[int]int{}
+	postings := idx.Postings[field]
+	if len(terms) == 1 {
+		for _, posting := range postings[terms[0]] {
+			frequencies[posting.Doc] = len(posting.Positions)
+		}
+		return frequencies
+	}
+
+	// the positions of the following terms in each record
+	following := make([]map[int]map[int]bool, len(terms))
+	for i, term := range terms[1:] {
+		following[i+1] = map[int]map[int]bool{}
+		for _, posting := range postings[term] {
+			positions := map[int]bool{}
+			for _, position := range posting.Positions {
+				positions[position] = true
+			}
+			following[i+1][posting.Doc] = positions
+		}
+	}
+	for _, posting := range postings[terms[0]] {
+		for _, start := range posting.Positions {
+			found := true
+			for i := 1; i < len(terms) && found; i++ {
+				found = following[i][posting.Doc][start+i]
+			}
+			if found {
+				frequencies[posting.Doc]++
+			}
+		}
+	}
+	return frequencies
+}
+
+// Search returns the records matching a query, at most limit hits when
+// limit is positive, and the facets of all the records matching.
+func (idx *SearchIndex) Search(query string, limit int) (*SearchResult, error) {
+	clauses, err := idx.parseSearchQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	var scores map[int]float64
+	var excluded []map[int]float64
+	for _, clause := range clauses {
+		matched, err := idx.match(clause)
+		if err != nil {
+			return nil, err
+		}
+		if clause.negated {
+			excluded = append(excluded, matched)
+			continue
+		}
+		if scores == nil {
+			scores = matched
+			continue
+		}
+		for doc, score := range scores {
+			if other, ok := matched[doc]; ok {
+				scores[doc] = score + other
+			} else {
+				delete(scores, doc)
+			}
+		}
+	}
+	if scores == nil {
+		// only negated clauses
+		scores = map[int]float64{}
+		for doc := range idx.Docs {
+			scores[doc] = 0
+		}
+	}
+	for _, matched := range excluded {
+		for doc := range matched {
+			delete(scores, doc)
+		}
+	}
+
+	result := &SearchResult{Total: len(scores), Facets: map[string]map[string]int{}}
+	for doc, score := range scores {
+		result.Hits = append(result.Hits, SearchHit{SearchDoc: idx.Docs[doc], Score: score})
+	}
+	sort.Slice(result.Hits, func(i, j int) bool {
+		if result.Hits[i].Score != result.Hits[j].Score {
+			return result.Hits[i].Score > result.Hits[j].Score
+		}
+		return result.Hits[i].Position < result.Hits[j].Position
+	})
+	if limit > 0 && len(result.Hits) > limit {
+		result.Hits = result.Hits[:limit]
+	}
+	for _, field := range idx.fields {
+		if !field.Facet {
+			continue
+		}
+		counts := map[string]int{}
+		for term, postings := range idx.Postings[field.Name] {
+			for _, posting := range postings {
+				if _, ok := scores[posting.Doc]; ok {
+					counts[term]++
+				}
+			}
+		}
+		result.Facets[field.Name] = counts
+	}
+	return result, nil
+}
@@ -0,0 +1,93 @@
+package gomarc21
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSearchIndex(test *testing.T) {
+	data, err := os.ReadFile("data/test_10.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+	marcFile := filepath.Join(test.TempDir(), "records.mrc")
+	if err := os.WriteFile(marcFile, data, 0644); err != nil {
+		test.Fatal(err)
+	}
+	idx, err := OpenSearchIndex(marcFile)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if _, err := os.Stat(SearchIndexFileName(marcFile)); err != nil {
+		test.Fatal("the index was not saved", err)
+	}
+
+	ids := func(result *SearchResult) string {
+		var ids []string
+		for _, hit := range result.Hits {
+			ids = append(ids, hit.Id)
+		}
+		return strings.Join(ids, " ")
+	}
+	for query, expected := range map[string]string{
+		"fish":                          "ocm57178112 ocm57178104",
+		`"fish culture"`:                "ocm57178104 ocm57178112",
+		"security aviation":             "ocm57177924",
+		`"security aviation"`:           "",
+		`title:"aviation security"`:     "ocm57177924",
+		"author:swanson":                "ocm57175940",
+		"subject:swanson":               "",
+		"numeros":                       "ocm57178089",
+		"language:spa":                  "ocm57178089",
+		"id:OCM57178158":                "ocm57178158",
+		"fish -hatchery":                "ocm57178104",
+		"-type:a":                       "",
+		`report "united states" russia`: "ocm57178031",
+	} {
+		result, err := idx.Search(query, 0)
+		if err != nil {
+			test.Errorf("%s: %s", query, err)
+			continue
+		}
+		if got := ids(result); got != expected || result.Total != len(result.Hits) {
+			test.Errorf("%s: expected %q, got %q", query, expected, got)
+		}
+	}
+
+	result, err := idx.Search("type:a", 3)
+	if err != nil || result.Total != 10 || len(result.Hits) != 3 || result.Hits[0].Position != 1 {
+		test.Error("wrong limited result", result, err)
+	}
+	if result.Facets["type"]["a"] != 10 || result.Facets["language"]["eng"] != 9 || result.Facets["language"]["spa"] != 1 {
+		test.Error("wrong facets", result.Facets)
+	}
+	if result, _ := idx.Search("fish", 0); result.Facets["language"]["eng"] != 2 || len(result.Facets["language"]) != 1 {
+		test.Error("wrong facets of a search", result.Facets)
+	}
+
+	for _, query := range []string{"", `"fish`, "...", "coal -"} {
+		if _, err := idx.Search(query, 0); err == nil {
+			test.Errorf("%q: expected an error", query)
+		}
+	}
+
+	// the saved index, then a changed file
+	if saved, err := OpenSearchIndex(marcFile); err != nil || len(saved.Docs) != 10 || len(saved.Postings) != len(idx.Postings) {
+		test.Fatal("wrong saved index", err)
+	}
+	first, err := NextRecord(bytes.NewReader(data))
+	if err != nil {
+		test.Fatal(err)
+	}
+	if err := os.WriteFile(marcFile, first, 0644); err != nil {
+		test.Fatal(err)
+	}
+	os.Chtimes(marcFile, time.Now(), time.Now().Add(time.Hour))
+	if rebuilt, err := OpenSearchIndex(marcFile); err != nil || len(rebuilt.Docs) != 1 {
+		test.Error("the index was not rebuilt", err)
+	}
+}
@@ -0,0 +1,564 @@
+package gomarc21
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+source: https://marcspec.github.io/MARCspec/marc-spec.html
+
+A Spec selects fields, subfields, indicators or character positions of a
+record with a subset of MARCspec:
+
+    245              the 245 fields
+    9..              the fields with a tag from 900 to 999
+    020[0]           the first 020, [#] the last, [0-2] the first three
+    245$a$b, 245$a-c the subfields a and b, a to c of the 245
+    245^2            the second indicator of the 245
+    008/35-37        the characters 35 to 37 of the 008, /# the last
+    LDR/06           the character 06 of the leader
+    650$a/0-2        the first three characters of the 650 $a
+
+Conditions in braces restrict the fields selected. Their subject is
+either relative to the field ($x, ^1, /0-3), a spec of the record
+(245$a), or omitted to compare the values selected themselves. The
+operators are = (equals), != (does not equal), ~ (contains) and !~ (does
+not contain); a subject alone, or preceded by ?, tests that it exists,
+and preceded by ! that it does not. Values may start with a backslash as
+in MARCspec. Alternatives are separated by |, and all the conditions in
+braces must hold:
+
+    856$z{^2=1}          the $z of the 856 with the second indicator 1
+    650{$2=\fast}        the 650 from FAST
+    9..{!$5}{$a~local|$b}
+    040$d{=\XYZ}          the $d of the 040 which are XYZ
+*/
+
+// isSpecRangeCode tells if c can start or end a range of subfield codes.
+func isSpecRangeCode(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// SpecRange is a range of positions; -1 stands for the last one (#).
+type SpecRange struct {
+	Set   bool
+	Start int
+	End   int
+}
+
+// resolve returns the positions of the range among n, or false when the
+// range is out of bounds.
+func (r SpecRange) resolve(n int) (int, int, bool) {
+	if !r.Set {
+		return 0, n - 1, n > 0
+	}
+	start, end := r.Start, r.End
+	if start < 0 {
+		start = n - 1
+	}
+	if end < 0 {
+		end = n - 1
+	}
+	if end > n-1 {
+		end = n - 1
+	}
+	return start, end, start >= 0 && start <= end
+}
+
+// SpecCondition is one of the alternatives of a condition.
+type SpecCondition struct {
+	Subject  *Spec // a spec of the record, or nil when relative
+	Relative Spec  // the relative subject, with no tag
+	Self     bool  // no subject: the value selected is compared
+	Operator string
+	Value    string
+}
+
+// Spec is a parsed MARCspec.
+type Spec struct {
+	Tag        string // may contain "." wildcards, or LDR
+	Index      SpecRange
+	Indicator  int    // 1 or 2 when the spec selects an indicator
+	Codes      string // the subfield codes selected
+	Characters SpecRange
+	Conditions [][]SpecCondition // all must hold, each is a list of alternatives
+	source     string
+}
+
+func (s Spec) String() string {
+	return s.source
+}
+
+// ParseSpec parses a MARCspec such as "245$a$b" or "650{$2=\fast}".
+func ParseSpec(spec string) (Spec, error) {
+	s := Spec{source: spec}
+	p := specParser{input: spec}
+	if len(spec) < 3 {
+		return s, fmt.Errorf("invalid spec %q: no tag", spec)
+	}
+	s.Tag = spec[:3]
+	for _, c := range s.Tag {
+		if c != '.' && !(c >= '0' && c <= '9') && !(c >= 'A' && c <= 'Z') && !(c >= 'a' && c <= 'z') {
+			return s, fmt.Errorf("invalid spec %q: invalid tag", spec)
+		}
+	}
+	p.pos = 3
+	if err := p.parseRest(&s, true); err != nil {
+		return s, fmt.Errorf("invalid spec %q: %s", spec, err)
+	}
+	return s, nil
+}
+
+// MustParseSpec is like ParseSpec but panics when the spec is invalid.
+func MustParseSpec(spec string) Spec {
+	s, err := ParseSpec(spec)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+type specParser struct {
+	input string
+	pos   int
+}
+
+func (p *specParser) peek() byte {
+	if p.pos < len(p.input) {
+		return p.input[p.pos]
+	}
+	return 0
+}
+
+// parseRest parses what follows the tag. Relative subjects of conditions
+// have no index and no conditions.
+func (p *specParser) parseRest(s *Spec, full bool) error {
+	if full && p.peek() == '[' {
+		end := strings.IndexByte(p.input[p.pos:], ']')
+		if end < 0 {
+			return fmt.Errorf("unclosed index")
+		}
+		r, err := parseSpecRange(p.input[p.pos+1 : p.pos+end])
+		if err != nil {
+			return err
+		}
+		s.Index = r
+		p.pos += end + 1
+	}
+
+	switch p.peek() {
+	case '^':
+		if p.pos+1 >= len(p.input) || (p.input[p.pos+1] != '1' && p.input[p.pos+1] != '2') {
+			return fmt.Errorf("the indicator should be ^1 or ^2")
+		}
+		s.Indicator = int(p.input[p.pos+1] - '0')
+		p.pos += 2
+	case '$':
+		for p.peek() == '$' {
+			if p.pos+1 >= len(p.input) {
+				return fmt.Errorf("no subfield code after $")
+			}
+			code := p.input[p.pos+1]
+			p.pos += 2
+			if p.peek() == '-' && p.pos+1 < len(p.input) {
+				last := p.input[p.pos+1]
+				if !isSpecRangeCode(code) || !isSpecRangeCode(last) || last < code {
+					return fmt.Errorf("invalid subfield range %q-%q", code, last)
+				}
+				for c := int(code); c <= int(last); c++ {
+					s.Codes += string(rune(c))
+				}
+				p.pos += 2
+			} else {
+				s.Codes += string(code)
+			}
+		}
+	}
+
+	if p.peek() == '/' {
+		end := p.pos + 1
+		for end < len(p.input) && strings.IndexByte("0123456789-#", p.input[end]) >= 0 {
+			end++
+		}
+		r, err := parseSpecRange(p.input[p.pos+1 : end])
+		if err != nil {
+			return err
+		}
+		s.Characters = r
+		p.pos = end
+	}
+
+	for full && p.peek() == '{' {
+		end := p.closingBrace()
+		if end < 0 {
+			return fmt.Errorf("unclosed condition")
+		}
+		var alternatives []SpecCondition
+		for _, text := range splitUnescaped(p.input[p.pos+1:end], '|') {
+			c, err := parseSpecCondition(text)
+			if err != nil {
+				return err
+			}
+			alternatives = append(alternatives, c)
+		}
+		s.Conditions = append(s.Conditions, alternatives)
+		p.pos = end + 1
+	}
+
+	if p.pos != len(p.input) {
+		return fmt.Errorf("unexpected %q", p.input[p.pos:])
+	}
+	return nil
+}
+
+// closingBrace returns the position of the brace closing the one at the
+// current position, skipping escaped characters.
+func (p *specParser) closingBrace() int {
+	for i := p.pos + 1; i < len(p.input); i++ {
+		switch p.input[i] {
+		case '\\':
+			i++
+		case '}':
+			return i
+		}
+	}
+	return -1
+}
+
+// splitUnescaped splits s on sep when it is not escaped by a backslash.
+func splitUnescaped(s string, sep byte) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseSpecRange parses "3", "#", "0-2" or "5-#".
+func parseSpecRange(text string) (SpecRange, error) {
+	r := SpecRange{Set: true}
+	bounds := strings.SplitN(text, "-", 2)
+	var err error
+	position := func(b string) int {
+		if b == "#" {
+			return -1
+		}
+		n, e := strconv.Atoi(b)
+		if e != nil || n < 0 {
+			err = fmt.Errorf("invalid position %q", b)
+		}
+		return n
+	}
+	r.Start = position(bounds[0])
+	r.End = r.Start
+	if len(bounds) == 2 {
+		r.End = position(bounds[1])
+	}
+	return r, err
+}
+
+// specOperators are the comparison operators, longest first.
+var specOperators = []string{"!=", "!~", "=", "~"}
+
+// parseSpecCondition parses a condition such as "$a=\foo" or "!$5".
+func parseSpecCondition(text string) (SpecCondition, error) {
+	c := SpecCondition{Operator: "?"}
+	subject := text
+	switch {
+	case strings.HasPrefix(text, "?"):
+		subject = text[1:]
+	case strings.HasPrefix(text, "!") && !strings.HasPrefix(text, "!=") && !strings.HasPrefix(text, "!~"):
+		c.Operator = "!"
+		subject = text[1:]
+	default:
+		for i := 0; i < len(text); i++ {
+			if text[i] == '\\' {
+				break
+			}
+			for _, op := range specOperators {
+				if strings.HasPrefix(text[i:], op) {
+					subject, c.Operator = text[:i], op
+					c.Value = text[i+len(op):]
+					i = len(text)
+					break
+				}
+			}
+		}
+	}
+	c.Value = strings.TrimPrefix(c.Value, "\\")
+	c.Value = strings.NewReplacer(`\|`, "|", `\}`, "}", `\\`, `\`).Replace(c.Value)
+
+	if subject == "" {
+		if c.Operator == "?" || c.Operator == "!" {
+			return c, fmt.Errorf("condition %q has no subject", text)
+		}
+		c.Self = true
+		return c, nil
+	}
+	if strings.IndexByte("$^/", subject[0]) >= 0 {
+		p := specParser{input: subject}
+		if err := p.parseRest(&c.Relative, false); err != nil {
+			return c, err
+		}
+		return c, nil
+	}
+	s, err := ParseSpec(subject)
+	if err != nil {
+		return c, err
+	}
+	c.Subject = &s
+	return c, nil
+}
+
+// MatchTag reports whether a tag matches the tag of the spec.
+func (s Spec) MatchTag(tag string) bool {
+	if len(tag) != len(s.Tag) {
+		return false
+	}
+	for i := range tag {
+		if s.Tag[i] != '.' && s.Tag[i] != tag[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// isControl reports whether the spec selects control fields.
+func (s Spec) isControl() bool {
+	return s.Tag[:2] == "00"
+}
+
+// characters returns the characters of the range of a value.
+func (r SpecRange) characters(value string) (string, bool) {
+	if !r.Set {
+		return value, true
+	}
+	runes := []rune(value)
+	start, end, ok := r.resolve(len(runes))
+	if !ok {
+		return "", false
+	}
+	return string(runes[start : end+1]), true
+}
+
+// fieldValues returns the values a spec (without tag and index) selects
+// in a data field.
+func (s Spec) fieldValues(df DataField) []string {
+	var values []string
+	switch {
+	case s.Indicator == 1:
+		values = []string{df.GetIndicator1()}
+	case s.Indicator == 2:
+		values = []string{df.GetIndicator2()}
+	case s.Codes != "":
+		for _, sf := range df.SubFields {
+			if strings.Contains(s.Codes, sf.Code) {
+				values = append(values, sf.Data)
+			}
+		}
+	default:
+		var parts []string
+		for _, sf := range df.SubFields {
+			parts = append(parts, sf.Data)
+		}
+		values = []string{strings.Join(parts, " ")}
+	}
+	if !s.Characters.Set {
+		return values
+	}
+	var out []string
+	for _, v := range values {
+		if chars, ok := s.Characters.characters(v); ok {
+			out = append(out, chars)
+		}
+	}
+	return out
+}
+
+// controlValues returns the values a spec selects in a control field.
+func (s Spec) controlValues(data string) []string {
+	if chars, ok := s.Characters.characters(data); ok {
+		return []string{chars}
+	}
+	return nil
+}
+
+// holds reports whether the conditions of the spec hold for a field of
+// the record; df is nil for control fields, whose data is given. The
+// conditions comparing the values themselves are left to holdsFor.
+func (s Spec) holds(rec Record, df *DataField, data string) bool {
+	for _, alternatives := range s.Conditions {
+		if hasSelf(alternatives) {
+			continue
+		}
+		if !anyHolds(alternatives, rec, df, data, "") {
+			return false
+		}
+	}
+	return true
+}
+
+// holdsFor reports whether the conditions comparing the values themselves
+// hold for a value of a field.
+func (s Spec) holdsFor(rec Record, df *DataField, data string, value string) bool {
+	for _, alternatives := range s.Conditions {
+		if hasSelf(alternatives) && !anyHolds(alternatives, rec, df, data, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// filter returns the values for which the conditions hold.
+func (s Spec) filter(rec Record, df *DataField, data string, values []string) []string {
+	var out []string
+	for _, v := range values {
+		if s.holdsFor(rec, df, data, v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func hasSelf(alternatives []SpecCondition) bool {
+	for _, c := range alternatives {
+		if c.Self {
+			return true
+		}
+	}
+	return false
+}
+
+func anyHolds(alternatives []SpecCondition, rec Record, df *DataField, data string, value string) bool {
+	for _, c := range alternatives {
+		if c.holds(rec, df, data, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c SpecCondition) holds(rec Record, df *DataField, data string, value string) bool {
+	var values []string
+	switch {
+	case c.Self:
+		values = []string{value}
+	case c.Subject != nil:
+		values = rec.Select(*c.Subject)
+	case df != nil:
+		values = c.Relative.fieldValues(*df)
+	default:
+		values = c.Relative.controlValues(data)
+	}
+
+	switch c.Operator {
+	case "?":
+		return len(values) > 0
+	case "!":
+		return len(values) == 0
+	}
+	for _, v := range values {
+		switch c.Operator {
+		case "=":
+			if v == c.Value {
+				return true
+			}
+		case "!=":
+			if v == c.Value {
+				return false
+			}
+		case "~":
+			if strings.Contains(v, c.Value) {
+				return true
+			}
+		case "!~":
+			if strings.Contains(v, c.Value) {
+				return false
+			}
+		}
+	}
+	return c.Operator == "!=" || c.Operator == "!~"
+}
+
+// SelectDataFields returns the positions in Record.DataFields of the data
+// fields the spec selects, its indicator, subfields and character
+// positions aside.
+func (rec Record) SelectDataFields(spec Spec) []int {
+	if spec.Tag == "LDR" || spec.isControl() {
+		return nil
+	}
+	var candidates []int
+	for pos, df := range rec.DataFields {
+		if spec.MatchTag(df.Tag.GetTag()) {
+			candidates = append(candidates, pos)
+		}
+	}
+	var positions []int
+	if start, end, ok := spec.Index.resolve(len(candidates)); ok {
+		for _, pos := range candidates[start : end+1] {
+			df := &rec.DataFields[pos]
+			if spec.holds(rec, df, "") && len(spec.filter(rec, df, "", spec.fieldValues(*df))) > 0 {
+				positions = append(positions, pos)
+			}
+		}
+	}
+	return positions
+}
+
+// SelectControlFields returns the positions in Record.ControlFields of
+// the control fields the spec selects.
+func (rec Record) SelectControlFields(spec Spec) []int {
+	if spec.Tag == "LDR" || !spec.isControl() {
+		return nil
+	}
+	var candidates []int
+	for pos, cf := range rec.ControlFields {
+		if spec.MatchTag(cf.Tag.GetTag()) {
+			candidates = append(candidates, pos)
+		}
+	}
+	var positions []int
+	if start, end, ok := spec.Index.resolve(len(candidates)); ok {
+		for _, pos := range candidates[start : end+1] {
+			data := rec.ControlFields[pos].Data
+			if spec.holds(rec, nil, data) && len(spec.filter(rec, nil, data, spec.controlValues(data))) > 0 {
+				positions = append(positions, pos)
+			}
+		}
+	}
+	return positions
+}
+
+// Select returns the values the spec selects in the record. A data field
+// without subfield or indicator selected gives the data of its subfields
+// joined with blanks.
+func (rec Record) Select(spec Spec) []string {
+	var values []string
+	switch {
+	case spec.Tag == "LDR":
+		leader := rec.Leader.GetRaw()
+		if spec.holds(rec, nil, leader) {
+			values = spec.filter(rec, nil, leader, spec.controlValues(leader))
+		}
+	case spec.isControl():
+		for _, pos := range rec.SelectControlFields(spec) {
+			data := rec.ControlFields[pos].Data
+			values = append(values, spec.filter(rec, nil, data, spec.controlValues(data))...)
+		}
+	default:
+		for _, pos := range rec.SelectDataFields(spec) {
+			df := &rec.DataFields[pos]
+			values = append(values, spec.filter(rec, df, "", spec.fieldValues(*df))...)
+		}
+	}
+	return values
+}
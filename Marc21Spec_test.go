@@ -0,0 +1,64 @@
+package gomarc21
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSpec(test *testing.T) {
+	file, err := OpenFile("data/test_10.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer file.Close()
+	rec := readAll(test, NewReader(file))[0]
+
+	tests := []struct {
+		spec   string
+		values []string
+	}{
+		{"001", []string{"ocm57175940"}},
+		{"LDR/06", []string{"a"}},
+		{"LDR/5-7", []string{"nam"}},
+		{"008/35-37", []string{"eng"}},
+		{"008/#", []string{"c"}},
+		{"245^1", []string{"1"}},
+		{"100$a$d", []string{"Swanson, Vernon E.", "1922-1992."}},
+		{"100$a-d", []string{"Swanson, Vernon E.", "1922-1992."}},
+		{"650$x", []string{"Analysis.", "Sampling."}},
+		{"650[0]$x", []string{"Analysis."}},
+		{"650[#]$x", []string{"Sampling."}},
+		{"650[0-5]$x/0-2", []string{"Ana", "Sam"}},
+		{"65.$x{$x=\\Sampling.}", []string{"Sampling."}},
+		{"650$x{$x!=Sampling.}", []string{"Analysis."}},
+		{"650$x{$x~Samp|$x~Anal}", []string{"Analysis.", "Sampling."}},
+		{"650$x{$x!~Samp}", []string{"Analysis."}},
+		{"856$u{^1=4}{^2=0}", []string{"http://purl.access.gpo.gov/GPO/LPS56007"}},
+		{"856$u{^2=1}", nil},
+		{"9..$a{!$b}", []string{"MARCIVE", "Hathi Trust report None"}},
+		{"700$a{?100$q}", []string{"Huffman, Claude."}},
+		{"700$a{245$a~nothing}", nil},
+		{"440", []string{"Geological Survey circular ; 735."}},
+		{"650$x{=\\Analysis.}", []string{"Analysis."}},
+		{"008/35-37{=\\eng}", []string{"eng"}},
+		{"001{~ocn}", nil},
+		{"999", nil},
+	}
+	for _, t := range tests {
+		spec, err := ParseSpec(t.spec)
+		if err != nil {
+			test.Errorf("%s: %s", t.spec, err)
+			continue
+		}
+		values := rec.Select(spec)
+		if strings.Join(values, "|") != strings.Join(t.values, "|") {
+			test.Errorf("%s: expected %q, got %q", t.spec, t.values, values)
+		}
+	}
+
+	for _, spec := range []string{"24", "245$", "245^3", "245[x]", "245{$a=b", "245$a{}", "245 $a", "24#", "245$a-\xff", "245$\xfe-\xff", "245$c-a"} {
+		if _, err := ParseSpec(spec); err == nil {
+			test.Errorf("%q should not parse", spec)
+		}
+	}
+}
@@ -0,0 +1,878 @@
+package gomarc21
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+source: https://www.loc.gov/standards/sru/
+
+    SRU (Search/Retrieve via URL) 1.2 and 2.0 searchRetrieve and explain
+    over HTTP GET or POST:
+
+    ?version=1.2&operation=searchRetrieve&query=dc.title=cats&startRecord=1&maximumRecords=10
+    ?version=1.2&operation=explain
+
+In SRU 2.0 there is no operation parameter: a request with a query is a
+searchRetrieve, other requests are explains.
+
+An SruServer evaluates CQL queries (see ParseCql) against the index
+values of its records, and returns them in MARCXML (recordSchema marcxml)
+or Dublin Core (dc), in the order they were added. The values of each
+index are extracted when a record is added; text values are compared
+word by word after NACO normalization, identifiers (bath.isbn, ...) are
+compared whole after their own normalization.
+
+    =, adj        the words of the term follow each other in a value
+    all, any      all or any of the words of the term are in the values
+    ==, exact     a value is the term
+    <>            no value is the term
+    <, >, <=, >=  a value sorts before or after the term (as numbers when
+                  both are numbers)
+
+Unqualified indexes are looked for in the dc, bath and rec context sets,
+so "title = cats" searches dc.title.
+*/
+
+const (
+	Sru12Namespace           = "http://www.loc.gov/zing/srw/"
+	Sru20Namespace           = "http://docs.oasis-open.org/ns/search-ws/sruResponse"
+	Sru12DiagnosticNamespace = "http://www.loc.gov/zing/srw/diagnostic/"
+	Sru20DiagnosticNamespace = "http://docs.oasis-open.org/ns/search-ws/diagnostic"
+	ExplainNamespace         = "http://explain.z3950.org/dtd/2.0/"
+	SruSchemaMarcXml         = "info:srw/schema/1/marcxml-v1.1"
+	SruSchemaDc              = "info:srw/schema/1/dc-v1.1"
+	DefaultSruRecords        = 10
+	DefaultSruMaxRecords     = 100
+)
+
+// sruSchemas maps the names and identifiers of the record schemas to
+// their identifiers.
+var sruSchemas = map[string]string{
+	"":               SruSchemaMarcXml,
+	"marcxml":        SruSchemaMarcXml,
+	"marc21":         SruSchemaMarcXml,
+	SruSchemaMarcXml: SruSchemaMarcXml,
+	"dc":             SruSchemaDc,
+	SruSchemaDc:      SruSchemaDc,
+}
+
+// sruContextSets are the context sets of the indexes and where unqualified
+// indexes are looked for, in order.
+var sruContextSets = []struct{ name, identifier string }{
+	{"dc", "info:srw/cql-context-set/1/dc-v1.1"},
+	{"bath", "http://zing.z3950.org/cql/bath/2.0/"},
+	{"rec", "info:srw/cql-context-set/2/rec-1.1"},
+	{"cql", "info:srw/cql-context-set/1/cql-v1.2"},
+}
+
+// SruIndex is a searchable index of an SruServer.
+type SruIndex struct {
+	Name  string // with its context set, e.g. dc.title
+	Title string
+	// Specs are the MARCspecs of the values of the index, or Values
+	// returns them.
+	Specs  []string
+	Values func(rec Record) []string
+	// Normalize normalizes the values of an identifier index, compared
+	// whole. The values of text indexes are NACO normalized and compared
+	// word by word when it is nil.
+	Normalize func(value string) string
+}
+
+var (
+	sruTitleSpecs   = []string{"245$a$b$n$p", "246$a$b", "130$a", "240$a", "740$a"}
+	sruCreatorSpecs = []string{"100$a$b$c$d$q", "110$a$b", "111$a", "700$a", "710$a$b", "711$a"}
+	sruSubjectSpecs = []string{"600$a$x$y$z", "610$a$x", "611$a", "630$a", "650$a$x$y$z", "651$a$x$y$z", "653$a"}
+)
+
+// DefaultSruIndexes are the indexes of a server without configured
+// indexes.
+var DefaultSruIndexes = []SruIndex{
+	{Name: "dc.title", Title: "Title", Specs: sruTitleSpecs},
+	{Name: "dc.creator", Title: "Creator", Specs: sruCreatorSpecs},
+	{Name: "dc.subject", Title: "Subject", Specs: sruSubjectSpecs},
+	{Name: "dc.publisher", Title: "Publisher", Specs: []string{"260$b", "264$b"}},
+	{Name: "dc.date", Title: "Date", Specs: []string{"008/07-10", "260$c", "264$c"}},
+	{Name: "dc.language", Title: "Language", Specs: []string{"008/35-37", "041$a"}},
+	{Name: "dc.identifier", Title: "Identifier", Specs: []string{"001", "020$a", "022$a", "024$a", "035$a"},
+		Normalize: normalizeSruIdentifier},
+	{Name: "bath.isbn", Title: "ISBN", Values: Record.Isbns, Normalize: normalizeSruIsbn},
+	{Name: "bath.issn", Title: "ISSN", Values: Record.Issns, Normalize: NormalizeIssn},
+	{Name: "bath.lccn", Title: "LCCN", Values: Record.Lccns, Normalize: NormalizeLccn},
+	{Name: "bath.name", Title: "Name", Specs: sruCreatorSpecs},
+	{Name: "rec.identifier", Title: "Control number", Specs: []string{"001"}, Normalize: normalizeSruIdentifier},
+	{Name: "cql.serverChoice", Title: "Keywords", Specs: append(append(append([]string{}, sruTitleSpecs...),
+		sruCreatorSpecs...), sruSubjectSpecs...)},
+}
+
+func normalizeSruIdentifier(value string) string {
+	return strings.ToUpper(strings.TrimSpace(value))
+}
+
+// normalizeSruIsbn returns the ISBN-13 of a valid ISBN.
+func normalizeSruIsbn(value string) string {
+	if isbn, err := Isbn13(value); err == nil {
+		return isbn
+	}
+	return NormalizeIsbn(value)
+}
+
+// SruConfig configures an SruServer.
+type SruConfig struct {
+	Title       string
+	Description string
+	// DefaultRecords is the number of records of a response without
+	// maximumRecords, DefaultSruRecords when zero, and MaxRecords the
+	// largest maximumRecords, DefaultSruMaxRecords when zero.
+	DefaultRecords int
+	MaxRecords     int
+	// Indexes are DefaultSruIndexes when empty.
+	Indexes []SruIndex
+}
+
+// sruEntry is a record of the server with its index values.
+type sruEntry struct {
+	id     string
+	values map[string][]string
+	record *Record
+}
+
+// SruServer answers SRU requests about a set of records.
+type SruServer struct {
+	Config SruConfig
+
+	mu      sync.Mutex
+	get     func(id string) (Record, error)
+	specs   map[string][]Spec
+	entries []*sruEntry
+	closer  io.Closer
+}
+
+// NewSruServer returns a server without records. get reads the record
+// of a control number; when it is nil the records given to Add are kept
+// in memory.
+func NewSruServer(config SruConfig, get func(id string) (Record, error)) (*SruServer, error) {
+	s := &SruServer{Config: config, get: get, specs: map[string][]Spec{}}
+	if s.Config.DefaultRecords <= 0 {
+		s.Config.DefaultRecords = DefaultSruRecords
+	}
+	if s.Config.MaxRecords <= 0 {
+		s.Config.MaxRecords = DefaultSruMaxRecords
+	}
+	if s.Config.Title == "" {
+		s.Config.Title = "MARC records"
+	}
+	if len(s.Config.Indexes) == 0 {
+		s.Config.Indexes = DefaultSruIndexes
+	}
+	for _, index := range s.Config.Indexes {
+		if !strings.Contains(index.Name, ".") {
+			return nil, fmt.Errorf("index %q has no context set", index.Name)
+		}
+		for _, text := range index.Specs {
+			spec, err := ParseSpec(text)
+			if err != nil {
+				return nil, fmt.Errorf("index %s: %s", index.Name, err)
+			}
+			s.specs[index.Name] = append(s.specs[index.Name], spec)
+		}
+	}
+	return s, nil
+}
+
+// OpenSruServer returns a server searching the records of a file, whose
+// binary MARC records are returned through the index of the file.
+func OpenSruServer(marcFile string, config SruConfig) (*SruServer, error) {
+	f, err := openRecordFile(marcFile)
+	if err != nil {
+		return nil, err
+	}
+	return openSruServer(f, config)
+}
+
+// OpenStoreSruServer returns a server searching the records of a store
+// (see OpenStore), whose records are returned from the store.
+func OpenStoreSruServer(storeFile string, config SruConfig) (*SruServer, error) {
+	f, err := openRecordStore(storeFile)
+	if err != nil {
+		return nil, err
+	}
+	return openSruServer(f, config)
+}
+
+// openSruServer returns a server searching the records of f, which is
+// closed with the server.
+func openSruServer(f *recordFile, config SruConfig) (*SruServer, error) {
+	s, err := NewSruServer(config, f.get())
+	if err == nil {
+		s.closer = f
+		err = f.each(s.Add)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close closes the file of the records when the server opened it.
+func (s *SruServer) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+// Add adds a record to the server.
+func (s *SruServer) Add(rec Record) {
+	entry := &sruEntry{id: strings.TrimSpace(rec.ControlNum()), values: map[string][]string{}}
+	if s.get == nil {
+		entry.record = &rec
+	}
+	for _, index := range s.Config.Indexes {
+		var values []string
+		if index.Values != nil {
+			values = index.Values(rec)
+		}
+		for _, spec := range s.specs[index.Name] {
+			values = append(values, rec.Select(spec)...)
+		}
+		for _, value := range values {
+			if value = normalizeSruValue(index, value); value != "" {
+				entry.values[index.Name] = appendValue(entry.values[index.Name], value)
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entry)
+}
+
+func normalizeSruValue(index SruIndex, value string) string {
+	if index.Normalize != nil {
+		return index.Normalize(value)
+	}
+	return NacoNormalize(value)
+}
+
+// index returns the index of a query index name.
+func (s *SruServer) index(name string) (SruIndex, bool) {
+	for _, index := range s.Config.Indexes {
+		if strings.EqualFold(index.Name, name) {
+			return index, true
+		}
+	}
+	if !strings.Contains(name, ".") {
+		for _, set := range sruContextSets {
+			if index, ok := s.index(set.name + "." + name); ok {
+				return index, true
+			}
+		}
+	}
+	return SruIndex{}, false
+}
+
+// checkQuery checks that the indexes, relations and booleans of a query
+// are supported.
+func (s *SruServer) checkQuery(q *CqlQuery) error {
+	if q.Boolean != "" {
+		if q.Boolean == "prox" {
+			return &CqlError{Code: CqlUnsupportedBoolean, Message: "unsupported boolean operator", Details: q.Boolean}
+		}
+		if err := s.checkQuery(q.Left); err != nil {
+			return err
+		}
+		return s.checkQuery(q.Right)
+	}
+	if strings.EqualFold(q.Index, cqlAllRecordsIndex) {
+		return nil
+	}
+	if _, ok := s.index(q.Index); !ok {
+		return &CqlError{Code: CqlUnsupportedIndex, Message: "unsupported index", Details: q.Index}
+	}
+	switch q.Relation {
+	case "=", "==", "<>", "<", ">", "<=", ">=", "any", "all", "adj", "exact":
+		return nil
+	}
+	return &CqlError{Code: CqlUnsupportedRelation, Message: "unsupported relation", Details: q.Relation}
+}
+
+// Search returns the positions of the records matching a query, in the
+// order the records were added.
+func (s *SruServer) Search(query string) ([]int, error) {
+	q, err := ParseCql(query)
+	if err != nil {
+		return nil, err
+	}
+	return s.searchQuery(q)
+}
+
+// searchQuery returns the positions of the records matching a parsed
+// query.
+func (s *SruServer) searchQuery(q *CqlQuery) ([]int, error) {
+	if err := s.checkQuery(q); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	entries := s.entries
+	s.mu.Unlock()
+
+	var positions []int
+	for i, entry := range entries {
+		if s.matches(entry, q) {
+			positions = append(positions, i)
+		}
+	}
+	return positions, nil
+}
+
+// matches evaluates a checked query for a record.
+func (s *SruServer) matches(entry *sruEntry, q *CqlQuery) bool {
+	switch q.Boolean {
+	case "and":
+		return s.matches(entry, q.Left) && s.matches(entry, q.Right)
+	case "or":
+		return s.matches(entry, q.Left) || s.matches(entry, q.Right)
+	case "not":
+		return s.matches(entry, q.Left) && !s.matches(entry, q.Right)
+	}
+	if strings.EqualFold(q.Index, cqlAllRecordsIndex) {
+		return true
+	}
+
+	index, _ := s.index(q.Index)
+	values := entry.values[index.Name]
+	if index.Normalize != nil {
+		return matchSruValues(values, q.Relation, index.Normalize(q.Term))
+	}
+
+	words := sruTermWords(q.Term)
+	switch q.Relation {
+	case "==", "exact", "<>", "<", ">", "<=", ">=":
+		return matchSruValues(values, q.Relation, strings.Join(words, " "))
+	case "any":
+		for _, word := range words {
+			if matchSruWords(values, []string{word}) {
+				return true
+			}
+		}
+		return false
+	case "all":
+		for _, word := range words {
+			if !matchSruWords(values, []string{word}) {
+				return false
+			}
+		}
+		return len(words) > 0
+	}
+	return matchSruWords(values, words)
+}
+
+// sruTermWords returns the normalized words of a term, keeping its
+// wildcards.
+func sruTermWords(term string) []string {
+	var words []string
+	for _, word := range strings.Fields(term) {
+		var b strings.Builder
+		start := 0
+		for i := 0; i < len(word); i++ {
+			if word[i] != '*' && word[i] != '?' {
+				continue
+			}
+			if i > 0 && word[i-1] == '\\' {
+				// a literal * or ? is dropped like the other punctuation
+				b.WriteString(strings.ReplaceAll(NacoNormalize(word[start:i-1]), " ", ""))
+				start = i + 1
+				continue
+			}
+			b.WriteString(strings.ReplaceAll(NacoNormalize(word[start:i]), " ", ""))
+			b.WriteByte(word[i])
+			start = i + 1
+		}
+		b.WriteString(strings.ReplaceAll(NacoNormalize(word[start:]), " ", ""))
+		if b.Len() > 0 {
+			words = append(words, b.String())
+		}
+	}
+	return words
+}
+
+// matchSruWord matches a word, with wildcards, with the word of a value.
+func matchSruWord(pattern string, word string) bool {
+	if !strings.ContainsAny(pattern, "*?") {
+		return pattern == word
+	}
+	matched, _ := path.Match(pattern, word)
+	return matched
+}
+
+// matchSruWords tells whether the words follow each other in a value.
+func matchSruWords(values []string, words []string) bool {
+	if len(words) == 0 {
+		return false
+	}
+	for _, value := range values {
+		valueWords := strings.Fields(value)
+		for start := 0; start+len(words) <= len(valueWords); start++ {
+			matched := true
+			for i, word := range words {
+				if !matchSruWord(word, valueWords[start+i]) {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchSruValues compares whole values with a term.
+func matchSruValues(values []string, relation string, term string) bool {
+	if relation == "<>" {
+		return !matchSruValues(values, "==", term)
+	}
+	for _, value := range values {
+		switch relation {
+		case "<", ">", "<=", ">=":
+			c := compareSruValues(value, term)
+			if (relation == "<" && c < 0) || (relation == ">" && c > 0) ||
+				(relation == "<=" && c <= 0) || (relation == ">=" && c >= 0) {
+				return true
+			}
+		default:
+			if matchSruWord(term, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// compareSruValues compares two values, as numbers when they both are.
+func compareSruValues(a string, b string) int {
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	if errA != nil || errB != nil {
+		return strings.Compare(a, b)
+	}
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// SruResponse is an SRU searchRetrieve or explain response.
+type SruResponse struct {
+	XMLName            xml.Name          // searchRetrieveResponse or explainResponse
+	Xmlns              string            `xml:"xmlns,attr,omitempty"`
+	Version            string            `xml:"version"`
+	NumberOfRecords    *int              `xml:"numberOfRecords"`
+	Records            *SruRecords       `xml:"records"`
+	NextRecordPosition int               `xml:"nextRecordPosition,omitempty"`
+	Echoed             *SruEchoedRequest `xml:"echoedSearchRetrieveRequest"`
+	Record             *SruRecord        `xml:"record"`
+	Diagnostics        *SruDiagnostics   `xml:"diagnostics"`
+}
+
+// SruRecords lists the records of a response.
+type SruRecords struct {
+	Records []SruRecord `xml:"record"`
+}
+
+// SruRecord is a record of a response. Its data is XML, escaped when the
+// record packing is string.
+type SruRecord struct {
+	Schema      string        `xml:"recordSchema"`
+	Packing     string        `xml:"recordPacking,omitempty"`
+	XmlEscaping string        `xml:"recordXMLEscaping,omitempty"`
+	Data        SruRecordData `xml:"recordData"`
+	Position    int           `xml:"recordPosition,omitempty"`
+}
+
+// SruRecordData holds the data of a record.
+type SruRecordData struct {
+	Xml string `xml:",innerxml"`
+}
+
+// SruEchoedRequest echoes a searchRetrieve request.
+type SruEchoedRequest struct {
+	Version        string `xml:"version"`
+	Query          string `xml:"query"`
+	StartRecord    string `xml:"startRecord,omitempty"`
+	MaximumRecords string `xml:"maximumRecords,omitempty"`
+	RecordSchema   string `xml:"recordSchema,omitempty"`
+}
+
+// SruDiagnostics lists the diagnostics of a response.
+type SruDiagnostics struct {
+	Diagnostics []SruDiagnostic `xml:"diagnostic"`
+}
+
+// SruDiagnostic reports an error or a warning.
+type SruDiagnostic struct {
+	Xmlns   string `xml:"xmlns,attr,omitempty"`
+	Uri     string `xml:"uri"`
+	Details string `xml:"details,omitempty"`
+	Message string `xml:"message,omitempty"`
+}
+
+// Code returns the number of a diagnostic of the SRU diagnostics list,
+// or 0.
+func (d SruDiagnostic) Code() int {
+	code, _ := strconv.Atoi(strings.TrimPrefix(d.Uri, cqlDiagnosticUriPrefix))
+	return code
+}
+
+// sruRequest is an SRU request being answered.
+type sruRequest struct {
+	args     url.Values
+	version  string
+	response *SruResponse
+}
+
+func (r *sruRequest) diagnostic(err error) {
+	cqlErr, ok := err.(*CqlError)
+	if !ok {
+		cqlErr = &CqlError{Code: CqlGeneralError, Message: "general system error", Details: err.Error()}
+	}
+	namespace := Sru12DiagnosticNamespace
+	if r.version == "2.0" {
+		namespace = Sru20DiagnosticNamespace
+	}
+	if r.response.Diagnostics == nil {
+		r.response.Diagnostics = &SruDiagnostics{}
+	}
+	r.response.Diagnostics.Diagnostics = append(r.response.Diagnostics.Diagnostics,
+		SruDiagnostic{Xmlns: namespace, Uri: cqlErr.Uri(), Details: cqlErr.Details, Message: cqlErr.Message})
+}
+
+// ServeHTTP answers an SRU request.
+func (s *SruServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	args := r.URL.Query()
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		args = r.PostForm
+	}
+
+	response := s.Respond(args, r.Host, r.URL.Path)
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	io.WriteString(w, xml.Header)
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(response); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+// Respond answers the request given by args. host and database are
+// those of the explain record.
+func (s *SruServer) Respond(args url.Values, host string, database string) *SruResponse {
+	operation := args.Get("operation")
+	version := args.Get("version")
+	if version == "" {
+		version = "2.0"
+		if operation != "" {
+			version = "1.2"
+		}
+	}
+	r := &sruRequest{args: args, version: version,
+		response: &SruResponse{XMLName: xml.Name{Local: "searchRetrieveResponse"}, Xmlns: Sru12Namespace, Version: version}}
+	if version == "2.0" {
+		r.response.Xmlns = Sru20Namespace
+	}
+	if operation == "" && version == "2.0" && args.Get("query") != "" {
+		operation = "searchRetrieve"
+	}
+
+	switch {
+	case version != "1.1" && version != "1.2" && version != "2.0":
+		r.version = "1.2"
+		r.response.Xmlns = Sru12Namespace
+		r.response.Version = "1.2"
+		r.diagnostic(&CqlError{Code: CqlUnsupportedVersion, Message: "unsupported version", Details: "1.2"})
+	case operation == "" || operation == "explain":
+		s.explain(r, host, database)
+	case operation == "searchRetrieve":
+		s.searchRetrieve(r)
+	default:
+		r.diagnostic(&CqlError{Code: CqlUnsupportedOperation, Message: "unsupported operation", Details: operation})
+	}
+	return r.response
+}
+
+// recordPacking returns the packing of the records and the name of its
+// parameter and element, which depend on the version.
+func (r *sruRequest) recordPacking() (string, error) {
+	name := "recordPacking"
+	if r.version == "2.0" {
+		name = "recordXMLEscaping"
+	}
+	packing := r.args.Get(name)
+	switch packing {
+	case "":
+		return "xml", nil
+	case "xml", "string":
+		return packing, nil
+	}
+	return "", &CqlError{Code: CqlUnsupportedPacking, Message: "unsupported record packing", Details: packing}
+}
+
+// record returns a record of a response.
+func (r *sruRequest) record(schema string, packing string, data string, position int) SruRecord {
+	if packing == "string" {
+		var b bytes.Buffer
+		xml.EscapeText(&b, []byte(data))
+		data = b.String()
+	}
+	record := SruRecord{Schema: schema, Data: SruRecordData{Xml: data}, Position: position}
+	if r.version == "2.0" {
+		record.XmlEscaping = packing
+	} else {
+		record.Packing = packing
+	}
+	return record
+}
+
+func (s *SruServer) searchRetrieve(r *sruRequest) {
+	args := r.args
+	zero := 0
+	r.response.NumberOfRecords = &zero
+	r.response.Echoed = &SruEchoedRequest{Version: r.version, Query: args.Get("query"),
+		StartRecord: args.Get("startRecord"), MaximumRecords: args.Get("maximumRecords"), RecordSchema: args.Get("recordSchema")}
+
+	query := args.Get("query")
+	if query == "" {
+		r.diagnostic(&CqlError{Code: CqlMandatoryParameter, Message: "mandatory parameter not supplied", Details: "query"})
+		return
+	}
+	start, err := sruNumber(args, "startRecord", 1)
+	if err != nil || start < 1 {
+		r.diagnostic(&CqlError{Code: CqlUnsupportedParameter, Message: "unsupported parameter value", Details: "startRecord"})
+		return
+	}
+	maximum, err := sruNumber(args, "maximumRecords", s.Config.DefaultRecords)
+	if err != nil || maximum < 0 {
+		r.diagnostic(&CqlError{Code: CqlUnsupportedParameter, Message: "unsupported parameter value", Details: "maximumRecords"})
+		return
+	}
+	if maximum > s.Config.MaxRecords {
+		maximum = s.Config.MaxRecords
+	}
+	schema, ok := sruSchemas[args.Get("recordSchema")]
+	if !ok {
+		r.diagnostic(&CqlError{Code: CqlUnknownSchema, Message: "unknown schema for retrieval", Details: args.Get("recordSchema")})
+		return
+	}
+	packing, err := r.recordPacking()
+	if err != nil {
+		r.diagnostic(err)
+		return
+	}
+
+	positions, err := s.Search(query)
+	if err != nil {
+		r.diagnostic(err)
+		return
+	}
+	total := len(positions)
+	r.response.NumberOfRecords = &total
+	if total == 0 || maximum == 0 {
+		return
+	}
+	if start > total {
+		r.diagnostic(&CqlError{Code: CqlFirstRecordOutOfRange, Message: "first record position out of range"})
+		return
+	}
+
+	end := start - 1 + maximum
+	if end > total {
+		end = total
+	}
+	if end < total {
+		r.response.NextRecordPosition = end + 1
+	}
+	s.mu.Lock()
+	entries := s.entries
+	s.mu.Unlock()
+	r.response.Records = &SruRecords{}
+	for i := start - 1; i < end; i++ {
+		data, err := s.recordData(entries[positions[i]], schema)
+		if err != nil {
+			r.diagnostic(err)
+			continue
+		}
+		r.response.Records.Records = append(r.response.Records.Records, r.record(schema, packing, data, i+1))
+	}
+}
+
+// sruNumber returns the number of a parameter.
+func sruNumber(args url.Values, name string, defaultValue int) (int, error) {
+	if args.Get(name) == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(args.Get(name))
+}
+
+// recordData returns a record in a schema.
+func (s *SruServer) recordData(entry *sruEntry, schema string) (string, error) {
+	rec, err := s.record(entry)
+	if err != nil {
+		return "", err
+	}
+	if schema == SruSchemaDc {
+		return rec.RecordAsDcXml()
+	}
+	return oaiMetadata(rec, OaiPrefixMarc21)
+}
+
+// record returns the record of an entry.
+func (s *SruServer) record(entry *sruEntry) (Record, error) {
+	if entry.record != nil {
+		return *entry.record, nil
+	}
+	rec, err := s.get(entry.id)
+	if err != nil {
+		return Record{}, fmt.Errorf("record %s: %s", entry.id, err)
+	}
+	return rec, nil
+}
+
+// recordAt returns the record at a position of the server.
+func (s *SruServer) recordAt(position int) (Record, error) {
+	s.mu.Lock()
+	entry := s.entries[position]
+	s.mu.Unlock()
+	return s.record(entry)
+}
+
+// Explain is the ZeeRex record describing a server.
+type Explain struct {
+	XMLName      xml.Name            `xml:"explain"`
+	Xmlns        string              `xml:"xmlns,attr"`
+	ServerInfo   ExplainServerInfo   `xml:"serverInfo"`
+	DatabaseInfo ExplainDatabaseInfo `xml:"databaseInfo"`
+	IndexInfo    ExplainIndexInfo    `xml:"indexInfo"`
+	SchemaInfo   []ExplainSchema     `xml:"schemaInfo>schema"`
+	ConfigInfo   []ExplainSetting    `xml:"configInfo>default"`
+}
+
+// ExplainServerInfo tells where the server is.
+type ExplainServerInfo struct {
+	Protocol string `xml:"protocol,attr"`
+	Version  string `xml:"version,attr"`
+	Host     string `xml:"host"`
+	Port     string `xml:"port"`
+	Database string `xml:"database"`
+}
+
+// ExplainDatabaseInfo describes the records.
+type ExplainDatabaseInfo struct {
+	Title       string `xml:"title"`
+	Description string `xml:"description,omitempty"`
+}
+
+// ExplainIndexInfo lists the context sets and the indexes.
+type ExplainIndexInfo struct {
+	Sets    []ExplainSet   `xml:"set"`
+	Indexes []ExplainIndex `xml:"index"`
+}
+
+// ExplainSet is a context set.
+type ExplainSet struct {
+	Identifier string `xml:"identifier,attr"`
+	Name       string `xml:"name,attr"`
+}
+
+// ExplainIndex is an index and its names.
+type ExplainIndex struct {
+	Title string           `xml:"title"`
+	Names []ExplainMapName `xml:"map>name"`
+}
+
+// ExplainMapName is the name of an index in a context set.
+type ExplainMapName struct {
+	Set  string `xml:"set,attr"`
+	Name string `xml:",chardata"`
+}
+
+// ExplainSchema is a record schema.
+type ExplainSchema struct {
+	Identifier string `xml:"identifier,attr"`
+	Name       string `xml:"name,attr"`
+	Title      string `xml:"title"`
+}
+
+// ExplainSetting is a default of the configuration.
+type ExplainSetting struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+func (s *SruServer) explain(r *sruRequest, host string, database string) {
+	r.response.XMLName = xml.Name{Local: "explainResponse"}
+	packing, err := r.recordPacking()
+	if err != nil {
+		r.diagnostic(err)
+		return
+	}
+
+	port := "80"
+	if h, p, ok := strings.Cut(host, ":"); ok {
+		host, port = h, p
+	}
+	explain := Explain{
+		Xmlns:        ExplainNamespace,
+		ServerInfo:   ExplainServerInfo{Protocol: "SRU", Version: r.version, Host: host, Port: port, Database: strings.TrimPrefix(database, "/")},
+		DatabaseInfo: ExplainDatabaseInfo{Title: s.Config.Title, Description: s.Config.Description},
+		SchemaInfo: []ExplainSchema{
+			{Identifier: SruSchemaMarcXml, Name: "marcxml", Title: "MARCXML"},
+			{Identifier: SruSchemaDc, Name: "dc", Title: "Dublin Core"},
+		},
+		ConfigInfo: []ExplainSetting{
+			{Type: "numberOfRecords", Value: strconv.Itoa(s.Config.DefaultRecords)},
+			{Type: "maximumRecords", Value: strconv.Itoa(s.Config.MaxRecords)},
+		},
+	}
+	for _, set := range sruContextSets {
+		explain.IndexInfo.Sets = append(explain.IndexInfo.Sets, ExplainSet{Identifier: set.identifier, Name: set.name})
+	}
+	for _, index := range s.Config.Indexes {
+		set, name, _ := strings.Cut(index.Name, ".")
+		explain.IndexInfo.Indexes = append(explain.IndexInfo.Indexes,
+			ExplainIndex{Title: index.Title, Names: []ExplainMapName{{Set: set, Name: name}}})
+	}
+
+	data, err := xml.Marshal(explain)
+	if err != nil {
+		r.diagnostic(err)
+		return
+	}
+	record := r.record(ExplainNamespace, packing, string(data), 0)
+	r.response.Record = &record
+}
@@ -0,0 +1,243 @@
+package gomarc21
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// sruGet requests a server and decodes the response.
+func sruGet(test *testing.T, server *httptest.Server, args url.Values) SruResponse {
+	test.Helper()
+	resp, err := http.Get(server.URL + "/sru?" + args.Encode())
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/xml") {
+		test.Fatalf("%s: status %d: %s", args.Encode(), resp.StatusCode, body)
+	}
+	var response SruResponse
+	if err := xml.Unmarshal(body, &response); err != nil {
+		test.Fatalf("%s: %s\n%s", args.Encode(), err, body)
+	}
+	return response
+}
+
+func sruDiagnosticCode(response SruResponse) int {
+	if response.Diagnostics == nil || len(response.Diagnostics.Diagnostics) == 0 {
+		return 0
+	}
+	return response.Diagnostics.Diagnostics[0].Code()
+}
+
+// sruIds returns the control numbers of the MARCXML records of a response.
+func sruIds(test *testing.T, response SruResponse) []string {
+	test.Helper()
+	var ids []string
+	if response.Records == nil {
+		return nil
+	}
+	for _, record := range response.Records.Records {
+		rec, err := ParseXmlRecord([]byte(record.Data.Xml))
+		if err != nil {
+			test.Fatal(err)
+		}
+		ids = append(ids, rec.ControlNum())
+	}
+	return ids
+}
+
+func TestSruServer(test *testing.T) {
+	file, err := OpenFile("data/test_10.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer file.Close()
+	recs := readAll(test, NewReader(file))
+
+	sru, err := NewSruServer(SruConfig{Title: "Test records", MaxRecords: 5}, nil)
+	if err != nil {
+		test.Fatal(err)
+	}
+	withIsbn := recs[0].Clone()
+	withIsbn.SetControlField("001", "isbn1")
+	df := DataField{Tag: "020", Indicator1: " ", Indicator2: " "}
+	df.AddSubField("a", "0-306-40615-2 (pbk.)")
+	withIsbn.AddDataField(df)
+	for _, rec := range append(recs, withIsbn) {
+		sru.Add(rec)
+	}
+	server := httptest.NewServer(sru)
+	defer server.Close()
+
+	search := func(query string) []string {
+		response := sruGet(test, server, url.Values{"operation": {"searchRetrieve"}, "version": {"1.2"}, "query": {query}})
+		if code := sruDiagnosticCode(response); code != 0 {
+			test.Errorf("%s: diagnostic %d", query, code)
+		}
+		return sruIds(test, response)
+	}
+	for query, ids := range map[string]string{
+		`dc.title = "aviation security"`:                       "ocm57177924",
+		`title = "security aviation"`:                          "",
+		`dc.title all "security aviation"`:                     "ocm57177924",
+		`dc.title any "aviation diabetes"`:                     "ocm57177924 ocm57178158",
+		`dc.title = fish* and dc.subject = "fish culture"`:     "ocm57178104 ocm57178112",
+		`dc.title = fish* not dc.title = "san marcos"`:         "ocm57178104",
+		`dc.creator = swanson`:                                 "ocm57175940 isbn1",
+		`bath.isbn = 9780306406157`:                            "isbn1",
+		`bath.isbn = 0306406152`:                               "isbn1",
+		`dc.date < 2004`:                                       "ocm57175940 ocm57178158 isbn1",
+		`dc.title exact "diabetes insipidus"`:                  "ocm57178158",
+		`numeros`:                                              "ocm57178089",
+		`rec.identifier = OCM57178216`:                         "ocm57178216",
+		`dc.subject = diabetes and (title = diab?tes or coal)`: "ocm57178158",
+	} {
+		if got := strings.Join(search(query), " "); got != ids {
+			test.Errorf("%s: expected %q, got %q", query, ids, got)
+		}
+	}
+
+	// the pages of a search
+	var ids []string
+	args := url.Values{"query": {"cql.allRecords = 1"}, "maximumRecords": {"4"}}
+	for start := "1"; ; {
+		args.Set("startRecord", start)
+		response := sruGet(test, server, args)
+		if response.Version != "2.0" || *response.NumberOfRecords != 11 {
+			test.Fatal("wrong response", response.Version, *response.NumberOfRecords)
+		}
+		ids = append(ids, sruIds(test, response)...)
+		if response.NextRecordPosition == 0 {
+			break
+		}
+		start = strconv.Itoa(response.NextRecordPosition)
+	}
+	if len(ids) != 11 || ids[0] != "ocm57175940" || ids[10] != "isbn1" {
+		test.Error("wrong pages", ids)
+	}
+	response := sruGet(test, server, url.Values{"query": {"cql.allRecords = 1"}, "maximumRecords": {"50"}})
+	if len(response.Records.Records) != 5 || response.NextRecordPosition != 6 {
+		test.Error("maximumRecords was not limited", len(response.Records.Records))
+	}
+
+	response = sruGet(test, server, url.Values{"operation": {"searchRetrieve"}, "query": {"aviation"},
+		"recordSchema": {"dc"}, "recordPacking": {"string"}})
+	record := response.Records.Records[0]
+	if record.Schema != SruSchemaDc || record.Packing != "string" || record.Position != 1 ||
+		!strings.Contains(record.Data.Xml, "&lt;dc:title&gt;Aviation security") {
+		test.Error("wrong Dublin Core record", record)
+	}
+
+	response = sruGet(test, server, url.Values{"operation": {"explain"}})
+	if response.XMLName.Local != "explainResponse" || response.Record == nil {
+		test.Fatal("wrong explain response", response.XMLName)
+	}
+	var explain Explain
+	if err := xml.Unmarshal([]byte(response.Record.Data.Xml), &explain); err != nil {
+		test.Fatal(err)
+	}
+	if explain.DatabaseInfo.Title != "Test records" || explain.ServerInfo.Database != "sru" ||
+		len(explain.IndexInfo.Indexes) != len(DefaultSruIndexes) || len(explain.SchemaInfo) != 2 {
+		test.Error("wrong explain record", explain)
+	}
+
+	for query, code := range map[string]int{
+		"operation=searchRetrieve&version=1.2":                               CqlMandatoryParameter,
+		"operation=searchRetrieve&version=1.2&query=dc.title+%3D":            CqlSyntaxError,
+		"operation=searchRetrieve&version=1.2&query=dc.nothing+%3D+a":        CqlUnsupportedIndex,
+		"operation=searchRetrieve&version=1.2&query=dc.title+within+a":       CqlUnsupportedRelation,
+		"operation=searchRetrieve&version=1.2&query=a+prox+b":                CqlUnsupportedBoolean,
+		"operation=searchRetrieve&version=1.2&query=a+sortby+dc.title":       CqlSortNotSupported,
+		"operation=searchRetrieve&version=1.2&query=coal&startRecord=5":      CqlFirstRecordOutOfRange,
+		"operation=searchRetrieve&version=1.2&query=coal&startRecord=x":      CqlUnsupportedParameter,
+		"operation=searchRetrieve&version=1.2&query=coal&recordSchema=mods":  CqlUnknownSchema,
+		"operation=searchRetrieve&version=1.2&query=coal&recordPacking=json": CqlUnsupportedPacking,
+		"query=coal&recordXMLEscaping=json":                                  CqlUnsupportedPacking,
+		"operation=scan&version=1.2&scanClause=coal":                         CqlUnsupportedOperation,
+		"operation=explain&version=3.0":                                      CqlUnsupportedVersion,
+	} {
+		args, _ := url.ParseQuery(query)
+		if response := sruGet(test, server, args); sruDiagnosticCode(response) != code {
+			test.Errorf("%s: expected diagnostic %d, got %v", query, code, response.Diagnostics)
+		}
+	}
+
+	resp, err := http.PostForm(server.URL+"/sru", url.Values{"query": {"bath.isbn = 0306406152"}})
+	if err != nil {
+		test.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `<searchRetrieveResponse xmlns="`+Sru20Namespace+`">`) ||
+		!strings.Contains(string(body), `<record xmlns="http://www.loc.gov/MARC21/slim">`) ||
+		!strings.Contains(string(body), "<recordXMLEscaping>xml</recordXMLEscaping>") {
+		test.Error("wrong POST response", string(body))
+	}
+}
+
+func TestOpenSruServer(test *testing.T) {
+	data, err := os.ReadFile("data/test_10.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+	marcFile := filepath.Join(test.TempDir(), "records.mrc")
+	if err := os.WriteFile(marcFile, data, 0644); err != nil {
+		test.Fatal(err)
+	}
+
+	sru, err := OpenSruServer(marcFile, SruConfig{})
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer sru.Close()
+	server := httptest.NewServer(sru)
+	defer server.Close()
+
+	response := sruGet(test, server, url.Values{"query": {"dc.subject = security"}})
+	if ids := sruIds(test, response); strings.Join(ids, " ") != "ocm57177924 ocm57178089" {
+		test.Error("wrong records", ids)
+	}
+	if _, err := OpenSruServer(marcFile, SruConfig{Indexes: []SruIndex{{Name: "title", Specs: []string{"245$a"}}}}); err == nil {
+		test.Error("an index without context set was accepted")
+	}
+
+	// the records of a store
+	storeFile := filepath.Join(test.TempDir(), "records.db")
+	store, err := OpenStore(storeFile, StoreConfig{})
+	if err != nil {
+		test.Fatal(err)
+	}
+	err = eachRecord(marcFile, func(rec Record) {
+		if err := store.Put(rec); err != nil {
+			test.Fatal(err)
+		}
+	})
+	if err != nil {
+		test.Fatal(err)
+	}
+	store.Close()
+	stored, err := OpenStoreSruServer(storeFile, SruConfig{})
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer stored.Close()
+	storeServer := httptest.NewServer(stored)
+	defer storeServer.Close()
+	response = sruGet(test, storeServer, url.Values{"query": {"dc.subject = security"}})
+	if ids := sruIds(test, response); strings.Join(ids, " ") != "ocm57177924 ocm57178089" {
+		test.Error("wrong stored records", ids)
+	}
+}
@@ -0,0 +1,215 @@
+package gomarc21
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+/*
+Stats profiles a stream of MARC records before it is loaded or migrated:
+
+    - per-tag occurrence counts and the share of records carrying the tag
+    - indicator value distributions for each data field tag
+    - subfield code frequencies for each data field tag
+    - value histograms for the coded leader positions
+    - language (008/35-37) and date 1 (008/07-10) distributions of
+      bibliographic records
+
+source: http://www.loc.gov/marc/bibliographic/bd008a.html
+*/
+
+// leaderStatPositions lists the coded leader positions that are profiled.
+// Record length (00-04) and base address of data (12-16) are numbers
+// rather than codes and are left out.
+var leaderStatPositions = []int{5, 6, 7, 8, 9, 10, 11, 17, 18, 19, 20, 21, 22, 23}
+
+// TagStats holds the statistics of a single tag.
+type TagStats struct {
+	Tag         string         `json:"tag"`
+	Occurrences int            `json:"occurrences"`
+	Records     int            `json:"records"`
+	Percent     float64        `json:"percent"`
+	Indicator1  map[string]int `json:"ind1,omitempty"`
+	Indicator2  map[string]int `json:"ind2,omitempty"`
+	SubFields   map[string]int `json:"subfields,omitempty"`
+}
+
+// Stats accumulates field and subfield statistics over a set of records.
+type Stats struct {
+	Records   int                    `json:"records"`
+	Tags      map[string]*TagStats   `json:"tags"`
+	Leader    map[int]map[string]int `json:"leader"`
+	Languages map[string]int         `json:"languages"`
+	Dates     map[string]int         `json:"dates"`
+}
+
+// NewStats returns an empty Stats ready to accumulate records.
+func NewStats() *Stats {
+	stats := &Stats{
+		Tags:      map[string]*TagStats{},
+		Leader:    map[int]map[string]int{},
+		Languages: map[string]int{},
+		Dates:     map[string]int{},
+	}
+	for _, pos := range leaderStatPositions {
+		stats.Leader[pos] = map[string]int{}
+	}
+	return stats
+}
+
+// ParseStats reads all the records from a reader and returns their statistics.
+func ParseStats(reader io.Reader) (*Stats, error) {
+	stats := NewStats()
+	for {
+		rec, err := ParseNextRecord(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return stats, err
+		}
+		stats.Add(rec)
+	}
+	stats.Finish()
+	return stats, nil
+}
+
+// Add accumulates the statistics of one record. Call Finish after the
+// last record.
+func (stats *Stats) Add(rec Record) {
+	stats.Records++
+
+	leader := rec.Leader.GetRaw()
+	for _, pos := range leaderStatPositions {
+		if pos < len(leader) {
+			stats.Leader[pos][string(leader[pos])]++
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, cf := range rec.ControlFields {
+		ts := stats.tagStats(cf.Tag.GetTag())
+		ts.Occurrences++
+		if !seen[ts.Tag] {
+			ts.Records++
+			seen[ts.Tag] = true
+		}
+		if ts.Tag == "008" && isBibliographic(rec.Leader.TypeOfRecord) {
+			if len(cf.Data) >= 38 {
+				stats.Languages[cf.Data[35:38]]++
+			}
+			if len(cf.Data) >= 11 {
+				stats.Dates[cf.Data[7:11]]++
+			}
+		}
+	}
+
+	for _, df := range rec.DataFields {
+		ts := stats.tagStats(df.Tag.GetTag())
+		ts.Occurrences++
+		if !seen[ts.Tag] {
+			ts.Records++
+			seen[ts.Tag] = true
+		}
+		if ts.Indicator1 == nil {
+			ts.Indicator1 = map[string]int{}
+			ts.Indicator2 = map[string]int{}
+			ts.SubFields = map[string]int{}
+		}
+		ts.Indicator1[df.GetIndicator1()]++
+		ts.Indicator2[df.GetIndicator2()]++
+		for _, sf := range df.SubFields {
+			ts.SubFields[sf.Code]++
+		}
+	}
+}
+
+// Finish computes the share of the records carrying each tag (Percent)
+// once all the records are added. ParseStats, AsJson and AsText call it.
+func (stats *Stats) Finish() {
+	if stats.Records == 0 {
+		return
+	}
+	for _, ts := range stats.Tags {
+		ts.Percent = float64(ts.Records) * 100 / float64(stats.Records)
+	}
+}
+
+func (stats *Stats) tagStats(tag string) *TagStats {
+	ts, ok := stats.Tags[tag]
+	if !ok {
+		ts = &TagStats{Tag: tag}
+		stats.Tags[tag] = ts
+	}
+	return ts
+}
+
+// SortedTags returns the statistics of each tag in tag order.
+func (stats *Stats) SortedTags() []*TagStats {
+	tags := make([]*TagStats, 0, len(stats.Tags))
+	for _, ts := range stats.Tags {
+		tags = append(tags, ts)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Tag < tags[j].Tag })
+	return tags
+}
+
+// AsJson returns the statistics as an indented JSON document.
+func (stats *Stats) AsJson() (string, error) {
+	stats.Finish()
+	b, err := json.MarshalIndent(stats, "", "  ")
+	return string(b), err
+}
+
+// AsText returns the statistics as plain text tables.
+func (stats *Stats) AsText() string {
+	stats.Finish()
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Records: %d\n\n", stats.Records)
+
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Tag\tOccurrences\tRecords\t%\tInd1\tInd2\tSubfields")
+	for _, ts := range stats.SortedTags() {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.1f\t%s\t%s\t%s\n", ts.Tag, ts.Occurrences, ts.Records, ts.Percent,
+			formatCounts(ts.Indicator1), formatCounts(ts.Indicator2), formatCounts(ts.SubFields))
+	}
+	w.Flush()
+
+	buf.WriteString("\nLeader\n")
+	w = tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Position\tValues")
+	for _, pos := range leaderStatPositions {
+		fmt.Fprintf(w, "%02d\t%s\n", pos, formatCounts(stats.Leader[pos]))
+	}
+	w.Flush()
+
+	fmt.Fprintf(&buf, "\nLanguages (008/35-37): %s\n", formatCounts(stats.Languages))
+	fmt.Fprintf(&buf, "Dates (008/07-10): %s\n", formatCounts(stats.Dates))
+	return buf.String()
+}
+
+// formatCounts renders a value histogram as "value=count" pairs ordered
+// by value. Blanks are shown as "\" as in the mrk format.
+func formatCounts(counts map[string]int) string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	values := make([]string, 0, len(keys))
+	for _, k := range keys {
+		values = append(values, fmt.Sprintf("%s=%d", strings.ReplaceAll(k, " ", "\\"), counts[k]))
+	}
+	return strings.Join(values, " ")
+}
+
+// isBibliographic reports whether leader/06 is a bibliographic type of record.
+func isBibliographic(typeOfRecord byte) bool {
+	return strings.IndexByte("acdefgijkmoprt", typeOfRecord) >= 0
+}
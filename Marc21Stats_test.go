@@ -0,0 +1,93 @@
+package gomarc21
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseStats(test *testing.T) {
+	data, err := os.Open("data/test_10.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer data.Close()
+
+	stats, err := ParseStats(data)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if stats.Records != 10 {
+		test.Error("Records should be 10, but got", stats.Records)
+	}
+
+	ts := stats.Tags["650"]
+	if ts == nil {
+		test.Fatal("650 should be counted")
+	}
+	if ts.Occurrences != 19 || ts.Records != 10 || ts.Percent != 100 {
+		test.Error("650 counts are wrong", ts.Occurrences, ts.Records, ts.Percent)
+	}
+	if ts.Indicator2["0"] != 19 {
+		test.Error("650 ind2 should be 0 for all occurrences", ts.Indicator2)
+	}
+	if ts.SubFields["z"] != 14 {
+		test.Error("650 $z should occur 14 times, but got", ts.SubFields["z"])
+	}
+
+	if stats.Tags["246"].Records != 3 || stats.Tags["246"].Percent != 30 {
+		test.Error("246 should be in 3 records", stats.Tags["246"])
+	}
+	if stats.Leader[5]["n"] != 7 || stats.Leader[5]["c"] != 3 {
+		test.Error("leader/05 histogram is wrong", stats.Leader[5])
+	}
+	if stats.Languages["eng"] != 9 || stats.Languages["spa"] != 1 {
+		test.Error("language distribution is wrong", stats.Languages)
+	}
+	if stats.Dates["2004"] != 8 {
+		test.Error("date distribution is wrong", stats.Dates)
+	}
+}
+
+func TestStatsOutput(test *testing.T) {
+	data, err := os.Open("data/test_1a.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer data.Close()
+
+	stats, err := ParseStats(data)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	text := stats.AsText()
+	if !strings.Contains(text, "Records: 1") || !strings.Contains(text, "245  1") {
+		test.Error("text output is wrong", text)
+	}
+
+	str, err := stats.AsJson()
+	if err != nil {
+		test.Fatal(err)
+	}
+	var decoded Stats
+	if err := json.Unmarshal([]byte(str), &decoded); err != nil {
+		test.Fatal(err)
+	}
+	if decoded.Records != 1 || decoded.Tags["245"].Occurrences != 1 {
+		test.Error("json output is wrong", str)
+	}
+
+	// the shares of records are computed when the statistics added
+	// record by record are printed
+	added := NewStats()
+	added.Add(Record{DataFields: []DataField{{Tag: "245", SubFields: []SubField{{Code: "a", Data: "One"}}}}})
+	added.Add(Record{DataFields: []DataField{{Tag: "246", SubFields: []SubField{{Code: "a", Data: "Two"}}}}})
+	if added.Tags["245"].Percent != 0 {
+		test.Error("the share of records should not be computed by Add")
+	}
+	if text := added.AsText(); added.Tags["245"].Percent != 50 || !strings.Contains(text, "50.0") {
+		test.Error("the share of records was not computed", text)
+	}
+}
@@ -0,0 +1,689 @@
+package gomarc21
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+A Store is a database of records in a single file, keyed by control
+number (001), for the features needing records at hand: deduplication,
+authority matching, OAI-PMH, random lookups.
+
+    store, _ := OpenStore("records.db", StoreConfig{Indexes: []StoreIndex{
+        {Name: "isbn", Values: Record.Isbns, Normalize: NormalizeIsbn},
+        {Name: "title", Specs: []string{"245$a"}},
+    }})
+    defer store.Close()
+    store.Put(rec)
+    ids, _ := store.Lookup("title", "Aviation security")
+
+The file is an append-only log of the records in binary MARC. After a
+header line, each entry is
+
+    op (P put, D delete, C commit) | uvarint length | control number |
+    uvarint length | record | CRC-32 (IEEE) of the entry, big endian
+
+The operations of a batch (see Update) are written at once and followed
+by a commit. When the store is opened the log is replayed: the entries
+of a batch left incomplete by a crash are dropped, a checksum mismatch is
+an error. The secondary indexes are rebuilt in memory from the records,
+so they can be changed between openings.
+
+Records are versioned by their 005: a record is not replaced by a record
+with an older 005 (ErrStaleRecord), and the versions replaced stay in the
+log, see Versions, until the store is compacted.
+*/
+
+// storeHeader starts the file of a store.
+const storeHeader = "GOMARC21 STORE 1\n"
+
+// The operations of the entries of a store.
+const (
+	storePut    = 'P'
+	storeDelete = 'D'
+	storeCommit = 'C'
+)
+
+// maxStoreEntry is the largest control number or record of an entry.
+const maxStoreEntry = 1 << 20
+
+// ErrStaleRecord is returned when a record is put over a stored record
+// with a newer 005.
+var ErrStaleRecord = errors.New("the stored record is newer")
+
+// StoreIndex is a secondary index of a Store.
+type StoreIndex struct {
+	Name string
+	// Specs are the MARCspecs of the values of the index, or Values
+	// returns them.
+	Specs  []string
+	Values func(rec Record) []string
+	// Normalize normalizes the values and the looked up values;
+	// NacoNormalize when nil.
+	Normalize func(value string) string
+}
+
+// StoreConfig configures a Store.
+type StoreConfig struct {
+	Indexes []StoreIndex
+	// NoSync leaves the batches in the buffers of the operating system,
+	// which is faster but loses the last batches on a crash.
+	NoSync bool
+}
+
+// storeVersion locates a version of a record in the file.
+type storeVersion struct {
+	offset  int64
+	length  int
+	version string
+}
+
+// storeEntry is a record of a store: its versions, oldest first, and its
+// values in the indexes.
+type storeEntry struct {
+	versions []storeVersion
+	keys     map[string][]string
+}
+
+// storeOp is an operation of a batch.
+type storeOp struct {
+	op     byte
+	id     string
+	data   []byte
+	rec    Record
+	offset int64 // of the data in the file
+}
+
+// Store is a persistent database of records.
+type Store struct {
+	Config StoreConfig
+
+	mu      sync.RWMutex
+	path    string
+	file    *os.File
+	size    int64
+	specs   map[string][]Spec
+	entries map[string]*storeEntry
+	indexes map[string]map[string][]string
+}
+
+// OpenStore opens the store of a file, created when it does not exist.
+func OpenStore(path string, config StoreConfig) (*Store, error) {
+	s := &Store{Config: config, path: path, specs: map[string][]Spec{}}
+	for _, index := range config.Indexes {
+		if index.Name == "" {
+			return nil, errors.New("an index has no name")
+		}
+		if _, ok := s.specs[index.Name]; ok {
+			return nil, fmt.Errorf("index %s is defined twice", index.Name)
+		}
+		s.specs[index.Name] = nil
+		for _, text := range index.Specs {
+			spec, err := ParseSpec(text)
+			if err != nil {
+				return nil, fmt.Errorf("index %s: %s", index.Name, err)
+			}
+			s.specs[index.Name] = append(s.specs[index.Name], spec)
+		}
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s.file = file
+	if err := s.replay(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return s, nil
+}
+
+// replay reads the log of the file into memory.
+func (s *Store) replay() error {
+	s.entries = map[string]*storeEntry{}
+	s.indexes = map[string]map[string][]string{}
+	info, err := s.file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		if _, err := s.file.WriteAt([]byte(storeHeader), 0); err != nil {
+			return err
+		}
+		s.size = int64(len(storeHeader))
+		return s.sync()
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(s.file, 0, info.Size()))
+	header := make([]byte, len(storeHeader))
+	if _, err := io.ReadFull(reader, header); err != nil || string(header) != storeHeader {
+		return errors.New("not a record store")
+	}
+	offset := int64(len(storeHeader))
+	committed := offset
+	var pending []storeOp
+	for {
+		op, n, err := readStoreEntry(reader)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("entry at offset %d: %s", offset, err)
+		}
+		op.offset += offset
+		offset += int64(n)
+		if op.op != storeCommit {
+			if op.op == storePut {
+				if op.rec, err = ParseRecord(op.data); err != nil {
+					return fmt.Errorf("record %s at offset %d: %s", op.id, op.offset, err)
+				}
+			}
+			pending = append(pending, op)
+			continue
+		}
+		for _, op := range pending {
+			s.apply(op)
+		}
+		pending = nil
+		committed = offset
+	}
+	s.size = committed
+	if committed < info.Size() {
+		// an incomplete batch
+		if err := s.file.Truncate(committed); err != nil {
+			return err
+		}
+		return s.sync()
+	}
+	return nil
+}
+
+// readStoreEntry reads an entry of the log. The offset of the operation
+// is the offset of its data in the entry, whose length is returned.
+func readStoreEntry(reader *bufio.Reader) (storeOp, int, error) {
+	var op storeOp
+	code, err := reader.ReadByte()
+	if err != nil {
+		return op, 0, err
+	}
+	if code != storePut && code != storeDelete && code != storeCommit {
+		return op, 0, fmt.Errorf("unknown operation %q", code)
+	}
+	op.op = code
+	entry := []byte{code}
+	readPart := func() ([]byte, error) {
+		n, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return nil, err
+		}
+		if n > maxStoreEntry {
+			return nil, fmt.Errorf("invalid length %d", n)
+		}
+		entry = binary.AppendUvarint(entry, n)
+		part := make([]byte, n)
+		if _, err := io.ReadFull(reader, part); err != nil {
+			return nil, err
+		}
+		entry = append(entry, part...)
+		return part, nil
+	}
+	id, err := readPart()
+	if err == nil {
+		op.id = string(id)
+		op.data, err = readPart()
+		op.offset = int64(len(entry) - len(op.data))
+	}
+	var checksum [4]byte
+	if err == nil {
+		_, err = io.ReadFull(reader, checksum[:])
+	}
+	if err == io.EOF {
+		return op, 0, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return op, 0, err
+	}
+	if binary.BigEndian.Uint32(checksum[:]) != crc32.ChecksumIEEE(entry) {
+		return op, 0, errors.New("checksum mismatch")
+	}
+	return op, len(entry) + len(checksum), nil
+}
+
+// appendStoreEntry appends an entry to a buffer, and returns the buffer
+// and the position of the data in it.
+func appendStoreEntry(buf []byte, op byte, id string, data []byte) ([]byte, int) {
+	start := len(buf)
+	buf = append(buf, op)
+	buf = binary.AppendUvarint(buf, uint64(len(id)))
+	buf = append(buf, id...)
+	buf = binary.AppendUvarint(buf, uint64(len(data)))
+	position := len(buf)
+	buf = append(buf, data...)
+	return binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf[start:])), position
+}
+
+// apply applies a committed operation to the records and the indexes.
+func (s *Store) apply(op storeOp) {
+	entry := s.entries[op.id]
+	if entry != nil {
+		for name, values := range entry.keys {
+			for _, value := range values {
+				s.unindex(name, value, op.id)
+			}
+		}
+	}
+	if op.op == storeDelete {
+		delete(s.entries, op.id)
+		return
+	}
+	if entry == nil {
+		entry = &storeEntry{}
+		s.entries[op.id] = entry
+	}
+	entry.versions = append(entry.versions,
+		storeVersion{offset: op.offset, length: len(op.data), version: recordVersion(op.rec)})
+	entry.keys = s.indexValues(op.rec)
+	for name, values := range entry.keys {
+		for _, value := range values {
+			if s.indexes[name] == nil {
+				s.indexes[name] = map[string][]string{}
+			}
+			s.indexes[name][value] = append(s.indexes[name][value], op.id)
+		}
+	}
+}
+
+// unindex removes a record from a value of an index.
+func (s *Store) unindex(name string, value string, id string) {
+	ids := s.indexes[name][value]
+	for i, v := range ids {
+		if v == id {
+			ids = append(ids[:i:i], ids[i+1:]...)
+			break
+		}
+	}
+	if len(ids) == 0 {
+		delete(s.indexes[name], value)
+	} else {
+		s.indexes[name][value] = ids
+	}
+}
+
+// indexValues returns the normalized values of a record in each index.
+func (s *Store) indexValues(rec Record) map[string][]string {
+	keys := map[string][]string{}
+	for _, index := range s.Config.Indexes {
+		var values []string
+		if index.Values != nil {
+			values = index.Values(rec)
+		}
+		for _, spec := range s.specs[index.Name] {
+			values = append(values, rec.Select(spec)...)
+		}
+		for _, value := range values {
+			if value = normalizeStoreValue(index, value); value != "" {
+				keys[index.Name] = appendValue(keys[index.Name], value)
+			}
+		}
+	}
+	return keys
+}
+
+func normalizeStoreValue(index StoreIndex, value string) string {
+	if index.Normalize != nil {
+		return strings.TrimSpace(index.Normalize(value))
+	}
+	return NacoNormalize(value)
+}
+
+// recordVersion returns the 005 of a record.
+func recordVersion(rec Record) string {
+	for _, cf := range rec.GetControlfields("005") {
+		return strings.TrimSpace(cf.Data)
+	}
+	return ""
+}
+
+func (s *Store) sync() error {
+	if s.Config.NoSync {
+		return nil
+	}
+	return s.file.Sync()
+}
+
+// Close closes the file of the store.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// Len returns the number of records.
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.entries)
+}
+
+// Ids returns the control numbers of the records in sorted order.
+func (s *Store) Ids() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ids()
+}
+
+func (s *Store) ids() []string {
+	ids := make([]string, 0, len(s.entries))
+	for id := range s.entries {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// GetRaw returns the binary MARC of the record of a control number.
+func (s *Store) GetRaw(id string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry := s.entries[strings.TrimSpace(id)]
+	if entry == nil {
+		return nil, ErrRecordNotFound
+	}
+	return s.readAt(entry.versions[len(entry.versions)-1])
+}
+
+// Get returns the record of a control number.
+func (s *Store) Get(id string) (Record, error) {
+	raw, err := s.GetRaw(id)
+	if err != nil {
+		return Record{}, err
+	}
+	return ParseRecord(raw)
+}
+
+// Version returns the 005 of the record of a control number.
+func (s *Store) Version(id string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry := s.entries[strings.TrimSpace(id)]
+	if entry == nil {
+		return "", ErrRecordNotFound
+	}
+	return entry.versions[len(entry.versions)-1].version, nil
+}
+
+// Versions returns the versions of the record of a control number kept
+// since it was last put after a delete or the store was compacted,
+// oldest first.
+func (s *Store) Versions(id string) ([]Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry := s.entries[strings.TrimSpace(id)]
+	if entry == nil {
+		return nil, ErrRecordNotFound
+	}
+	var recs []Record
+	for _, version := range entry.versions {
+		raw, err := s.readAt(version)
+		if err != nil {
+			return nil, err
+		}
+		rec, err := ParseRecord(raw)
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+
+func (s *Store) readAt(version storeVersion) ([]byte, error) {
+	if s.file == nil {
+		return nil, os.ErrClosed
+	}
+	raw := make([]byte, version.length)
+	if _, err := s.file.ReadAt(raw, version.offset); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// Lookup returns the control numbers of the records with a value in an
+// index, in sorted order.
+func (s *Store) Lookup(index string, value string) ([]string, error) {
+	for _, i := range s.Config.Indexes {
+		if i.Name != index {
+			continue
+		}
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		ids := append([]string{}, s.indexes[index][normalizeStoreValue(i, value)]...)
+		sort.Strings(ids)
+		return ids, nil
+	}
+	return nil, fmt.Errorf("unknown index %s", index)
+}
+
+// Each calls fn with each record in the order of the control numbers,
+// until fn returns an error. fn must not write to the store.
+func (s *Store) Each(fn func(rec Record) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, id := range s.ids() {
+		entry := s.entries[id]
+		raw, err := s.readAt(entry.versions[len(entry.versions)-1])
+		if err != nil {
+			return err
+		}
+		rec, err := ParseRecord(raw)
+		if err != nil {
+			return fmt.Errorf("record %s: %s", id, err)
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Put adds a record or replaces the record of its control number.
+func (s *Store) Put(rec Record) error {
+	return s.Update(func(batch *StoreBatch) error { return batch.Put(rec) })
+}
+
+// Delete deletes the record of a control number.
+func (s *Store) Delete(id string) error {
+	return s.Update(func(batch *StoreBatch) error { return batch.Delete(id) })
+}
+
+// StoreBatch collects the operations of an Update.
+type StoreBatch struct {
+	store *Store
+	ops   []storeOp
+}
+
+// pending returns the last operation of the batch on a record.
+func (b *StoreBatch) pending(id string) *storeOp {
+	for i := len(b.ops) - 1; i >= 0; i-- {
+		if b.ops[i].id == id {
+			return &b.ops[i]
+		}
+	}
+	return nil
+}
+
+// Get returns the record of a control number as changed by the batch.
+func (b *StoreBatch) Get(id string) (Record, error) {
+	id = strings.TrimSpace(id)
+	if op := b.pending(id); op != nil {
+		if op.op == storeDelete {
+			return Record{}, ErrRecordNotFound
+		}
+		return op.rec, nil
+	}
+	entry := b.store.entries[id]
+	if entry == nil {
+		return Record{}, ErrRecordNotFound
+	}
+	raw, err := b.store.readAt(entry.versions[len(entry.versions)-1])
+	if err != nil {
+		return Record{}, err
+	}
+	return ParseRecord(raw)
+}
+
+// version returns the 005 of the record of a control number as changed
+// by the batch, and whether there is one.
+func (b *StoreBatch) version(id string) (string, bool) {
+	if op := b.pending(id); op != nil {
+		return recordVersion(op.rec), op.op == storePut
+	}
+	if entry := b.store.entries[id]; entry != nil {
+		return entry.versions[len(entry.versions)-1].version, true
+	}
+	return "", false
+}
+
+// Put adds a record or replaces the record of its control number. It
+// returns ErrStaleRecord when the 005 of the record is older than the
+// 005 of the record replaced; records without a 005 always replace.
+func (b *StoreBatch) Put(rec Record) error {
+	id := strings.TrimSpace(rec.ControlNum())
+	if id == "" {
+		return errors.New("the record has no control number")
+	}
+	if stored, _ := b.version(id); stored != "" && recordVersion(rec) != "" && recordVersion(rec) < stored {
+		return fmt.Errorf("record %s: %w", id, ErrStaleRecord)
+	}
+	data, err := rec.RecordAsMarc()
+	if err != nil {
+		return fmt.Errorf("record %s: %s", id, err)
+	}
+	if len(data) > maxStoreEntry {
+		return fmt.Errorf("record %s is too long", id)
+	}
+	b.ops = append(b.ops, storeOp{op: storePut, id: id, data: data, rec: rec})
+	return nil
+}
+
+// Delete deletes the record of a control number. It returns
+// ErrRecordNotFound when there is none.
+func (b *StoreBatch) Delete(id string) error {
+	id = strings.TrimSpace(id)
+	if _, ok := b.version(id); !ok {
+		return ErrRecordNotFound
+	}
+	b.ops = append(b.ops, storeOp{op: storeDelete, id: id})
+	return nil
+}
+
+// Update calls fn with a batch, and writes the operations of the batch
+// at once when fn returns nil. Nothing is written when fn returns an
+// error, which is returned. Other writes wait for the end of fn.
+func (s *Store) Update(fn func(batch *StoreBatch) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return os.ErrClosed
+	}
+	batch := &StoreBatch{store: s}
+	if err := fn(batch); err != nil {
+		return err
+	}
+	if len(batch.ops) == 0 {
+		return nil
+	}
+
+	var buf []byte
+	for i, op := range batch.ops {
+		var position int
+		buf, position = appendStoreEntry(buf, op.op, op.id, op.data)
+		batch.ops[i].offset = s.size + int64(position)
+	}
+	buf, _ = appendStoreEntry(buf, storeCommit, "", nil)
+	if _, err := s.file.WriteAt(buf, s.size); err != nil {
+		s.file.Truncate(s.size)
+		return err
+	}
+	if err := s.sync(); err != nil {
+		s.file.Truncate(s.size)
+		return err
+	}
+	s.size += int64(len(buf))
+	for _, op := range batch.ops {
+		s.apply(op)
+	}
+	return nil
+}
+
+// Compact rewrites the file of the store with the last versions of its
+// records only.
+func (s *Store) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return os.ErrClosed
+	}
+
+	compacted := s.path + ".compact"
+	out, err := os.Create(compacted)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(out)
+	writer.WriteString(storeHeader)
+	size := int64(len(storeHeader))
+	versions := map[string]storeVersion{}
+	for _, id := range s.ids() {
+		version := s.entries[id].versions[len(s.entries[id].versions)-1]
+		data, err := s.readAt(version)
+		if err == nil {
+			buf, position := appendStoreEntry(nil, storePut, id, data)
+			_, err = writer.Write(buf)
+			versions[id] = storeVersion{offset: size + int64(position), length: len(data), version: version.version}
+			size += int64(len(buf))
+		}
+		if err != nil {
+			out.Close()
+			os.Remove(compacted)
+			return err
+		}
+	}
+	buf, _ := appendStoreEntry(nil, storeCommit, "", nil)
+	writer.Write(buf)
+	size += int64(len(buf))
+	err = writer.Flush()
+	if err == nil {
+		err = out.Sync()
+	}
+	if err == nil {
+		err = os.Rename(compacted, s.path)
+	}
+	if err != nil {
+		out.Close()
+		os.Remove(compacted)
+		return err
+	}
+
+	s.file.Close()
+	s.file = out
+	s.size = size
+	for id, version := range versions {
+		s.entries[id].versions = []storeVersion{version}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package gomarc21
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStore(test *testing.T) {
+	file, err := OpenFile("data/test_10.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+	recs := readAll(test, NewReader(file))
+	file.Close()
+
+	path := filepath.Join(test.TempDir(), "records.db")
+	config := StoreConfig{Indexes: []StoreIndex{
+		{Name: "title", Specs: []string{"245$a"}},
+		{Name: "subject", Specs: []string{"650$a"}},
+		{Name: "version", Specs: []string{"005"}, Normalize: func(value string) string { return value }},
+	}}
+	store, err := OpenStore(path, config)
+	if err != nil {
+		test.Fatal(err)
+	}
+	err = store.Update(func(batch *StoreBatch) error {
+		for _, rec := range recs {
+			if err := batch.Put(rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		test.Fatal(err)
+	}
+	if store.Len() != 10 || store.Ids()[0] != "ocm57175940" {
+		test.Error("wrong records", store.Ids())
+	}
+	if rec, err := store.Get("ocm57177924"); err != nil || rec.Leader.GetRaw() != recs[1].Leader.GetRaw() {
+		test.Error("wrong record", err)
+	}
+	if ids, _ := store.Lookup("subject", "Fish culture"); !reflect.DeepEqual(ids, []string{"ocm57178104", "ocm57178112"}) {
+		test.Error("wrong subject lookup", ids)
+	}
+	if ids, _ := store.Lookup("title", "aviation security."); !reflect.DeepEqual(ids, []string{"ocm57177924"}) {
+		test.Error("wrong title lookup", ids)
+	}
+	if _, err := store.Lookup("isbn", "0306406152"); err == nil {
+		test.Error("expected an unknown index")
+	}
+
+	// versions
+	version, _ := store.Version("ocm57177924")
+	updated := recs[1].Clone()
+	updated.SetControlField("005", "20991231000000.0")
+	updated.SetControlField("008", "changed")
+	if err := store.Put(updated); err != nil {
+		test.Fatal(err)
+	}
+	if stored, _ := store.Version("ocm57177924"); stored != "20991231000000.0" {
+		test.Error("wrong version", stored)
+	}
+	if ids, _ := store.Lookup("version", version); len(ids) != 0 {
+		test.Error("the replaced version is still indexed", ids)
+	}
+	if err := store.Put(recs[1]); !errors.Is(err, ErrStaleRecord) {
+		test.Error("expected a stale record, got", err)
+	}
+	if versions, err := store.Versions("ocm57177924"); err != nil || len(versions) != 2 ||
+		recordVersion(versions[0]) != version {
+		test.Error("wrong versions", len(versions), err)
+	}
+
+	// deletes and failed batches
+	if err := store.Delete("ocm57178216"); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.Get("ocm57178216"); err != ErrRecordNotFound {
+		test.Error("expected no record, got", err)
+	}
+	if err := store.Delete("ocm57178216"); err != ErrRecordNotFound {
+		test.Error("expected no record, got", err)
+	}
+	failure := errors.New("failure")
+	err = store.Update(func(batch *StoreBatch) error {
+		batch.Delete("ocm57175940")
+		if _, err := batch.Get("ocm57175940"); err != ErrRecordNotFound {
+			test.Error("the batch does not see its delete")
+		}
+		return failure
+	})
+	if err != failure || store.Len() != 9 {
+		test.Error("the failed batch was written", err, store.Len())
+	}
+	var ids []string
+	store.Each(func(rec Record) error {
+		ids = append(ids, rec.ControlNum())
+		return nil
+	})
+	if len(ids) != 9 || ids[8] != "ocm57178158" {
+		test.Error("wrong iteration", ids)
+	}
+	if err := store.Close(); err != nil {
+		test.Fatal(err)
+	}
+
+	// a crash in the middle of a batch
+	data, _ := os.ReadFile(path)
+	raw, _ := recs[9].RecordAsMarc()
+	torn, _ := appendStoreEntry(nil, storePut, "ocm57178216", raw)
+	torn = append(data, torn[:len(torn)-10]...)
+	if err := os.WriteFile(path, torn, 0644); err != nil {
+		test.Fatal(err)
+	}
+	store, err = OpenStore(path, config)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+	if info, _ := os.Stat(path); store.Len() != 9 || info.Size() != int64(len(data)) {
+		test.Error("the incomplete batch was not dropped", store.Len())
+	}
+	if ids, _ := store.Lookup("subject", "fish culture"); !reflect.DeepEqual(ids, []string{"ocm57178104", "ocm57178112"}) {
+		test.Error("wrong rebuilt index", ids)
+	}
+	if stored, _ := store.Version("ocm57177924"); stored != "20991231000000.0" {
+		test.Error("wrong version after opening", stored)
+	}
+
+	if err := store.Compact(); err != nil {
+		test.Fatal(err)
+	}
+	if info, _ := os.Stat(path); info.Size() >= int64(len(data)) {
+		test.Error("the store was not compacted", info.Size())
+	}
+	if versions, _ := store.Versions("ocm57177924"); len(versions) != 1 || recordVersion(versions[0]) != "20991231000000.0" {
+		test.Error("wrong versions after compaction", len(versions))
+	}
+	if err := store.Put(recs[9]); err != nil {
+		test.Fatal(err)
+	}
+	store.Close()
+	store, err = OpenStore(path, StoreConfig{})
+	if err != nil {
+		test.Fatal(err)
+	}
+	if store.Len() != 10 {
+		test.Error("wrong records after compaction", store.Len())
+	}
+
+	data[len(data)-3] ^= 0xff
+	os.WriteFile(path+".broken", data, 0644)
+	if _, err := OpenStore(path+".broken", StoreConfig{}); err == nil {
+		test.Error("expected a checksum mismatch")
+	}
+}
@@ -0,0 +1,338 @@
+package gomarc21
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// The checks of CheckStructure.
+const (
+	CheckRecordLength  = "record-length"
+	CheckBaseAddress   = "base-address"
+	CheckLeader        = "leader"
+	CheckDirectory     = "directory"
+	CheckField         = "field"
+	CheckLayout        = "layout"
+	CheckControlNumber = "control-number"
+	CheckOrder         = "order"
+	CheckTerminator    = "terminator"
+)
+
+// StructureIssue is a mismatch found by CheckStructure between the
+// leader, the directory and the data of a record.
+type StructureIssue struct {
+	Check   string `json:"check"`
+	Tag     string `json:"tag,omitempty"`
+	Message string `json:"message"`
+}
+
+func (issue StructureIssue) String() string {
+	if issue.Tag == "" {
+		return fmt.Sprintf("[%s] %s", issue.Check, issue.Message)
+	}
+	return fmt.Sprintf("[%s] %s: %s", issue.Check, issue.Tag, issue.Message)
+}
+
+// structureEntry is a directory entry as found, which unlike a
+// DirectoryEntry may have an unreadable length or starting position (-1).
+type structureEntry struct {
+	tag              string
+	fieldLength      int
+	startingPosition int
+}
+
+// NextTerminatedRecord returns the bytes up to and including the next
+// record terminator. Unlike NextRecord it does not trust the record
+// length of the leader, so a record with a wrong length does not throw
+// off the records after it. The bytes after the last terminator are
+// returned as a record of their own.
+func NextTerminatedRecord(reader *bufio.Reader) ([]byte, error) {
+	rawRec, err := reader.ReadBytes(END_OF_RECORD)
+	// the line breaks some systems put between the records
+	rawRec = bytes.TrimLeft(rawRec, "\r\n")
+	if err == io.EOF && len(bytes.TrimSpace(rawRec)) > 0 {
+		return rawRec, nil
+	}
+	return rawRec, err
+}
+
+// CheckStructure verifies that the leader and the directory of a raw
+// record match its data: the record length (leader/00-04), the base
+// address (leader/12-16), the directory entries against the field
+// terminators, overlapping and gapped fields, leader/10-11 and 20-23,
+// the 001 at the base address and the order of the directory. It returns
+// nothing for a sound record.
+func CheckStructure(rawRec []byte) (issues []StructureIssue) {
+	report := func(check, tag, format string, args ...interface{}) {
+		issues = append(issues, StructureIssue{Check: check, Tag: tag, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(rawRec) < LEADER_LEN {
+		report(CheckRecordLength, "", "the record is %d bytes, shorter than a leader", len(rawRec))
+		return issues
+	}
+	leader := rawRec[:LEADER_LEN]
+
+	if recordLength, err := strconv.Atoi(string(leader[0:5])); err != nil {
+		report(CheckRecordLength, "", "leader/00-04 %q is not a number", leader[0:5])
+	} else if recordLength != len(rawRec) {
+		report(CheckRecordLength, "", "leader/00-04 is %d but the record is %d bytes", recordLength, len(rawRec))
+	}
+	dataEnd := len(rawRec)
+	if rawRec[len(rawRec)-1] == END_OF_RECORD {
+		dataEnd--
+	} else {
+		report(CheckTerminator, "", "the record does not end with a record terminator")
+	}
+	if dataEnd < LEADER_LEN {
+		report(CheckRecordLength, "", "the record is %d bytes, with no room for a record terminator after the leader", len(rawRec))
+		return issues
+	}
+	if string(leader[10:12]) != "22" {
+		report(CheckLeader, "", "leader/10-11 is %q instead of \"22\"", leader[10:12])
+	}
+	if string(leader[20:24]) != "4500" {
+		report(CheckLeader, "", "leader/20-23 is %q instead of \"4500\"", leader[20:24])
+	}
+
+	dirEnd := bytes.IndexByte(rawRec[LEADER_LEN:dataEnd], END_OF_FIELD)
+	if dirEnd < 0 {
+		report(CheckDirectory, "", "the directory has no field terminator")
+		return issues
+	}
+	dirEnd += LEADER_LEN
+	baseAddress := dirEnd + 1
+	if address, err := strconv.Atoi(string(leader[12:17])); err != nil {
+		report(CheckBaseAddress, "", "leader/12-16 %q is not a number", leader[12:17])
+	} else if address != baseAddress {
+		report(CheckBaseAddress, "", "leader/12-16 is %d but the directory ends at %d", address, baseAddress)
+	}
+
+	entries, err := scanDirectory(rawRec[LEADER_LEN:dirEnd])
+	if err != nil {
+		report(CheckDirectory, "", "%s", err)
+	}
+	if len(entries) == 0 {
+		report(CheckDirectory, "", "the directory is empty")
+		return issues
+	}
+
+	// the fields against their terminators
+	dataLen := dataEnd - baseAddress
+	for i, e := range entries {
+		if e.fieldLength < 0 || e.startingPosition < 0 {
+			report(CheckDirectory, e.tag, "entry %d %q is not numeric", i+1, rawRec[LEADER_LEN+i*DIRECTORY_ENTRY_LEN:LEADER_LEN+(i+1)*DIRECTORY_ENTRY_LEN])
+			continue
+		}
+		if e.fieldLength == 0 {
+			report(CheckField, e.tag, "the field length is 0")
+			continue
+		}
+		end := e.startingPosition + e.fieldLength
+		if end > dataLen {
+			report(CheckField, e.tag, "the field at %d with length %d runs past the end of the data (%d bytes)", e.startingPosition, e.fieldLength, dataLen)
+			continue
+		}
+		field := rawRec[baseAddress+e.startingPosition : baseAddress+end]
+		if field[len(field)-1] != END_OF_FIELD {
+			report(CheckField, e.tag, "the field at %d with length %d does not end with a field terminator", e.startingPosition, e.fieldLength)
+		} else if bytes.IndexByte(field[:len(field)-1], END_OF_FIELD) >= 0 {
+			report(CheckField, e.tag, "the field at %d with length %d holds more than one field", e.startingPosition, e.fieldLength)
+		}
+	}
+
+	// overlaps and gaps between the fields in the order of the data
+	placed := make([]structureEntry, 0, len(entries))
+	for _, e := range entries {
+		if e.fieldLength >= 0 && e.startingPosition >= 0 {
+			placed = append(placed, e)
+		}
+	}
+	sort.SliceStable(placed, func(i, j int) bool { return placed[i].startingPosition < placed[j].startingPosition })
+	next := 0
+	for i, e := range placed {
+		if e.startingPosition < next {
+			report(CheckLayout, e.tag, "the field at %d overlaps the %s before it by %d bytes", e.startingPosition, placed[i-1].tag, next-e.startingPosition)
+		} else if e.startingPosition > next {
+			report(CheckLayout, e.tag, "%d bytes before the field at %d are not in any field", e.startingPosition-next, e.startingPosition)
+		}
+		if end := e.startingPosition + e.fieldLength; end > next {
+			next = end
+		}
+	}
+	if next < dataLen {
+		report(CheckLayout, "", "%d bytes after the last field are not in any field", dataLen-next)
+	}
+
+	// the 001 at the base address
+	if entries[0].tag != "001" {
+		found := false
+		for _, e := range entries {
+			found = found || e.tag == "001"
+		}
+		if found {
+			report(CheckControlNumber, "001", "the 001 is not the first directory entry")
+		} else {
+			report(CheckControlNumber, "", "the record has no 001")
+		}
+	} else if entries[0].startingPosition > 0 {
+		report(CheckControlNumber, "001", "the 001 starts at %d instead of the base address", entries[0].startingPosition)
+	}
+
+	// the order of the directory
+	for i := 1; i < len(entries); i++ {
+		prev, e := entries[i-1].tag, entries[i].tag
+		if !directoryOrdered(prev, e) {
+			report(CheckOrder, e, "the directory entry %d comes after %s", i+1, prev)
+		}
+	}
+
+	return issues
+}
+
+// scanDirectory returns the entries of a directory without its field
+// terminator. It returns the whole entries with an error when the
+// directory is not a multiple of the entry length.
+func scanDirectory(dir []byte) ([]structureEntry, error) {
+	var entries []structureEntry
+	for i := 0; i+DIRECTORY_ENTRY_LEN <= len(dir); i += DIRECTORY_ENTRY_LEN {
+		entry := dir[i : i+DIRECTORY_ENTRY_LEN]
+		e := structureEntry{tag: string(entry[0:3]), fieldLength: -1, startingPosition: -1}
+		if n, err := strconv.Atoi(string(entry[3:7])); err == nil && n >= 0 {
+			e.fieldLength = n
+		}
+		if n, err := strconv.Atoi(string(entry[7:12])); err == nil && n >= 0 {
+			e.startingPosition = n
+		}
+		entries = append(entries, e)
+	}
+	if len(dir)%DIRECTORY_ENTRY_LEN != 0 {
+		return entries, fmt.Errorf("the directory is %d bytes, not a multiple of %d", len(dir), DIRECTORY_ENTRY_LEN)
+	}
+	return entries, nil
+}
+
+// directoryOrdered tells if the directory entry with tag may follow the
+// one with prev: the control fields come first in the order of their
+// tags, then the data fields in the order of the first digit of theirs.
+func directoryOrdered(prev, tag string) bool {
+	prevControl, _ := Tag(prev).IsControlTag()
+	control, _ := Tag(tag).IsControlTag()
+	switch {
+	case prevControl && control:
+		return prev <= tag
+	case prevControl:
+		return true
+	case control:
+		return false
+	}
+	return prev[0] <= tag[0]
+}
+
+// RepairStructure rebuilds the directory and the leader lengths of a raw
+// record from its data, taking the fields as they are delimited by the
+// field terminators. The tags are taken from the directory entries
+// starting at the fields or, when there are as many entries as fields,
+// from the entries in the order of their starting positions. The
+// directory is written in the order CheckStructure asks for and the
+// leader gets the record length, the base address, "22" and "4500".
+func RepairStructure(rawRec []byte) ([]byte, error) {
+	if len(rawRec) < LEADER_LEN {
+		return nil, errors.New("the record is shorter than a leader")
+	}
+	dataEnd := len(rawRec)
+	if rawRec[dataEnd-1] == END_OF_RECORD {
+		dataEnd--
+	}
+	if dataEnd < LEADER_LEN {
+		return nil, errors.New("the record has no room for a record terminator after the leader")
+	}
+	dirEnd := bytes.IndexByte(rawRec[LEADER_LEN:dataEnd], END_OF_FIELD)
+	if dirEnd < 0 {
+		return nil, errors.New("the directory has no field terminator")
+	}
+	dirEnd += LEADER_LEN
+	entries, _ := scanDirectory(rawRec[LEADER_LEN:dirEnd])
+
+	type field struct {
+		tag      string
+		position int
+		data     []byte
+	}
+	var fields []field
+	data := rawRec[dirEnd+1 : dataEnd]
+	for position := 0; position < len(data); {
+		end := bytes.IndexByte(data[position:], END_OF_FIELD)
+		if end < 0 {
+			// a last field without its terminator
+			end = len(data) - position
+		}
+		fields = append(fields, field{position: position, data: append(data[position:position+end:position+end], END_OF_FIELD)})
+		position += end + 1
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("the record has no fields")
+	}
+
+	if len(entries) == len(fields) {
+		sorted := append([]structureEntry(nil), entries...)
+		sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].startingPosition < sorted[j].startingPosition })
+		for i := range fields {
+			fields[i].tag = sorted[i].tag
+		}
+	} else {
+		for i, f := range fields {
+			for j, e := range entries {
+				if e.startingPosition == f.position {
+					fields[i].tag = e.tag
+					entries[j].startingPosition = -1
+					break
+				}
+			}
+			if fields[i].tag == "" {
+				return nil, fmt.Errorf("no directory entry for the field at %d", f.position)
+			}
+		}
+	}
+	for _, f := range fields {
+		if _, err := NewTag([]byte(f.tag)); err != nil {
+			return nil, fmt.Errorf("invalid tag %q for the field at %d", f.tag, f.position)
+		}
+	}
+	sort.SliceStable(fields, func(i, j int) bool {
+		return directoryOrdered(fields[i].tag, fields[j].tag) && !directoryOrdered(fields[j].tag, fields[i].tag)
+	})
+
+	var dir, body bytes.Buffer
+	for _, f := range fields {
+		if len(f.data) > 9999 {
+			return nil, fmt.Errorf("field %s is too long (%d bytes)", f.tag, len(f.data))
+		}
+		fmt.Fprintf(&dir, "%s%04d%05d", f.tag, len(f.data), body.Len())
+		body.Write(f.data)
+	}
+	dir.WriteByte(END_OF_FIELD)
+
+	baseAddress := LEADER_LEN + dir.Len()
+	recordLength := baseAddress + body.Len() + 1
+	if recordLength > MAX_RECORD_LEN {
+		return nil, errors.New("MARC record is too long")
+	}
+	leader := append([]byte(nil), rawRec[:LEADER_LEN]...)
+	copy(leader[0:5], fmt.Sprintf("%05d", recordLength))
+	copy(leader[10:12], "22")
+	copy(leader[12:17], fmt.Sprintf("%05d", baseAddress))
+	copy(leader[20:24], "4500")
+
+	repaired := make([]byte, 0, recordLength)
+	repaired = append(repaired, leader...)
+	repaired = append(repaired, dir.Bytes()...)
+	repaired = append(repaired, body.Bytes()...)
+	repaired = append(repaired, END_OF_RECORD)
+	return repaired, nil
+}
@@ -0,0 +1,126 @@
+package gomarc21
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCheckStructure(test *testing.T) {
+	data, err := os.ReadFile("data/test_10.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+	var raws [][]byte
+	reader := bufio.NewReader(bytes.NewReader(data))
+	for {
+		rawRec, err := NextTerminatedRecord(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			test.Fatal(err)
+		}
+		raws = append(raws, rawRec)
+	}
+	if len(raws) != 10 {
+		test.Fatal("wrong records", len(raws))
+	}
+	for i, rawRec := range raws {
+		if issues := CheckStructure(rawRec); len(issues) != 0 {
+			test.Errorf("record %d: unexpected issues %v", i+1, issues)
+		}
+	}
+
+	checks := func(issues []StructureIssue) string {
+		var checks []string
+		for _, issue := range issues {
+			checks = append(checks, issue.Check)
+		}
+		return strings.Join(checks, " ")
+	}
+	rawRec := raws[0]
+	dirEntry := func(corrupted []byte, i int) []byte {
+		return corrupted[LEADER_LEN+i*DIRECTORY_ENTRY_LEN : LEADER_LEN+(i+1)*DIRECTORY_ENTRY_LEN]
+	}
+	shift := func(digits []byte, delta int) {
+		n, _ := strconv.Atoi(string(digits))
+		copy(digits, fmt.Sprintf("%0*d", len(digits), n+delta))
+	}
+	for name, c := range map[string]struct {
+		corrupt  func(corrupted []byte) []byte
+		expected string
+	}{
+		"record length": {func(corrupted []byte) []byte { copy(corrupted, "00999"); return corrupted }, "record-length"},
+		"base address":  {func(corrupted []byte) []byte { corrupted[16]++; return corrupted }, "base-address"},
+		"leader/20-23":  {func(corrupted []byte) []byte { copy(corrupted[20:], "0000"); return corrupted }, "leader"},
+		"field length": {func(corrupted []byte) []byte { shift(dirEntry(corrupted, 2)[3:7], 1); return corrupted },
+			"field layout"},
+		"gap": {func(corrupted []byte) []byte {
+			shift(dirEntry(corrupted, 2)[3:7], -1)
+			shift(dirEntry(corrupted, 2)[7:12], 1)
+			return corrupted
+		}, "layout"},
+		"order": {func(corrupted []byte) []byte {
+			first := append([]byte(nil), dirEntry(corrupted, 0)...)
+			copy(dirEntry(corrupted, 0), dirEntry(corrupted, 1))
+			copy(dirEntry(corrupted, 1), first)
+			return corrupted
+		}, "control-number order"},
+		"terminator": {func(corrupted []byte) []byte { return corrupted[:len(corrupted)-1] }, "record-length terminator"},
+	} {
+		corrupted := c.corrupt(append([]byte(nil), rawRec...))
+		issues := CheckStructure(corrupted)
+		if got := checks(issues); got != c.expected {
+			test.Errorf("%s: expected %q, got %v", name, c.expected, issues)
+		}
+		repaired, err := RepairStructure(corrupted)
+		if err != nil {
+			test.Errorf("%s: %s", name, err)
+			continue
+		}
+		if issues := CheckStructure(repaired); len(issues) != 0 {
+			test.Errorf("%s: the repaired record has issues %v", name, issues)
+		}
+		if name != "leader/20-23" && !bytes.Equal(repaired, rawRec) {
+			test.Errorf("%s: wrong repaired record\n%q", name, repaired)
+		}
+	}
+
+	// a wrong record length does not throw off the next records
+	corrupted := append([]byte(nil), data...)
+	copy(corrupted, "00100")
+	reader = bufio.NewReader(bytes.NewReader(corrupted))
+	count := 0
+	for {
+		rawRec, err := NextTerminatedRecord(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			test.Fatal(err)
+		}
+		if count++; count > 1 && len(CheckStructure(rawRec)) != 0 {
+			test.Errorf("record %d: unexpected issues", count)
+		}
+	}
+	if count != 10 {
+		test.Error("wrong records", count)
+	}
+
+	for _, rawRec := range [][]byte{[]byte("00010nam"), []byte("00030nam a2200025 i 4500abc\x1d"), []byte("00000000000000000000000\x1d")} {
+		if _, err := RepairStructure(rawRec); err == nil {
+			test.Errorf("%q: expected an error", rawRec)
+		}
+	}
+
+	// a leader that ends with the record terminator
+	if got := checks(CheckStructure([]byte("00000000000000000000000\x1d"))); !strings.Contains(got, CheckRecordLength) {
+		test.Errorf("expected a record-length issue, got %q", got)
+	}
+}
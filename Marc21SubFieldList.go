@@ -24,7 +24,7 @@ func (sf SubField) GetValue() string {
 
 // GetText returns the text for the subfield
 func (sf SubField) AsJson() string {
-	return fmt.Sprintf("{ \"%s\": \"%s\"}", sf.Code, sf.Data)
+	return fmt.Sprintf("{ %s: %s}", jsonString(sf.Code), jsonString(sf.Data))
 }
 func (sf SubField) AddSubField(Code string, Value string) {
 }
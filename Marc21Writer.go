@@ -0,0 +1,310 @@
+package gomarc21
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Output and input formats of records.
+const (
+	FormatMarc      = "marc"      // ISO 2709 binary MARC
+	FormatXml       = "xml"       // MARCXML (MARC21slim)
+	FormatJson      = "json"      // one JSON record per line
+	FormatJsonArray = "jsonarray" // JSON array of records, output only
+	FormatMrk       = "mrk"       // MARCMaker mnemonic text
+	FormatDc        = "dc"        // Dublin Core (oai_dc), output only
+	FormatDcJson    = "dcjson"    // Dublin Core, one JSON object per line, output only
+	FormatMods      = "mods"      // MODS 3.7, output only
+	FormatNt        = "nt"        // BIBFRAME 2.0 in N-Triples, output only
+	FormatTurtle    = "ttl"       // BIBFRAME 2.0 in Turtle, output only
+	FormatJsonLd    = "jsonld"    // BIBFRAME 2.0, one JSON-LD document per line, output only
+	FormatBibtex    = "bibtex"    // BibTeX entries, output only
+	FormatRis       = "ris"       // RIS tagged records, output only
+	FormatCsl       = "csljson"   // CSL-JSON array of items, output only
+)
+
+const (
+	CollectionXmlHeader = "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<collection xmlns=\"http://www.loc.gov/MARC21/slim\">\n"
+	CollectionXmlFooter = "</collection>\n"
+	DcCollectionHeader  = "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<collection>\n"
+)
+
+// writerEnvelopes holds what goes before and after the records of the
+// formats that wrap them in a document element.
+var writerEnvelopes = map[string][2]string{
+	FormatXml:       {CollectionXmlHeader, CollectionXmlFooter},
+	FormatDc:        {DcCollectionHeader, CollectionXmlFooter},
+	FormatMods:      {ModsCollectionHeader, ModsCollectionFooter},
+	FormatCsl:       {"[\n", "\n]\n"},
+	FormatJsonArray: {"[\n", "\n]\n"},
+}
+
+// FormatFromName returns the record format implied by the extension of a
+// file name, ignoring any compression extension. It returns an empty
+// string when the extension is unknown.
+func FormatFromName(name string) string {
+	switch strings.ToLower(filepath.Ext(TrimCompressionExt(name))) {
+	case ".mrc", ".marc", ".dat":
+		return FormatMarc
+	case ".xml":
+		return FormatXml
+	case ".json", ".jsonl":
+		return FormatJson
+	case ".mrk", ".txt":
+		return FormatMrk
+	case ".nt":
+		return FormatNt
+	case ".ttl":
+		return FormatTurtle
+	case ".jsonld":
+		return FormatJsonLd
+	case ".bib":
+		return FormatBibtex
+	case ".ris":
+		return FormatRis
+	}
+	return ""
+}
+
+// RecordAsMarc returns the record in ISO 2709 binary MARC. The record
+// length, base address of data and directory are computed from the
+// fields, so the record does not need to come from a parsed file.
+func (rec Record) RecordAsMarc() ([]byte, error) {
+	var dir, data bytes.Buffer
+
+	addEntry := func(tag Tag, field []byte) error {
+		if len(tag) != 3 {
+			return fmt.Errorf("invalid tag %q", tag)
+		}
+		if len(field) > 9999 {
+			return fmt.Errorf("field %s is too long (%d bytes)", tag, len(field))
+		}
+		fmt.Fprintf(&dir, "%s%04d%05d", tag, len(field), data.Len())
+		data.Write(field)
+		return nil
+	}
+
+	for _, cf := range rec.ControlFields {
+		field := append([]byte(cf.Data), END_OF_FIELD)
+		if err := addEntry(cf.Tag, field); err != nil {
+			return nil, err
+		}
+	}
+	for _, df := range rec.DataFields {
+		var field bytes.Buffer
+		field.WriteString(df.GetIndicator1())
+		field.WriteString(df.GetIndicator2())
+		for _, sf := range df.SubFields {
+			field.WriteByte(SUBFIELD_INDICATOR)
+			field.WriteString(sf.Code)
+			field.WriteString(sf.Data)
+		}
+		field.WriteByte(END_OF_FIELD)
+		if err := addEntry(df.Tag, field.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	dir.WriteByte(END_OF_FIELD)
+
+	baseAddress := LEADER_LEN + dir.Len()
+	recordLength := baseAddress + data.Len() + 1
+	if recordLength > MAX_RECORD_LEN {
+		return nil, errors.New("MARC record is too long")
+	}
+
+	leader := []byte(rec.Leader.GetRaw())
+	if len(leader) != LEADER_LEN {
+		leader = []byte("     nam a22     uu 4500")
+	}
+	copy(leader[0:5], fmt.Sprintf("%05d", recordLength))
+	copy(leader[10:12], "22")
+	copy(leader[12:17], fmt.Sprintf("%05d", baseAddress))
+	copy(leader[20:24], "4500")
+
+	rawRec := make([]byte, 0, recordLength)
+	rawRec = append(rawRec, leader...)
+	rawRec = append(rawRec, dir.Bytes()...)
+	rawRec = append(rawRec, data.Bytes()...)
+	rawRec = append(rawRec, END_OF_RECORD)
+	return rawRec, nil
+}
+
+// Writer writes records to a stream in one of the record formats, taking
+// care of what goes before and after the records (e.g. the MARCXML
+// collection element).
+type Writer struct {
+	writer  io.Writer
+	format  string
+	started bool
+	count   int
+
+	// keys are the BibTeX citation keys written so far
+	keys map[string]bool
+
+	// BaseIri is the base of the IRIs minted for the BIBFRAME formats.
+	// DefaultBaseIri is used when it is empty.
+	BaseIri string
+}
+
+// NewWriter returns a Writer writing records in format to writer.
+func NewWriter(writer io.Writer, format string) (*Writer, error) {
+	switch format {
+	case FormatMarc, FormatXml, FormatJson, FormatMrk, FormatDc, FormatDcJson, FormatMods,
+		FormatNt, FormatTurtle, FormatJsonLd, FormatBibtex, FormatRis, FormatCsl, FormatJsonArray:
+	default:
+		return nil, fmt.Errorf("unsupported output format %q", format)
+	}
+	return &Writer{writer: writer, format: format}, nil
+}
+
+// Write writes a single record.
+func (w *Writer) Write(rec Record) error {
+	if !w.started {
+		if err := w.writeHeader(); err != nil {
+			return err
+		}
+	}
+
+	var out []byte
+	switch w.format {
+	case FormatMarc:
+		b, err := rec.RecordAsMarc()
+		if err != nil {
+			return err
+		}
+		out = b
+	case FormatXml:
+		str, err := rec.RecordAsXml()
+		if err != nil {
+			return err
+		}
+		out = []byte(str + "\n")
+	case FormatJson:
+		str, err := rec.RecordAsJson()
+		if err != nil {
+			return err
+		}
+		out = []byte(str + "\n")
+	case FormatJsonArray:
+		str, err := rec.RecordAsJson()
+		if err != nil {
+			return err
+		}
+		if w.count > 0 {
+			str = ",\n" + str
+		}
+		out = []byte(str)
+	case FormatMrk:
+		str, err := rec.RecordAsMrk()
+		if err != nil {
+			return err
+		}
+		out = []byte(str + "\n")
+	case FormatDc:
+		str, err := rec.RecordAsDcXml()
+		if err != nil {
+			return err
+		}
+		out = []byte(str + "\n")
+	case FormatDcJson:
+		str, err := rec.RecordAsDcJson()
+		if err != nil {
+			return err
+		}
+		out = []byte(str + "\n")
+	case FormatMods:
+		str, err := rec.RecordAsMods()
+		if err != nil {
+			return err
+		}
+		out = []byte(str + "\n")
+	case FormatNt, FormatTurtle, FormatJsonLd:
+		g, err := rec.Bibframe(w.BaseIri)
+		if err != nil {
+			return err
+		}
+		switch w.format {
+		case FormatNt:
+			out = []byte(g.AsNTriples())
+		case FormatTurtle:
+			out = []byte(g.TurtleStatements())
+		default:
+			str, err := g.AsJsonLd()
+			if err != nil {
+				return err
+			}
+			out = []byte(str + "\n")
+		}
+	case FormatBibtex:
+		c := rec.Citation()
+		out = []byte(c.bibtexEntry(w.uniqueKey(c.Key())) + "\n")
+	case FormatRis:
+		str, err := rec.RecordAsRis()
+		if err != nil {
+			return err
+		}
+		out = []byte(str + "\r\n")
+	case FormatCsl:
+		str, err := rec.RecordAsCslJson()
+		if err != nil {
+			return err
+		}
+		if w.count > 0 {
+			// the items are elements of a single JSON array
+			str = ",\n" + str
+		}
+		out = []byte(str)
+	}
+	w.count++
+	_, err := w.writer.Write(out)
+	return err
+}
+
+// uniqueKey returns key, with a suffix (a, b, c...) when a citation with
+// the same key was written before, so that the keys of a BibTeX file are
+// unique.
+func (w *Writer) uniqueKey(key string) string {
+	if w.keys == nil {
+		w.keys = map[string]bool{}
+	}
+	unique := key
+	for n := 1; w.keys[unique]; n++ {
+		unique = key + keySuffix(n)
+	}
+	w.keys[unique] = true
+	return unique
+}
+
+func (w *Writer) writeHeader() error {
+	w.started = true
+	if w.format == FormatTurtle {
+		// the prefixes are the same for every record, so they are written once
+		_, err := io.WriteString(w.writer, newBibframeGraph().TurtlePrefixes()+"\n")
+		return err
+	}
+	envelope, ok := writerEnvelopes[w.format]
+	if !ok {
+		return nil
+	}
+	_, err := io.WriteString(w.writer, envelope[0])
+	return err
+}
+
+// Close finishes the output. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	envelope, ok := writerEnvelopes[w.format]
+	if !ok {
+		return nil
+	}
+	if !w.started {
+		if err := w.writeHeader(); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w.writer, envelope[1])
+	return err
+}
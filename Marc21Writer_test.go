@@ -0,0 +1,89 @@
+package gomarc21
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRecordAsMarc(test *testing.T) {
+	data, err := os.Open("data/test_10.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer data.Close()
+
+	for {
+		rawRec, err := NextRecord(data)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			test.Fatal(err)
+		}
+		rec, err := ParseRecord(rawRec)
+		if err != nil {
+			test.Fatal(err)
+		}
+		b, err := rec.RecordAsMarc()
+		if err != nil {
+			test.Fatal(err)
+		}
+		if !bytes.Equal(b, rawRec) {
+			test.Errorf("%s: RecordAsMarc should reproduce the original record\n%q\n%q", rec.ControlNum(), rawRec, b)
+		}
+	}
+}
+
+func TestWriter(test *testing.T) {
+	data, err := os.Open("data/test_1a.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer data.Close()
+	rec, err := ParseNextRecord(data)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, FormatXml)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if err := w.Write(rec); err != nil {
+		test.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		test.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, CollectionXmlHeader) || !strings.HasSuffix(out, CollectionXmlFooter) {
+		test.Error("the xml output should be wrapped in a collection", out)
+	}
+	if strings.Count(out, "<record>") != 1 {
+		test.Error("the xml output should contain one record", out)
+	}
+
+	if _, err := NewWriter(&buf, "csv"); err == nil {
+		test.Error("unsupported format should be rejected")
+	}
+}
+
+func TestFormatFromName(test *testing.T) {
+	names := map[string]string{
+		"in.mrc":      FormatMarc,
+		"in.mrc.gz":   FormatMarc,
+		"out.xml.bz2": FormatXml,
+		"out.json":    FormatJson,
+		"out.mrk.zst": FormatMrk,
+		"out.pdf":     "",
+	}
+	for name, format := range names {
+		if FormatFromName(name) != format {
+			test.Errorf("%s should be %q, but got %q", name, format, FormatFromName(name))
+		}
+	}
+}
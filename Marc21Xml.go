@@ -2,7 +2,6 @@ package gomarc21
 
 import (
 	"encoding/xml"
-	"fmt"
 )
 
 func (record Record) RecordAsXml() (string, error) {
@@ -13,7 +12,6 @@ func (record Record) RecordAsXml() (string, error) {
 	}
 
 	b, err := xml.MarshalIndent(x, "", "")
-	fmt.Print(string(b))
 
 	return string(b), err
 }
@@ -0,0 +1,591 @@
+package gomarc21
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+source: https://www.loc.gov/z3950/agency/markup/markup.html
+
+    Z39.50 is a session protocol over TCP whose PDUs are BER encoded (see
+    Marc21Ber.go). A client initializes the association, searches a
+    database, which makes a result set, and presents records of the
+    result set:
+
+    client, err := DialZ3950("z3950.loc.gov:7090", Z3950Config{Database: "Voyager"})
+    count, err := client.Search(`@attr 1=7 0306406152`)
+    recs, err := client.Present(1, 10)
+
+Queries are type-1 (RPN) queries of the Bib-1 attribute set, written in
+the prefix query format (PQF) of YAZ:
+
+    @attr 1=4 "aviation security"
+    @and @attr 1=1003 swanson @attr 1=4 @attr 5=1 coal
+    @or @attr 1=7 0306406152 @attr 1=8 1234-5678
+
+An attribute is a type and a value: the use attribute (type 1) is the
+index, 2 the relation, 3 the position, 4 the structure, 5 the truncation
+and 6 the completeness. Records are requested in USMARC.
+*/
+
+// Z39.50 object identifiers.
+const (
+	Z3950Bib1AttributeSet  = "1.2.840.10003.3.1"
+	Z3950Bib1DiagnosticSet = "1.2.840.10003.4.1"
+	Z3950UsMarcSyntax      = "1.2.840.10003.5.10"
+)
+
+// Bib-1 attribute types.
+const (
+	Bib1Use          = 1
+	Bib1Relation     = 2
+	Bib1Position     = 3
+	Bib1Structure    = 4
+	Bib1Truncation   = 5
+	Bib1Completeness = 6
+)
+
+// Bib-1 use attributes.
+const (
+	Bib1PersonalName = 1
+	Bib1Title        = 4
+	Bib1Isbn         = 7
+	Bib1Issn         = 8
+	Bib1Lccn         = 9
+	Bib1LocalNumber  = 12
+	Bib1Subject      = 21
+	Bib1Date         = 31
+	Bib1Language     = 54
+	Bib1Author       = 1003
+	Bib1Any          = 1016
+	Bib1Publisher    = 1018
+)
+
+// Bib-1 diagnostic conditions.
+const (
+	Bib1PermanentError             = 1
+	Bib1PresentOutOfRange          = 13
+	Bib1NoSuchResultSet            = 30
+	Bib1UnsupportedQueryType       = 107
+	Bib1MalformedQuery             = 108
+	Bib1DatabaseUnavailable        = 109
+	Bib1UnsupportedBooleanOperator = 110
+	Bib1UnsupportedAttributeType   = 113
+	Bib1UnsupportedUse             = 114
+	Bib1UnsupportedRelation        = 117
+	Bib1UnsupportedStructure       = 118
+	Bib1UnsupportedTruncation      = 120
+	Bib1UnsupportedAttributeSet    = 121
+	Bib1UnsupportedCompleteness    = 122
+	Bib1UnsupportedRecordSyntax    = 239
+)
+
+// Z39.50 PDUs, of the context class.
+const (
+	z3950InitRequest     = 20
+	z3950InitResponse    = 21
+	z3950SearchRequest   = 22
+	z3950SearchResponse  = 23
+	z3950PresentRequest  = 24
+	z3950PresentResponse = 25
+	z3950Close           = 48
+)
+
+const (
+	z3950ResultSet   = "default"
+	z3950MessageSize = 1 << 20
+)
+
+// Z3950Diagnostic is a diagnostic of a target.
+type Z3950Diagnostic struct {
+	Condition int
+	AddInfo   string
+}
+
+func (d *Z3950Diagnostic) Error() string {
+	if d.AddInfo == "" {
+		return fmt.Sprintf("Z39.50 diagnostic %d", d.Condition)
+	}
+	return fmt.Sprintf("Z39.50 diagnostic %d: %s", d.Condition, d.AddInfo)
+}
+
+// ber returns the DefaultDiagFormat of a diagnostic.
+func (d *Z3950Diagnostic) ber() *berValue {
+	return berSequenceOf(
+		berOidValue(Z3950Bib1DiagnosticSet),
+		&berValue{Class: berUniversal, Tag: berInteger, Data: berIntData(d.Condition)},
+		&berValue{Class: berUniversal, Tag: berGeneral, Data: []byte(d.AddInfo)})
+}
+
+// parseZ3950Diagnostic decodes a DefaultDiagFormat.
+func parseZ3950Diagnostic(v *berValue) *Z3950Diagnostic {
+	d := &Z3950Diagnostic{Condition: Bib1PermanentError}
+	if condition := v.Child(berUniversal, berInteger); condition != nil {
+		d.Condition = condition.Int()
+	}
+	for _, child := range v.Children {
+		if child.Class == berUniversal && (child.Tag == berVisible || child.Tag == berGeneral) {
+			d.AddInfo = string(child.Data)
+		}
+	}
+	return d
+}
+
+// Z3950Attribute is an attribute of a term.
+type Z3950Attribute struct {
+	Type  int
+	Value int
+}
+
+// Z3950Query is a node of a type-1 query: either a boolean of two
+// queries or a term and its attributes.
+type Z3950Query struct {
+	Operator string // and, or or not; empty for a term
+	Left     *Z3950Query
+	Right    *Z3950Query
+
+	Attributes []Z3950Attribute
+	Term       string
+}
+
+// Attribute returns the value of an attribute type of a term, or 0.
+func (q *Z3950Query) Attribute(attributeType int) int {
+	for _, attribute := range q.Attributes {
+		if attribute.Type == attributeType {
+			return attribute.Value
+		}
+	}
+	return 0
+}
+
+// String returns the query in PQF.
+func (q *Z3950Query) String() string {
+	if q.Operator != "" {
+		return "@" + q.Operator + " " + q.Left.String() + " " + q.Right.String()
+	}
+	var b strings.Builder
+	for _, attribute := range q.Attributes {
+		fmt.Fprintf(&b, "@attr %d=%d ", attribute.Type, attribute.Value)
+	}
+	if q.Term == "" || strings.ContainsAny(q.Term, " \t\"@") {
+		b.WriteString(strconv.Quote(q.Term))
+	} else {
+		b.WriteString(q.Term)
+	}
+	return b.String()
+}
+
+// ParsePqf parses a query in the prefix query format. Its errors are
+// *Z3950Diagnostic.
+func ParsePqf(pqf string) (*Z3950Query, error) {
+	tokens, err := lexPqf(pqf)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) >= 2 && tokens[0] == "@attrset" {
+		if !strings.EqualFold(tokens[1], "bib-1") && tokens[1] != Z3950Bib1AttributeSet {
+			return nil, &Z3950Diagnostic{Condition: Bib1UnsupportedAttributeSet, AddInfo: tokens[1]}
+		}
+		tokens = tokens[2:]
+	}
+	q, rest, err := parsePqf(tokens)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, &Z3950Diagnostic{Condition: Bib1MalformedQuery, AddInfo: "unexpected " + rest[0]}
+	}
+	return q, nil
+}
+
+// lexPqf splits a query in words and quoted strings, which keep their
+// quotes.
+func lexPqf(pqf string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(pqf); {
+		switch {
+		case pqf[i] == ' ' || pqf[i] == '\t' || pqf[i] == '\n' || pqf[i] == '\r':
+			i++
+		case pqf[i] == '"':
+			end := i + 1
+			for end < len(pqf) && pqf[end] != '"' {
+				if pqf[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(pqf) {
+				return nil, &Z3950Diagnostic{Condition: Bib1MalformedQuery, AddInfo: "unterminated string"}
+			}
+			tokens = append(tokens, pqf[i:end+1])
+			i = end + 1
+		default:
+			end := i
+			for end < len(pqf) && !strings.ContainsRune(" \t\n\r\"", rune(pqf[end])) {
+				end++
+			}
+			tokens = append(tokens, pqf[i:end])
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+func parsePqf(tokens []string) (*Z3950Query, []string, error) {
+	if len(tokens) == 0 {
+		return nil, nil, &Z3950Diagnostic{Condition: Bib1MalformedQuery, AddInfo: "missing term"}
+	}
+	switch tokens[0] {
+	case "@and", "@or", "@not":
+		left, rest, err := parsePqf(tokens[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		right, rest, err := parsePqf(rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &Z3950Query{Operator: tokens[0][1:], Left: left, Right: right}, rest, nil
+	case "@prox":
+		return nil, nil, &Z3950Diagnostic{Condition: Bib1UnsupportedBooleanOperator, AddInfo: "prox"}
+	}
+
+	q := &Z3950Query{}
+	for len(tokens) > 0 && tokens[0] == "@attr" {
+		if len(tokens) < 2 {
+			return nil, nil, &Z3950Diagnostic{Condition: Bib1MalformedQuery, AddInfo: "missing attribute"}
+		}
+		attribute := tokens[1]
+		tokens = tokens[2:]
+		if !strings.Contains(attribute, "=") && len(tokens) > 0 {
+			// an attribute set before the attribute
+			if !strings.EqualFold(attribute, "bib-1") && attribute != Z3950Bib1AttributeSet {
+				return nil, nil, &Z3950Diagnostic{Condition: Bib1UnsupportedAttributeSet, AddInfo: attribute}
+			}
+			attribute = tokens[0]
+			tokens = tokens[1:]
+		}
+		name, value, _ := strings.Cut(attribute, "=")
+		attributeType, errType := strconv.Atoi(name)
+		attributeValue, errValue := strconv.Atoi(value)
+		if errType != nil || errValue != nil {
+			return nil, nil, &Z3950Diagnostic{Condition: Bib1MalformedQuery, AddInfo: "invalid attribute " + attribute}
+		}
+		q.Attributes = append(q.Attributes, Z3950Attribute{Type: attributeType, Value: attributeValue})
+	}
+	if len(tokens) == 0 || (strings.HasPrefix(tokens[0], "@") && len(tokens[0]) > 1) {
+		return nil, nil, &Z3950Diagnostic{Condition: Bib1MalformedQuery, AddInfo: "missing term"}
+	}
+	q.Term = tokens[0]
+	if strings.HasPrefix(q.Term, `"`) {
+		term, err := strconv.Unquote(q.Term)
+		if err != nil {
+			term = strings.Trim(q.Term, `"`)
+		}
+		q.Term = term
+	}
+	return q, tokens[1:], nil
+}
+
+// ber returns the RPNStructure of a query.
+func (q *Z3950Query) ber() *berValue {
+	if q.Operator != "" {
+		operators := map[string]int{"and": 0, "or": 1, "not": 2}
+		return berConstructed(1, q.Left.ber(), q.Right.ber(),
+			berConstructed(46, berPrimitive(operators[q.Operator], nil)))
+	}
+	attributes := berConstructed(44)
+	for _, attribute := range q.Attributes {
+		attributes.Children = append(attributes.Children,
+			berSequenceOf(berInt(120, attribute.Type), berInt(121, attribute.Value)))
+	}
+	return berConstructed(0, berConstructed(102, attributes, berString(45, q.Term)))
+}
+
+// parseRpn decodes an RPNStructure.
+func parseRpn(v *berValue) (*Z3950Query, error) {
+	malformed := &Z3950Diagnostic{Condition: Bib1MalformedQuery}
+	switch {
+	case v.Is(berContext, 1):
+		if len(v.Children) != 3 || !v.Children[2].Is(berContext, 46) || len(v.Children[2].Children) != 1 {
+			return nil, malformed
+		}
+		operator := v.Children[2].Children[0]
+		q := &Z3950Query{}
+		switch {
+		case operator.Is(berContext, 0):
+			q.Operator = "and"
+		case operator.Is(berContext, 1):
+			q.Operator = "or"
+		case operator.Is(berContext, 2):
+			q.Operator = "not"
+		default:
+			return nil, &Z3950Diagnostic{Condition: Bib1UnsupportedBooleanOperator, AddInfo: "prox"}
+		}
+		var err error
+		if q.Left, err = parseRpn(v.Children[0]); err != nil {
+			return nil, err
+		}
+		if q.Right, err = parseRpn(v.Children[1]); err != nil {
+			return nil, err
+		}
+		return q, nil
+	case v.Is(berContext, 0) && len(v.Children) == 1:
+		operand := v.Children[0]
+		if !operand.Is(berContext, 102) {
+			return nil, &Z3950Diagnostic{Condition: Bib1UnsupportedQueryType, AddInfo: "operand"}
+		}
+		q := &Z3950Query{}
+		if attributes := operand.Context(44); attributes != nil {
+			for _, element := range attributes.Children {
+				attributeType, value := element.Context(120), element.Context(121)
+				if attributeType == nil || value == nil {
+					return nil, &Z3950Diagnostic{Condition: Bib1UnsupportedAttributeType, AddInfo: "complex attribute"}
+				}
+				if set := element.Context(1); set != nil && set.Oid() != Z3950Bib1AttributeSet {
+					return nil, &Z3950Diagnostic{Condition: Bib1UnsupportedAttributeSet, AddInfo: set.Oid()}
+				}
+				q.Attributes = append(q.Attributes, Z3950Attribute{Type: attributeType.Int(), Value: value.Int()})
+			}
+		}
+		term := operand.Context(45)
+		if term == nil {
+			return nil, malformed
+		}
+		q.Term = string(term.Data)
+		return q, nil
+	}
+	return nil, malformed
+}
+
+// Z3950Config configures a Z3950Client.
+type Z3950Config struct {
+	Database string // Default when empty
+	User     string
+	Password string
+	// Timeout limits each request; 30 seconds when zero.
+	Timeout time.Duration
+}
+
+// Z3950Client is an association with a Z39.50 target.
+type Z3950Client struct {
+	Config Z3950Config
+	// ImplementationName is the name of the target software.
+	ImplementationName string
+
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// DialZ3950 connects to a target at host:port and initializes the
+// association.
+func DialZ3950(address string, config Z3950Config) (*Z3950Client, error) {
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewZ3950Client(conn, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewZ3950Client initializes an association over a connection.
+func NewZ3950Client(conn net.Conn, config Z3950Config) (*Z3950Client, error) {
+	if config.Database == "" {
+		config.Database = "Default"
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+	c := &Z3950Client{Config: config, conn: conn, reader: bufio.NewReader(conn)}
+
+	init := berConstructed(z3950InitRequest,
+		berBits(3, 3, 0, 1, 2), // versions 1 to 3
+		berBits(4, 2, 0, 1),    // search and present
+		berInt(5, z3950MessageSize),
+		berInt(6, z3950MessageSize))
+	if config.Password != "" {
+		init.Children = append(init.Children, berConstructed(7,
+			berConstructed(0, berString(1, config.User), berString(2, config.Password))))
+	} else if config.User != "" {
+		init.Children = append(init.Children, berConstructed(7,
+			&berValue{Class: berUniversal, Tag: berVisible, Data: []byte(config.User)}))
+	}
+	init.Children = append(init.Children, berString(111, "gomarc21"), berString(112, Version.String()))
+
+	response, err := c.request(init, z3950InitResponse)
+	if err != nil {
+		return nil, err
+	}
+	if name := response.Context(111); name != nil {
+		c.ImplementationName = string(name.Data)
+	}
+	if result := response.Context(12); result == nil || !result.Bool() {
+		return nil, fmt.Errorf("Z39.50 initialization refused by %s", conn.RemoteAddr())
+	}
+	return c, nil
+}
+
+// request sends a PDU and reads the response, which must be the PDU of a
+// tag.
+func (c *Z3950Client) request(pdu *berValue, tag int) (*berValue, error) {
+	c.conn.SetDeadline(time.Now().Add(c.Config.Timeout))
+	defer c.conn.SetDeadline(time.Time{})
+	if _, err := c.conn.Write(pdu.Encode()); err != nil {
+		return nil, err
+	}
+	response, err := readBer(c.reader)
+	if err != nil {
+		return nil, err
+	}
+	if response.Is(berContext, z3950Close) {
+		reason := -1
+		if closeReason := response.Context(211); closeReason != nil {
+			reason = closeReason.Int()
+		}
+		return nil, fmt.Errorf("Z39.50 association closed by the target (reason %d)", reason)
+	}
+	if !response.Is(berContext, tag) {
+		return nil, fmt.Errorf("Z39.50 unexpected PDU %d, expected %d", response.Tag, tag)
+	}
+	return response, nil
+}
+
+// Search searches the database with a PQF query and returns the number
+// of records found, which make the result set of Present.
+func (c *Z3950Client) Search(pqf string) (int, error) {
+	q, err := ParsePqf(pqf)
+	if err != nil {
+		return 0, err
+	}
+	return c.SearchQuery(q)
+}
+
+// SearchQuery searches the database with a query.
+func (c *Z3950Client) SearchQuery(q *Z3950Query) (int, error) {
+	search := berConstructed(z3950SearchRequest,
+		berInt(13, 0), // no records in the response
+		berInt(14, 1),
+		berInt(15, 0),
+		berBool(16, true),
+		berString(17, z3950ResultSet),
+		berConstructed(18, berString(105, c.Config.Database)),
+		&berValue{Class: berContext, Tag: 104, Data: berOidValue(Z3950UsMarcSyntax).Data},
+		berConstructed(21, berConstructed(1, berOidValue(Z3950Bib1AttributeSet), q.ber())))
+	response, err := c.request(search, z3950SearchResponse)
+	if err != nil {
+		return 0, err
+	}
+	if diagnostic := z3950Diagnostic(response); diagnostic != nil {
+		return 0, diagnostic
+	}
+	if status := response.Context(22); status != nil && !status.Bool() {
+		return 0, &Z3950Diagnostic{Condition: Bib1PermanentError, AddInfo: "search failed"}
+	}
+	count := response.Context(23)
+	if count == nil {
+		return 0, fmt.Errorf("Z39.50 search response without result count")
+	}
+	return count.Int(), nil
+}
+
+// z3950Diagnostic returns the non-surrogate diagnostic of a response, or
+// nil.
+func z3950Diagnostic(response *berValue) *Z3950Diagnostic {
+	if diagnostic := response.Context(130); diagnostic != nil {
+		return parseZ3950Diagnostic(diagnostic)
+	}
+	if diagnostics := response.Context(205); diagnostics != nil && len(diagnostics.Children) > 0 {
+		return parseZ3950Diagnostic(diagnostics.Children[0])
+	}
+	return nil
+}
+
+// Present returns count records of the result set of the last search,
+// from the position start (the first is 1). A record the target could
+// not return is reported by an error after the other records.
+func (c *Z3950Client) Present(start int, count int) ([]Record, error) {
+	var recs []Record
+	var recordErr error
+	for count > 0 {
+		present := berConstructed(z3950PresentRequest,
+			berString(31, z3950ResultSet),
+			berInt(30, start),
+			berInt(29, count),
+			berConstructed(19, berString(0, "F")),
+			&berValue{Class: berContext, Tag: 104, Data: berOidValue(Z3950UsMarcSyntax).Data})
+		response, err := c.request(present, z3950PresentResponse)
+		if err != nil {
+			return recs, err
+		}
+		if diagnostic := z3950Diagnostic(response); diagnostic != nil {
+			return recs, diagnostic
+		}
+		records := response.Context(28)
+		if records == nil || len(records.Children) == 0 {
+			break
+		}
+		for _, namePlusRecord := range records.Children {
+			rec, err := parseNamePlusRecord(namePlusRecord)
+			if err != nil {
+				if recordErr == nil {
+					recordErr = fmt.Errorf("record %d: %w", start, err)
+				}
+			} else {
+				recs = append(recs, rec)
+			}
+			start++
+			count--
+		}
+	}
+	return recs, recordErr
+}
+
+// parseNamePlusRecord decodes a record returned by a target.
+func parseNamePlusRecord(v *berValue) (Record, error) {
+	record := v.Context(1)
+	if record == nil || len(record.Children) != 1 {
+		return Record{}, fmt.Errorf("Z39.50 malformed record")
+	}
+	choice := record.Children[0]
+	if choice.Is(berContext, 2) && len(choice.Children) == 1 {
+		return Record{}, parseZ3950Diagnostic(choice.Children[0])
+	}
+	if !choice.Is(berContext, 1) {
+		return Record{}, fmt.Errorf("Z39.50 unsupported record")
+	}
+	if syntax := choice.Child(berUniversal, berOid); syntax != nil && syntax.Oid() != Z3950UsMarcSyntax {
+		return Record{}, fmt.Errorf("Z39.50 unsupported record syntax %s", syntax.Oid())
+	}
+	data := choice.Context(1)
+	if data == nil || data.Constructed || len(data.Data) <= LEADER_LEN {
+		return Record{}, fmt.Errorf("Z39.50 record not octet-aligned")
+	}
+	rec, err := ParseRecord(data.Data)
+	if err != nil {
+		return Record{}, fmt.Errorf("Z39.50 malformed USMARC record: %s", err)
+	}
+	return rec, nil
+}
+
+// Close closes the association.
+func (c *Z3950Client) Close() error {
+	c.conn.SetDeadline(time.Now().Add(c.Config.Timeout))
+	if _, err := c.conn.Write(berConstructed(z3950Close, berInt(211, 0)).Encode()); err == nil {
+		// the target answers with a Close or closes the connection
+		readBer(c.reader)
+	}
+	return c.conn.Close()
+}
@@ -0,0 +1,288 @@
+package gomarc21
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+)
+
+/*
+A Z3950Server is a minimal Z39.50 target, made to test clients without a
+network: it answers Init, Search and Present requests about records held
+in memory, and returns them in USMARC.
+
+    server, _ := NewZ3950Server("Default")
+    server.Add(rec)
+    listener, _ := net.Listen("tcp", "127.0.0.1:0")
+    go server.Serve(listener)
+
+Searches are evaluated like the CQL queries of an SruServer: the Bib-1 use
+attributes are mapped to its indexes, and relations, structures,
+truncations and completeness to CQL relations and wildcards.
+*/
+
+// z3950UseIndexes maps the Bib-1 use attributes to the indexes of
+// DefaultSruIndexes.
+var z3950UseIndexes = map[int]string{
+	Bib1PersonalName: "dc.creator",
+	Bib1Title:        "dc.title",
+	Bib1Isbn:         "bath.isbn",
+	Bib1Issn:         "bath.issn",
+	Bib1Lccn:         "bath.lccn",
+	Bib1LocalNumber:  "rec.identifier",
+	Bib1Subject:      "dc.subject",
+	Bib1Date:         "dc.date",
+	Bib1Language:     "dc.language",
+	Bib1Author:       "dc.creator",
+	Bib1Any:          "cql.serverChoice",
+	Bib1Publisher:    "dc.publisher",
+}
+
+// z3950Relations maps the Bib-1 relation attributes to CQL relations.
+var z3950Relations = map[int]string{1: "<", 2: "<=", 3: "=", 4: ">=", 5: ">", 6: "<>"}
+
+// Z3950Server is a Z39.50 target of records held in memory.
+type Z3950Server struct {
+	Database string
+	records  *SruServer
+}
+
+// NewZ3950Server returns a target of a database without records.
+func NewZ3950Server(database string) (*Z3950Server, error) {
+	records, err := NewSruServer(SruConfig{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Z3950Server{Database: database, records: records}, nil
+}
+
+// Add adds a record to the database.
+func (s *Z3950Server) Add(rec Record) {
+	s.records.Add(rec)
+}
+
+// Serve answers the connections of a listener until it is closed.
+func (s *Z3950Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn answers the requests of an association.
+func (s *Z3950Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	resultSets := map[string][]int{}
+	for {
+		request, err := readBer(reader)
+		if err != nil || request.Class != berContext {
+			return
+		}
+		var response *berValue
+		switch request.Tag {
+		case z3950InitRequest:
+			response = berConstructed(z3950InitResponse,
+				berBits(3, 3, 0, 1, 2),
+				berBits(4, 2, 0, 1),
+				berInt(5, z3950MessageSize),
+				berInt(6, z3950MessageSize),
+				berBool(12, true),
+				berString(111, "gomarc21"),
+				berString(112, Version.String()))
+		case z3950SearchRequest:
+			response = s.search(request, resultSets)
+		case z3950PresentRequest:
+			response = s.present(request, resultSets)
+		case z3950Close:
+			conn.Write(berConstructed(z3950Close, berInt(211, 0)).Encode())
+			return
+		default:
+			// protocol error
+			conn.Write(berConstructed(z3950Close, berInt(211, 3)).Encode())
+			return
+		}
+		if _, err := conn.Write(response.Encode()); err != nil {
+			return
+		}
+	}
+}
+
+// search answers a search request.
+func (s *Z3950Server) search(request *berValue, resultSets map[string][]int) *berValue {
+	failed := func(diagnostic *Z3950Diagnostic) *berValue {
+		return berConstructed(z3950SearchResponse, berInt(23, 0), berInt(24, 0), berInt(25, 0),
+			berBool(22, false), berInt(26, 3), berConstructed(130, diagnostic.ber().Children...))
+	}
+
+	if databases := request.Context(18); databases != nil {
+		for _, database := range databases.Children {
+			if !strings.EqualFold(string(database.Data), s.Database) {
+				return failed(&Z3950Diagnostic{Condition: Bib1DatabaseUnavailable, AddInfo: string(database.Data)})
+			}
+		}
+	}
+	query := request.Context(21)
+	if query == nil || len(query.Children) != 1 || !query.Children[0].Is(berContext, 1) {
+		return failed(&Z3950Diagnostic{Condition: Bib1UnsupportedQueryType})
+	}
+	rpnQuery := query.Children[0]
+	if len(rpnQuery.Children) != 2 {
+		return failed(&Z3950Diagnostic{Condition: Bib1MalformedQuery})
+	}
+	if set := rpnQuery.Children[0].Oid(); set != Z3950Bib1AttributeSet {
+		return failed(&Z3950Diagnostic{Condition: Bib1UnsupportedAttributeSet, AddInfo: set})
+	}
+	q, err := parseRpn(rpnQuery.Children[1])
+	if err != nil {
+		return failed(err.(*Z3950Diagnostic))
+	}
+	cql, diagnostic := z3950CqlQuery(q)
+	if diagnostic != nil {
+		return failed(diagnostic)
+	}
+	positions, err := s.records.searchQuery(cql)
+	if err != nil {
+		return failed(&Z3950Diagnostic{Condition: Bib1PermanentError, AddInfo: err.Error()})
+	}
+
+	name := z3950ResultSet
+	if resultSet := request.Context(17); resultSet != nil {
+		name = string(resultSet.Data)
+	}
+	resultSets[name] = positions
+	return berConstructed(z3950SearchResponse, berInt(23, len(positions)), berInt(24, 0), berInt(25, 1),
+		berBool(22, true))
+}
+
+// z3950CqlQuery translates a query to the CQL query evaluating it.
+func z3950CqlQuery(q *Z3950Query) (*CqlQuery, *Z3950Diagnostic) {
+	if q.Operator != "" {
+		left, diagnostic := z3950CqlQuery(q.Left)
+		if diagnostic != nil {
+			return nil, diagnostic
+		}
+		right, diagnostic := z3950CqlQuery(q.Right)
+		if diagnostic != nil {
+			return nil, diagnostic
+		}
+		return &CqlQuery{Boolean: q.Operator, Left: left, Right: right}, nil
+	}
+
+	cql := &CqlQuery{Index: "cql.serverChoice", Relation: "=", Term: q.Term}
+	for _, attribute := range q.Attributes {
+		unsupported := func(condition int) (*CqlQuery, *Z3950Diagnostic) {
+			return nil, &Z3950Diagnostic{Condition: condition, AddInfo: fmt.Sprintf("%d=%d", attribute.Type, attribute.Value)}
+		}
+		switch attribute.Type {
+		case Bib1Use:
+			index, ok := z3950UseIndexes[attribute.Value]
+			if !ok {
+				return unsupported(Bib1UnsupportedUse)
+			}
+			cql.Index = index
+		case Bib1Relation:
+			relation, ok := z3950Relations[attribute.Value]
+			if !ok {
+				return unsupported(Bib1UnsupportedRelation)
+			}
+			if relation != "=" || cql.Relation != "exact" {
+				cql.Relation = relation
+			}
+		case Bib1Position:
+			// first in field or any position
+		case Bib1Structure:
+			switch attribute.Value {
+			case 1, 2, 4, 5, 100, 101:
+				// phrase, word, year, date
+			case 6:
+				if cql.Relation == "=" {
+					cql.Relation = "all"
+				}
+			default:
+				return unsupported(Bib1UnsupportedStructure)
+			}
+		case Bib1Truncation:
+			switch attribute.Value {
+			case 1:
+				cql.Term += "*"
+			case 2:
+				cql.Term = "*" + cql.Term
+			case 3:
+				cql.Term = "*" + cql.Term + "*"
+			case 100:
+			case 101:
+				cql.Term = strings.ReplaceAll(cql.Term, "#", "*")
+			default:
+				return unsupported(Bib1UnsupportedTruncation)
+			}
+		case Bib1Completeness:
+			switch attribute.Value {
+			case 1:
+			case 2, 3:
+				if cql.Relation == "=" {
+					cql.Relation = "exact"
+				}
+			default:
+				return unsupported(Bib1UnsupportedCompleteness)
+			}
+		default:
+			return unsupported(Bib1UnsupportedAttributeType)
+		}
+	}
+	return cql, nil
+}
+
+// present answers a present request.
+func (s *Z3950Server) present(request *berValue, resultSets map[string][]int) *berValue {
+	failed := func(diagnostic *Z3950Diagnostic) *berValue {
+		return berConstructed(z3950PresentResponse, berInt(24, 0), berInt(25, 0), berInt(27, 5),
+			berConstructed(130, diagnostic.ber().Children...))
+	}
+
+	name := z3950ResultSet
+	if resultSet := request.Context(31); resultSet != nil {
+		name = string(resultSet.Data)
+	}
+	positions, ok := resultSets[name]
+	if !ok {
+		return failed(&Z3950Diagnostic{Condition: Bib1NoSuchResultSet, AddInfo: name})
+	}
+	start, count := 1, 1
+	if v := request.Context(30); v != nil {
+		start = v.Int()
+	}
+	if v := request.Context(29); v != nil {
+		count = v.Int()
+	}
+	if start < 1 || count < 0 || start+count-1 > len(positions) {
+		return failed(&Z3950Diagnostic{Condition: Bib1PresentOutOfRange})
+	}
+	if syntax := request.Context(104); syntax != nil && syntax.Oid() != Z3950UsMarcSyntax {
+		return failed(&Z3950Diagnostic{Condition: Bib1UnsupportedRecordSyntax, AddInfo: syntax.Oid()})
+	}
+
+	records := berConstructed(28)
+	for _, position := range positions[start-1 : start-1+count] {
+		var record *berValue
+		rec, err := s.records.recordAt(position)
+		var data []byte
+		if err == nil {
+			data, err = rec.RecordAsMarc()
+		}
+		if err != nil {
+			diagnostic := &Z3950Diagnostic{Condition: Bib1PermanentError, AddInfo: err.Error()}
+			record = berConstructed(2, diagnostic.ber())
+		} else {
+			record = berConstructed(1, berOidValue(Z3950UsMarcSyntax), berPrimitive(1, data))
+		}
+		records.Children = append(records.Children,
+			berSequenceOf(berString(0, s.Database), berConstructed(1, record)))
+	}
+	return berConstructed(z3950PresentResponse, berInt(24, count), berInt(25, start+count), berInt(27, 0),
+		records)
+}
@@ -0,0 +1,171 @@
+package gomarc21
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestParsePqf(test *testing.T) {
+	tests := []struct {
+		pqf    string
+		parsed string
+	}{
+		{"coal", "coal"},
+		{`@attr 1=4 "aviation security"`, `@attr 1=4 "aviation security"`},
+		{"@attrset bib-1 @attr bib-1 1=7 @attr 5=100 0306406152", "@attr 1=7 @attr 5=100 0306406152"},
+		{"@and @attr 1=1003 swanson @or coal @attr 1=21 fish", "@and @attr 1=1003 swanson @or coal @attr 1=21 fish"},
+		{`@not fish "san marcos"`, `@not fish "san marcos"`},
+	}
+	for _, t := range tests {
+		q, err := ParsePqf(t.pqf)
+		if err != nil {
+			test.Errorf("%s: %s", t.pqf, err)
+			continue
+		}
+		if q.String() != t.parsed {
+			test.Errorf("%s: expected %s, got %s", t.pqf, t.parsed, q)
+		}
+	}
+	if q, _ := ParsePqf("@attr 1=4 @attr 5=1 coal"); q.Attribute(Bib1Use) != Bib1Title || q.Attribute(Bib1Truncation) != 1 {
+		test.Error("wrong attributes", q.Attributes)
+	}
+
+	for pqf, condition := range map[string]int{
+		"":                      Bib1MalformedQuery,
+		"@and coal":             Bib1MalformedQuery,
+		"@attr 1=4":             Bib1MalformedQuery,
+		"@attr x=4 coal":        Bib1MalformedQuery,
+		"coal fish":             Bib1MalformedQuery,
+		`"coal`:                 Bib1MalformedQuery,
+		"@prox 0 1 0 2 k 2 a b": Bib1UnsupportedBooleanOperator,
+		"@attrset gils coal":    Bib1UnsupportedAttributeSet,
+	} {
+		_, err := ParsePqf(pqf)
+		var diagnostic *Z3950Diagnostic
+		if !errors.As(err, &diagnostic) || diagnostic.Condition != condition {
+			test.Errorf("%q: expected diagnostic %d, got %v", pqf, condition, err)
+		}
+	}
+}
+
+// newTestZ3950Server serves the test records in the database Default.
+func newTestZ3950Server(test *testing.T) (string, []Record) {
+	file, err := OpenFile("data/test_10.mrc")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer file.Close()
+	recs := readAll(test, NewReader(file))
+
+	server, err := NewZ3950Server("Default")
+	if err != nil {
+		test.Fatal(err)
+	}
+	for _, rec := range recs {
+		server.Add(rec)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		test.Fatal(err)
+	}
+	test.Cleanup(func() { listener.Close() })
+	go server.Serve(listener)
+	return listener.Addr().String(), recs
+}
+
+func TestZ3950(test *testing.T) {
+	address, recs := newTestZ3950Server(test)
+	client, err := DialZ3950(address, Z3950Config{User: "test", Password: "secret"})
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer client.Close()
+	if client.ImplementationName != "gomarc21" {
+		test.Error("wrong implementation name", client.ImplementationName)
+	}
+
+	search := func(pqf string) []string {
+		count, err := client.Search(pqf)
+		if err != nil {
+			test.Errorf("%s: %s", pqf, err)
+			return nil
+		}
+		recs, err := client.Present(1, count)
+		if err != nil {
+			test.Errorf("%s: %s", pqf, err)
+		}
+		var ids []string
+		for _, rec := range recs {
+			ids = append(ids, rec.ControlNum())
+		}
+		return ids
+	}
+	for pqf, ids := range map[string]string{
+		`@attr 1=4 "aviation security"`:                           "ocm57177924",
+		`@attr 1=4 @attr 4=6 "security aviation"`:                 "ocm57177924",
+		`@attr 1=4 @attr 6=3 "diabetes insipidus"`:                "ocm57178158",
+		`@attr 1=4 @attr 6=3 diabetes`:                            "",
+		`@and @attr 1=4 @attr 5=1 fish @attr 1=21 "fish culture"`: "ocm57178104 ocm57178112",
+		`@not @attr 1=4 @attr 5=1 fish @attr 1=4 "san marcos"`:    "ocm57178104",
+		`@or @attr 1=1003 swanson @attr 1=12 ocm57178216`:         "ocm57175940 ocm57178216",
+		`@attr 1=31 @attr 2=1 2004`:                               "ocm57175940 ocm57178158",
+		`@attr 1=1016 numeros`:                                    "ocm57178089",
+		`@attr 1=4 @attr 5=101 nucl#`:                             "ocm57178031",
+	} {
+		if got := strings.Join(search(pqf), " "); got != ids {
+			test.Errorf("%s: expected %q, got %q", pqf, ids, got)
+		}
+	}
+
+	count, err := client.Search("@attr 1=1016 @attr 5=1 a")
+	if err != nil || count == 0 {
+		test.Fatal("wrong search", count, err)
+	}
+	got, err := client.Present(2, 1)
+	if err != nil || len(got) != 1 || len(got[0].DataFields) != len(recs[1].DataFields) ||
+		got[0].Leader.GetRaw() != recs[1].Leader.GetRaw() {
+		test.Error("wrong record", err)
+	}
+
+	for pqf, condition := range map[string]int{
+		"@attr 1=9999 coal": Bib1UnsupportedUse,
+		"@attr 2=102 coal":  Bib1UnsupportedRelation,
+		"@attr 5=104 coal":  Bib1UnsupportedTruncation,
+		"@attr 9=1 coal":    Bib1UnsupportedAttributeType,
+		"@attr 4=3 coal":    Bib1UnsupportedStructure,
+	} {
+		_, err := client.Search(pqf)
+		var diagnostic *Z3950Diagnostic
+		if !errors.As(err, &diagnostic) || diagnostic.Condition != condition {
+			test.Errorf("%s: expected diagnostic %d, got %v", pqf, condition, err)
+		}
+	}
+	if _, err := client.Search("coal"); err != nil {
+		test.Fatal(err)
+	}
+	_, err = client.Present(2, 5)
+	var diagnostic *Z3950Diagnostic
+	if !errors.As(err, &diagnostic) || diagnostic.Condition != Bib1PresentOutOfRange {
+		test.Error("expected present out of range, got", err)
+	}
+
+	other, err := DialZ3950(address, Z3950Config{Database: "Other"})
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer other.Close()
+	if _, err := other.Search("coal"); !errors.As(err, &diagnostic) || diagnostic.Condition != Bib1DatabaseUnavailable {
+		test.Error("expected database unavailable, got", err)
+	}
+
+	// a directory entry with a field length past the end of the record
+	raw, _ := recs[0].RecordAsMarc()
+	copy(raw[LEADER_LEN+3:], "9999")
+	namePlusRecord := berSequenceOf(berString(0, "Default"),
+		berConstructed(1, berConstructed(1, berOidValue(Z3950UsMarcSyntax), berPrimitive(1, raw))))
+	if _, err := parseNamePlusRecord(namePlusRecord); err == nil || !strings.Contains(err.Error(), "malformed") {
+		test.Error("expected a malformed record, got", err)
+	}
+}
@@ -0,0 +1,1137 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"github.com/jasonzou/gomarc21"
+)
+
+var CLI struct {
+	Convert   ConvertCmd   `cmd:"" help:"Convert MARC records between formats, (de)compressing as needed."`
+	Link      LinkCmd      `cmd:"" help:"Match the headings of bibliographic records against an authority file."`
+	Items     ItemsCmd     `cmd:"" help:"Extract the items embedded in bibliographic records as CSV or JSON."`
+	Dedup     DedupCmd     `cmd:"" help:"Find duplicate records and optionally write the records without duplicates."`
+	Lint      LintCmd      `cmd:"" help:"Check records and report the issues found."`
+	Edit      EditCmd      `cmd:"" help:"Apply the edit rules of a YAML or JSON rule file to records."`
+	Transform TransformCmd `cmd:"" help:"Transform records with a Starlark script."`
+	OaiServer OaiServerCmd `cmd:"" name:"oai-server" help:"Serve records to harvesters over OAI-PMH 2.0."`
+	Harvest   HarvestCmd   `cmd:"" help:"Harvest the MARCXML records of an OAI-PMH repository."`
+	SruServer SruServerCmd `cmd:"" name:"sru-server" help:"Serve CQL searches of records over SRU 1.2 and 2.0."`
+	Z3950     Z3950Cmd     `cmd:"" name:"z3950" help:"Search a Z39.50 target and retrieve the USMARC records found."`
+	ApiServer ApiServerCmd `cmd:"" name:"api-server" help:"Serve a REST API converting and linting records and returning them by control number."`
+	Search    SearchCmd    `cmd:"" help:"Search the records of a file with a full-text index saved next to it."`
+	New       NewCmd       `cmd:"" help:"Create a record from a template."`
+	Check     CheckCmd     `cmd:"" help:"Check that the leader and the directory of MARC records match their data, optionally repairing them."`
+	Store     StoreCmd     `cmd:"" help:"Load records into a record store, created when it does not exist."`
+}
+
+type ConvertCmd struct {
+	InputFile  string `arg:"" name:"input" help:"The file contains MARC or MARCXML records, optionally gzip, bzip2 or zstd compressed." type:"existingfile"`
+	OutputFile string `arg:"" name:"output" help:"The file will contain the converted records; .gz and .zst extensions compress it (.bz2 cannot be written)." type:"outputfile"`
+	To         string `short:"t" name:"to" help:"Output format (marc, xml, json, jsonarray, mrk, dc, dcjson, mods, nt, ttl, jsonld, bibtex, ris or csljson). Defaults to the format implied by the output file name."`
+	BaseIri    string `name:"base-iri" help:"Base IRI of the minted BIBFRAME resources (nt, ttl and jsonld)." default:"http://example.org/"`
+}
+
+func (c *ConvertCmd) Run() error {
+	format := c.To
+	if format == "" {
+		format = gomarc21.FormatFromName(c.OutputFile)
+	}
+	if format == "" {
+		return fmt.Errorf("cannot tell the output format from %q, use --to", c.OutputFile)
+	}
+
+	in, err := gomarc21.OpenFile(c.InputFile)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := gomarc21.CreateFile(c.OutputFile)
+	if err != nil {
+		return err
+	}
+
+	count, err := convert(gomarc21.NewReader(in), out, format, c.BaseIri)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d records converted\n", count)
+	return nil
+}
+
+func convert(reader *gomarc21.Reader, out io.Writer, format string, baseIri string) (int, error) {
+	writer, err := gomarc21.NewWriter(out, format)
+	if err != nil {
+		return 0, err
+	}
+	writer.BaseIri = baseIri
+
+	count := 0
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, fmt.Errorf("record %d: %s", count+1, err)
+		}
+		if err := writer.Write(rec); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, writer.Close()
+}
+
+type LinkCmd struct {
+	InputFile   string `arg:"" name:"input" help:"The file contains the bibliographic records." type:"existingfile"`
+	Authorities string `short:"a" name:"authorities" help:"The file contains the authority records." type:"existingfile" required:""`
+	SaveIndex   bool   `name:"save-index" help:"Save the authority index next to the authority file for the next runs."`
+	OutputFile  string `short:"o" name:"output" help:"Write the records with variant headings replaced by the authorized form to this file." type:"outputfile"`
+	AddIds      bool   `name:"add-ids" help:"Add the authority record control number in $0 of the matched headings."`
+	All         bool   `name:"all" help:"Report exact matches too, not only variant, ambiguous and unmatched headings."`
+}
+
+func (c *LinkCmd) Run() error {
+	idx, err := gomarc21.OpenAuthorityIndex(c.Authorities, c.SaveIndex)
+	if err != nil {
+		return err
+	}
+
+	in, err := gomarc21.OpenFile(c.InputFile)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	reader := gomarc21.NewReader(in)
+
+	var out io.WriteCloser
+	var writer *gomarc21.Writer
+	if c.OutputFile != "" {
+		format := gomarc21.FormatFromName(c.OutputFile)
+		if format == "" {
+			format = gomarc21.FormatMarc
+		}
+		if out, err = gomarc21.CreateFile(c.OutputFile); err != nil {
+			return err
+		}
+		defer out.Close()
+		if writer, err = gomarc21.NewWriter(out, format); err != nil {
+			return err
+		}
+	}
+
+	counts := map[string]int{}
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		controlled, matches := idx.Control(rec, c.AddIds)
+		for _, m := range matches {
+			counts[m.Status]++
+			if m.Status == gomarc21.MatchExact && !c.All {
+				continue
+			}
+			authorized := ""
+			switch m.Status {
+			case gomarc21.MatchExact, gomarc21.MatchVariant:
+				authorized = gomarc21.AuthorityHeading{Field: m.Entry.Field}.String()
+			case gomarc21.MatchAmbiguous:
+				var headings []string
+				for _, e := range m.Entries {
+					headings = append(headings, gomarc21.AuthorityHeading{Field: e.Field}.String())
+				}
+				authorized = strings.Join(headings, " | ")
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\t%s\n", strings.TrimSpace(rec.ControlNum()), m.Field.Tag, m.Status,
+				gomarc21.AuthorityHeading{Field: m.Field}.String(), authorized)
+		}
+		if writer != nil {
+			if err := writer.Write(controlled); err != nil {
+				return err
+			}
+		}
+	}
+	if writer != nil {
+		if err := writer.Close(); err != nil {
+			return err
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d exact, %d variant, %d ambiguous, %d unmatched headings\n",
+		counts[gomarc21.MatchExact], counts[gomarc21.MatchVariant], counts[gomarc21.MatchAmbiguous], counts[gomarc21.MatchUnmatched])
+	return nil
+}
+
+type ItemsCmd struct {
+	InputFile  string `arg:"" name:"input" help:"The file contains the bibliographic records." type:"existingfile"`
+	Mapping    string `short:"m" name:"mapping" help:"Preset (koha, sierra, alma) or mapping spec such as 949:barcode=i,callnumber=a,location=l,status=s." default:"koha"`
+	Format     string `short:"f" name:"format" help:"Output format (csv or json)." enum:"csv,json" default:"csv"`
+	OutputFile string `short:"o" name:"output" help:"Write to this file instead of the standard output." type:"outputfile"`
+}
+
+func (c *ItemsCmd) Run() error {
+	mapping, err := gomarc21.ParseItemMapping(c.Mapping)
+	if err != nil {
+		return err
+	}
+
+	in, err := gomarc21.OpenFile(c.InputFile)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	reader := gomarc21.NewReader(in)
+
+	var out io.Writer = os.Stdout
+	var file io.WriteCloser
+	if c.OutputFile != "" {
+		if file, err = gomarc21.CreateFile(c.OutputFile); err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	columns := []string{"id", "title", "barcode", "call_number", "library", "location", "status", "item_type"}
+	csvWriter := csv.NewWriter(out)
+	encoder := json.NewEncoder(out)
+	if c.Format == "csv" {
+		if err := csvWriter.Write(columns); err != nil {
+			return err
+		}
+	}
+
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		id := strings.TrimSpace(rec.ControlNum())
+		var titleParts []string
+		for _, df := range rec.GetDatafields("245") {
+			for _, sf := range df.GetSubFields("ab") {
+				titleParts = append(titleParts, strings.TrimSpace(sf.Data))
+			}
+		}
+		title := strings.TrimRight(strings.Join(titleParts, " "), " /:;,.")
+		for _, item := range rec.Items(mapping) {
+			if c.Format == "json" {
+				err = encoder.Encode(struct {
+					Id    string        `json:"id"`
+					Title string        `json:"title"`
+					Item  gomarc21.Item `json:"item"`
+				}{id, title, item})
+			} else {
+				err = csvWriter.Write([]string{id, title,
+					item.Barcode, item.CallNumber, item.Library, item.Location, item.Status, item.ItemType})
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return err
+	}
+	if file != nil {
+		return file.Close()
+	}
+	return nil
+}
+
+type DedupCmd struct {
+	InputFile  string `arg:"" name:"input" help:"The file contains the records." type:"existingfile"`
+	Rules      string `short:"r" name:"rules" help:"Match rules separated by semicolons; a rule is a set of keys (isbn, issn, oclc, lccn, title) joined by +." default:"oclc;lccn;isbn;issn+title;title"`
+	OutputFile string `short:"o" name:"output" help:"Write the records without duplicates, keeping the most complete record of each cluster, to this file." type:"outputfile"`
+}
+
+func (c *DedupCmd) Run() error {
+	rules, err := gomarc21.ParseDedupRules(c.Rules)
+	if err != nil {
+		return err
+	}
+
+	in, err := gomarc21.OpenFile(c.InputFile)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	reader := gomarc21.NewReader(in)
+
+	dedup := gomarc21.NewDeduplicator(rules)
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		dedup.Add(rec)
+	}
+
+	records := dedup.Records()
+	clusters := dedup.Clusters()
+	duplicates := 0
+	for n, cluster := range clusters {
+		for _, i := range cluster.Records {
+			status := "duplicate"
+			if i == cluster.Winner {
+				status = "winner"
+			}
+			fmt.Printf("%d\t%d\t%s\t%s\t%s\n", n+1, i+1, strings.TrimSpace(records[i].ControlNum()), status,
+				strings.Join(cluster.Rules, ","))
+		}
+		duplicates += len(cluster.Records) - 1
+	}
+
+	if c.OutputFile != "" {
+		format := gomarc21.FormatFromName(c.OutputFile)
+		if format == "" {
+			format = gomarc21.FormatMarc
+		}
+		out, err := gomarc21.CreateFile(c.OutputFile)
+		if err != nil {
+			return err
+		}
+		writer, err := gomarc21.NewWriter(out, format)
+		if err != nil {
+			out.Close()
+			return err
+		}
+		for _, rec := range dedup.Unique() {
+			if err := writer.Write(rec); err != nil {
+				out.Close()
+				return err
+			}
+		}
+		if err := writer.Close(); err != nil {
+			out.Close()
+			return err
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d records, %d clusters, %d duplicates\n", len(records), len(clusters), duplicates)
+	return nil
+}
+
+type LintCmd struct {
+	InputFile   string `arg:"" name:"input" help:"The file contains the records." type:"existingfile"`
+	Rules       string `short:"r" name:"rules" help:"Comma separated lint rules to run (default all): identifiers."`
+	OutputFile  string `short:"o" name:"output" help:"Write the records to this file, with the fixes asked for." type:"outputfile"`
+	MoveInvalid bool   `name:"move-invalid" help:"Move the invalid ISBN, LCCN and OCLC numbers to $z and the invalid ISSN to $y in the output file."`
+}
+
+func (c *LintCmd) Run() error {
+	rules, err := gomarc21.ParseLintRules(c.Rules)
+	if err != nil {
+		return err
+	}
+
+	in, err := gomarc21.OpenFile(c.InputFile)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	reader := gomarc21.NewReader(in)
+
+	var out io.WriteCloser
+	var writer *gomarc21.Writer
+	if c.OutputFile != "" {
+		format := gomarc21.FormatFromName(c.OutputFile)
+		if format == "" {
+			format = gomarc21.FormatMarc
+		}
+		if out, err = gomarc21.CreateFile(c.OutputFile); err != nil {
+			return err
+		}
+		defer out.Close()
+		if writer, err = gomarc21.NewWriter(out, format); err != nil {
+			return err
+		}
+	}
+
+	count, issues := 0, 0
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		count++
+
+		for _, issue := range rec.Lint(rules) {
+			issues++
+			fmt.Printf("%d\t%s\t%s\n", count, strings.TrimSpace(rec.ControlNum()), issue)
+		}
+		if writer != nil {
+			if c.MoveInvalid {
+				rec, _ = rec.MoveInvalidIdentifiers()
+			}
+			if err := writer.Write(rec); err != nil {
+				return err
+			}
+		}
+	}
+	if writer != nil {
+		if err := writer.Close(); err != nil {
+			return err
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d records, %d issues\n", count, issues)
+	return nil
+}
+
+type EditCmd struct {
+	InputFile  string `arg:"" name:"input" help:"The file contains the records." type:"existingfile"`
+	OutputFile string `arg:"" name:"output" help:"The file will contain the edited records; the format is implied by the file name." type:"outputfile"`
+	Rules      string `short:"r" name:"rules" help:"The YAML or JSON rule file." type:"existingfile" required:""`
+}
+
+func (c *EditCmd) Run() error {
+	rules, err := gomarc21.ReadEditRules(c.Rules)
+	if err != nil {
+		return fmt.Errorf("%s: %s", c.Rules, err)
+	}
+	editor, err := gomarc21.NewEditor(rules)
+	if err != nil {
+		return fmt.Errorf("%s: %s", c.Rules, err)
+	}
+
+	in, err := gomarc21.OpenFile(c.InputFile)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	reader := gomarc21.NewReader(in)
+
+	format := gomarc21.FormatFromName(c.OutputFile)
+	if format == "" {
+		format = gomarc21.FormatMarc
+	}
+	out, err := gomarc21.CreateFile(c.OutputFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	writer, err := gomarc21.NewWriter(out, format)
+	if err != nil {
+		return err
+	}
+
+	count, edited, changes := 0, 0, 0
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("record %d: %s", count+1, err)
+		}
+		count++
+
+		rec, n := editor.Edit(rec)
+		if n > 0 {
+			edited++
+			changes += n
+		}
+		if err := writer.Write(rec); err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%d records, %d edited, %d changes\n", count, edited, changes)
+	return nil
+}
+
+type TransformCmd struct {
+	InputFile  string `arg:"" name:"input" help:"The file contains the records." type:"existingfile"`
+	OutputFile string `arg:"" name:"output" optional:"" help:"The file will contain the transformed records; the format is implied by the file name." type:"outputfile"`
+	Script     string `short:"s" name:"script" help:"The Starlark script defining transform(record)." type:"existingfile" required:""`
+	DryRun     bool   `short:"n" name:"dry-run" help:"Print the changes to the records instead of writing them."`
+}
+
+func (c *TransformCmd) Run() error {
+	if c.OutputFile == "" && !c.DryRun {
+		return fmt.Errorf("an output file is needed without --dry-run")
+	}
+	script, err := gomarc21.ReadScript(c.Script)
+	if err != nil {
+		return err
+	}
+
+	in, err := gomarc21.OpenFile(c.InputFile)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	reader := gomarc21.NewReader(in)
+
+	var out io.WriteCloser
+	var writer *gomarc21.Writer
+	if !c.DryRun {
+		format := gomarc21.FormatFromName(c.OutputFile)
+		if format == "" {
+			format = gomarc21.FormatMarc
+		}
+		if out, err = gomarc21.CreateFile(c.OutputFile); err != nil {
+			return err
+		}
+		defer out.Close()
+		if writer, err = gomarc21.NewWriter(out, format); err != nil {
+			return err
+		}
+	}
+
+	count, changed, dropped, failed := 0, 0, 0, 0
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("record %d: %s", count+1, err)
+		}
+		count++
+
+		// a failing record is kept as it was
+		result, keep, err := script.Transform(rec)
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "record %d (%s): %s\n", count, rec.ControlNum(), err)
+		}
+		diff := gomarc21.DiffRecords(rec, result)
+		if len(diff) > 0 {
+			changed++
+		}
+		if !keep {
+			dropped++
+		}
+
+		if c.DryRun {
+			switch {
+			case !keep:
+				fmt.Printf("record %d (%s): dropped\n", count, rec.ControlNum())
+			case len(diff) > 0:
+				fmt.Printf("record %d (%s):\n%s\n", count, rec.ControlNum(), strings.Join(diff, "\n"))
+			}
+			continue
+		}
+		if keep {
+			if err := writer.Write(result); err != nil {
+				return err
+			}
+		}
+	}
+	if !c.DryRun {
+		if err := writer.Close(); err != nil {
+			return err
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d records, %d changed, %d dropped, %d failed\n", count, changed, dropped, failed)
+	return nil
+}
+
+type OaiServerCmd struct {
+	InputFile  string   `arg:"" name:"input" help:"The file contains the records." type:"existingfile" optional:""`
+	StoreFile  string   `name:"store" help:"Serve the records of this record store (see marc store) instead of a file." type:"existingfile"`
+	Listen     string   `short:"l" name:"listen" help:"The address to listen on." default:":8080"`
+	BaseUrl    string   `name:"base-url" help:"The base URL of the repository; the URL of the requests by default."`
+	Name       string   `name:"name" help:"The name of the repository." default:"MARC records"`
+	AdminEmail []string `name:"admin-email" help:"The e-mail address of an administrator of the repository."`
+	Prefix     string   `name:"prefix" help:"The prefix of the identifiers, oai:<host>: by default."`
+	PageSize   int      `name:"page-size" help:"The number of records of a list page." default:"100"`
+	Sets       []string `name:"set" help:"A set of each value of a MARCspec, as spec=MARCspec (e.g. type=LDR/06)."`
+}
+
+func (c *OaiServerCmd) Run() error {
+	config := gomarc21.OaiConfig{
+		RepositoryName:   c.Name,
+		BaseUrl:          c.BaseUrl,
+		AdminEmail:       c.AdminEmail,
+		IdentifierPrefix: c.Prefix,
+		PageSize:         c.PageSize,
+	}
+	for _, set := range c.Sets {
+		spec, field, ok := strings.Cut(set, "=")
+		if !ok {
+			return fmt.Errorf("invalid set %q, expected spec=MARCspec", set)
+		}
+		config.Sets = append(config.Sets, gomarc21.OaiSetConfig{Spec: spec, Name: spec, Field: field})
+	}
+
+	source, err := recordSource(c.InputFile, c.StoreFile)
+	if err != nil {
+		return err
+	}
+	var provider *gomarc21.OaiProvider
+	if c.StoreFile != "" {
+		provider, err = gomarc21.OpenStoreOaiProvider(c.StoreFile, config)
+	} else {
+		provider, err = gomarc21.OpenOaiProvider(c.InputFile, config)
+	}
+	if err != nil {
+		return err
+	}
+	defer provider.Close()
+	fmt.Fprintf(os.Stderr, "serving %s on %s\n", source, c.Listen)
+	return http.ListenAndServe(c.Listen, provider)
+}
+
+type HarvestCmd struct {
+	BaseUrl     string `arg:"" name:"url" help:"The base URL of the repository."`
+	OutputFile  string `arg:"" name:"output" help:"The file will contain the records; the format is implied by the file name." type:"outputfile"`
+	Prefix      string `name:"prefix" help:"The metadata prefix of the MARCXML records." default:"marc21"`
+	From        string `name:"from" help:"Harvest the records changed from this date (YYYY-MM-DD or YYYY-MM-DDThh:mm:ssZ)."`
+	Until       string `name:"until" help:"Harvest the records changed until this date."`
+	Set         string `name:"set" help:"Harvest the records of this set."`
+	DeletedFile string `name:"deleted" help:"The file will contain the identifiers of the deleted records." type:"outputfile"`
+}
+
+func (c *HarvestCmd) Run() error {
+	harvester := gomarc21.NewOaiHarvester(c.BaseUrl)
+	harvester.MetadataPrefix = c.Prefix
+	harvester.From = c.From
+	harvester.Until = c.Until
+	harvester.Set = c.Set
+
+	format := gomarc21.FormatFromName(c.OutputFile)
+	if format == "" {
+		format = gomarc21.FormatMarc
+	}
+	out, err := gomarc21.CreateFile(c.OutputFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	writer, err := gomarc21.NewWriter(out, format)
+	if err != nil {
+		return err
+	}
+	var deletedOut io.WriteCloser
+	if c.DeletedFile != "" {
+		if deletedOut, err = gomarc21.CreateFile(c.DeletedFile); err != nil {
+			return err
+		}
+		defer deletedOut.Close()
+	}
+
+	count, deleted := 0, 0
+	for {
+		harvested, err := harvester.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if harvested.Header.Deleted() {
+			deleted++
+			if deletedOut != nil {
+				fmt.Fprintln(deletedOut, harvested.Header.Identifier)
+			}
+			continue
+		}
+		count++
+		if err := writer.Write(harvested.Record); err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if deletedOut != nil {
+		if err := deletedOut.Close(); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d records harvested, %d deleted\n", count, deleted)
+	if harvester.Restarts > 0 {
+		fmt.Fprintf(os.Stderr, "the list was requested again %d times after refused resumption tokens; "+
+			"a repository not listing the records by datestamp may have records missing, harvest again to be sure\n",
+			harvester.Restarts)
+	}
+	return nil
+}
+
+type SruServerCmd struct {
+	InputFile  string `arg:"" name:"input" help:"The file contains the records." type:"existingfile" optional:""`
+	StoreFile  string `name:"store" help:"Serve the records of this record store (see marc store) instead of a file." type:"existingfile"`
+	Listen     string `short:"l" name:"listen" help:"The address to listen on." default:":8080"`
+	Title      string `name:"title" help:"The title of the database." default:"MARC records"`
+	MaxRecords int    `name:"max-records" help:"The largest number of records of a response." default:"100"`
+}
+
+func (c *SruServerCmd) Run() error {
+	source, err := recordSource(c.InputFile, c.StoreFile)
+	if err != nil {
+		return err
+	}
+	config := gomarc21.SruConfig{Title: c.Title, MaxRecords: c.MaxRecords}
+	var server *gomarc21.SruServer
+	if c.StoreFile != "" {
+		server, err = gomarc21.OpenStoreSruServer(c.StoreFile, config)
+	} else {
+		server, err = gomarc21.OpenSruServer(c.InputFile, config)
+	}
+	if err != nil {
+		return err
+	}
+	defer server.Close()
+	fmt.Fprintf(os.Stderr, "serving %s on %s\n", source, c.Listen)
+	return http.ListenAndServe(c.Listen, server)
+}
+
+// recordSource returns the file or the store served, which must be given
+// but not both.
+func recordSource(inputFile string, storeFile string) (string, error) {
+	switch {
+	case inputFile != "" && storeFile != "":
+		return "", fmt.Errorf("give either an input file or --store, not both")
+	case storeFile != "":
+		return storeFile, nil
+	case inputFile != "":
+		return inputFile, nil
+	}
+	return "", fmt.Errorf("give an input file or --store")
+}
+
+type ApiServerCmd struct {
+	InputFile      string `arg:"" name:"input" help:"The file contains the records returned by /records/{id}." type:"existingfile" optional:""`
+	Listen         string `short:"l" name:"listen" help:"The address to listen on." default:":8080"`
+	MaxRequestSize int64  `name:"max-request-size" help:"The largest request body in bytes." default:"33554432"`
+	Rules          string `short:"r" name:"rules" help:"Comma separated lint rules of /lint (default all): identifiers."`
+}
+
+func (c *ApiServerCmd) Run() error {
+	rules, err := gomarc21.ParseLintRules(c.Rules)
+	if err != nil {
+		return err
+	}
+	config := gomarc21.RestConfig{MaxRequestSize: c.MaxRequestSize, LintRules: rules}
+	server := gomarc21.NewRestServer(config, nil)
+	if c.InputFile != "" {
+		server, err = gomarc21.OpenRestServer(c.InputFile, config)
+		if err != nil {
+			return err
+		}
+	}
+	defer server.Close()
+	fmt.Fprintf(os.Stderr, "serving the API on %s\n", c.Listen)
+	return http.ListenAndServe(c.Listen, server)
+}
+
+type SearchCmd struct {
+	Query      string `arg:"" name:"query" help:"The query: words, \"phrases\", field:word (title, author, subject, isbn, id, type, language) and -clauses."`
+	InputFile  string `name:"in" help:"The file contains the records." type:"existingfile" required:""`
+	Limit      int    `short:"n" name:"limit" help:"The largest number of records listed." default:"20"`
+	Reindex    bool   `name:"reindex" help:"Rebuild the index even when it is up to date."`
+	OutputFile string `short:"o" name:"output" help:"Write the records found to this file; the format is implied by the file name." type:"outputfile"`
+}
+
+func (c *SearchCmd) Run() error {
+	var idx *gomarc21.SearchIndex
+	var err error
+	if c.Reindex {
+		idx, err = gomarc21.WriteSearchIndexFile(c.InputFile)
+	} else {
+		idx, err = gomarc21.OpenSearchIndex(c.InputFile)
+	}
+	if err != nil {
+		return err
+	}
+	result, err := idx.Search(c.Query, c.Limit)
+	if err != nil {
+		return err
+	}
+
+	for _, hit := range result.Hits {
+		fmt.Printf("%s\t%s\n", hit.Id, hit.Title)
+	}
+	for _, name := range []string{"type", "language"} {
+		counts := result.Facets[name]
+		values := make([]string, 0, len(counts))
+		for value := range counts {
+			values = append(values, value)
+		}
+		sort.Slice(values, func(i, j int) bool {
+			if counts[values[i]] != counts[values[j]] {
+				return counts[values[i]] > counts[values[j]]
+			}
+			return values[i] < values[j]
+		})
+		for _, value := range values {
+			fmt.Fprintf(os.Stderr, "%s %s: %d\n", name, value, counts[value])
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d records found\n", result.Total)
+
+	if c.OutputFile == "" {
+		return nil
+	}
+	positions := map[int]bool{}
+	for _, hit := range result.Hits {
+		positions[hit.Position] = true
+	}
+	in, err := gomarc21.OpenFile(c.InputFile)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	format := gomarc21.FormatFromName(c.OutputFile)
+	if format == "" {
+		format = gomarc21.FormatMarc
+	}
+	out, err := gomarc21.CreateFile(c.OutputFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	writer, err := gomarc21.NewWriter(out, format)
+	if err != nil {
+		return err
+	}
+	reader := gomarc21.NewReader(in)
+	for position := 1; len(positions) > 0; position++ {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("record %d: %s", position, err)
+		}
+		if positions[position] {
+			delete(positions, position)
+			if err := writer.Write(rec); err != nil {
+				return err
+			}
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+type NewCmd struct {
+	Template   string            `arg:"" name:"template" help:"A built-in template (authority-personal, book, ebook, holdings, serial, thesis) or an .mrk template file."`
+	OutputFile string            `arg:"" name:"output" help:"The file will contain the record; the format is implied by the file name." type:"outputfile"`
+	Set        map[string]string `short:"s" name:"set" help:"The value of a placeholder of the template, as name=value."`
+}
+
+func (c *NewCmd) Run() error {
+	builder, err := gomarc21.NewRecordBuilderFromTemplate(c.Template, c.Set)
+	if err != nil {
+		return err
+	}
+	rec, err := builder.Build()
+	if err != nil {
+		return err
+	}
+
+	format := gomarc21.FormatFromName(c.OutputFile)
+	if format == "" {
+		format = gomarc21.FormatMarc
+	}
+	out, err := gomarc21.CreateFile(c.OutputFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	writer, err := gomarc21.NewWriter(out, format)
+	if err != nil {
+		return err
+	}
+	if err := writer.Write(rec); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "created %s from %s\n", c.OutputFile, c.Template)
+	return nil
+}
+
+type Z3950Cmd struct {
+	Target     string `arg:"" name:"target" help:"The target, as host:port/database."`
+	Query      string `arg:"" name:"query" help:"The query in PQF, e.g. '@attr 1=7 0306406152'."`
+	OutputFile string `arg:"" name:"output" help:"The file will contain the records; the format is implied by the file name." type:"outputfile"`
+	Max        int    `short:"m" name:"max" help:"The largest number of records to retrieve." default:"10"`
+	User       string `name:"user" help:"The user of the target."`
+	Password   string `name:"password" help:"The password of the user."`
+}
+
+func (c *Z3950Cmd) Run() error {
+	address, database, _ := strings.Cut(c.Target, "/")
+	client, err := gomarc21.DialZ3950(address, gomarc21.Z3950Config{Database: database, User: c.User, Password: c.Password})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	found, err := client.Search(c.Query)
+	if err != nil {
+		return err
+	}
+	count := found
+	if count > c.Max {
+		count = c.Max
+	}
+	recs, err := client.Present(1, count)
+	if err != nil && len(recs) == 0 {
+		return err
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	format := gomarc21.FormatFromName(c.OutputFile)
+	if format == "" {
+		format = gomarc21.FormatMarc
+	}
+	out, err := gomarc21.CreateFile(c.OutputFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	writer, err := gomarc21.NewWriter(out, format)
+	if err != nil {
+		return err
+	}
+	for _, rec := range recs {
+		if err := writer.Write(rec); err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%d records found, %d retrieved\n", found, len(recs))
+	return nil
+}
+
+type CheckCmd struct {
+	InputFile  string `arg:"" name:"input" help:"The file contains MARC records, optionally compressed." type:"existingfile"`
+	OutputFile string `short:"o" name:"output" help:"Write the records to this file with their directories and leaders rebuilt." type:"outputfile"`
+}
+
+func (c *CheckCmd) Run() error {
+	in, err := gomarc21.OpenFile(c.InputFile)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	reader := bufio.NewReader(in)
+
+	var out io.WriteCloser
+	var writer *gomarc21.Writer
+	if c.OutputFile != "" {
+		format := gomarc21.FormatFromName(c.OutputFile)
+		if format == "" {
+			format = gomarc21.FormatMarc
+		}
+		if out, err = gomarc21.CreateFile(c.OutputFile); err != nil {
+			return err
+		}
+		defer out.Close()
+		if writer, err = gomarc21.NewWriter(out, format); err != nil {
+			return err
+		}
+	}
+
+	count, issues, broken, skipped := 0, 0, 0, 0
+	for {
+		rawRec, err := gomarc21.NextTerminatedRecord(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		count++
+
+		// the control number is read from the repaired record, when it can be
+		var rec gomarc21.Record
+		repaired, repairErr := gomarc21.RepairStructure(rawRec)
+		if repairErr == nil {
+			rec, repairErr = gomarc21.ParseRecord(repaired)
+		}
+		id := strings.TrimSpace(rec.ControlNum())
+
+		found := gomarc21.CheckStructure(rawRec)
+		for _, issue := range found {
+			fmt.Printf("%d\t%s\t%s\n", count, id, issue)
+		}
+		issues += len(found)
+		if len(found) > 0 {
+			broken++
+		}
+		if writer != nil {
+			if repairErr != nil {
+				skipped++
+				fmt.Printf("%d\t%s\tnot repaired: %s\n", count, id, repairErr)
+				continue
+			}
+			if err := writer.Write(rec); err != nil {
+				return err
+			}
+		}
+	}
+	if writer != nil {
+		if err := writer.Close(); err != nil {
+			return err
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%d records, %d with %d issues, %d not repaired\n", count, broken, issues, skipped)
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "%d records, %d with %d issues\n", count, broken, issues)
+	return nil
+}
+
+type StoreCmd struct {
+	StoreFile  string   `arg:"" name:"store" help:"The record store; it is created when it does not exist." type:"path"`
+	InputFiles []string `arg:"" name:"input" help:"The files contain the records, optionally compressed." type:"existingfile"`
+	BatchSize  int      `name:"batch-size" help:"The number of records written at once." default:"1000"`
+	Compact    bool     `name:"compact" help:"Compact the store after loading, dropping the versions replaced."`
+}
+
+func (c *StoreCmd) Run() error {
+	store, err := gomarc21.OpenStore(c.StoreFile, gomarc21.StoreConfig{})
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	stored, stale := 0, 0
+	for _, inputFile := range c.InputFiles {
+		in, err := gomarc21.OpenFile(inputFile)
+		if err != nil {
+			return err
+		}
+		reader := gomarc21.NewReader(in)
+		for done := false; !done; {
+			err = store.Update(func(batch *gomarc21.StoreBatch) error {
+				for count := 0; count < c.BatchSize || c.BatchSize <= 0; count++ {
+					rec, err := reader.Next()
+					if err == io.EOF {
+						done = true
+						return nil
+					}
+					if err != nil {
+						return fmt.Errorf("%s: %s", inputFile, err)
+					}
+					if err := batch.Put(rec); errors.Is(err, gomarc21.ErrStaleRecord) {
+						stale++
+						continue
+					} else if err != nil {
+						return fmt.Errorf("%s: %s", inputFile, err)
+					}
+					stored++
+				}
+				return nil
+			})
+			if err != nil {
+				in.Close()
+				return err
+			}
+		}
+		in.Close()
+	}
+	if c.Compact {
+		if err := store.Compact(); err != nil {
+			return err
+		}
+	}
+	total := store.Len()
+	if err := store.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%d records stored, %d older than the stored records skipped, %d records in %s\n",
+		stored, stale, total, c.StoreFile)
+	return nil
+}
+
+// outputFileMapper decodes an output file name like the "path" type, but
+// refuses up front the compressions that cannot be written, before any
+// input is read.
+func outputFileMapper(ctx *kong.DecodeContext, target reflect.Value) error {
+	var path string
+	if err := ctx.Scan.PopValueInto("file", &path); err != nil {
+		return err
+	}
+	if gomarc21.CompressionFromName(path) == gomarc21.CompressionBzip2 {
+		return fmt.Errorf("%s: bzip2 compressed output is not supported, use .gz or .zst", path)
+	}
+	if path != "-" {
+		path = kong.ExpandPath(path)
+	}
+	target.SetString(path)
+	return nil
+}
+
+func main() {
+	ctx := kong.Parse(&CLI,
+		kong.Name("marc"),
+		kong.Description("Work with MARC records."),
+		kong.NamedMapper("outputfile", kong.MapperFunc(outputFileMapper)),
+		kong.UsageOnError(),
+		kong.ConfigureHelp(kong.HelpOptions{
+			Compact: true,
+			Summary: true,
+		}))
+	ctx.FatalIfErrorf(ctx.Run())
+}
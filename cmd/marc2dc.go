@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/alecthomas/kong"
+	"github.com/jasonzou/gomarc21"
+)
+
+var CLI struct {
+	InputFile  string `short:"i" name:"input" help:"The file contains MARC or MARCXML records." type:"existingfile"`
+	OutputFile string `short:"o" name:"output" help:"The file will contain Dublin Core records converted from the input MARC records." type:"file"`
+	Json       bool   `short:"j" name:"json" help:"Write one Dublin Core JSON object per line instead of oai_dc XML."`
+}
+
+func main() {
+	kong.Parse(&CLI,
+		kong.Name("marc2dc"),
+		kong.Description("Convert MARC records into Dublin Core (oai_dc) records."),
+		kong.UsageOnError(),
+		kong.ConfigureHelp(kong.HelpOptions{
+			Compact: true,
+			Summary: true,
+		}))
+
+	data, err := gomarc21.OpenFile(CLI.InputFile)
+	if err != nil {
+		log.Fatal(fmt.Printf("File open failed: %q", err))
+	}
+	defer data.Close()
+
+	var out io.WriteCloser = os.Stdout
+	if CLI.OutputFile != "" {
+		out, err = gomarc21.CreateFile(CLI.OutputFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	defer out.Close()
+
+	format := gomarc21.FormatDc
+	if CLI.Json {
+		format = gomarc21.FormatDcJson
+	}
+	writer, err := gomarc21.NewWriter(out, format)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	reader := gomarc21.NewReader(data)
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := writer.Write(rec); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
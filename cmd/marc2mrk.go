@@ -29,31 +29,49 @@ func main() {
 	fmt.Print(CLI.OutputFile)
 
 	var marcfile = CLI.InputFile
-	//var output = CLI.OutputFile
 
-	data, err := os.Open(marcfile)
+	data, err := gomarc21.OpenFile(marcfile)
 	if err != nil {
-		data.Close()
-		fmt.Errorf("Failed to open the marc file: %s", marcfile)
-		return
+		log.Fatal(fmt.Printf("File open failed: %q", err))
 	}
 	defer data.Close()
 
+	var out io.WriteCloser = os.Stdout
+	if CLI.OutputFile != "" {
+		out, err = gomarc21.CreateFile(CLI.OutputFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// the output is closed before exiting, a compressed file is only
+	// complete once it is flushed
+	err = writeRecords(data, out)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func writeRecords(data io.Reader, out io.Writer) error {
 	for {
 		rec, err := gomarc21.ParseNextRecord(data)
 		if err == io.EOF {
-			break
+			return nil
 		}
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 
 		recxml, err := rec.RecordAsMrk()
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 
-		fmt.Print(recxml)
-		fmt.Println()
+		if _, err := fmt.Fprintln(out, recxml); err != nil {
+			return err
+		}
 	}
 }
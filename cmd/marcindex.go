@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/alecthomas/kong"
+	"github.com/jasonzou/gomarc21"
+)
+
+var CLI struct {
+	InputFile string `short:"i" name:"input" help:"The file contains MARC records." type:"existingfile"`
+	Tags      string `short:"t" name:"tags" help:"Comma separated data field tags whose $a values are indexed too (e.g. 035,020)."`
+	Get       string `short:"g" name:"get" help:"Print the record with this id (001 or an indexed value) in mrk format."`
+}
+
+func main() {
+	kong.Parse(&CLI,
+		kong.Name("marcindex"),
+		kong.Description("Build the sidecar index of a MARC file and look up records by id."),
+		kong.UsageOnError(),
+		kong.ConfigureHelp(kong.HelpOptions{
+			Compact: true,
+			Summary: true,
+		}))
+
+	if CLI.Get == "" {
+		idx, err := gomarc21.WriteIndexFile(CLI.InputFile, CLI.Tags)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%d keys written to %s\n", len(idx.Entries), gomarc21.IndexFileName(CLI.InputFile))
+		return
+	}
+
+	f, err := gomarc21.OpenIndexedFile(CLI.InputFile, CLI.Tags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	rec, err := f.Get(CLI.Get)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(rec.GetMrk())
+}
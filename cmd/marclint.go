@@ -7,6 +7,7 @@ import (
 	"os"
 
 	"github.com/alecthomas/kong"
+	"github.com/jasonzou/gomarc21"
 )
 
 var CLI struct {
@@ -28,38 +29,51 @@ func main() {
 	fmt.Print(CLI.OutputFile)
 
 	var marcfile = CLI.InputFile
-	//var output = CLI.OutputFile
-
-	fi, err := os.Open(marcfile)
+	data, err := gomarc21.OpenFile(marcfile)
 	if err != nil {
 		log.Fatal(fmt.Printf("File open failed: %q", err))
 	}
-	defer func() {
-		if cerr := fi.Close(); cerr != nil && err == nil {
-			err = cerr
+	defer data.Close()
+
+	var out io.WriteCloser = os.Stdout
+	if CLI.OutputFile != "" {
+		out, err = gomarc21.CreateFile(CLI.OutputFile)
+		if err != nil {
+			log.Fatal(err)
 		}
-	}()
+	}
 
-	fmt.Print(marc21.CollectionXMLHeader)
+	// the output is closed before exiting, a compressed file is only
+	// complete once it is flushed
+	err = writeRecords(data, out)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
 
+func writeRecords(data io.Reader, out io.Writer) error {
+	// the writer puts the records in a MARCXML collection
+	writer, err := gomarc21.NewWriter(out, gomarc21.FormatXml)
+	if err != nil {
+		return err
+	}
+	reader := gomarc21.NewReader(data)
 	for {
-		rec, err := marc21.ParseNextRecord(fi)
+		rec, err := reader.Next()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
-
-		recxml, err := rec.AsXML()
-		if err != nil {
-			log.Fatal(err)
+		if err := writer.Write(rec); err != nil {
+			return err
 		}
-
-		fmt.Print(recxml)
 	}
-
-	fmt.Print(marc21.CollectionXMLFooter)
+	return writer.Close()
 }
 
 func showHelp() {
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/alecthomas/kong"
+	"github.com/jasonzou/gomarc21"
+)
+
+var CLI struct {
+	InputFile  string `short:"i" name:"input" help:"The file contains MARC records." type:"existingfile"`
+	OutputFile string `short:"o" name:"output" help:"The file will contain the statistics of the input MARC records." type:"file"`
+	Format     string `short:"f" name:"format" help:"Output format (text or json)." enum:"text,json" default:"text"`
+}
+
+func main() {
+	kong.Parse(&CLI,
+		kong.Name("marcstats"),
+		kong.Description("Report field, subfield, indicator and leader statistics of MARC records."),
+		kong.UsageOnError(),
+		kong.ConfigureHelp(kong.HelpOptions{
+			Compact: true,
+			Summary: true,
+		}))
+
+	data, err := gomarc21.OpenFile(CLI.InputFile)
+	if err != nil {
+		log.Fatal(fmt.Printf("File open failed: %q", err))
+	}
+	defer data.Close()
+
+	stats, err := gomarc21.ParseStats(data)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var out string
+	if CLI.Format == "json" {
+		out, err = stats.AsJson()
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		out = stats.AsText()
+	}
+
+	if CLI.OutputFile == "" {
+		fmt.Println(out)
+		return
+	}
+	f, err := gomarc21.CreateFile(CLI.OutputFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := fmt.Fprintln(f, out); err != nil {
+		f.Close()
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -1,5 +1,18 @@
 module github.com/jasonzou/gomarc21
 
-go 1.16
+go 1.22
 
-require github.com/alecthomas/kong v0.5.0
+require (
+	github.com/alecthomas/kong v0.5.0
+	github.com/klauspost/compress v1.18.0
+	go.starlark.net v0.0.0-20231121155337-90ade8b19d09
+	golang.org/x/text v0.14.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/google/go-cmp v0.5.8 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	golang.org/x/sys v0.10.0 // indirect
+	google.golang.org/protobuf v1.27.1 // indirect
+)